@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/archive"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+)
+
+// runEncryptArchive encrypts a directory as one tar archive with a single
+// data key. The archive is streamed, so it never exists unencrypted on disk.
+func runEncryptArchive(archiveDir, outputFile, keyFile string, calculateChecksum bool, chunkSizeStr, format, compression string) error {
+	// Initialize logger (use flags, not config file)
+	log, err := logger.New(logLevel, streamLogOutput(outputFile))
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer func() { _ = log.Sync() }()
+
+	compression = strings.ToLower(compression)
+	if err := archive.ValidateCompression(compression); err != nil {
+		return fmt.Errorf("--compress: %w", err)
+	}
+
+	info, err := os.Stat(archiveDir)
+	if err != nil {
+		return fmt.Errorf("archive directory does not exist: %s", archiveDir)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("--archive must be a directory: %s", archiveDir)
+	}
+
+	log.Info("Encrypting directory as archive", "dir", archiveDir, "output", outputFile, "compression", compression)
+
+	// Load configuration (only Vault settings are needed for CLI mode)
+	cfg, err := loadCLIConfig()
+	if err != nil {
+		return err
+	}
+
+	vaultClient, err := newVaultClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = vaultClient.Close() }()
+
+	encryptor, format, err := newCLIEncryptor(log, cfg, vaultClient, chunkSizeStr, format)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	src := archive.Reader(ctx, archiveDir, compression)
+	defer func() { _ = src.Close() }()
+
+	// The key file defaults to the output name (bundle.tar.enc -> bundle.tar.key)
+	source := streamSource{
+		name:     archiveDir,
+		filename: filepath.Base(filepath.Clean(archiveDir)) + "." + archive.Extension(compression),
+	}
+
+	return encryptReader(ctx, log, encryptor, src, source, outputFile, keyFile, calculateChecksum, format)
+}
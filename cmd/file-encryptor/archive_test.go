@@ -0,0 +1,58 @@
+package main
+
+import (
+	"archive/tar"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/archive"
+)
+
+// TestExtractOutput tests extracting an archive written to the decrypt output
+func TestExtractOutput(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "project")
+	if err := os.MkdirAll(src, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("alpha"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	out, finish := extractOutput(context.Background(), dest)
+
+	err := archive.Write(context.Background(), out, src, archive.CompressionGzip)
+	if err := finish(err); err != nil {
+		t.Fatalf("extraction failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dest, "project", "a.txt"))
+	if err != nil {
+		t.Fatalf("extracted file missing: %v", err)
+	}
+	if string(data) != "alpha" {
+		t.Errorf("extracted content = %q, want %q", data, "alpha")
+	}
+}
+
+// TestExtractOutput_UnsafeEntry tests that extraction errors are reported
+func TestExtractOutput_UnsafeEntry(t *testing.T) {
+	out, finish := extractOutput(context.Background(), t.TempDir())
+
+	tw := tar.NewWriter(out)
+	err := tw.WriteHeader(&tar.Header{Name: "../evil.txt", Typeflag: tar.TypeReg, Mode: 0600, Size: 4})
+	if err == nil {
+		_, err = tw.Write([]byte("evil"))
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+
+	err = finish(err)
+	if err == nil || !strings.Contains(err.Error(), "unsafe path") {
+		t.Errorf("expected unsafe path error, got %v", err)
+	}
+}
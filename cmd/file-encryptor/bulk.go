@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/bulk"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/watcher"
+	"github.com/spf13/cobra"
+)
+
+// bulkOptions holds the directory mode flags of the encrypt and decrypt commands
+type bulkOptions struct {
+	dir       string
+	out       string
+	recursive bool
+	parallel  int
+	include   []string
+	exclude   []string
+	report    string
+}
+
+// addBulkFlags adds the directory mode flags. keyFlag names the single-file
+// key flag, which --dir excludes; the command decides which of --input and
+// --dir is required.
+func addBulkFlags(cmd *cobra.Command, opts *bulkOptions, keyFlag string) {
+	cmd.Flags().StringVarP(&opts.dir, "dir", "d", "", "Directory to process instead of a single file")
+	cmd.Flags().StringVar(&opts.out, "out", "", "Output directory for --dir, mirroring its tree")
+	cmd.Flags().BoolVarP(&opts.recursive, "recursive", "r", false, "Process subdirectories of --dir")
+	cmd.Flags().IntVarP(&opts.parallel, "parallel", "p", 1, "Number of files processed at once with --dir")
+	cmd.Flags().StringSliceVar(&opts.include, "include", nil, "Glob patterns of files to process with --dir (default: all)")
+	cmd.Flags().StringSliceVar(&opts.exclude, "exclude", nil, "Glob patterns of files to skip with --dir")
+	cmd.Flags().StringVar(&opts.report, "report", "text", "Report format for --dir: text, json, csv")
+
+	cmd.MarkFlagsMutuallyExclusive("output", "dir")
+	cmd.MarkFlagsMutuallyExclusive(keyFlag, "dir")
+	cmd.MarkFlagsRequiredTogether("dir", "out")
+}
+
+// validate checks the flag values that cobra cannot
+func (o bulkOptions) validate() error {
+	if o.parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+
+	switch strings.ToLower(o.report) {
+	case "text", "json", "csv":
+		return nil
+	default:
+		return fmt.Errorf("--report must be one of: text, json, csv")
+	}
+}
+
+func runBulkEncrypt(opts bulkOptions, calculateChecksum bool, chunkSizeStr, format string) error {
+	return runBulk(model.OperationEncrypt, opts, func(log logger.Logger) (watcher.ProcessStrategy, func(), error) {
+		cfg, err := loadCLIConfig()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		vaultClient, err := newVaultClient(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		encryptor, format, err := newCLIEncryptor(log, cfg, vaultClient, chunkSizeStr, format)
+		if err != nil {
+			_ = vaultClient.Close()
+			return nil, nil, err
+		}
+
+		strategy := watcher.NewEncryptStrategy(encryptor, log, calculateChecksum, format, watcher.PublishOptions{})
+		return strategy, func() { _ = vaultClient.Close() }, nil
+	})
+}
+
+func runBulkDecrypt(opts bulkOptions, verifyChecksum bool) error {
+	return runBulk(model.OperationDecrypt, opts, func(log logger.Logger) (watcher.ProcessStrategy, func(), error) {
+		cfg, err := loadCLIConfig()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		vaultClient, err := newVaultClient(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		strategy := watcher.NewDecryptStrategy(newCLIDecryptor(cfg, vaultClient), log, verifyChecksum, watcher.PublishOptions{})
+		return strategy, func() { _ = vaultClient.Close() }, nil
+	})
+}
+
+// runBulk processes a directory with the strategy built by newStrategy, which
+// is called once so that every file shares one Vault client, and prints the
+// report to stdout. It fails when any file failed.
+func runBulk(operation model.OperationType, opts bulkOptions,
+	newStrategy func(log logger.Logger) (watcher.ProcessStrategy, func(), error)) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	// Initialize logger; the report goes to stdout, so logs to stdout would mix with it
+	log, err := logger.New(logLevel, streamLogOutput(stdioPath))
+	if err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	defer func() { _ = log.Sync() }()
+
+	strategy, closeStrategy, err := newStrategy(log)
+	if err != nil {
+		return err
+	}
+	defer closeStrategy()
+
+	runner, err := bulk.NewRunner(bulk.Options{
+		Operation: operation,
+		SourceDir: opts.dir,
+		DestDir:   opts.out,
+		Recursive: opts.recursive,
+		Parallel:  opts.parallel,
+		Include:   opts.include,
+		Exclude:   opts.exclude,
+		Strategy:  strategy,
+		Logger:    log,
+	})
+	if err != nil {
+		return err
+	}
+
+	items, failed, err := runner.Plan()
+	if err != nil {
+		return err
+	}
+
+	log.Info("Found files", "operation", operation, "count", len(items)+len(failed),
+		"directory", opts.dir, "recursive", opts.recursive, "parallel", opts.parallel)
+
+	reporter := bulk.NewReporter(string(operation))
+	reporter.AddResults(runner.Run(context.Background(), items))
+	reporter.AddResults(failed)
+
+	if err := writeBulkReport(reporter, opts.report); err != nil {
+		return err
+	}
+
+	stats := reporter.GetStatistics()
+	if stats.Failed > 0 {
+		log.Error("Bulk operation completed with failures", "operation", operation,
+			"successful", stats.Successful, "failed", stats.Failed)
+		return fmt.Errorf("%d of %d files failed", stats.Failed, stats.TotalFiles)
+	}
+
+	log.Info("Bulk operation completed successfully", "operation", operation,
+		"total", stats.TotalFiles, "bytes", stats.TotalBytes)
+
+	return nil
+}
+
+// writeBulkReport prints the report to stdout in the given format
+func writeBulkReport(reporter *bulk.Reporter, format string) error {
+	switch strings.ToLower(format) {
+	case "json":
+		if err := reporter.WriteJSON(os.Stdout, true); err != nil {
+			return fmt.Errorf("failed to write JSON output: %w", err)
+		}
+	case "csv":
+		if err := reporter.WriteCSV(os.Stdout); err != nil {
+			return fmt.Errorf("failed to write CSV output: %w", err)
+		}
+	default: // text
+		if err := reporter.WriteText(os.Stdout, true); err != nil {
+			return fmt.Errorf("failed to write text output: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestBulkFlags_Validation tests the flag rules of the directory and archive modes
+func TestBulkFlags_Validation(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		errorMsg string
+	}{
+		{
+			name:     "neither input nor dir",
+			args:     []string{"encrypt"},
+			errorMsg: "at least one of the flags in the group [input dir archive] is required",
+		},
+		{
+			name:     "input and dir",
+			args:     []string{"encrypt", "-i", "a.txt", "-o", "a.txt.enc", "--dir", "src", "--out", "dst"},
+			errorMsg: "[dir input] were all set",
+		},
+		{
+			name:     "dir without out",
+			args:     []string{"decrypt", "--dir", "src"},
+			errorMsg: "missing [out]",
+		},
+		{
+			name:     "key with dir",
+			args:     []string{"decrypt", "--dir", "src", "--out", "dst", "-k", "a.key"},
+			errorMsg: "[dir key] were all set",
+		},
+		{
+			name:     "archive and dir",
+			args:     []string{"encrypt", "--archive", "src", "--dir", "src", "--out", "dst"},
+			errorMsg: "[archive dir] were all set",
+		},
+		{
+			name:     "archive without output",
+			args:     []string{"encrypt", "--archive", "src"},
+			errorMsg: "--output is required with --input or --archive",
+		},
+		{
+			name:     "output and extract",
+			args:     []string{"decrypt", "-i", "a.tar.enc", "-o", "a.tar", "--extract", "dst"},
+			errorMsg: "[extract output] were all set",
+		},
+		{
+			name:     "input without output or extract",
+			args:     []string{"decrypt", "-i", "a.tar.enc"},
+			errorMsg: "--output or --extract is required with --input",
+		},
+		{
+			name:     "invalid parallel",
+			args:     []string{"encrypt", "--dir", "src", "--out", "dst", "--parallel", "0"},
+			errorMsg: "--parallel must be at least 1",
+		},
+		{
+			name:     "invalid report format",
+			args:     []string{"decrypt", "--dir", "src", "--out", "dst", "--report", "xml"},
+			errorMsg: "--report must be one of: text, json, csv",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := encryptCmd()
+			if tt.args[0] == "decrypt" {
+				cmd = decryptCmd()
+			}
+			cmd.SetArgs(tt.args[1:])
+			cmd.SilenceUsage = true
+			cmd.SilenceErrors = true
+
+			err := cmd.Execute()
+			if err == nil {
+				t.Fatalf("expected error containing %q", tt.errorMsg)
+			}
+			if !strings.Contains(err.Error(), tt.errorMsg) {
+				t.Errorf("error = %q, want it to contain %q", err.Error(), tt.errorMsg)
+			}
+		})
+	}
+}
@@ -18,6 +18,8 @@ func TestRewrapCmd_FlagValidation(t *testing.T) {
 		dir         string
 		minVersion  int
 		format      string
+		parallel    int // 0 for the flag default
+		rate        float64
 		expectError bool
 		errorMsg    string
 	}{
@@ -57,6 +59,24 @@ func TestRewrapCmd_FlagValidation(t *testing.T) {
 			expectError: true,
 			errorMsg:    "--format must be one of: text, json, csv",
 		},
+		{
+			name:        "invalid parallel",
+			keyFile:     "test.key",
+			minVersion:  1,
+			format:      "text",
+			parallel:    -1,
+			expectError: true,
+			errorMsg:    "--parallel must be at least 1",
+		},
+		{
+			name:        "invalid rate",
+			keyFile:     "test.key",
+			minVersion:  1,
+			format:      "text",
+			rate:        -5,
+			expectError: true,
+			errorMsg:    "--rate must not be negative",
+		},
 		{
 			name:        "valid key-file",
 			keyFile:     "test.key",
@@ -77,7 +97,11 @@ func TestRewrapCmd_FlagValidation(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := runRewrap(tt.keyFile, tt.dir, false, false, tt.minVersion, true, tt.format)
+			parallel := tt.parallel
+			if parallel == 0 {
+				parallel = 1
+			}
+			err := runRewrap(tt.keyFile, tt.dir, false, false, tt.minVersion, true, tt.format, parallel, tt.rate)
 
 			if tt.expectError {
 				if err == nil {
@@ -171,7 +195,7 @@ func TestRewrapCmd_FormatCaseInsensitive(t *testing.T) {
 	for _, format := range formats {
 		t.Run(format, func(t *testing.T) {
 			// This will fail due to missing key file, but should not fail due to format validation
-			err := runRewrap("test.key", "", false, false, 1, true, format)
+			err := runRewrap("test.key", "", false, false, 1, true, format, 1, 0)
 
 			if err == nil {
 				t.Error("expected error (file not found), got none")
@@ -210,7 +234,7 @@ func TestKeyVersionsCmd_FormatCaseInsensitive(t *testing.T) {
 
 // TestRewrapCmd_NonExistentFile tests error handling for non-existent files
 func TestRewrapCmd_NonExistentFile(t *testing.T) {
-	err := runRewrap("/non/existent/file.key", "", false, false, 1, true, "text")
+	err := runRewrap("/non/existent/file.key", "", false, false, 1, true, "text", 1, 0)
 
 	if err == nil {
 		t.Error("expected error for non-existent file, got none")
@@ -240,7 +264,7 @@ func TestKeyVersionsCmd_NonExistentFile(t *testing.T) {
 
 // TestRewrapCmd_InvalidDirectory tests error handling for invalid directory
 func TestRewrapCmd_InvalidDirectory(t *testing.T) {
-	err := runRewrap("", "/non/existent/directory", false, false, 1, true, "text")
+	err := runRewrap("", "/non/existent/directory", false, false, 1, true, "text", 1, 0)
 
 	if err == nil {
 		t.Error("expected error for non-existent directory, got none")
@@ -433,7 +457,7 @@ func TestRewrapCmd_WithRealFiles(t *testing.T) {
 	defer func() { configFile = oldConfigFile }()
 
 	// Test with valid flags - will fail on Vault connection but flag validation should pass
-	err := runRewrap(keyFile, "", false, false, 2, true, "text")
+	err := runRewrap(keyFile, "", false, false, 2, true, "text", 1, 0)
 
 	// Should get error about Vault or config, not about flag validation
 	if err != nil {
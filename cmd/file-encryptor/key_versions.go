@@ -23,9 +23,10 @@ func keyVersionsCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "key-versions",
 		Short: "Display encryption key version statistics",
-		Long: `Displays statistics about the Vault Transit encryption key versions used by encrypted data keys (.key files).
+		Long: `Displays statistics about the Vault Transit encryption key versions used by encrypted data keys
+(.key files and self-describing .enc containers).
 
-This command scans for .key files and reports their version distribution without making any changes.
+This command scans for .key files and containers and reports their version distribution without making any changes.
 Use this to audit your key versions before performing a rewrap operation.
 
 The command shows:
@@ -118,8 +119,8 @@ func runKeyVersions(keyFile, directory string, recursive bool, outputFormat stri
 
 	// Process each file to get version info
 	for _, filePath := range files {
-		// Read key file
-		ciphertext, err := os.ReadFile(filePath) // #nosec G304 - user-provided key file path
+		// Read key file (or container header)
+		ciphertext, err := rewrap.ReadWrappedKey(filePath)
 		if err != nil {
 			log.Error("Failed to read key file", "file", filePath, "error", err)
 			reporter.AddResult(&vault.RewrapResult{
@@ -130,7 +131,7 @@ func runKeyVersions(keyFile, directory string, recursive bool, outputFormat stri
 		}
 
 		// Get version info without calling Vault
-		versionInfo, err := vault.GetKeyVersionInfo(filePath, string(ciphertext), 0)
+		versionInfo, err := vault.GetKeyVersionInfo(filePath, ciphertext, 0)
 		if err != nil {
 			log.Error("Failed to get version info", "file", filePath, "error", err)
 			reporter.AddResult(&vault.RewrapResult{
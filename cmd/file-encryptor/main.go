@@ -6,9 +6,11 @@ import (
 	"os"
 	"strings"
 
+	"github.com/gitrgoliveira/vault-file-encryption/internal/archive"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/objectstore"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/service"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/vault"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/version"
@@ -33,7 +35,7 @@ Can also be used for one-off file encryption/decryption.`,
 	}
 
 	// Global flags
-	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "config.hcl", "Configuration file path")
+	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", defaultConfigFile, "Configuration file path")
 	rootCmd.PersistentFlags().StringVarP(&logLevel, "log-level", "l", "info", "Log level (debug, info, error)")
 	rootCmd.PersistentFlags().StringVar(&logOutput, "log-output", "stdout", "Log output (stdout, stderr, or file path)")
 
@@ -43,6 +45,7 @@ Can also be used for one-off file encryption/decryption.`,
 	rootCmd.AddCommand(decryptCmd())
 	rootCmd.AddCommand(rewrapCmd())
 	rootCmd.AddCommand(keyVersionsCmd())
+	rootCmd.AddCommand(queueCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
@@ -69,12 +72,22 @@ func encryptCmd() *cobra.Command {
 		keyFile    string
 		checksum   bool
 		chunkSize  string
+		format     string
+		bulk       bulkOptions
+		archiveDir string
+		compress   string
 	)
 
 	cmd := &cobra.Command{
 		Use:   "encrypt",
-		Short: "Encrypt a single file",
-		Long:  `Encrypts a single file using Vault Transit Engine with envelope encryption.`,
+		Short: "Encrypt a file or a directory",
+		Long: `Encrypts a single file using Vault Transit Engine with envelope encryption.
+
+With --dir and --out every file of a directory is encrypted with one Vault
+client, mirroring the directory tree, and a summary report is printed.
+
+With --archive a directory is encrypted as one tar archive with a single data
+key; decrypt --extract restores it.`,
 		Example: `  # Encrypt a file
   file-encryptor encrypt -i data.txt -o data.txt.enc
   
@@ -85,20 +98,49 @@ func encryptCmd() *cobra.Command {
   file-encryptor encrypt -i data.txt -o data.txt.enc --checksum
   
   # Encrypt with custom chunk size
-  file-encryptor encrypt -i large.db -o large.db.enc --chunk-size 5MB`,
+  file-encryptor encrypt -i large.db -o large.db.enc --chunk-size 5MB
+  
+  # Encrypt into a single self-describing file (no separate .key file)
+  file-encryptor encrypt -i data.txt -o data.txt.enc --format container
+
+  # Encrypt standard input (the key file defaults to dump.key)
+  pg_dump mydb | file-encryptor encrypt -i - -o dump.enc
+
+  # Encrypt to standard output, writing the key file to file descriptor 3
+  tar c dir | file-encryptor encrypt -i - -o - --key-file fd:3 3>dir.key > dir.tar.enc
+
+  # Encrypt a directory tree with 4 files at a time
+  file-encryptor encrypt --dir /data/export --out /data/encrypted --recursive --parallel 4 --exclude '*.tmp'
+
+  # Encrypt a directory into one compressed archive (the key file defaults to bundle.tar.gz.key)
+  file-encryptor encrypt --archive /data/project -o bundle.tar.gz.enc --compress gzip`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runEncrypt(inputFile, outputFile, keyFile, checksum, chunkSize)
+			if bulk.dir != "" {
+				return runBulkEncrypt(bulk, checksum, chunkSize, format)
+			}
+			if outputFile == "" {
+				return fmt.Errorf("--output is required with --input or --archive")
+			}
+			if archiveDir != "" {
+				return runEncryptArchive(archiveDir, outputFile, keyFile, checksum, chunkSize, format, compress)
+			}
+			return runEncrypt(inputFile, outputFile, keyFile, checksum, chunkSize, format)
 		},
 	}
 
-	cmd.Flags().StringVarP(&inputFile, "input", "i", "", "Input file to encrypt")
-	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output encrypted file")
-	cmd.Flags().StringVarP(&keyFile, "key-file", "k", "", "Output key file (default: output.key)")
+	cmd.Flags().StringVarP(&inputFile, "input", "i", "", "Input file to encrypt, or - for stdin")
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output encrypted file, or - for stdout")
+	cmd.Flags().StringVarP(&keyFile, "key-file", "k", "", "Output key file, stderr or fd:N (default: input.key)")
 	cmd.Flags().BoolVar(&checksum, "checksum", false, "Calculate and save checksum")
 	cmd.Flags().StringVar(&chunkSize, "chunk-size", "", "Chunk size for encryption (e.g., 2MB, 512KB) - overrides config")
+	cmd.Flags().StringVar(&format, "format", "", "Output format: split (.enc + .key) or container (single file) - overrides config")
+	cmd.Flags().StringVar(&archiveDir, "archive", "", "Directory to encrypt as one tar archive")
+	cmd.Flags().StringVar(&compress, "compress", archive.CompressionNone, "Archive compression with --archive: none, gzip")
+	addBulkFlags(cmd, &bulk, "key-file")
+	addVaultFlags(cmd)
 
-	_ = cmd.MarkFlagRequired("input")
-	_ = cmd.MarkFlagRequired("output")
+	cmd.MarkFlagsOneRequired("input", "dir", "archive")
+	cmd.MarkFlagsMutuallyExclusive("input", "dir", "archive")
 
 	return cmd
 }
@@ -110,30 +152,68 @@ func decryptCmd() *cobra.Command {
 		keyFile        string
 		outputFile     string
 		verifyChecksum bool
+		bulk           bulkOptions
+		extractDir     string
 	)
 
 	cmd := &cobra.Command{
 		Use:   "decrypt",
-		Short: "Decrypt a single file",
-		Long:  `Decrypts a single file that was encrypted with Vault Transit Engine.`,
+		Short: "Decrypt a file or a directory",
+		Long: `Decrypts a single file that was encrypted with Vault Transit Engine.
+
+With --dir and --out every .enc file of a directory is decrypted with one Vault
+client, mirroring the directory tree, and a summary report is printed. Key
+files are expected next to the encrypted files, as the encrypt command and the
+watch service write them.
+
+With --extract a tar archive, such as one written by encrypt --archive, is
+extracted into a directory instead of being written to --output.
+
+An s3://bucket/key input is read from the bucket of an encryption destination
+of the configuration file. Its key is read from the object metadata or the
+<name>.key object unless --key is given.`,
 		Example: `  # Decrypt a file
   file-encryptor decrypt -i data.txt.enc -k data.txt.key -o data.txt
   
   # Decrypt with checksum verification
-  file-encryptor decrypt -i data.txt.enc -k data.txt.key -o data.txt --verify-checksum`,
+  file-encryptor decrypt -i data.txt.enc -k data.txt.key -o data.txt --verify-checksum
+  
+  # Decrypt a self-describing container (the key is embedded)
+  file-encryptor decrypt -i data.txt.enc -o data.txt
+
+  # Decrypt to standard output
+  file-encryptor decrypt -i dump.enc -k dump.key -o - | psql mydb
+
+  # Decrypt a directory tree and report the results as CSV
+  file-encryptor decrypt --dir /data/encrypted --out /data/restored --recursive --report csv
+
+  # Decrypt an archive and extract it into /data/restored
+  file-encryptor decrypt -i bundle.tar.gz.enc -k bundle.tar.gz.key --extract /data/restored
+
+  # Decrypt an object uploaded by an encryption destination
+  file-encryptor decrypt -i s3://encrypted/reports/q1.csv.enc -o q1.csv`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runDecrypt(inputFile, keyFile, outputFile, verifyChecksum)
+			if bulk.dir != "" {
+				return runBulkDecrypt(bulk, verifyChecksum)
+			}
+			if outputFile == "" && extractDir == "" {
+				return fmt.Errorf("--output or --extract is required with --input")
+			}
+			return runDecrypt(inputFile, keyFile, outputFile, extractDir, verifyChecksum)
 		},
 	}
 
-	cmd.Flags().StringVarP(&inputFile, "input", "i", "", "Encrypted file to decrypt (required)")
-	cmd.Flags().StringVarP(&keyFile, "key", "k", "", "Key file (required)")
-	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output decrypted file (required)")
+	cmd.Flags().StringVarP(&inputFile, "input", "i", "", "Encrypted file to decrypt, - for stdin or an s3:// URL (required)")
+	cmd.Flags().StringVarP(&keyFile, "key", "k", "", "Key file (required unless the input is a self-describing container)")
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output decrypted file, or - for stdout")
 	cmd.Flags().BoolVar(&verifyChecksum, "verify-checksum", false, "Verify SHA256 checksum if available")
+	cmd.Flags().StringVar(&extractDir, "extract", "", "Directory to extract a decrypted tar archive into, instead of --output")
+	addBulkFlags(cmd, &bulk, "key")
+	addVaultFlags(cmd)
 
-	_ = cmd.MarkFlagRequired("input")
-	_ = cmd.MarkFlagRequired("key")
-	_ = cmd.MarkFlagRequired("output")
+	cmd.MarkFlagsOneRequired("input", "dir")
+	cmd.MarkFlagsMutuallyExclusive("input", "dir")
+	cmd.MarkFlagsMutuallyExclusive("output", "extract")
 
 	return cmd
 }
@@ -157,9 +237,9 @@ func runWatch(cmd *cobra.Command, args []string) error {
 	return svc.Run(ctx, sigChan, isReloadSignal, isShutdownSignal)
 }
 
-func runEncrypt(inputFile, outputFile, keyFile string, calculateChecksum bool, chunkSizeStr string) error {
+func runEncrypt(inputFile, outputFile, keyFile string, calculateChecksum bool, chunkSizeStr, format string) error {
 	// Initialize logger (use flags, not config file)
-	log, err := logger.New(logLevel, logOutput)
+	log, err := logger.New(logLevel, streamLogOutput(outputFile))
 	if err != nil {
 		return fmt.Errorf("failed to initialize logger: %w", err)
 	}
@@ -168,56 +248,57 @@ func runEncrypt(inputFile, outputFile, keyFile string, calculateChecksum bool, c
 	log.Info("Encrypting file", "input", inputFile, "output", outputFile)
 
 	// Verify input file exists
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return fmt.Errorf("input file does not exist: %s", inputFile)
+	if inputFile != stdioPath {
+		if _, err := os.Stat(inputFile); os.IsNotExist(err) {
+			return fmt.Errorf("input file does not exist: %s", inputFile)
+		}
 	}
 
 	// Load configuration (only Vault settings are needed for CLI mode)
-	cfg, err := config.Load(configFile)
+	cfg, err := loadCLIConfig()
 	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
-	}
-
-	// Only validate Vault config for CLI mode
-	if cfg.Vault.AgentAddress == "" || cfg.Vault.TransitMount == "" || cfg.Vault.KeyName == "" {
-		return fmt.Errorf("vault configuration is incomplete (agent_address, transit_mount, key_name required)")
+		return err
 	}
 
-	// Create Vault client
-	vaultClient, err := vault.NewClient(&vault.Config{
-		AgentAddress: cfg.Vault.AgentAddress,
-		TransitMount: cfg.Vault.TransitMount,
-		KeyName:      cfg.Vault.KeyName,
-		Timeout:      cfg.Vault.RequestTimeout,
-	})
+	vaultClient, err := newVaultClient(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to create vault client: %w", err)
+		return err
 	}
 	defer func() { _ = vaultClient.Close() }()
 
-	// Determine chunk size (CLI flag overrides config)
-	chunkSize := cfg.Encryption.ChunkSize
-	if chunkSizeStr != "" {
-		size, err := config.ParseSize(chunkSizeStr)
-		if err != nil {
-			return fmt.Errorf("invalid chunk size: %w", err)
-		}
-		chunkSize = size
-		log.Info("Using custom chunk size", "chunk_size", config.FormatSize(chunkSize))
+	encryptor, format, err := newCLIEncryptor(log, cfg, vaultClient, chunkSizeStr, format)
+	if err != nil {
+		return err
 	}
 
-	// Create encryptor
-	encryptor := crypto.NewEncryptor(vaultClient, &crypto.EncryptorConfig{
-		ChunkSize: chunkSize,
-	})
+	// Create context for the operation
+	ctx := context.Background()
+
+	// Standard input or output ("-") is streamed
+	if inputFile == stdioPath || outputFile == stdioPath {
+		return encryptStream(ctx, log, encryptor, inputFile, outputFile, keyFile, calculateChecksum, format)
+	}
 
 	// Progress callback
 	progressCallback := func(progress float64) {
 		log.Info("Encryption progress", "file", inputFile, "progress", fmt.Sprintf("%.0f%%", progress))
 	}
 
-	// Create context for the operation
-	ctx := context.Background()
+	// Self-describing container: key and checksum are embedded in the header
+	if format == config.FormatContainer {
+		header, err := encryptor.EncryptFileContainer(ctx, inputFile, outputFile, progressCallback)
+		if err != nil {
+			return fmt.Errorf("encryption failed: %w", err)
+		}
+
+		log.Info("File encrypted successfully",
+			"input", inputFile,
+			"output", outputFile,
+			"format", format,
+			"checksum", header.Checksum)
+
+		return nil
+	}
 
 	// Encrypt the file
 	encryptedKey, err := encryptor.EncryptFile(ctx, inputFile, outputFile, progressCallback)
@@ -230,17 +311,11 @@ func runEncrypt(inputFile, outputFile, keyFile string, calculateChecksum bool, c
 		keyFile = inputFile + ".key"
 	}
 
-	// Save the encrypted data key
-	if err := os.WriteFile(keyFile, []byte(encryptedKey), 0600); err != nil {
-		return fmt.Errorf("failed to save key file: %w", err)
-	}
-
-	log.Info("Encrypted data key saved", "key_file", keyFile)
-
 	// Calculate and save checksum if requested
+	checksum := ""
 	if calculateChecksum {
 		checksumPath := inputFile + ".sha256"
-		checksum, err := crypto.CalculateChecksum(inputFile)
+		checksum, err = crypto.CalculateChecksum(inputFile)
 		if err != nil {
 			return fmt.Errorf("failed to calculate checksum: %w", err)
 		}
@@ -252,6 +327,17 @@ func runEncrypt(inputFile, outputFile, keyFile string, calculateChecksum bool, c
 		log.Info("Checksum saved", "checksum_file", checksumPath, "checksum", checksum)
 	}
 
+	// Save the encrypted data key with its metadata
+	keyData, err := encryptor.NewKeyFile(inputFile, encryptedKey, checksum)
+	if err != nil {
+		return fmt.Errorf("failed to build key file: %w", err)
+	}
+	if err := crypto.WriteKeyFile(keyFile, keyData); err != nil {
+		return fmt.Errorf("failed to save key file: %w", err)
+	}
+
+	log.Info("Encrypted data key saved", "key_file", keyFile)
+
 	log.Info("File encrypted successfully",
 		"input", inputFile,
 		"output", outputFile,
@@ -260,9 +346,52 @@ func runEncrypt(inputFile, outputFile, keyFile string, calculateChecksum bool, c
 	return nil
 }
 
-func runDecrypt(inputFile, keyFile, outputFile string, verifyChecksum bool) error {
+// newCLIEncryptor creates the encryptor of a one-off command and resolves
+// the output format. The chunk size and format flags override the config.
+func newCLIEncryptor(log logger.Logger, cfg *config.Config, vaultClient *vault.Client, chunkSizeStr, format string) (*crypto.Encryptor, string, error) {
+	// Determine chunk size (CLI flag overrides config)
+	chunkSize := cfg.Encryption.ChunkSize
+	if chunkSizeStr != "" {
+		size, err := config.ParseSize(chunkSizeStr)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid chunk size: %w", err)
+		}
+		chunkSize = size
+		log.Info("Using custom chunk size", "chunk_size", config.FormatSize(chunkSize))
+	}
+
+	// Determine output format (CLI flag overrides config)
+	if format == "" {
+		format = cfg.Encryption.Format
+	}
+	format = strings.ToLower(format)
+	if format != config.FormatSplit && format != config.FormatContainer {
+		return nil, "", fmt.Errorf("--format must be one of: %s, %s", config.FormatSplit, config.FormatContainer)
+	}
+
+	encryptor := crypto.NewEncryptor(vaultClient, &crypto.EncryptorConfig{
+		ChunkSize:    chunkSize,
+		Namespace:    vaultClient.Namespace(),
+		TransitMount: cfg.Vault.TransitMount,
+		KeyName:      cfg.Vault.KeyName,
+	})
+
+	return encryptor, format, nil
+}
+
+// newCLIDecryptor creates the decryptor of a one-off command
+func newCLIDecryptor(cfg *config.Config, vaultClient *vault.Client) *crypto.Decryptor {
+	return crypto.NewDecryptor(vaultClient, &crypto.EncryptorConfig{
+		ChunkSize:    cfg.Encryption.ChunkSize,
+		Namespace:    vaultClient.Namespace(),
+		TransitMount: cfg.Vault.TransitMount,
+		KeyName:      cfg.Vault.KeyName,
+	})
+}
+
+func runDecrypt(inputFile, keyFile, outputFile, extractDir string, verifyChecksum bool) error {
 	// Initialize logger (use flags, not config file)
-	log, err := logger.New(logLevel, logOutput)
+	log, err := logger.New(logLevel, streamLogOutput(outputFile))
 	if err != nil {
 		return fmt.Errorf("failed to initialize logger: %w", err)
 	}
@@ -270,57 +399,90 @@ func runDecrypt(inputFile, keyFile, outputFile string, verifyChecksum bool) erro
 
 	log.Info("Decrypting file", "input", inputFile, "output", outputFile)
 
-	// Verify input files exist
-	if _, err := os.Stat(inputFile); os.IsNotExist(err) {
-		return fmt.Errorf("encrypted file does not exist: %s", inputFile)
+	// Objects uploaded by an encryption destination are read from the bucket
+	if objectstore.IsURL(inputFile) {
+		return runDecryptObject(log, inputFile, keyFile, outputFile, extractDir, verifyChecksum)
+	}
+
+	// Self-describing containers carry their own key; otherwise a key file is
+	// required. Containers on standard input are detected while streaming.
+	isContainer := false
+	if inputFile != stdioPath {
+		// Verify input files exist
+		if _, err := os.Stat(inputFile); os.IsNotExist(err) {
+			return fmt.Errorf("encrypted file does not exist: %s", inputFile)
+		}
+
+		isContainer, err = crypto.IsContainer(inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to read encrypted file: %w", err)
+		}
 	}
-	if _, err := os.Stat(keyFile); os.IsNotExist(err) {
-		return fmt.Errorf("key file does not exist: %s", keyFile)
+	if isContainer {
+		if keyFile != "" {
+			log.Info("Input is a self-describing container, ignoring key file", "key_file", keyFile)
+			keyFile = ""
+		}
+	} else {
+		if keyFile == "" && inputFile != stdioPath {
+			return fmt.Errorf("--key is required unless the input is a self-describing container")
+		}
+		if _, err := os.Stat(keyFile); keyFile != "" && os.IsNotExist(err) {
+			return fmt.Errorf("key file does not exist: %s", keyFile)
+		}
 	}
 
 	// Load configuration (only Vault settings are needed for CLI mode)
-	cfg, err := config.Load(configFile)
+	cfg, err := loadCLIConfig()
 	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
-	}
-
-	// Only validate Vault config for CLI mode
-	if cfg.Vault.AgentAddress == "" || cfg.Vault.TransitMount == "" || cfg.Vault.KeyName == "" {
-		return fmt.Errorf("vault configuration is incomplete (agent_address, transit_mount, key_name required)")
+		return err
 	}
 
-	// Create Vault client
-	vaultClient, err := vault.NewClient(&vault.Config{
-		AgentAddress: cfg.Vault.AgentAddress,
-		TransitMount: cfg.Vault.TransitMount,
-		KeyName:      cfg.Vault.KeyName,
-		Timeout:      cfg.Vault.RequestTimeout,
-	})
+	vaultClient, err := newVaultClient(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to create vault client: %w", err)
+		return err
 	}
 	defer func() { _ = vaultClient.Close() }()
 
 	// Create decryptor with config chunk size
-	decryptor := crypto.NewDecryptor(vaultClient, &crypto.EncryptorConfig{
-		ChunkSize: cfg.Encryption.ChunkSize,
-	})
+	decryptor := newCLIDecryptor(cfg, vaultClient)
+
+	// Create context for the operation
+	ctx := context.Background()
+
+	// Standard input or output ("-") and archive extraction are streamed
+	if inputFile == stdioPath || outputFile == stdioPath || extractDir != "" {
+		return decryptStream(ctx, log, decryptor, inputFile, keyFile, outputFile, extractDir, verifyChecksum)
+	}
 
 	// Progress callback
 	progressCallback := func(progress float64) {
 		log.Info("Decryption progress", "file", inputFile, "progress", fmt.Sprintf("%.0f%%", progress))
 	}
 
-	// Create context for the operation
-	ctx := context.Background()
-
 	// Decrypt the file
 	if err := decryptor.DecryptFile(ctx, inputFile, keyFile, outputFile, progressCallback); err != nil {
 		return fmt.Errorf("decryption failed: %w", err)
 	}
 
-	// Verify checksum if requested
-	if verifyChecksum {
+	// Verify checksum if requested (containers carry the checksum in their header)
+	if verifyChecksum && isContainer {
+		header, err := crypto.ReadContainerHeader(inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to read container header: %w", err)
+		}
+
+		if header.Checksum != "" {
+			valid, err := crypto.VerifyChecksum(outputFile, header.Checksum)
+			if err != nil {
+				return fmt.Errorf("failed to verify checksum: %w", err)
+			}
+			if !valid {
+				return fmt.Errorf("checksum verification failed")
+			}
+			log.Info("Checksum verification passed")
+		}
+	} else if verifyChecksum {
 		// Derive checksum path from original filename (remove .enc extension)
 		originalFile := strings.TrimSuffix(inputFile, ".enc")
 		checksumPath := originalFile + ".sha256"
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/objectstore"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/watcher"
+)
+
+// runDecryptObject decrypts an object uploaded by an encryption destination.
+// The bucket must be the destination of an encryption block of the
+// configuration, which provides the endpoint and credentials. The key comes
+// from --key (a path or an s3:// URL), the object metadata or the <name>.key
+// object, in that order.
+func runDecryptObject(log logger.Logger, inputURL, keyFile, outputFile, extractDir string, verifyChecksum bool) error {
+	bucket, key, err := objectstore.ParseURL(inputURL)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadCLIConfig()
+	if err != nil {
+		return err
+	}
+
+	destination := destinationForBucket(cfg, bucket)
+	if destination == nil {
+		return fmt.Errorf("no encryption destination in %s uses bucket %s", configFile, bucket)
+	}
+	store, err := objectstore.NewClientFromConfig(destination)
+	if err != nil {
+		return fmt.Errorf("failed to create object store client: %w", err)
+	}
+
+	vaultClient, err := newVaultClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = vaultClient.Close() }()
+
+	ctx := context.Background()
+
+	src, metadata, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	kf, keySource, err := objectKeyFile(ctx, store, key, keyFile, metadata)
+	if err != nil {
+		return err
+	}
+
+	base := strings.TrimSuffix(key, ".enc")
+	source := decryptSource{name: inputURL, keyFile: keySource, checksum: func() (string, string, error) {
+		data, err := store.ReadAll(ctx, base+".sha256")
+		if errors.Is(err, objectstore.ErrNotFound) {
+			return "", "", nil
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("failed to load checksum: %w", err)
+		}
+		return strings.TrimSpace(string(data)), store.URL(base + ".sha256"), nil
+	}}
+
+	return decryptReader(ctx, log, newCLIDecryptor(cfg, vaultClient), src, kf, source, outputFile, extractDir, verifyChecksum)
+}
+
+// destinationForBucket returns the destination of the first encryption
+// block, default block first, that uploads to bucket
+func destinationForBucket(cfg *config.Config, bucket string) *config.DestinationConfig {
+	for _, rule := range cfg.EncryptionRules() {
+		if rule.Destination != nil && rule.Destination.Bucket == bucket {
+			return rule.Destination
+		}
+	}
+	return nil
+}
+
+// objectKeyFile returns the key file of an encrypted object and where it came
+// from. A nil key file without error means none was found, which is fine
+// for self-describing containers.
+func objectKeyFile(ctx context.Context, store *objectstore.Client, key, keyFile string,
+	metadata map[string]string) (*crypto.KeyFile, string, error) {
+	switch {
+	case objectstore.IsURL(keyFile):
+		bucket, keyKey, err := objectstore.ParseURL(keyFile)
+		if err != nil {
+			return nil, "", err
+		}
+		if bucket != store.Bucket() {
+			return nil, "", fmt.Errorf("key %s must be in the bucket of the encrypted object", keyFile)
+		}
+		return readKeyObject(ctx, store, keyKey)
+
+	case keyFile != "":
+		kf, err := crypto.ReadKeyFile(keyFile)
+		return kf, keyFile, err
+
+	case metadata[watcher.KeyFileMetadata] != "":
+		data, err := base64.StdEncoding.DecodeString(metadata[watcher.KeyFileMetadata])
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid key file in object metadata: %w", err)
+		}
+		kf, err := crypto.ParseKeyFile(data)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid key file in object metadata: %w", err)
+		}
+		return kf, "metadata", nil
+	}
+
+	kf, source, err := readKeyObject(ctx, store, strings.TrimSuffix(key, ".enc")+".key")
+	if errors.Is(err, objectstore.ErrNotFound) {
+		return nil, "", nil
+	}
+	return kf, source, err
+}
+
+// readKeyObject reads a key file stored as an object
+func readKeyObject(ctx context.Context, store *objectstore.Client, key string) (*crypto.KeyFile, string, error) {
+	data, err := store.ReadAll(ctx, key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	kf, err := crypto.ParseKeyFile(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid key file %s: %w", store.URL(key), err)
+	}
+	return kf, store.URL(key), nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/objectstore/objectstoretest"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/watcher"
+)
+
+// TestObjectKeyFile tests the sources of the key of an uploaded object
+func TestObjectKeyFile(t *testing.T) {
+	server := objectstoretest.NewServer()
+	defer server.Close()
+
+	store, err := server.Client("bucket", "", 0)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	marshal := func(ciphertext string) []byte {
+		data, err := (&crypto.KeyFile{Version: crypto.KeyFileVersion, Ciphertext: ciphertext}).Marshal()
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		return data
+	}
+
+	ctx := context.Background()
+	if err := store.Put(ctx, "data.csv.key", marshal("vault:v1:sidecar"), nil); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := store.Put(ctx, "keys/other.key", marshal("vault:v1:explicit"), nil); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	localKey := filepath.Join(t.TempDir(), "local.key")
+	if err := crypto.WriteKeyFile(localKey, &crypto.KeyFile{Version: crypto.KeyFileVersion, Ciphertext: "vault:v1:local"}); err != nil {
+		t.Fatalf("WriteKeyFile failed: %v", err)
+	}
+	metadata := map[string]string{watcher.KeyFileMetadata: base64.StdEncoding.EncodeToString(marshal("vault:v1:metadata"))}
+
+	tests := []struct {
+		name       string
+		key        string
+		keyFile    string
+		metadata   map[string]string
+		ciphertext string
+		source     string
+	}{
+		{"sidecar object", "data.csv.enc", "", nil, "vault:v1:sidecar", "s3://bucket/data.csv.key"},
+		{"metadata", "data.csv.enc", "", metadata, "vault:v1:metadata", "metadata"},
+		{"key URL", "data.csv.enc", "s3://bucket/keys/other.key", metadata, "vault:v1:explicit", "s3://bucket/keys/other.key"},
+		{"local key", "data.csv.enc", localKey, metadata, "vault:v1:local", localKey},
+		{"no key", "missing.enc", "", nil, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kf, source, err := objectKeyFile(ctx, store, tt.key, tt.keyFile, tt.metadata)
+			if err != nil {
+				t.Fatalf("objectKeyFile failed: %v", err)
+			}
+			if source != tt.source {
+				t.Errorf("source = %q, want %q", source, tt.source)
+			}
+			if tt.ciphertext == "" {
+				if kf != nil {
+					t.Errorf("expected no key file, got %+v", kf)
+				}
+				return
+			}
+			if kf == nil || kf.Ciphertext != tt.ciphertext {
+				t.Errorf("key file = %+v, want ciphertext %q", kf, tt.ciphertext)
+			}
+		})
+	}
+
+	t.Run("key in another bucket", func(t *testing.T) {
+		if _, _, err := objectKeyFile(ctx, store, "data.csv.enc", "s3://other/data.csv.key", nil); err == nil {
+			t.Error("expected an error for a key in another bucket")
+		}
+	})
+}
+
+// TestDestinationForBucket tests finding the destination of an s3:// input
+func TestDestinationForBucket(t *testing.T) {
+	cfg := &config.Config{
+		Encryption: config.EncryptionConfig{SourceDir: "/data/local"},
+		NamedEncryption: []config.EncryptionConfig{
+			{Name: "reports", Destination: &config.DestinationConfig{Type: config.DestinationS3, Bucket: "reports"}},
+			{Name: "backups", Destination: &config.DestinationConfig{Type: config.DestinationS3, Bucket: "backups"}},
+		},
+	}
+
+	if got := destinationForBucket(cfg, "backups"); got != cfg.NamedEncryption[1].Destination {
+		t.Errorf("destinationForBucket(backups) = %+v, want the backups destination", got)
+	}
+	if got := destinationForBucket(cfg, "unknown"); got != nil {
+		t.Errorf("destinationForBucket(unknown) = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,567 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/queue"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/watcher"
+	"github.com/spf13/cobra"
+)
+
+// adminRequestTimeout bounds each request to a running service's admin API
+const adminRequestTimeout = 30 * time.Second
+
+// adminAddr is the --admin-addr flag of the queue commands
+var adminAddr string
+
+// queueBackend is the queue seen by the queue commands: the state file
+// itself, or the admin API of the watch service that holds it
+type queueBackend interface {
+	List() ([]*model.Item, error)
+	DeadLetters() ([]*model.Item, error)
+	Get(id string) (*model.Item, error)
+	Retry(id string) (*model.Item, error)
+	Replay(id string) (*model.Item, error)
+	Purge(id string) error
+	Close() error
+}
+
+// queueCmd groups the queue inspection and maintenance commands
+func queueCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "queue",
+		Short: "Inspect and manage the watch service queue",
+		Long: `Lists, retries and purges the items of the watch service queue and its dead letter queue.
+
+When the watch service is not running, the commands work on the queue state file
+(queue.state_path) directly, holding its lock. While the service runs it holds the
+lock, and the commands use its admin API instead, which must be enabled with
+admin = true in the telemetry block. The admin token is read from the telemetry
+block's admin_token or the FILE_ENCRYPTOR_ADMIN_TOKEN environment variable.`,
+		Example: `  # List queued items
+  file-encryptor queue list -c config.hcl
+
+  # Retry a failed item now instead of waiting for its retry delay
+  file-encryptor queue retry 3f2b...
+
+  # List dead-lettered items and replay one
+  file-encryptor queue dlq list
+  file-encryptor queue dlq replay 3f2b...
+
+  # Remove every dead-lettered item
+  file-encryptor queue purge --dlq`,
+	}
+
+	cmd.PersistentFlags().StringVar(&adminAddr, "admin-addr", "", "Admin API address of a running watch service (default: telemetry admin_listen address)")
+
+	cmd.AddCommand(queueListCmd())
+	cmd.AddCommand(queueShowCmd())
+	cmd.AddCommand(queueRetryCmd())
+	cmd.AddCommand(queuePurgeCmd())
+	cmd.AddCommand(dlqCmd())
+
+	return cmd
+}
+
+func queueListCmd() *cobra.Command {
+	var outputFormat string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List queued items",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withQueue(func(b queueBackend) error {
+				items, err := b.List()
+				if err != nil {
+					return err
+				}
+				return printItems(cmd.OutOrStdout(), items, outputFormat, "Queue is empty")
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Output format: text, json")
+
+	return cmd
+}
+
+func queueShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a queued or dead-lettered item",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withQueue(func(b queueBackend) error {
+				item, err := b.Get(args[0])
+				if err != nil {
+					return err
+				}
+				return printJSON(cmd.OutOrStdout(), item)
+			})
+		},
+	}
+}
+
+func queueRetryCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "retry <id>...",
+		Short: "Retry failed items now",
+		Long: `Makes failed items ready for processing now instead of waiting for their retry delay.
+Source files that were moved to the failed directory are moved back.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withQueue(func(b queueBackend) error {
+				for _, id := range args {
+					item, err := b.Retry(id)
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(cmd.OutOrStdout(), "Retrying %s (%s)\n", item.ID, item.SourcePath)
+				}
+				return nil
+			})
+		},
+	}
+}
+
+func queuePurgeCmd() *cobra.Command {
+	var (
+		all bool
+		dlq bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "purge [<id>...]",
+		Short: "Remove items without processing them",
+		Long: `Removes queued or dead-lettered items without processing them. Their files are left
+where they are. Items that are being processed cannot be purged.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && !all && !dlq {
+				return fmt.Errorf("specify item IDs, --all or --dlq")
+			}
+
+			return withQueue(func(b queueBackend) error {
+				ids := append([]string(nil), args...)
+				if all {
+					items, err := b.List()
+					if err != nil {
+						return err
+					}
+					ids = append(ids, itemIDs(items)...)
+				}
+				if dlq {
+					items, err := b.DeadLetters()
+					if err != nil {
+						return err
+					}
+					ids = append(ids, itemIDs(items)...)
+				}
+
+				for _, id := range ids {
+					if err := b.Purge(id); err != nil {
+						return err
+					}
+					fmt.Fprintf(cmd.OutOrStdout(), "Purged %s\n", id)
+				}
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Purge every queued item")
+	cmd.Flags().BoolVar(&dlq, "dlq", false, "Purge every dead-lettered item")
+
+	return cmd
+}
+
+// dlqCmd groups the dead letter queue commands
+func dlqCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dlq",
+		Short: "Inspect and replay the dead letter queue",
+	}
+
+	cmd.AddCommand(dlqListCmd())
+	cmd.AddCommand(dlqReplayCmd())
+
+	return cmd
+}
+
+func dlqListCmd() *cobra.Command {
+	var outputFormat string
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List dead-lettered items",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withQueue(func(b queueBackend) error {
+				items, err := b.DeadLetters()
+				if err != nil {
+					return err
+				}
+				return printItems(cmd.OutOrStdout(), items, outputFormat, "Dead letter queue is empty")
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Output format: text, json")
+
+	return cmd
+}
+
+func dlqReplayCmd() *cobra.Command {
+	var all bool
+
+	cmd := &cobra.Command{
+		Use:   "replay [<id>...]",
+		Short: "Queue dead-lettered items again",
+		Long: `Queues dead-lettered items again with their attempt count reset. Source files are
+moved back from the dead letter (or failed) directory. Replays are recorded in the
+audit log when audit logging is enabled.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && !all {
+				return fmt.Errorf("specify item IDs or --all")
+			}
+
+			return withQueue(func(b queueBackend) error {
+				ids := args
+				if all {
+					items, err := b.DeadLetters()
+					if err != nil {
+						return err
+					}
+					ids = itemIDs(items)
+				}
+
+				for _, id := range ids {
+					item, err := b.Replay(id)
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(cmd.OutOrStdout(), "Replayed %s (%s)\n", item.ID, item.SourcePath)
+				}
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().BoolVar(&all, "all", false, "Replay every dead-lettered item")
+
+	return cmd
+}
+
+// withQueue loads the configuration, opens the queue and runs fn
+func withQueue(fn func(b queueBackend) error) error {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	b, err := openQueue(cfg)
+	if err != nil {
+		return err
+	}
+
+	err = fn(b)
+	if closeErr := b.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// openQueue opens the queue state file if its lock is free, and otherwise
+// connects to the admin API of the watch service holding it
+func openQueue(cfg *config.Config) (queueBackend, error) {
+	token := os.Getenv(config.AdminTokenEnv)
+	if cfg.Telemetry != nil && cfg.Telemetry.AdminToken != "" {
+		token = cfg.Telemetry.AdminToken
+	}
+
+	if adminAddr != "" {
+		return newServiceQueue(adminAddr, token)
+	}
+
+	lock, err := queue.LockState(cfg.Queue.StatePath)
+	if errors.Is(err, queue.ErrLocked) {
+		if cfg.Telemetry == nil || !cfg.Telemetry.Admin {
+			return nil, fmt.Errorf("queue state %s is in use by a running watch service: "+
+				"enable its admin API with admin = true in the telemetry block, or use --admin-addr", cfg.Queue.StatePath)
+		}
+		return newServiceQueue(cfg.Telemetry.AdminListen, token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newOfflineQueue(cfg, lock)
+}
+
+// offlineQueue works on the queue state file while holding its lock
+type offlineQueue struct {
+	q     *queue.Queue
+	lock  *queue.StateLock
+	rules []watcher.RuleConfig
+	log   logger.Logger
+}
+
+func newOfflineQueue(cfg *config.Config, lock *queue.StateLock) (*offlineQueue, error) {
+	// Changes are logged like the service logs them, including to the audit log
+	var opts []logger.LoggerOption
+	if cfg.Logging.AuditLog {
+		opts = append(opts, logger.WithAudit(cfg.Logging.AuditPath))
+	}
+	log, err := logger.New(logLevel, logOutput, opts...)
+	if err != nil {
+		_ = lock.Unlock()
+		return nil, fmt.Errorf("failed to initialize logger: %w", err)
+	}
+
+	q, err := queue.NewQueue(&queue.Config{
+		MaxRetries: cfg.Queue.MaxRetries,
+		BaseDelay:  cfg.Queue.BaseDelay,
+		MaxDelay:   cfg.Queue.MaxDelay,
+		StatePath:  cfg.Queue.StatePath,
+	})
+	if err == nil {
+		err = q.Load()
+	}
+	if err != nil {
+		_ = log.Sync()
+		_ = lock.Unlock()
+		return nil, fmt.Errorf("failed to open queue: %w", err)
+	}
+
+	return &offlineQueue{
+		q:     q,
+		lock:  lock,
+		rules: watcher.RulesFromConfig(cfg),
+		log:   log,
+	}, nil
+}
+
+func (o *offlineQueue) List() ([]*model.Item, error) { return o.q.List(), nil }
+
+func (o *offlineQueue) DeadLetters() ([]*model.Item, error) { return o.q.DeadLetters(), nil }
+
+func (o *offlineQueue) Get(id string) (*model.Item, error) { return o.q.Get(id) }
+
+func (o *offlineQueue) Retry(id string) (*model.Item, error) {
+	var restoredFrom string
+	item, err := o.q.Retry(id, func(item *model.Item) error {
+		var err error
+		restoredFrom, err = watcher.RestoreSource(o.rules, item)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	o.log.Info("Retrying queue item", "id", id, "file", item.SourcePath, "restored_from", restoredFrom, "via", "cli")
+	return item, nil
+}
+
+func (o *offlineQueue) Replay(id string) (*model.Item, error) {
+	var restoredFrom string
+	item, err := o.q.Replay(id, func(item *model.Item) error {
+		var err error
+		restoredFrom, err = watcher.RestoreSource(o.rules, item)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	o.log.Info("Replayed item from dead letter queue",
+		"id", id,
+		"operation", item.Operation,
+		"file", item.SourcePath,
+		"restored_from", restoredFrom,
+		"via", "cli")
+	return item, nil
+}
+
+func (o *offlineQueue) Purge(id string) error {
+	if err := o.q.Remove(id); err != nil {
+		return err
+	}
+
+	o.log.Info("Purged queue item", "id", id, "via", "cli")
+	return nil
+}
+
+func (o *offlineQueue) Close() error {
+	err := o.q.Close()
+	_ = o.log.Sync()
+	if unlockErr := o.lock.Unlock(); err == nil {
+		err = unlockErr
+	}
+	return err
+}
+
+// serviceQueue uses the admin API of a running watch service
+type serviceQueue struct {
+	baseURL string
+	token   string // bearer token; empty if the API needs none
+	client  *http.Client
+}
+
+// newServiceQueue connects to the admin API at addr, a URL or a host:port
+// listen address; a wildcard host means the local machine
+func newServiceQueue(addr, token string) (*serviceQueue, error) {
+	baseURL := addr
+	if !strings.Contains(addr, "://") {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid admin address %q: %w", addr, err)
+		}
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "127.0.0.1"
+		}
+		baseURL = "http://" + net.JoinHostPort(host, port)
+	}
+
+	return &serviceQueue{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: adminRequestTimeout},
+	}, nil
+}
+
+func (s *serviceQueue) List() ([]*model.Item, error) {
+	var items []*model.Item
+	return items, s.do(http.MethodGet, "/queue", &items)
+}
+
+func (s *serviceQueue) DeadLetters() ([]*model.Item, error) {
+	var items []*model.Item
+	return items, s.do(http.MethodGet, "/dlq", &items)
+}
+
+func (s *serviceQueue) Get(id string) (*model.Item, error) {
+	var item model.Item
+	if err := s.do(http.MethodGet, "/queue/"+url.PathEscape(id), &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *serviceQueue) Retry(id string) (*model.Item, error) {
+	var item model.Item
+	if err := s.do(http.MethodPost, "/queue/"+url.PathEscape(id)+"/retry", &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *serviceQueue) Replay(id string) (*model.Item, error) {
+	var item model.Item
+	if err := s.do(http.MethodPost, "/dlq/"+url.PathEscape(id)+"/replay", &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *serviceQueue) Purge(id string) error {
+	return s.do(http.MethodDelete, "/queue/"+url.PathEscape(id), nil)
+}
+
+func (s *serviceQueue) Close() error { return nil }
+
+// do sends a request to the admin API and decodes the JSON response into out
+func (s *serviceQueue) do(method, path string, out interface{}) error {
+	req, err := http.NewRequest(method, s.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create admin request: %w", err)
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach watch service admin API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read admin response: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &apiErr) != nil || apiErr.Error == "" {
+			return fmt.Errorf("watch service admin API at %s returned %s (is admin = true set in the telemetry block?)",
+				s.baseURL, resp.Status)
+		}
+		return fmt.Errorf("%s", apiErr.Error)
+	}
+
+	if out == nil || len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to decode admin response: %w", err)
+	}
+	return nil
+}
+
+// printItems writes items as a table or as JSON
+func printItems(w io.Writer, items []*model.Item, outputFormat, emptyMessage string) error {
+	switch strings.ToLower(outputFormat) {
+	case "json":
+		return printJSON(w, items)
+	case "text":
+	default:
+		return fmt.Errorf("--format must be one of: text, json")
+	}
+
+	if len(items) == 0 {
+		fmt.Fprintln(w, emptyMessage)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tOPERATION\tSTATUS\tATTEMPTS\tNEXT RETRY\tSOURCE\tERROR")
+	for _, item := range items {
+		nextRetry := "-"
+		if item.Status == model.StatusFailed && !item.NextRetry.IsZero() {
+			nextRetry = item.NextRetry.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			item.ID, item.Operation, item.Status, item.AttemptCount, nextRetry, item.SourcePath, item.Error)
+	}
+	return tw.Flush()
+}
+
+func printJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func itemIDs(items []*model.Item) []string {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
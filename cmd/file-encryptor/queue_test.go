@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/queue"
+)
+
+// queueTestConfig writes a watch configuration and returns its path, the
+// encryption source directory and the queue state path
+func queueTestConfig(t *testing.T, extra string) (string, string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	sourceDir := filepath.Join(dir, "source")
+	statePath := filepath.Join(dir, "state", "queue-state.json")
+	content := `
+vault {
+  agent_address = "http://127.0.0.1:8200"
+  transit_mount = "transit"
+  key_name      = "test-key"
+}
+encryption {
+  source_dir           = "` + filepath.ToSlash(sourceDir) + `"
+  dest_dir             = "` + filepath.ToSlash(filepath.Join(dir, "dest")) + `"
+  source_file_behavior = "archive"
+}
+queue {
+  state_path  = "` + filepath.ToSlash(statePath) + `"
+  max_retries = 0
+}
+logging {
+  level       = "info"
+  output      = "stderr"
+  audit_log   = true
+  audit_path  = "` + filepath.ToSlash(filepath.Join(dir, "audit.log")) + `"
+}
+` + extra
+
+	file := filepath.Join(dir, "config.hcl")
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	prevLevel, prevOutput, prevAddr := logLevel, logOutput, adminAddr
+	t.Cleanup(func() { logLevel, logOutput, adminAddr = prevLevel, prevOutput, prevAddr })
+	logLevel, logOutput, adminAddr = "info", "stderr", ""
+	setCLIState(t, file, vaultOverrides{})
+
+	return file, sourceDir, statePath
+}
+
+// runQueueCmd runs a queue subcommand and returns its output
+func runQueueCmd(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	cmd := queueCmd()
+	cmd.SetArgs(args)
+	cmd.SetOut(&out)
+	cmd.SetErr(&out)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+// TestQueueCmd_ReplayOffline tests replaying a dead-lettered item while the
+// watch service is not running
+func TestQueueCmd_ReplayOffline(t *testing.T) {
+	file, sourceDir, statePath := queueTestConfig(t, "")
+
+	// Dead-letter an item and move its file to the DLQ directory
+	q, err := queue.NewQueue(&queue.Config{StatePath: statePath})
+	if err != nil {
+		t.Fatalf("Failed to create queue: %v", err)
+	}
+	sourceFile := filepath.Join(sourceDir, "data.txt")
+	item := model.NewItem(model.OperationEncrypt, sourceFile, sourceFile+".enc")
+	if err := q.Enqueue(item); err != nil {
+		t.Fatalf("Failed to enqueue: %v", err)
+	}
+	if err := q.Requeue(q.Dequeue(), os.ErrPermission); err == nil {
+		t.Fatal("Expected the item to be dead-lettered")
+	}
+	_ = q.Close()
+
+	dlqFile := filepath.Join(sourceDir, "dlq", "data.txt")
+	if err := os.MkdirAll(filepath.Dir(dlqFile), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dlqFile, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := runQueueCmd(t, "dlq", "list")
+	if err != nil || !strings.Contains(out, item.ID) {
+		t.Fatalf("Expected dlq list to show %s, got %q (error: %v)", item.ID, out, err)
+	}
+
+	if _, err := runQueueCmd(t, "dlq", "replay", item.ID); err != nil {
+		t.Fatalf("Expected replay to succeed, got: %v", err)
+	}
+
+	if _, err := os.Stat(sourceFile); err != nil {
+		t.Errorf("Expected source file to be restored: %v", err)
+	}
+
+	out, err = runQueueCmd(t, "list", "--format", "json")
+	if err != nil {
+		t.Fatalf("Expected list to succeed, got: %v", err)
+	}
+	var items []*model.Item
+	if err := json.Unmarshal([]byte(out), &items); err != nil {
+		t.Fatalf("Expected JSON output, got %q: %v", out, err)
+	}
+	if len(items) != 1 || items[0].ID != item.ID || items[0].AttemptCount != 0 || items[0].Status != model.StatusPending {
+		t.Errorf("Expected the replayed item to be pending with no attempts, got: %+v", items)
+	}
+
+	audit, err := os.ReadFile(filepath.Join(filepath.Dir(file), "audit.log"))
+	if err != nil || !strings.Contains(string(audit), "Replayed item from dead letter queue") {
+		t.Errorf("Expected the replay in the audit log, got %q (error: %v)", audit, err)
+	}
+}
+
+// TestQueueCmd_LockedWithoutAdmin tests the error while a service holds the
+// queue state and its admin API is not enabled
+func TestQueueCmd_LockedWithoutAdmin(t *testing.T) {
+	_, _, statePath := queueTestConfig(t, "")
+
+	lock, err := queue.LockState(statePath)
+	if err != nil {
+		t.Fatalf("Failed to lock queue state: %v", err)
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	_, err = runQueueCmd(t, "list")
+	if err == nil || !strings.Contains(err.Error(), "in use by a running watch service") {
+		t.Errorf("Expected locked state error, got: %v", err)
+	}
+}
+
+// TestQueueCmd_ServiceAdmin tests that a locked queue state is managed
+// through the admin API of the running service
+func TestQueueCmd_ServiceAdmin(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"missing or invalid admin token"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/dlq":
+			_, _ = w.Write([]byte(`[{"id":"a","status":"dead_letter_queue"},{"id":"b","status":"dead_letter_queue"}]`))
+		case "/dlq/a/replay", "/dlq/b/replay":
+			_, _ = w.Write([]byte(`{"id":"x","status":"pending","source_path":"/data/x.txt"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"item not found: missing"}`))
+		}
+	}))
+	defer server.Close()
+
+	listen := strings.TrimPrefix(server.URL, "http://")
+	_, _, statePath := queueTestConfig(t, `
+telemetry {
+  listen       = "127.0.0.1:9102"
+  admin        = true
+  admin_listen = "`+listen+`"
+  admin_token  = "secret"
+}
+`)
+
+	lock, err := queue.LockState(statePath)
+	if err != nil {
+		t.Fatalf("Failed to lock queue state: %v", err)
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	if _, err := runQueueCmd(t, "dlq", "replay", "--all"); err != nil {
+		t.Fatalf("Expected replay to succeed, got: %v", err)
+	}
+	want := []string{"GET /dlq", "POST /dlq/a/replay", "POST /dlq/b/replay"}
+	if strings.Join(requests, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected requests %v, got %v", want, requests)
+	}
+
+	_, err = runQueueCmd(t, "show", "missing")
+	if err == nil || !strings.Contains(err.Error(), "item not found") {
+		t.Errorf("Expected the API error, got: %v", err)
+	}
+}
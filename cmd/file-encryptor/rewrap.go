@@ -4,12 +4,12 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
-	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/rewrap"
-	"github.com/gitrgoliveira/vault-file-encryption/internal/vault"
 	"github.com/spf13/cobra"
 )
 
@@ -23,6 +23,8 @@ func rewrapCmd() *cobra.Command {
 		minVersion   int
 		enableBackup bool
 		outputFormat string
+		parallel     int
+		rateLimit    float64
 	)
 
 	cmd := &cobra.Command{
@@ -38,7 +40,12 @@ The rewrap operation:
 4. Atomically updates the .key file with the new ciphertext
 5. Optionally creates backups before modification
 
-The encrypted files (.enc) do not need to be re-encrypted, only the .key files are updated.`,
+The encrypted files (.enc) do not need to be re-encrypted, only the .key files are updated.
+Self-describing containers (format = "container") are found as well; their embedded
+data key is updated in place without rewriting the encrypted body.
+
+With --parallel several files are re-wrapped at once, and --rate caps the requests sent to
+Vault per second. Ctrl+C stops the files not yet started and reports the ones processed.`,
 		Example: `  # Re-wrap a single key file
   file-encryptor rewrap --key-file data.txt.key --min-version 2
 
@@ -51,28 +58,35 @@ The encrypted files (.enc) do not need to be re-encrypted, only the .key files a
   # Dry-run to see what would be re-wrapped
   file-encryptor rewrap --dir /path/to/keys --recursive --dry-run --min-version 2
 
+  # Re-wrap 8 files at once, at most 200 Vault requests per second
+  file-encryptor rewrap --dir /path/to/keys --recursive --min-version 2 --parallel 8 --rate 200
+
   # Output results as JSON
   file-encryptor rewrap --dir /path/to/keys --min-version 2 --format json
 
   # Output results as CSV
   file-encryptor rewrap --dir /path/to/keys --min-version 2 --format csv`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runRewrap(keyFile, directory, recursive, dryRun, minVersion, enableBackup, outputFormat)
+			return runRewrap(keyFile, directory, recursive, dryRun, minVersion, enableBackup, outputFormat, parallel, rateLimit)
 		},
 	}
 
-	cmd.Flags().StringVarP(&keyFile, "key-file", "k", "", "Single key file to re-wrap")
+	cmd.Flags().StringVarP(&keyFile, "key-file", "k", "", "Single key file (or container) to re-wrap")
 	cmd.Flags().StringVarP(&directory, "dir", "d", "", "Directory containing key files to re-wrap")
 	cmd.Flags().BoolVarP(&recursive, "recursive", "r", false, "Recursively scan directory for key files")
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be re-wrapped without making changes")
 	cmd.Flags().IntVarP(&minVersion, "min-version", "m", 1, "Minimum key version (re-wrap keys below this version)")
 	cmd.Flags().BoolVarP(&enableBackup, "backup", "b", true, "Create backups before re-wrapping (enabled by default)")
 	cmd.Flags().StringVarP(&outputFormat, "format", "f", "text", "Output format: text, json, csv")
+	cmd.Flags().IntVarP(&parallel, "parallel", "p", 1, "Number of key files re-wrapped at once")
+	cmd.Flags().Float64Var(&rateLimit, "rate", 0, "Maximum Vault rewrap requests per second (0 for no limit)")
+	addVaultFlags(cmd)
 
 	return cmd
 }
 
-func runRewrap(keyFile, directory string, recursive, dryRun bool, minVersion int, enableBackup bool, outputFormat string) error {
+func runRewrap(keyFile, directory string, recursive, dryRun bool, minVersion int, enableBackup bool, outputFormat string,
+	parallel int, rateLimit float64) error {
 	// Validate flags
 	if keyFile == "" && directory == "" {
 		return fmt.Errorf("either --key-file or --dir must be specified")
@@ -83,6 +97,12 @@ func runRewrap(keyFile, directory string, recursive, dryRun bool, minVersion int
 	if minVersion < 1 {
 		return fmt.Errorf("--min-version must be at least 1")
 	}
+	if parallel < 1 {
+		return fmt.Errorf("--parallel must be at least 1")
+	}
+	if rateLimit < 0 {
+		return fmt.Errorf("--rate must not be negative")
+	}
 
 	// Validate output format
 	outputFormat = strings.ToLower(outputFormat)
@@ -102,25 +122,14 @@ func runRewrap(keyFile, directory string, recursive, dryRun bool, minVersion int
 	}
 
 	// Load configuration (only Vault settings needed)
-	cfg, err := config.Load(configFile)
+	cfg, err := loadCLIConfig()
 	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
+		return err
 	}
 
-	// Validate Vault config
-	if cfg.Vault.AgentAddress == "" || cfg.Vault.TransitMount == "" || cfg.Vault.KeyName == "" {
-		return fmt.Errorf("vault configuration is incomplete (agent_address, transit_mount, key_name required)")
-	}
-
-	// Create Vault client
-	vaultClient, err := vault.NewClient(&vault.Config{
-		AgentAddress: cfg.Vault.AgentAddress,
-		TransitMount: cfg.Vault.TransitMount,
-		KeyName:      cfg.Vault.KeyName,
-		Timeout:      cfg.Vault.RequestTimeout,
-	})
+	vaultClient, err := newVaultClient(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to create vault client: %w", err)
+		return err
 	}
 	defer func() { _ = vaultClient.Close() }()
 
@@ -132,6 +141,8 @@ func runRewrap(keyFile, directory string, recursive, dryRun bool, minVersion int
 		CreateBackup: enableBackup,
 		BackupSuffix: ".bak",
 		Logger:       log,
+		Parallel:     parallel,
+		Rate:         rateLimit,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create rewrapper: %w", err)
@@ -170,14 +181,12 @@ func runRewrap(keyFile, directory string, recursive, dryRun bool, minVersion int
 	// Create reporter
 	reporter := rewrap.NewReporter()
 
-	// Create context
-	ctx := context.Background()
+	// Ctrl+C stops the files not yet started; the report covers the others
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	// Re-wrap files
-	results, err := rewrapper.RewrapBatch(ctx, files)
-	if err != nil {
-		return fmt.Errorf("rewrap batch failed: %w", err)
-	}
+	results, batchErr := rewrapper.RewrapBatch(ctx, files)
 
 	// Add results to reporter
 	reporter.AddResults(results)
@@ -199,8 +208,13 @@ func runRewrap(keyFile, directory string, recursive, dryRun bool, minVersion int
 		}
 	}
 
-	// Determine exit code based on results
 	stats := reporter.GetStatistics()
+	if batchErr != nil {
+		log.Error("Rewrap interrupted", "processed", stats.TotalFiles, "total", len(files))
+		return fmt.Errorf("rewrap batch failed: %w", batchErr)
+	}
+
+	// Determine exit code based on results
 	if stats.Failed > 0 {
 		// Some failures occurred
 		if stats.Successful > 0 {
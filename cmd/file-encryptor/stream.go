@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/archive"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+)
+
+// stdioPath selects standard input or output in place of a file path
+const stdioPath = "-"
+
+// Key outputs of a streamed encryption other than a file path
+const (
+	keyOutputStderr   = "stderr"
+	keyOutputFDPrefix = "fd:"
+)
+
+// streamLogOutput keeps logs off standard output when it carries data
+func streamLogOutput(outputFile string) string {
+	if outputFile == stdioPath && logOutput == "stdout" {
+		return "stderr"
+	}
+	return logOutput
+}
+
+// openStreamInput opens the input file, or standard input for "-"
+func openStreamInput(path string) (io.ReadCloser, error) {
+	if path == stdioPath {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	f, err := os.Open(path) // #nosec G304 - intentional file encryption tool
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	return f, nil
+}
+
+// createStreamOutput creates the output file, or uses standard output for
+// "-". The returned function completes the output: it syncs and closes the
+// file, or removes it if the operation failed.
+func createStreamOutput(path string) (io.Writer, func(error) error, error) {
+	if path == stdioPath {
+		return os.Stdout, func(err error) error { return err }, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600) // #nosec G304 - intentional file encryption tool
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	finish := func(opErr error) error {
+		if opErr == nil {
+			if err := f.Sync(); err != nil {
+				opErr = fmt.Errorf("failed to sync output file: %w", err)
+			}
+		}
+		if err := f.Close(); err != nil && opErr == nil {
+			opErr = fmt.Errorf("failed to close output file: %w", err)
+		}
+		if opErr != nil {
+			_ = os.Remove(path)
+		}
+		return opErr
+	}
+
+	return f, finish, nil
+}
+
+// writeKeyOutput writes the key file to a path, to standard error ("stderr")
+// or to an open file descriptor ("fd:3")
+func writeKeyOutput(spec string, kf *crypto.KeyFile) error {
+	var w io.Writer
+
+	switch {
+	case spec == keyOutputStderr:
+		w = os.Stderr
+	case strings.HasPrefix(spec, keyOutputFDPrefix):
+		fd, err := strconv.Atoi(strings.TrimPrefix(spec, keyOutputFDPrefix))
+		if err != nil || fd < 0 {
+			return fmt.Errorf("invalid key file descriptor: %s", spec)
+		}
+		f := os.NewFile(uintptr(fd), spec)
+		if f == nil {
+			return fmt.Errorf("invalid key file descriptor: %s", spec)
+		}
+		defer func() { _ = f.Close() }()
+		w = f
+	default:
+		return crypto.WriteKeyFile(spec, kf)
+	}
+
+	data, err := kf.Marshal()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write key file to %s: %w", spec, err)
+	}
+	return nil
+}
+
+// streamSource describes the data read by encryptReader
+type streamSource struct {
+	name         string // Shown in logs: a path, "-" or a directory
+	filename     string // Recorded in the key file or container header
+	keyFile      string // Default key file path, if there is one
+	checksumFile string // Where --checksum also saves the checksum, if anywhere
+}
+
+// encryptStream encrypts when the input or output is standard input or
+// output
+func encryptStream(ctx context.Context, log logger.Logger, encryptor *crypto.Encryptor,
+	inputFile, outputFile, keyFile string, calculateChecksum bool, format string) error {
+	source := streamSource{name: inputFile}
+	if inputFile != stdioPath {
+		source.filename = filepath.Base(inputFile)
+		source.keyFile = inputFile + ".key"
+		source.checksumFile = inputFile + ".sha256"
+	}
+
+	src, err := openStreamInput(inputFile)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	return encryptReader(ctx, log, encryptor, src, source, outputFile, keyFile, calculateChecksum, format)
+}
+
+// encryptReader encrypts src to a file or standard output. Containers are
+// completed in place, so their output must be a file.
+func encryptReader(ctx context.Context, log logger.Logger, encryptor *crypto.Encryptor, src io.Reader,
+	source streamSource, outputFile, keyFile string, calculateChecksum bool, format string) error {
+	if format == config.FormatContainer && outputFile == stdioPath {
+		return fmt.Errorf("--format %s cannot be written to standard output", config.FormatContainer)
+	}
+
+	// Determine key file path (defaults to the source, or the output, + .key)
+	if format == config.FormatSplit && keyFile == "" {
+		switch {
+		case source.keyFile != "":
+			keyFile = source.keyFile
+		case outputFile != stdioPath:
+			keyFile = strings.TrimSuffix(outputFile, ".enc") + ".key"
+		default:
+			return fmt.Errorf("--key-file is required when streaming to standard output (a path, %s or %sN)",
+				keyOutputStderr, keyOutputFDPrefix)
+		}
+	}
+
+	// Self-describing container: key and checksum are embedded in the header
+	if format == config.FormatContainer {
+		out, finish, err := createStreamOutput(outputFile)
+		if err != nil {
+			return err
+		}
+
+		header, err := encryptor.EncryptStreamContainer(ctx, src, out.(*os.File), source.filename)
+		if err := finish(err); err != nil {
+			return fmt.Errorf("encryption failed: %w", err)
+		}
+
+		log.Info("File encrypted successfully",
+			"input", source.name,
+			"output", outputFile,
+			"format", format,
+			"size", header.Size,
+			"checksum", header.Checksum)
+
+		return nil
+	}
+
+	out, finish, err := createStreamOutput(outputFile)
+	if err != nil {
+		return err
+	}
+
+	encryptedKey, info, err := encryptor.EncryptStream(ctx, src, out)
+	if err := finish(err); err != nil {
+		return fmt.Errorf("encryption failed: %w", err)
+	}
+
+	// The checksum is computed while streaming; it is also saved next to an
+	// input file, like for file encryption
+	checksum := ""
+	if calculateChecksum {
+		checksum = info.Checksum
+		if source.checksumFile != "" {
+			if err := crypto.SaveChecksum(checksum, source.checksumFile); err != nil {
+				return fmt.Errorf("failed to save checksum: %w", err)
+			}
+			log.Info("Checksum saved", "checksum_file", source.checksumFile, "checksum", checksum)
+		}
+	}
+
+	// Save the encrypted data key with its metadata
+	keyData := encryptor.NewStreamKeyFile(source.filename, info.Size, encryptedKey, checksum)
+	if err := writeKeyOutput(keyFile, keyData); err != nil {
+		return fmt.Errorf("failed to save key file: %w", err)
+	}
+
+	log.Info("Encrypted data key saved", "key_file", keyFile)
+
+	log.Info("File encrypted successfully",
+		"input", source.name,
+		"output", outputFile,
+		"key_file", keyFile,
+		"size", info.Size)
+
+	return nil
+}
+
+// decryptStream decrypts when the input or output is standard input or
+// output, or extracts the decrypted archive into extractDir if set. The
+// checksum is verified against the container header, the key file or a
+// .sha256 file next to the input, in that order.
+func decryptStream(ctx context.Context, log logger.Logger, decryptor *crypto.Decryptor,
+	inputFile, keyFile, outputFile, extractDir string, verifyChecksum bool) error {
+	var kf *crypto.KeyFile
+	if keyFile != "" {
+		var err error
+		if kf, err = crypto.ReadKeyFile(keyFile); err != nil {
+			return err
+		}
+	}
+
+	src, err := openStreamInput(inputFile)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	source := decryptSource{name: inputFile, keyFile: keyFile, checksum: func() (string, string, error) {
+		return localChecksum(inputFile)
+	}}
+	return decryptReader(ctx, log, decryptor, src, kf, source, outputFile, extractDir, verifyChecksum)
+}
+
+// decryptSource describes the data read by decryptReader
+type decryptSource struct {
+	name    string // Shown in logs
+	keyFile string // Where the key file came from, if anywhere
+
+	// checksum returns the expected checksum saved next to the input and
+	// where it came from, or an empty checksum if there is none
+	checksum func() (string, string, error)
+}
+
+// decryptReader decrypts src to a file or standard output, or extracts it
+// into extractDir if set
+func decryptReader(ctx context.Context, log logger.Logger, decryptor *crypto.Decryptor, src io.Reader,
+	kf *crypto.KeyFile, source decryptSource, outputFile, extractDir string, verifyChecksum bool) error {
+	var (
+		out    io.Writer
+		finish func(error) error
+		err    error
+	)
+	if extractDir != "" {
+		out, finish = extractOutput(ctx, extractDir)
+		outputFile = extractDir
+	} else if out, finish, err = createStreamOutput(outputFile); err != nil {
+		return err
+	}
+
+	info, err := decryptor.DecryptStream(ctx, src, kf, out)
+	if err := finish(err); err != nil {
+		return fmt.Errorf("decryption failed: %w", err)
+	}
+
+	if verifyChecksum {
+		expected, checksumSource, err := streamChecksum(info, kf, source.checksum)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case expected == "":
+			log.Info("Checksum not available, skipping verification")
+		case expected != info.Checksum:
+			// Standard output and extracted files have already been
+			// written, so a file output is the only one that can be withdrawn
+			if outputFile != stdioPath && extractDir == "" {
+				_ = os.Remove(outputFile)
+			}
+			return fmt.Errorf("checksum verification failed")
+		default:
+			log.Info("Checksum verification passed", "source", checksumSource)
+		}
+	}
+
+	log.Info("File decrypted successfully",
+		"input", source.name,
+		"key_file", source.keyFile,
+		"output", outputFile,
+		"size", info.Size)
+
+	return nil
+}
+
+// extractOutput returns a writer that extracts the tar archive written to it
+// into dir. The returned function waits for the extraction to finish.
+func extractOutput(ctx context.Context, dir string) (io.Writer, func(error) error) {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+
+	go func() {
+		err := archive.Extract(ctx, pr, dir)
+		if err == nil {
+			// Consume the padding after the end of the archive
+			_, err = io.Copy(io.Discard, pr)
+		}
+		pr.CloseWithError(err)
+		done <- err
+	}()
+
+	finish := func(opErr error) error {
+		pw.CloseWithError(opErr)
+		if err := <-done; err != nil {
+			return fmt.Errorf("failed to extract archive: %w", err)
+		}
+		return opErr
+	}
+
+	return pw, finish
+}
+
+// streamChecksum returns the expected checksum of a decrypted stream and
+// where it came from, or an empty checksum if none is available. sidecar
+// looks for a checksum saved next to the input.
+func streamChecksum(info *crypto.StreamInfo, kf *crypto.KeyFile, sidecar func() (string, string, error)) (string, string, error) {
+	if info.Header != nil {
+		return info.Header.Checksum, "container", nil
+	}
+	if kf != nil && kf.Checksum != "" {
+		return kf.Checksum, "key_file", nil
+	}
+	return sidecar()
+}
+
+// localChecksum returns the checksum in the .sha256 file of an input file
+func localChecksum(inputFile string) (string, string, error) {
+	if inputFile == stdioPath {
+		return "", "", nil
+	}
+
+	checksumPath := strings.TrimSuffix(inputFile, ".enc") + ".sha256"
+	if _, err := os.Stat(checksumPath); err != nil {
+		return "", "", nil
+	}
+
+	checksum, err := crypto.LoadChecksum(checksumPath)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to load checksum: %w", err)
+	}
+	return checksum, checksumPath, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
+)
+
+// TestStreamLogOutput tests that logs move to stderr when data goes to stdout
+func TestStreamLogOutput(t *testing.T) {
+	prev := logOutput
+	t.Cleanup(func() { logOutput = prev })
+
+	tests := []struct {
+		logOutput string
+		output    string
+		want      string
+	}{
+		{"stdout", "-", "stderr"},
+		{"stdout", "out.enc", "stdout"},
+		{"/var/log/fe.log", "-", "/var/log/fe.log"},
+	}
+
+	for _, tt := range tests {
+		logOutput = tt.logOutput
+		if got := streamLogOutput(tt.output); got != tt.want {
+			t.Errorf("streamLogOutput(%q) with --log-output %q = %q, want %q", tt.output, tt.logOutput, got, tt.want)
+		}
+	}
+}
+
+// TestWriteKeyOutput tests writing the key file to a path and a file descriptor
+func TestWriteKeyOutput(t *testing.T) {
+	kf := &crypto.KeyFile{Version: crypto.KeyFileVersion, Ciphertext: "vault:v1:abc", Filename: "dump"}
+
+	t.Run("path", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dump.key")
+		if err := writeKeyOutput(path, kf); err != nil {
+			t.Fatalf("writeKeyOutput failed: %v", err)
+		}
+
+		got, err := crypto.ReadKeyFile(path)
+		if err != nil {
+			t.Fatalf("ReadKeyFile failed: %v", err)
+		}
+		if got.Ciphertext != kf.Ciphertext {
+			t.Errorf("ciphertext = %q, want %q", got.Ciphertext, kf.Ciphertext)
+		}
+	})
+
+	t.Run("file descriptor", func(t *testing.T) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatalf("os.Pipe failed: %v", err)
+		}
+		defer func() { _ = r.Close() }()
+
+		// writeKeyOutput closes the descriptor once the key is written
+		err = writeKeyOutput("fd:"+strconv.FormatUint(uint64(w.Fd()), 10), kf)
+		_ = w.Close()
+		if err != nil {
+			t.Fatalf("writeKeyOutput failed: %v", err)
+		}
+
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("failed to read pipe: %v", err)
+		}
+		got, err := crypto.ParseKeyFile(data)
+		if err != nil {
+			t.Fatalf("ParseKeyFile failed: %v", err)
+		}
+		if got.Filename != kf.Filename {
+			t.Errorf("filename = %q, want %q", got.Filename, kf.Filename)
+		}
+	})
+
+	t.Run("invalid descriptor", func(t *testing.T) {
+		if err := writeKeyOutput("fd:three", kf); err == nil {
+			t.Error("expected an error for an invalid descriptor")
+		}
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/vault"
+	"github.com/spf13/cobra"
+)
+
+// defaultConfigFile is the --config default. Unlike an explicit --config, it
+// may be missing for one-off commands configured through flags and the
+// environment.
+const defaultConfigFile = "config.hcl"
+
+// vaultOverrides holds the Vault flags of the one-off commands
+type vaultOverrides struct {
+	address      string
+	transitMount string
+	keyName      string
+	namespace    string
+}
+
+// cliVault is shared by the encrypt, decrypt and rewrap commands
+var cliVault vaultOverrides
+
+// addVaultFlags adds the Vault connection flags to a one-off command
+func addVaultFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&cliVault.address, "vault-addr", "", "Vault or Vault Agent address - overrides VAULT_ADDR and config")
+	cmd.Flags().StringVar(&cliVault.transitMount, "transit-mount", "", "Transit engine mount path - overrides config")
+	cmd.Flags().StringVar(&cliVault.keyName, "key-name", "", "Transit key name - overrides config")
+	cmd.Flags().StringVar(&cliVault.namespace, "namespace", "", "Vault Enterprise namespace - overrides VAULT_NAMESPACE and config")
+}
+
+// loadCLIConfig loads the configuration for a one-off command and applies
+// the Vault overrides: flags first, then VAULT_ADDR and VAULT_NAMESPACE, then
+// the configuration file. Without a configuration file defaults are used.
+func loadCLIConfig() (*config.Config, error) {
+	var cfg *config.Config
+
+	if _, err := os.Stat(configFile); configFile == defaultConfigFile && errors.Is(err, os.ErrNotExist) {
+		cfg = &config.Config{}
+		if err := cfg.SetDefaults(); err != nil {
+			return nil, fmt.Errorf("failed to set defaults: %w", err)
+		}
+	} else {
+		loaded, err := config.Load(configFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load configuration: %w", err)
+		}
+		cfg = loaded
+	}
+
+	cliVault.apply(&cfg.Vault)
+
+	if cfg.Vault.AgentAddress == "" || cfg.Vault.TransitMount == "" || cfg.Vault.KeyName == "" {
+		return nil, fmt.Errorf("vault configuration is incomplete: set agent_address, transit_mount and key_name in %s "+
+			"or use --vault-addr (or VAULT_ADDR), --transit-mount and --key-name", configFile)
+	}
+
+	return cfg, nil
+}
+
+// apply overrides the vault block with the flags and environment
+func (o vaultOverrides) apply(v *config.VaultConfig) {
+	v.AgentAddress = firstNonEmpty(o.address, os.Getenv("VAULT_ADDR"), v.AgentAddress)
+	v.TransitMount = firstNonEmpty(o.transitMount, v.TransitMount)
+	v.KeyName = firstNonEmpty(o.keyName, v.KeyName)
+	v.Namespace = firstNonEmpty(o.namespace, os.Getenv("VAULT_NAMESPACE"), v.Namespace)
+}
+
+// newVaultClient creates the Vault client of a one-off command, logging in
+// with the auth block if one is configured
+func newVaultClient(cfg *config.Config) (*vault.Client, error) {
+	client, err := vault.NewClientFromConfig(&cfg.Vault)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault client: %w", err)
+	}
+	return client, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setCLIState sets the --config value and Vault flags for one test
+func setCLIState(t *testing.T, file string, overrides vaultOverrides) {
+	t.Helper()
+
+	prevFile, prevVault := configFile, cliVault
+	t.Cleanup(func() {
+		configFile, cliVault = prevFile, prevVault
+	})
+
+	configFile, cliVault = file, overrides
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_NAMESPACE", "")
+}
+
+// TestLoadCLIConfig_WithoutConfigFile tests one-off use with flags only
+func TestLoadCLIConfig_WithoutConfigFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	setCLIState(t, defaultConfigFile, vaultOverrides{
+		address:      "http://127.0.0.1:8200",
+		transitMount: "transit",
+		keyName:      "my-key",
+		namespace:    "team-a",
+	})
+
+	cfg, err := loadCLIConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if cfg.Vault.AgentAddress != "http://127.0.0.1:8200" || cfg.Vault.TransitMount != "transit" ||
+		cfg.Vault.KeyName != "my-key" || cfg.Vault.Namespace != "team-a" {
+		t.Errorf("Unexpected vault config: %+v", cfg.Vault)
+	}
+	if cfg.Encryption.ChunkSize == 0 || cfg.Encryption.Format == "" {
+		t.Errorf("Expected encryption defaults, got: %+v", cfg.Encryption)
+	}
+}
+
+// TestLoadCLIConfig_Incomplete tests the error when Vault settings are missing
+func TestLoadCLIConfig_Incomplete(t *testing.T) {
+	t.Chdir(t.TempDir())
+	setCLIState(t, defaultConfigFile, vaultOverrides{transitMount: "transit"})
+
+	_, err := loadCLIConfig()
+	if err == nil || !strings.Contains(err.Error(), "vault configuration is incomplete") {
+		t.Errorf("Expected incomplete configuration error, got: %v", err)
+	}
+}
+
+// TestLoadCLIConfig_ExplicitMissingFile tests that an explicit --config must exist
+func TestLoadCLIConfig_ExplicitMissingFile(t *testing.T) {
+	setCLIState(t, filepath.Join(t.TempDir(), "missing.hcl"), vaultOverrides{
+		address:      "http://127.0.0.1:8200",
+		transitMount: "transit",
+		keyName:      "my-key",
+	})
+
+	_, err := loadCLIConfig()
+	if err == nil || !strings.Contains(err.Error(), "configuration file not found") {
+		t.Errorf("Expected missing file error, got: %v", err)
+	}
+}
+
+// TestLoadCLIConfig_Precedence tests flags > environment > config file
+func TestLoadCLIConfig_Precedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.hcl")
+	content := `
+vault {
+  agent_address = "http://file:8200"
+  transit_mount = "transit"
+  key_name      = "file-key"
+  namespace     = "file-ns"
+
+  auth {
+    method = "approle"
+    approle {
+      role_id   = "role"
+      secret_id = "secret"
+    }
+  }
+}
+
+encryption {
+  source_dir           = "/tmp/source"
+  dest_dir             = "/tmp/dest"
+  source_file_behavior = "archive"
+}
+
+queue {
+  state_path = "/tmp/queue.json"
+}
+
+logging {}
+`
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	setCLIState(t, file, vaultOverrides{keyName: "flag-key"})
+	t.Setenv("VAULT_ADDR", "http://env:8200")
+	t.Setenv("VAULT_NAMESPACE", "env-ns")
+
+	cfg, err := loadCLIConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if cfg.Vault.AgentAddress != "http://env:8200" {
+		t.Errorf("Expected VAULT_ADDR to override the config file, got: %s", cfg.Vault.AgentAddress)
+	}
+	if cfg.Vault.Namespace != "env-ns" {
+		t.Errorf("Expected VAULT_NAMESPACE to override the config file, got: %s", cfg.Vault.Namespace)
+	}
+	if cfg.Vault.TransitMount != "transit" {
+		t.Errorf("Expected transit mount from the config file, got: %s", cfg.Vault.TransitMount)
+	}
+	if cfg.Vault.KeyName != "flag-key" {
+		t.Errorf("Expected --key-name to override the config file, got: %s", cfg.Vault.KeyName)
+	}
+	if cfg.Vault.Auth == nil || cfg.Vault.Auth.Method != "approle" {
+		t.Errorf("Expected auth block from the config file, got: %+v", cfg.Vault.Auth)
+	}
+
+	cliVault.address = "http://flag:8200"
+	cfg, err = loadCLIConfig()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if cfg.Vault.AgentAddress != "http://flag:8200" {
+		t.Errorf("Expected --vault-addr to override VAULT_ADDR, got: %s", cfg.Vault.AgentAddress)
+	}
+}
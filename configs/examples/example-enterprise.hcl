@@ -68,7 +68,8 @@ queue {
   # Maximum retry delay (default: 5m)
   max_delay = "5m"
   
-  # File stability duration - wait time before processing (default: 1s)
+  # File stability duration - a file is processed once it has not changed for
+  # this long, or on Linux as soon as its writer closes it (default: 1s)
   stability_duration = "1s"
 }
 
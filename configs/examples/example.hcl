@@ -14,6 +14,18 @@ vault {
   
   # Request timeout (optional, default: 30s)
   request_timeout = "30s"
+
+  # Vault Enterprise namespace (optional, default: VAULT_NAMESPACE)
+  # namespace = "admin/team-a"
+
+  # TLS settings for an https:// agent_address (optional)
+  # tls {
+  #   ca_cert         = "/etc/file-encryptor/ca.crt"
+  #   client_cert     = "/etc/file-encryptor/client.crt"
+  #   client_key      = "/etc/file-encryptor/client.key"
+  #   tls_server_name = "vault.example.com"
+  #   tls_skip_verify = false
+  # }
 }
 
 encryption {
@@ -34,8 +46,67 @@ encryption {
   # Examples: "512KB", "2MB", "5MB"
   chunk_size = "1MB"
   
+  # Output format (optional, default: "split")
+  # "split":     data.txt.enc + data.txt.key (+ data.txt.sha256)
+  # "container": single self-describing data.txt.enc that embeds the
+  #              wrapped data key and checksum in its header
+  # format = "container"
+  
+  # Write data.txt.enc.done once all outputs of a file are in place
+  # (optional, default: false)
+  # done_marker = true
+  
   # Optional: File pattern to match (glob pattern)
   # file_pattern = "*.txt"
+  
+  # Optional: Include/exclude glob patterns ("**" matches any depth).
+  # Patterns without a "/" match the file name; others match the path
+  # relative to source_dir. Exclusions win over inclusions.
+  # include = ["*.csv", "reports/**/*.xlsx"]
+  # exclude = ["*.tmp", "*.part", "~$*", ".*"]
+  
+  # Watch subdirectories too (optional, default: false)
+  # New subdirectories are picked up automatically and the relative path
+  # is reproduced under dest_dir. archive/, failed/ and dlq/ are excluded.
+  # recursive = true
+  
+  # Queue a file only once a marker file appears next to it, instead of
+  # waiting for its size to stop changing (optional, default: "stability").
+  # The marker (data.txt.ready or data.txt.done) is removed once the file
+  # is queued; files and markers waiting longer than marker_timeout are logged.
+  # trigger        = "marker"
+  # marker_suffix  = ".ok" # default: .ready or .done
+  # marker_timeout = "1h"  # default: 1h
+
+  # List source_dir every poll_interval instead of relying on file system
+  # events, for NFS, SMB and FUSE mounts written by other hosts
+  # (optional, default: "events"; "hybrid" uses both)
+  # watch_mode    = "poll"
+  # poll_interval = "10s" # default: 10s, minimum: 1s
+  
+  # Encrypt a directory as one tar archive once a marker named after it
+  # appears (reports.ready next to reports/) (optional, default: false)
+  # Not compatible with recursive or source_file_behavior = "keep".
+  # archive_directories = true
+  # archive_compression = "gzip" # "none" (default) or "gzip"
+
+  # Upload to an S3-compatible bucket instead of dest_dir (optional)
+  # Remove dest_dir when a destination is set.
+  # destination "s3" {
+  #   endpoint    = "http://127.0.0.1:9000" # optional, AWS S3 by default
+  #   bucket      = "encrypted"
+  #   prefix      = "reports/"
+  #   region      = "us-east-1"
+  #   path_style  = true
+  #   key_storage = "object" # "object" (default) or "metadata"
+  #   part_size   = "8MiB"
+  #
+  #   # Falls back to the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY variables
+  #   credentials {
+  #     access_key_id     = "minioadmin"
+  #     secret_access_key = "minioadmin"
+  #   }
+  # }
 }
 
 # Decryption configuration (optional)
@@ -52,12 +123,63 @@ decryption {
   # What to do with source files after decryption: "archive", "delete", or "keep"
   source_file_behavior = "archive"
   
-  # Verify SHA256 checksum after decryption (optional, default: false)
+  # Verify SHA256 checksum after decryption (optional, default: false).
+  # Files that fail are moved to the quarantine directory, never to dest_dir
   verify_checksum = true
+
+  # Where files failing verification go (optional, default: <dest_dir>-quarantine)
+  # quarantine_dir = "/data/decrypted-quarantine"
+  
+  # Write data.txt.done once a decrypted file is in place (optional, default: false)
+  # done_marker = true
+  
+  # Watch subdirectories too and mirror them under dest_dir (optional, default: false)
+  # recursive = true
+  
+  # Queue data.txt.enc only once data.txt.enc.ready or .done appears
+  # (optional, default: "stability"); see the encryption block
+  # trigger = "marker"
+
+  # Poll a network mount instead of relying on file system events
+  # (optional, default: "events"); see the encryption block
+  # watch_mode = "poll"
+  
+  # Optional: Include/exclude glob patterns, matched against the .enc file
+  # include = ["**/*.csv.enc"]
+  # exclude = ["tmp/**"]
 }
 
+# Optional: named encryption/decryption blocks route their own directories
+# to a different transit key (key_name/transit_mount default to the vault
+# block). The unlabelled blocks above are the "default" rule.
+# encryption "finance" {
+#   source_dir           = "/data/finance/in"
+#   dest_dir             = "/data/finance/encrypted"
+#   source_file_behavior = "archive"
+#   key_name             = "finance"
+# }
+#
+# decryption "finance" {
+#   source_dir           = "/data/finance/encrypted"
+#   dest_dir             = "/data/finance/out"
+#   source_file_behavior = "archive"
+#   key_name             = "finance"
+# }
+
+# Optional: serve Prometheus metrics at http://<listen>/metrics and
+# liveness/readiness probes at /healthz and /readyz
+# telemetry {
+#   listen                    = "127.0.0.1:9102"
+#   health_check_interval     = "30s"
+#   vault_unreachable_timeout = "2m"
+#   admin                     = false # queue admin API used by "file-encryptor queue"
+#   admin_listen              = "127.0.0.1:9103" # admin API listener (default)
+#   admin_token               = "" # bearer token, required unless admin_listen is loopback
+# }
+
 queue {
-  # Path to save queue state for persistence
+  # Queue journal; every queue change is written here (a JSON state file from
+  # earlier versions is migrated on first start)
   state_path = "/var/lib/file-encryptor/queue-state.json"
   
   # Maximum retry attempts (-1 for infinite, default: 3)
@@ -69,8 +191,32 @@ queue {
   # Maximum retry delay (default: 5m)
   max_delay = "5m"
   
-  # File stability duration - wait time before processing (default: 1s)
+  # File stability duration - a file is processed once it has not changed for
+  # this long, or on Linux as soon as its writer closes it (default: 1s)
+  # Not used by blocks with trigger = "marker"
   stability_duration = "1s"
+  
+  # Number of files processed concurrently (default: 1)
+  # Can be changed at runtime with SIGHUP
+  workers = 4
+
+  # Ledger of processed files for source_file_behavior = "keep"
+  # (default: ledger.json next to state_path)
+  # ledger_path = "/var/lib/file-encryptor/ledger.json"
+
+  # Compare SHA256 of kept files that were touched but may be unchanged (default: false)
+  # ledger_hash = true
+
+  # Hook deliveries not made yet (default: hooks-outbox.json next to state_path)
+  # hook_outbox_path = "/var/lib/file-encryptor/hooks-outbox.json"
+
+  # Rescan source directories for files whose events were missed
+  # (default: 5m, "0" disables)
+  # reconcile_interval = "5m"
+
+  # Report files unprocessed in a source, failed or dlq directory for
+  # longer than this (default: 1h)
+  # stuck_after = "1h"
 }
 
 logging {
@@ -90,3 +236,18 @@ logging {
   audit_path = "/var/log/file-encryptor/audit.log"
 }
 
+
+# Hooks run when items are processed (optional, repeatable)
+# Events: "completed", "failed" (will be retried) and "dlq"
+# hook "notify" {
+#   command    = ["/usr/local/bin/notify-ops", "--channel", "files"]
+#   operations = ["encrypt"]       # default: both operations
+#   events     = ["failed", "dlq"] # default: all events
+# }
+#
+# hook "siem" {
+#   url         = "https://siem.example.com/file-encryptor"
+#   secret      = "change-me" # signs X-File-Encryptor-Signature
+#   timeout     = "10s"
+#   max_retries = 5
+# }
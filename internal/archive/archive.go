@@ -0,0 +1,304 @@
+package archive
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Compression methods of an archive
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+)
+
+// gzipMagic starts every gzip stream; Extract uses it to detect compression
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Extension returns the file extension of an archive, without the leading dot
+func Extension(compression string) string {
+	if compression == CompressionGzip {
+		return "tar.gz"
+	}
+	return "tar"
+}
+
+// ValidateCompression checks a compression method ("" means none)
+func ValidateCompression(compression string) error {
+	switch compression {
+	case "", CompressionNone, CompressionGzip:
+		return nil
+	default:
+		return fmt.Errorf("compression must be one of: %s, %s", CompressionNone, CompressionGzip)
+	}
+}
+
+// Write writes dir as a tar archive to w. Entries are named after the base
+// name of dir, like "tar c dir" does, and keep their permissions and
+// modification times. Symbolic links and special files are skipped.
+func Write(ctx context.Context, w io.Writer, dir, compression string) error {
+	if err := ValidateCompression(compression); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to access directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory: %s", dir)
+	}
+
+	var gz *gzip.Writer
+	if compression == CompressionGzip {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+
+	root := filepath.Base(filepath.Clean(dir))
+	err = filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		return writeEntry(tw, filePath, path.Join(root, filepath.ToSlash(rel)))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive directory: %w", err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("failed to finish compression: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// writeEntry adds one directory or regular file to the archive
+func writeEntry(tw *tar.Writer, filePath, name string) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	// Owner names depend on the machine; numeric IDs are enough
+	header.Uname, header.Gname = "", ""
+
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+
+	f, err := os.Open(filePath) // #nosec G304 - walking the directory being archived
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := io.Copy(tw, f); err != nil {
+		return fmt.Errorf("failed to archive %s: %w", filePath, err)
+	}
+	return nil
+}
+
+// Reader returns the archive of dir as a stream, written by a goroutine.
+// Closing the reader early stops the archiving.
+func Reader(ctx context.Context, dir, compression string) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(Write(ctx, pw, dir, compression))
+	}()
+	return pr
+}
+
+// Size returns the total size of the regular files in dir
+func Size(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure directory: %w", err)
+	}
+	return size, nil
+}
+
+// Extract restores a tar archive, compressed or not, into dest. Entries must
+// be directories or regular files inside dest; existing files are not
+// overwritten. Permissions (without setuid, setgid and sticky bits) and
+// modification times are restored.
+func Extract(ctx context.Context, r io.Reader, dest string) error {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(len(gzipMagic)); err == nil && bytes.Equal(magic, gzipMagic) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("failed to read compressed archive: %w", err)
+		}
+		defer func() { _ = gz.Close() }()
+		r = gz
+	} else {
+		r = br
+	}
+
+	if err := os.MkdirAll(dest, 0750); err != nil { // #nosec G301 - extraction directory
+		return fmt.Errorf("failed to create extraction directory: %w", err)
+	}
+
+	// Directory modes and times are set last, as creating their files needs
+	// write permission and changes their times
+	type dirAttrs struct {
+		path    string
+		mode    os.FileMode
+		modTime time.Time
+	}
+	var dirs []dirAttrs
+
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		target, err := entryPath(dest, header.Name)
+		if err != nil {
+			return err
+		}
+		mode := os.FileMode(header.Mode).Perm() // #nosec G115 - tar modes fit in FileMode
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0750); err != nil { // #nosec G301 - restored below
+				return fmt.Errorf("failed to create directory: %w", err)
+			}
+			if err := os.Chmod(target, mode|0700); err != nil {
+				return fmt.Errorf("failed to set directory permissions: %w", err)
+			}
+			dirs = append(dirs, dirAttrs{path: target, mode: mode, modTime: header.ModTime})
+
+		case tar.TypeReg:
+			if err := extractFile(tr, target, mode); err != nil {
+				return err
+			}
+			if err := os.Chtimes(target, header.ModTime, header.ModTime); err != nil {
+				return fmt.Errorf("failed to set modification time: %w", err)
+			}
+
+		default:
+			return fmt.Errorf("unsupported archive entry %s (type %c)", header.Name, header.Typeflag)
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i].path, dirs[i].mode); err != nil {
+			return fmt.Errorf("failed to set directory permissions: %w", err)
+		}
+		if err := os.Chtimes(dirs[i].path, dirs[i].modTime, dirs[i].modTime); err != nil {
+			return fmt.Errorf("failed to set modification time: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// extractFile writes one regular file, refusing to replace an existing one
+func extractFile(r io.Reader, target string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0750); err != nil { // #nosec G301 - mirrors archive layout
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode) // #nosec G304 - path checked by entryPath
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	if _, err := io.Copy(f, r); err != nil { // #nosec G110 - size bounded by the archive
+		_ = f.Close()
+		return fmt.Errorf("failed to extract %s: %w", target, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", target, err)
+	}
+
+	// The umask may have dropped bits of mode
+	return os.Chmod(target, mode)
+}
+
+// entryPath returns where an archive entry is extracted, rejecting absolute
+// names and names that leave dest, directly or through a symbolic link
+func entryPath(dest, name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if clean == "." || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || filepath.VolumeName(clean) != "" {
+		return "", fmt.Errorf("unsafe path in archive: %s", name)
+	}
+
+	// A symbolic link already in dest could lead outside of it
+	target := dest
+	for _, part := range strings.Split(clean, "/") {
+		target = filepath.Join(target, part)
+		info, err := os.Lstat(target)
+		if err != nil {
+			break
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("archive entry %s would be extracted through a symbolic link", name)
+		}
+	}
+
+	return filepath.Join(dest, filepath.FromSlash(clean)), nil
+}
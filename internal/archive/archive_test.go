@@ -0,0 +1,179 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteExtract_RoundTrip(t *testing.T) {
+	for _, compression := range []string{CompressionNone, CompressionGzip} {
+		t.Run(compression, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "project")
+			require.NoError(t, os.MkdirAll(filepath.Join(src, "docs", "empty"), 0750))
+			require.NoError(t, os.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh\n"), 0750))
+			require.NoError(t, os.WriteFile(filepath.Join(src, "docs", "a.txt"), []byte("alpha"), 0600))
+
+			modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+			require.NoError(t, os.Chtimes(filepath.Join(src, "docs", "a.txt"), modTime, modTime))
+			require.NoError(t, os.Chtimes(filepath.Join(src, "docs"), modTime, modTime))
+
+			var buf bytes.Buffer
+			require.NoError(t, Write(context.Background(), &buf, src, compression))
+
+			dest := t.TempDir()
+			require.NoError(t, Extract(context.Background(), &buf, dest))
+
+			data, err := os.ReadFile(filepath.Join(dest, "project", "docs", "a.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, "alpha", string(data))
+			assert.DirExists(t, filepath.Join(dest, "project", "docs", "empty"))
+
+			info, err := os.Stat(filepath.Join(dest, "project", "docs", "a.txt"))
+			require.NoError(t, err)
+			assert.True(t, info.ModTime().Equal(modTime))
+
+			info, err = os.Stat(filepath.Join(dest, "project", "docs"))
+			require.NoError(t, err)
+			assert.True(t, info.ModTime().Equal(modTime))
+
+			if runtime.GOOS != "windows" {
+				info, err = os.Stat(filepath.Join(dest, "project", "run.sh"))
+				require.NoError(t, err)
+				assert.Equal(t, os.FileMode(0750), info.Mode().Perm())
+			}
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("alpha"), 0600))
+
+	r := Reader(context.Background(), src, CompressionGzip)
+	defer func() { _ = r.Close() }()
+
+	dest := t.TempDir()
+	require.NoError(t, Extract(context.Background(), r, dest))
+	assert.FileExists(t, filepath.Join(dest, filepath.Base(src), "a.txt"))
+
+	size, err := Size(src)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), size)
+}
+
+func TestExtract_RejectsUnsafeEntries(t *testing.T) {
+	tests := []struct {
+		name   string
+		header tar.Header
+	}{
+		{"parent directory", tar.Header{Name: "../evil.txt", Typeflag: tar.TypeReg, Mode: 0600}},
+		{"nested parent directory", tar.Header{Name: "a/../../evil.txt", Typeflag: tar.TypeReg, Mode: 0600}},
+		{"absolute path", tar.Header{Name: "/tmp/evil.txt", Typeflag: tar.TypeReg, Mode: 0600}},
+		{"symbolic link", tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			require.NoError(t, tw.WriteHeader(&tt.header))
+			require.NoError(t, tw.Close())
+
+			root := t.TempDir()
+			dest := filepath.Join(root, "dest")
+			assert.Error(t, Extract(context.Background(), &buf, dest))
+			assert.NoFileExists(t, filepath.Join(root, "evil.txt"))
+		})
+	}
+}
+
+func TestExtract_RejectsSymlinkInDestination(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need privileges on Windows")
+	}
+
+	outside := t.TempDir()
+	dest := t.TempDir()
+	require.NoError(t, os.Symlink(outside, filepath.Join(dest, "project")))
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "project/a.txt", Typeflag: tar.TypeReg, Mode: 0600, Size: 1}))
+	_, err := tw.Write([]byte("a"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	assert.ErrorContains(t, Extract(context.Background(), &buf, dest), "symbolic link")
+	assert.NoFileExists(t, filepath.Join(outside, "a.txt"))
+}
+
+func TestExtract_ReadOnlyDirectories(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directory permissions are not enforced on Windows")
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "project/", Typeflag: tar.TypeDir, Mode: 0555}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "project/private/", Typeflag: tar.TypeDir, Mode: 0500}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "project/private/a.txt", Typeflag: tar.TypeReg, Mode: 0400, Size: 1}))
+	_, err := tw.Write([]byte("a"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	dest := t.TempDir()
+	t.Cleanup(func() {
+		// Let t.TempDir remove the extracted tree
+		_ = os.Chmod(filepath.Join(dest, "project"), 0700)
+		_ = os.Chmod(filepath.Join(dest, "project", "private"), 0700)
+	})
+	require.NoError(t, Extract(context.Background(), &buf, dest))
+
+	data, err := os.ReadFile(filepath.Join(dest, "project", "private", "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(data))
+
+	info, err := os.Stat(filepath.Join(dest, "project"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0555), info.Mode().Perm())
+
+	info, err = os.Stat(filepath.Join(dest, "project", "private"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0500), info.Mode().Perm())
+}
+
+func TestExtract_DoesNotOverwrite(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "project")
+	require.NoError(t, os.MkdirAll(src, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.txt"), []byte("new"), 0600))
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(context.Background(), &buf, src, CompressionNone))
+
+	dest := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dest, "project"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "project", "a.txt"), []byte("old"), 0600))
+
+	assert.Error(t, Extract(context.Background(), &buf, dest))
+
+	data, err := os.ReadFile(filepath.Join(dest, "project", "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(data))
+}
+
+func TestValidateCompression(t *testing.T) {
+	assert.NoError(t, ValidateCompression(""))
+	assert.NoError(t, ValidateCompression(CompressionGzip))
+	assert.Error(t, ValidateCompression("zstd"))
+	assert.Equal(t, "tar.gz", Extension(CompressionGzip))
+	assert.Equal(t, "tar", Extension(CompressionNone))
+}
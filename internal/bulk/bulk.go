@@ -0,0 +1,244 @@
+package bulk
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/watcher"
+)
+
+// Options configures a bulk encryption or decryption of a directory tree
+type Options struct {
+	Operation model.OperationType
+	SourceDir string
+	DestDir   string
+	Recursive bool     // Descend into subdirectories, mirroring them under DestDir
+	Parallel  int      // Number of files processed at once (default 1)
+	Include   []string // Glob patterns, as for the encryption and decryption blocks
+	Exclude   []string
+
+	// Strategy encrypts or decrypts one file, as in the watch service
+	Strategy watcher.ProcessStrategy
+	Logger   logger.Logger
+}
+
+// Runner processes every matching file of a directory tree with one
+// strategy, and so with one Vault client
+type Runner struct {
+	options Options
+	filter  *watcher.FileFilter
+}
+
+// NewRunner validates the options and creates a runner
+func NewRunner(options Options) (*Runner, error) {
+	if options.Operation != model.OperationEncrypt && options.Operation != model.OperationDecrypt {
+		return nil, fmt.Errorf("invalid operation: %s", options.Operation)
+	}
+	if options.SourceDir == "" || options.DestDir == "" {
+		return nil, fmt.Errorf("source and destination directories are required")
+	}
+	if options.Strategy == nil {
+		return nil, fmt.Errorf("strategy cannot be nil")
+	}
+	if options.Logger == nil {
+		return nil, fmt.Errorf("logger cannot be nil")
+	}
+	if options.Parallel < 1 {
+		options.Parallel = 1
+	}
+
+	info, err := os.Stat(options.SourceDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access source directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("source is not a directory: %s", options.SourceDir)
+	}
+
+	// Writing into the source tree would pick up the output on a later run
+	if within(options.DestDir, options.SourceDir) && options.Recursive {
+		return nil, fmt.Errorf("destination directory cannot be inside the source directory in recursive mode")
+	}
+
+	filter, err := watcher.NewFileFilter(options.Include, options.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Runner{options: options, filter: filter}, nil
+}
+
+// Plan lists the files to process as queue items whose paths mirror the
+// source tree under the destination directory. Encrypted files without a
+// key are returned as failed results.
+func (r *Runner) Plan() ([]*model.Item, []*Result, error) {
+	var (
+		items  []*model.Item
+		failed []*Result
+	)
+
+	err := filepath.WalkDir(r.options.SourceDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != r.options.SourceDir && !r.options.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(r.options.SourceDir, path)
+		if err != nil {
+			return err
+		}
+		if !r.wanted(relPath) {
+			return nil
+		}
+
+		item, err := r.newItem(path, relPath)
+		if err != nil {
+			failed = append(failed, &Result{Source: path, Error: err})
+			return nil
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to scan source directory: %w", err)
+	}
+
+	return items, failed, nil
+}
+
+// wanted applies the same suffix rules as the watcher, then the filter
+func (r *Runner) wanted(relPath string) bool {
+	if r.options.Operation == model.OperationEncrypt {
+		if strings.HasSuffix(relPath, ".enc") || strings.HasSuffix(relPath, ".key") || strings.HasSuffix(relPath, ".sha256") {
+			return false
+		}
+	} else if !strings.HasSuffix(relPath, ".enc") {
+		return false
+	}
+
+	ok, rule := r.filter.Match(relPath)
+	if !ok {
+		r.options.Logger.Debug("Skipping filtered file", "file", relPath, "rule", rule)
+	}
+	return ok
+}
+
+// newItem builds the item of one file, named like the watch service names
+// its output: <name>.enc and <name>.key, or <name> without .enc
+func (r *Runner) newItem(path, relPath string) (*model.Item, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	destPath := filepath.Join(r.options.DestDir, relPath)
+	item := model.NewItem(r.options.Operation, path, destPath)
+	item.FileSize = info.Size()
+
+	if r.options.Operation == model.OperationEncrypt {
+		item.DestPath = destPath + ".enc"
+		item.KeyPath = destPath + ".key"
+		return item, nil
+	}
+
+	item.DestPath = strings.TrimSuffix(destPath, ".enc")
+
+	// Self-describing containers carry their key; otherwise use the sibling .key
+	if isContainer, err := crypto.IsContainer(path); err == nil && isContainer {
+		return item, nil
+	}
+	keyPath := strings.TrimSuffix(path, ".enc") + ".key"
+	if _, err := os.Stat(keyPath); err != nil {
+		return nil, fmt.Errorf("key file not found: %s", keyPath)
+	}
+	item.KeyPath = keyPath
+
+	return item, nil
+}
+
+// Run processes the items with up to Parallel workers and returns one result
+// per item, in the order of the items. A cancelled context stops the files
+// not yet started, which are reported as failed.
+func (r *Runner) Run(ctx context.Context, items []*model.Item) []*Result {
+	results := make([]*Result, len(items))
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < r.options.Parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = r.process(ctx, items[i])
+			}
+		}()
+	}
+
+	for i := range items {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return results
+}
+
+// process runs the strategy on one item
+func (r *Runner) process(ctx context.Context, item *model.Item) *Result {
+	result := &Result{
+		Source: item.SourcePath,
+		Dest:   item.DestPath,
+		Key:    item.KeyPath,
+		Size:   item.FileSize,
+	}
+
+	if err := ctx.Err(); err != nil {
+		result.Error = err
+		return result
+	}
+
+	start := time.Now()
+	err := r.options.Strategy.Process(ctx, item)
+	result.Duration = time.Since(start)
+
+	if err != nil {
+		result.Error = err
+		r.options.Logger.Error("Failed to process file", "operation", item.Operation, "file", item.SourcePath, "error", err)
+		return result
+	}
+
+	// Containers have no key file
+	result.Key = item.KeyPath
+	result.Checksum = item.Checksum
+	r.options.Logger.Info("File processed", "operation", item.Operation, "file", item.SourcePath, "dest", item.DestPath)
+
+	return result
+}
+
+// within reports whether path is dir or inside it
+func within(path, dir string) bool {
+	absPath, err1 := filepath.Abs(path)
+	absDir, err2 := filepath.Abs(dir)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
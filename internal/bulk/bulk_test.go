@@ -0,0 +1,200 @@
+package bulk
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/vault"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/watcher"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockVaultClient returns a fixed data key
+type mockVaultClient struct{}
+
+func (m *mockVaultClient) GenerateDataKey() (*vault.DataKey, error) {
+	return &vault.DataKey{
+		Plaintext:  []byte("abcdefghijklmnopqrstuvwxyz123456"),
+		Ciphertext: "vault:v1:mock-encrypted-dek",
+		KeyVersion: 1,
+	}, nil
+}
+
+func (m *mockVaultClient) DecryptDataKey(ciphertext string) (*vault.DataKey, error) {
+	return &vault.DataKey{
+		Plaintext:  []byte("abcdefghijklmnopqrstuvwxyz123456"),
+		Ciphertext: ciphertext,
+		KeyVersion: 1,
+	}, nil
+}
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0750))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+}
+
+func newTestRunner(t *testing.T, opts Options, format string) *Runner {
+	t.Helper()
+
+	log, err := logger.New("error", os.DevNull)
+	require.NoError(t, err)
+
+	client := &mockVaultClient{}
+	if opts.Operation == model.OperationEncrypt {
+		opts.Strategy = watcher.NewEncryptStrategy(crypto.NewEncryptor(client, nil), log, true, format, watcher.PublishOptions{})
+	} else {
+		opts.Strategy = watcher.NewDecryptStrategy(crypto.NewDecryptor(client, nil), log, true, watcher.PublishOptions{})
+	}
+	opts.Logger = log
+
+	runner, err := NewRunner(opts)
+	require.NoError(t, err)
+	return runner
+}
+
+func TestRunner_RoundTrip(t *testing.T) {
+	for _, format := range []string{config.FormatSplit, config.FormatContainer} {
+		t.Run(format, func(t *testing.T) {
+			src, enc, dec := t.TempDir(), t.TempDir(), t.TempDir()
+			files := map[string]string{
+				"a.txt":           "alpha",
+				"reports/b.csv":   "bravo",
+				"reports/x/c.csv": "charlie",
+			}
+			writeTree(t, src, files)
+			writeTree(t, src, map[string]string{"skip.swp": "swap"})
+
+			encRunner := newTestRunner(t, Options{
+				Operation: model.OperationEncrypt,
+				SourceDir: src,
+				DestDir:   enc,
+				Recursive: true,
+				Parallel:  2,
+				Exclude:   []string{"*.swp"},
+			}, format)
+
+			items, failed, err := encRunner.Plan()
+			require.NoError(t, err)
+			assert.Empty(t, failed)
+			require.Len(t, items, len(files))
+
+			results := encRunner.Run(context.Background(), items)
+			for _, result := range results {
+				require.NoError(t, result.Error)
+				assert.NotEmpty(t, result.Checksum)
+			}
+			assert.FileExists(t, filepath.Join(enc, "reports", "x", "c.csv.enc"))
+			if format == config.FormatSplit {
+				assert.Equal(t, filepath.Join(enc, "a.txt.key"), results[0].Key)
+			} else {
+				assert.Empty(t, results[0].Key)
+			}
+
+			decRunner := newTestRunner(t, Options{
+				Operation: model.OperationDecrypt,
+				SourceDir: enc,
+				DestDir:   dec,
+				Recursive: true,
+				Parallel:  3,
+			}, format)
+
+			items, failed, err = decRunner.Plan()
+			require.NoError(t, err)
+			assert.Empty(t, failed)
+
+			for _, result := range decRunner.Run(context.Background(), items) {
+				require.NoError(t, result.Error)
+			}
+			for name, content := range files {
+				data, err := os.ReadFile(filepath.Join(dec, filepath.FromSlash(name)))
+				require.NoError(t, err)
+				assert.Equal(t, content, string(data))
+			}
+		})
+	}
+}
+
+func TestRunner_PlanNonRecursive(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt": "a", "sub/b.txt": "b", "a.txt.key": "k"})
+
+	runner := newTestRunner(t, Options{
+		Operation: model.OperationEncrypt,
+		SourceDir: src,
+		DestDir:   t.TempDir(),
+	}, config.FormatSplit)
+
+	items, _, err := runner.Plan()
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, filepath.Join(src, "a.txt"), items[0].SourcePath)
+}
+
+func TestRunner_PlanMissingKey(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt.enc": "not a container"})
+
+	runner := newTestRunner(t, Options{
+		Operation: model.OperationDecrypt,
+		SourceDir: src,
+		DestDir:   t.TempDir(),
+	}, config.FormatSplit)
+
+	items, failed, err := runner.Plan()
+	require.NoError(t, err)
+	assert.Empty(t, items)
+	require.Len(t, failed, 1)
+	assert.ErrorContains(t, failed[0].Error, "key file not found")
+}
+
+func TestRunner_CancelledContext(t *testing.T) {
+	src := t.TempDir()
+	writeTree(t, src, map[string]string{"a.txt": "a"})
+
+	runner := newTestRunner(t, Options{
+		Operation: model.OperationEncrypt,
+		SourceDir: src,
+		DestDir:   t.TempDir(),
+	}, config.FormatSplit)
+
+	items, _, err := runner.Plan()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	results := runner.Run(ctx, items)
+	require.Len(t, results, 1)
+	assert.True(t, errors.Is(results[0].Error, context.Canceled))
+}
+
+func TestNewRunner_Validation(t *testing.T) {
+	src := t.TempDir()
+	log, err := logger.New("error", os.DevNull)
+	require.NoError(t, err)
+	strategy := watcher.NewEncryptStrategy(crypto.NewEncryptor(&mockVaultClient{}, nil), log, false, config.FormatSplit, watcher.PublishOptions{})
+
+	_, err = NewRunner(Options{Operation: model.OperationEncrypt, SourceDir: src, DestDir: filepath.Join(src, "out"),
+		Recursive: true, Strategy: strategy, Logger: log})
+	assert.ErrorContains(t, err, "inside the source directory")
+
+	_, err = NewRunner(Options{Operation: model.OperationEncrypt, SourceDir: filepath.Join(src, "missing"), DestDir: t.TempDir(),
+		Strategy: strategy, Logger: log})
+	assert.Error(t, err)
+
+	_, err = NewRunner(Options{Operation: model.OperationEncrypt, SourceDir: src, DestDir: t.TempDir(),
+		Include: []string{"[invalid"}, Strategy: strategy, Logger: log})
+	assert.ErrorContains(t, err, "invalid glob pattern")
+}
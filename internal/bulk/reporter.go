@@ -0,0 +1,191 @@
+package bulk
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Result is the outcome of processing one file
+type Result struct {
+	Source   string        // Source file
+	Dest     string        // Encrypted or decrypted file
+	Key      string        // Key file written or used ("" for containers)
+	Size     int64         // Size of the source file in bytes
+	Checksum string        // SHA256 of the plaintext, when calculated
+	Duration time.Duration // Processing time
+	Error    error         // Error if processing failed
+}
+
+// MarshalJSON renders the error as a string and the duration in seconds
+func (r *Result) MarshalJSON() ([]byte, error) {
+	errorMsg := ""
+	if r.Error != nil {
+		errorMsg = r.Error.Error()
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"source":           r.Source,
+		"dest":             r.Dest,
+		"key":              r.Key,
+		"size":             r.Size,
+		"checksum":         r.Checksum,
+		"duration_seconds": r.Duration.Seconds(),
+		"error":            errorMsg,
+	})
+}
+
+// Statistics contains aggregated bulk operation statistics
+type Statistics struct {
+	Operation  string    `json:"operation"`
+	TotalFiles int       `json:"total_files"`
+	Successful int       `json:"successful"`
+	Failed     int       `json:"failed"`
+	TotalBytes int64     `json:"total_bytes"` // Size of the files processed successfully
+	Results    []*Result `json:"results,omitempty"`
+}
+
+// Reporter generates statistics and reports from bulk results
+type Reporter struct {
+	stats *Statistics
+}
+
+// NewReporter creates a reporter for the given operation
+func NewReporter(operation string) *Reporter {
+	return &Reporter{
+		stats: &Statistics{
+			Operation: operation,
+			Results:   make([]*Result, 0),
+		},
+	}
+}
+
+// AddResult updates the statistics with a result
+func (r *Reporter) AddResult(result *Result) {
+	r.stats.TotalFiles++
+	r.stats.Results = append(r.stats.Results, result)
+
+	if result.Error != nil {
+		r.stats.Failed++
+		return
+	}
+	r.stats.Successful++
+	r.stats.TotalBytes += result.Size
+}
+
+// AddResults processes multiple results
+func (r *Reporter) AddResults(results []*Result) {
+	for _, result := range results {
+		r.AddResult(result)
+	}
+}
+
+// GetStatistics returns the current statistics
+func (r *Reporter) GetStatistics() *Statistics {
+	return r.stats
+}
+
+// WriteText outputs the statistics in human-readable text format
+func (r *Reporter) WriteText(w io.Writer, includeDetails bool) error {
+	title := fmt.Sprintf("Bulk %s Statistics", r.stats.Operation)
+	if _, err := fmt.Fprintf(w, "%s\n%s\n\n", title, underline(len(title))); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Total Files:   %d\n", r.stats.TotalFiles); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Successful:    %d\n", r.stats.Successful); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Failed:        %d\n", r.stats.Failed); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Total Bytes:   %d\n\n", r.stats.TotalBytes); err != nil {
+		return err
+	}
+
+	if !includeDetails || len(r.stats.Results) == 0 {
+		return nil
+	}
+
+	if _, err := fmt.Fprintf(w, "Detailed Results:\n-----------------\n"); err != nil {
+		return err
+	}
+	for _, result := range r.stats.Results {
+		status := "SUCCESS"
+		if result.Error != nil {
+			status = fmt.Sprintf("FAILED: %v", result.Error)
+		}
+
+		line := "  " + result.Source
+		if result.Dest != "" {
+			line += " -> " + result.Dest
+		}
+		if _, err := fmt.Fprintf(w, "%s [%s]\n", line, status); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteJSON outputs the statistics in JSON format
+func (r *Reporter) WriteJSON(w io.Writer, includeResults bool) error {
+	stats := r.stats
+	if !includeResults {
+		copied := *r.stats
+		copied.Results = nil
+		stats = &copied
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(stats)
+}
+
+// WriteCSV outputs one row per file in CSV format
+func (r *Reporter) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	header := []string{"Source", "Dest", "Key", "Size", "Checksum", "DurationSeconds", "Status", "Error"}
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for _, result := range r.stats.Results {
+		status := "success"
+		errorMsg := ""
+		if result.Error != nil {
+			status = "failed"
+			errorMsg = result.Error.Error()
+		}
+
+		row := []string{
+			result.Source,
+			result.Dest,
+			result.Key,
+			strconv.FormatInt(result.Size, 10),
+			result.Checksum,
+			strconv.FormatFloat(result.Duration.Seconds(), 'f', 3, 64),
+			status,
+			errorMsg,
+		}
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("failed to write CSV row: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func underline(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = '='
+	}
+	return string(b)
+}
@@ -0,0 +1,83 @@
+package bulk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testResults() []*Result {
+	return []*Result{
+		{Source: "/src/a.txt", Dest: "/dst/a.txt.enc", Key: "/dst/a.txt.key", Size: 10, Duration: time.Second},
+		{Source: "/src/b.txt", Dest: "/dst/b.txt.enc", Size: 5, Error: errors.New("vault error")},
+	}
+}
+
+func TestReporter_Statistics(t *testing.T) {
+	reporter := NewReporter("encrypt")
+	reporter.AddResults(testResults())
+
+	stats := reporter.GetStatistics()
+	assert.Equal(t, 2, stats.TotalFiles)
+	assert.Equal(t, 1, stats.Successful)
+	assert.Equal(t, 1, stats.Failed)
+	assert.Equal(t, int64(10), stats.TotalBytes)
+}
+
+func TestReporter_WriteText(t *testing.T) {
+	reporter := NewReporter("encrypt")
+	reporter.AddResults(testResults())
+
+	var buf bytes.Buffer
+	require.NoError(t, reporter.WriteText(&buf, true))
+
+	output := buf.String()
+	assert.Contains(t, output, "Bulk encrypt Statistics")
+	assert.Contains(t, output, "Failed:        1")
+	assert.Contains(t, output, "/src/a.txt -> /dst/a.txt.enc [SUCCESS]")
+	assert.Contains(t, output, "[FAILED: vault error]")
+}
+
+func TestReporter_WriteJSON(t *testing.T) {
+	reporter := NewReporter("decrypt")
+	reporter.AddResults(testResults())
+
+	var buf bytes.Buffer
+	require.NoError(t, reporter.WriteJSON(&buf, true))
+
+	var decoded struct {
+		Operation string                   `json:"operation"`
+		Failed    int                      `json:"failed"`
+		Results   []map[string]interface{} `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, "decrypt", decoded.Operation)
+	assert.Equal(t, 1, decoded.Failed)
+	require.Len(t, decoded.Results, 2)
+	assert.Equal(t, "vault error", decoded.Results[1]["error"])
+	assert.Equal(t, 1.0, decoded.Results[0]["duration_seconds"])
+
+	buf.Reset()
+	require.NoError(t, reporter.WriteJSON(&buf, false))
+	assert.NotContains(t, buf.String(), "results")
+}
+
+func TestReporter_WriteCSV(t *testing.T) {
+	reporter := NewReporter("encrypt")
+	reporter.AddResults(testResults())
+
+	var buf bytes.Buffer
+	require.NoError(t, reporter.WriteCSV(&buf))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "Source,Dest,Key,Size,Checksum,DurationSeconds,Status,Error", lines[0])
+	assert.Equal(t, "/src/a.txt,/dst/a.txt.enc,/dst/a.txt.key,10,,1.000,success,", lines[1])
+	assert.True(t, strings.HasSuffix(lines[2], ",failed,vault error"))
+}
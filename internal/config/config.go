@@ -2,7 +2,9 @@ package config
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
 	"time"
 )
 
@@ -13,6 +15,13 @@ type Config struct {
 	Decryption *DecryptionConfig `hcl:"decryption,block"`
 	Queue      QueueConfig       `hcl:"queue,block"`
 	Logging    LoggingConfig     `hcl:"logging,block"`
+	Telemetry  *TelemetryConfig  `hcl:"telemetry,block"`
+	Hooks      []HookConfig      `hcl:"hook,block"`
+
+	// Named (labelled) encryption and decryption blocks, e.g.
+	// encryption "finance" { ... }. Populated by the loader.
+	NamedEncryption []EncryptionConfig
+	NamedDecryption []DecryptionConfig
 }
 
 // VaultConfig holds Vault-related configuration
@@ -20,11 +29,23 @@ type VaultConfig struct {
 	AgentAddress      string        `hcl:"agent_address"`
 	TransitMount      string        `hcl:"transit_mount"`
 	KeyName           string        `hcl:"key_name"`
+	Namespace         string        `hcl:"namespace,optional"` // Vault Enterprise namespace
 	RequestTimeoutStr string        `hcl:"request_timeout,optional"`
 	RequestTimeout    time.Duration // Parsed from RequestTimeoutStr
+	TLS               *TLSConfig    `hcl:"tls,block"`
 	Auth              *AuthConfig   `hcl:"auth,block"`
 }
 
+// TLSConfig configures TLS for connections to Vault or a Vault Agent listener
+type TLSConfig struct {
+	CACert        string `hcl:"ca_cert,optional"`     // PEM CA bundle used to verify the server
+	CAPath        string `hcl:"ca_path,optional"`     // Directory of PEM CA certificates
+	ClientCert    string `hcl:"client_cert,optional"` // Client certificate for mutual TLS
+	ClientKey     string `hcl:"client_key,optional"`
+	TLSServerName string `hcl:"tls_server_name,optional"` // SNI and verification name
+	TLSSkipVerify bool   `hcl:"tls_skip_verify,optional"` // Development only
+}
+
 type AuthConfig struct {
 	Method     string                `hcl:"method"` // token, approle, aws, gcp, azure, kubernetes, jwt, cert, agent
 	Token      *TokenAuthConfig      `hcl:"token,block"`
@@ -90,22 +111,121 @@ func (c *AuthConfig) Validate() error {
 
 // EncryptionConfig holds encryption-specific configuration
 type EncryptionConfig struct {
-	SourceDir          string `hcl:"source_dir"`
-	DestDir            string `hcl:"dest_dir"`
-	SourceFileBehavior string `hcl:"source_file_behavior"`
-	CalculateChecksum  bool   `hcl:"calculate_checksum,optional"`
-	FilePattern        string `hcl:"file_pattern,optional"`
-	ChunkSizeStr       string `hcl:"chunk_size,optional"`
-	ChunkSize          int    // Parsed from ChunkSizeStr
+	Name               string   // Block label; empty for the default block
+	TransitMount       string   `hcl:"transit_mount,optional"` // Overrides vault.transit_mount
+	KeyName            string   `hcl:"key_name,optional"`      // Overrides vault.key_name
+	SourceDir          string   `hcl:"source_dir"`
+	DestDir            string   `hcl:"dest_dir,optional"` // Required unless a destination block is set
+	SourceFileBehavior string   `hcl:"source_file_behavior"`
+	CalculateChecksum  bool     `hcl:"calculate_checksum,optional"`
+	FilePattern        string   `hcl:"file_pattern,optional"` // Single include pattern (kept for compatibility)
+	Include            []string `hcl:"include,optional"`
+	Exclude            []string `hcl:"exclude,optional"`
+	Recursive          bool     `hcl:"recursive,optional"`
+	ChunkSizeStr       string   `hcl:"chunk_size,optional"`
+	ChunkSize          int      // Parsed from ChunkSizeStr
+	Format             string   `hcl:"format,optional"`      // "split" (default) or "container"
+	DoneMarker         bool     `hcl:"done_marker,optional"` // Write <file>.done once the outputs are published
+
+	// Trigger "marker" processes a file once <file><marker_suffix> appears
+	Trigger          string        `hcl:"trigger,optional"`        // "stability" (default) or "marker"
+	MarkerSuffix     string        `hcl:"marker_suffix,optional"`  // Default: .ready or .done
+	MarkerTimeoutStr string        `hcl:"marker_timeout,optional"` // Default: 1h
+	MarkerTimeout    time.Duration // Parsed from MarkerTimeoutStr
+
+	// Watch mode "poll" finds files by listing source_dir every poll_interval,
+	// for network mounts whose changes from other hosts raise no events
+	WatchMode       string        `hcl:"watch_mode,optional"`    // "events" (default), "poll" or "hybrid"
+	PollIntervalStr string        `hcl:"poll_interval,optional"` // Default: 10s
+	PollInterval    time.Duration // Parsed from PollIntervalStr
+
+	// Directories marked by a <dir>.ready file are encrypted as one tar archive
+	ArchiveDirectories bool   `hcl:"archive_directories,optional"`
+	ArchiveCompression string `hcl:"archive_compression,optional"` // "none" (default) or "gzip"
+
+	// Destination uploads encrypted files to object storage instead of dest_dir
+	Destination *DestinationConfig `hcl:"destination,block"`
+}
+
+// DestinationConfig describes an S3-compatible bucket that receives the
+// encrypted files of an encryption block, e.g. destination "s3" { ... }
+type DestinationConfig struct {
+	Type        string               `hcl:"type,label"`        // "s3"
+	Endpoint    string               `hcl:"endpoint,optional"` // Default: the AWS endpoint of the region
+	Bucket      string               `hcl:"bucket"`
+	Prefix      string               `hcl:"prefix,optional"`      // Prepended to object names
+	Region      string               `hcl:"region,optional"`      // Default: us-east-1
+	PathStyle   bool                 `hcl:"path_style,optional"`  // endpoint/bucket/key, as MinIO expects
+	KeyStorage  string               `hcl:"key_storage,optional"` // "object" (default) or "metadata"
+	PartSizeStr string               `hcl:"part_size,optional"`
+	PartSize    int                  // Parsed from PartSizeStr
+	Credentials *S3CredentialsConfig `hcl:"credentials,block"`
+}
+
+// S3CredentialsConfig holds static S3 credentials
+type S3CredentialsConfig struct {
+	AccessKeyID     string `hcl:"access_key_id,optional"`     // Env: AWS_ACCESS_KEY_ID
+	SecretAccessKey string `hcl:"secret_access_key,optional"` // Env: AWS_SECRET_ACCESS_KEY
+	SessionToken    string `hcl:"session_token,optional"`     // Env: AWS_SESSION_TOKEN
+}
+
+// setDefaults fills in the region, key storage and part size
+func (d *DestinationConfig) setDefaults() error {
+	if d.Region == "" {
+		d.Region = DefaultS3Region
+	}
+	if d.KeyStorage == "" {
+		d.KeyStorage = KeyStorageObject
+	}
+	if d.PartSizeStr != "" {
+		partSize, err := ParseSize(d.PartSizeStr)
+		if err != nil {
+			return fmt.Errorf("invalid part_size: %w", err)
+		}
+		d.PartSize = partSize
+	}
+	if d.PartSize == 0 {
+		d.PartSize = DefaultPartSize
+	}
+	return nil
+}
+
+// IncludePatterns returns the include globs, including the legacy file_pattern
+func (c *EncryptionConfig) IncludePatterns() []string {
+	patterns := append([]string{}, c.Include...)
+	if c.FilePattern != "" {
+		patterns = append(patterns, c.FilePattern)
+	}
+	return patterns
 }
 
 // DecryptionConfig holds decryption-specific configuration
 type DecryptionConfig struct {
-	Enabled            bool   `hcl:"enabled,optional"`
-	SourceDir          string `hcl:"source_dir"`
-	DestDir            string `hcl:"dest_dir"`
-	SourceFileBehavior string `hcl:"source_file_behavior"`
-	VerifyChecksum     bool   `hcl:"verify_checksum,optional"`
+	Name               string   // Block label; empty for the default block
+	TransitMount       string   `hcl:"transit_mount,optional"` // Overrides vault.transit_mount
+	KeyName            string   `hcl:"key_name,optional"`      // Overrides vault.key_name
+	Enabled            bool     `hcl:"enabled,optional"`
+	SourceDir          string   `hcl:"source_dir"`
+	DestDir            string   `hcl:"dest_dir"`
+	SourceFileBehavior string   `hcl:"source_file_behavior"`
+	VerifyChecksum     bool     `hcl:"verify_checksum,optional"`
+	DoneMarker         bool     `hcl:"done_marker,optional"` // Write <file>.done once the output is published
+	Include            []string `hcl:"include,optional"`
+	Exclude            []string `hcl:"exclude,optional"`
+	Recursive          bool     `hcl:"recursive,optional"`
+	QuarantinePath     string   `hcl:"quarantine_dir,optional"` // Default: <dest_dir>-quarantine
+
+	// Trigger "marker" processes a file once <file><marker_suffix> appears
+	Trigger          string        `hcl:"trigger,optional"`        // "stability" (default) or "marker"
+	MarkerSuffix     string        `hcl:"marker_suffix,optional"`  // Default: .ready or .done
+	MarkerTimeoutStr string        `hcl:"marker_timeout,optional"` // Default: 1h
+	MarkerTimeout    time.Duration // Parsed from MarkerTimeoutStr
+
+	// Watch mode "poll" finds files by listing source_dir every poll_interval,
+	// for network mounts whose changes from other hosts raise no events
+	WatchMode       string        `hcl:"watch_mode,optional"`    // "events" (default), "poll" or "hybrid"
+	PollIntervalStr string        `hcl:"poll_interval,optional"` // Default: 10s
+	PollInterval    time.Duration // Parsed from PollIntervalStr
 }
 
 // QueueConfig holds queue-related configuration
@@ -115,9 +235,17 @@ type QueueConfig struct {
 	BaseDelayStr         string        `hcl:"base_delay,optional"`
 	MaxDelayStr          string        `hcl:"max_delay,optional"`
 	StabilityDurationStr string        `hcl:"stability_duration,optional"`
+	Workers              int           `hcl:"workers,optional"`
+	LedgerPath           string        `hcl:"ledger_path,optional"`        // Files kept in place after processing
+	LedgerHash           bool          `hcl:"ledger_hash,optional"`        // Compare SHA256 when a kept file is touched
+	HookOutboxPath       string        `hcl:"hook_outbox_path,optional"`   // Hook deliveries not yet made
+	ReconcileIntervalStr string        `hcl:"reconcile_interval,optional"` // Default: 5m, "0" disables
+	StuckAfterStr        string        `hcl:"stuck_after,optional"`        // Default: 1h
 	BaseDelay            time.Duration // Parsed from BaseDelayStr
 	MaxDelay             time.Duration // Parsed from MaxDelayStr
 	StabilityDuration    time.Duration // Parsed from StabilityDurationStr
+	ReconcileInterval    time.Duration // Parsed from ReconcileIntervalStr
+	StuckAfter           time.Duration // Parsed from StuckAfterStr
 }
 
 // LoggingConfig holds logging configuration
@@ -129,6 +257,48 @@ type LoggingConfig struct {
 	AuditPath string `hcl:"audit_path,optional"`
 }
 
+// TelemetryConfig holds the metrics endpoint configuration
+type TelemetryConfig struct {
+	Listen                 string        `hcl:"listen"` // e.g. ":9102"
+	HealthCheckIntervalStr string        `hcl:"health_check_interval,optional"`
+	HealthCheckInterval    time.Duration // Parsed from HealthCheckIntervalStr
+
+	// How long data key requests may fail to reach Vault before /readyz fails
+	VaultUnreachableTimeoutStr string        `hcl:"vault_unreachable_timeout,optional"`
+	VaultUnreachableTimeout    time.Duration // Parsed from VaultUnreachableTimeoutStr
+
+	// Serve the queue administration API used by the queue commands on its
+	// own listener. Requests must carry AdminToken as a bearer token when it
+	// is set; it is required unless AdminListen is a loopback address.
+	Admin       bool   `hcl:"admin,optional"`
+	AdminListen string `hcl:"admin_listen,optional"` // Default: 127.0.0.1:9103
+	AdminToken  string `hcl:"admin_token,optional"`  // Env: FILE_ENCRYPTOR_ADMIN_TOKEN
+}
+
+// HookConfig describes a command or webhook run when an item is processed
+type HookConfig struct {
+	Name       string   `hcl:"name,label"`
+	Operations []string `hcl:"operations,optional"` // encrypt, decrypt; empty for both
+	Events     []string `hcl:"events,optional"`     // completed, failed, dlq; empty for all
+
+	// Exactly one of Command and URL is set. The command gets the event as
+	// JSON on stdin and item fields as environment variables; the URL gets
+	// it POSTed, signed with Secret.
+	Command []string `hcl:"command,optional"`
+	URL     string   `hcl:"url,optional"`
+	Secret  string   `hcl:"secret,optional"` // HMAC-SHA256 key, required with url
+
+	TimeoutStr string        `hcl:"timeout,optional"`
+	Timeout    time.Duration // Parsed from TimeoutStr
+	MaxRetries int           `hcl:"max_retries,optional"`
+}
+
+// Matches reports whether the hook runs for an event of an operation
+func (h *HookConfig) Matches(operation, event string) bool {
+	return (len(h.Operations) == 0 || slices.Contains(h.Operations, operation)) &&
+		(len(h.Events) == 0 || slices.Contains(h.Events, event))
+}
+
 // SetDefaults sets default values for optional fields
 func (c *Config) SetDefaults() error {
 	// Vault defaults - parse duration string if provided
@@ -165,12 +335,67 @@ func (c *Config) SetDefaults() error {
 	if c.Encryption.ChunkSize == 0 {
 		c.Encryption.ChunkSize = 1024 * 1024 // Default 1MB
 	}
+	if c.Encryption.Format == "" {
+		c.Encryption.Format = FormatSplit
+	}
+	if err := setTriggerDefaults(&c.Encryption.Trigger, c.Encryption.MarkerTimeoutStr, &c.Encryption.MarkerTimeout); err != nil {
+		return fmt.Errorf("encryption config: %w", err)
+	}
+	if err := setWatchDefaults(&c.Encryption.WatchMode, c.Encryption.PollIntervalStr, &c.Encryption.PollInterval); err != nil {
+		return fmt.Errorf("encryption config: %w", err)
+	}
+	if c.Encryption.Destination != nil {
+		if err := c.Encryption.Destination.setDefaults(); err != nil {
+			return fmt.Errorf("encryption destination: %w", err)
+		}
+	}
+
+	// Named encryption blocks share the default block's chunk size
+	for i := range c.NamedEncryption {
+		rule := &c.NamedEncryption[i]
+		if rule.SourceFileBehavior == "" {
+			rule.SourceFileBehavior = "archive"
+		}
+		if rule.Format == "" {
+			rule.Format = FormatSplit
+		}
+		if err := setTriggerDefaults(&rule.Trigger, rule.MarkerTimeoutStr, &rule.MarkerTimeout); err != nil {
+			return fmt.Errorf("encryption %q: %w", rule.Name, err)
+		}
+		if err := setWatchDefaults(&rule.WatchMode, rule.PollIntervalStr, &rule.PollInterval); err != nil {
+			return fmt.Errorf("encryption %q: %w", rule.Name, err)
+		}
+		rule.ChunkSize = c.Encryption.ChunkSize
+		if rule.Destination != nil {
+			if err := rule.Destination.setDefaults(); err != nil {
+				return fmt.Errorf("encryption %q destination: %w", rule.Name, err)
+			}
+		}
+	}
 
 	// Decryption defaults
 	if c.Decryption != nil {
 		if c.Decryption.SourceFileBehavior == "" {
 			c.Decryption.SourceFileBehavior = "archive"
 		}
+		if err := setTriggerDefaults(&c.Decryption.Trigger, c.Decryption.MarkerTimeoutStr, &c.Decryption.MarkerTimeout); err != nil {
+			return fmt.Errorf("decryption config: %w", err)
+		}
+		if err := setWatchDefaults(&c.Decryption.WatchMode, c.Decryption.PollIntervalStr, &c.Decryption.PollInterval); err != nil {
+			return fmt.Errorf("decryption config: %w", err)
+		}
+	}
+	for i := range c.NamedDecryption {
+		rule := &c.NamedDecryption[i]
+		if rule.SourceFileBehavior == "" {
+			rule.SourceFileBehavior = "archive"
+		}
+		if err := setTriggerDefaults(&rule.Trigger, rule.MarkerTimeoutStr, &rule.MarkerTimeout); err != nil {
+			return fmt.Errorf("decryption %q: %w", rule.Name, err)
+		}
+		if err := setWatchDefaults(&rule.WatchMode, rule.PollIntervalStr, &rule.PollInterval); err != nil {
+			return fmt.Errorf("decryption %q: %w", rule.Name, err)
+		}
 	}
 
 	// Queue defaults - parse duration strings if provided
@@ -207,6 +432,85 @@ func (c *Config) SetDefaults() error {
 	if c.Queue.StabilityDuration == 0 {
 		c.Queue.StabilityDuration = DefaultStabilityDuration
 	}
+	if c.Queue.Workers == 0 {
+		c.Queue.Workers = DefaultWorkers
+	}
+	if c.Queue.ReconcileIntervalStr != "" {
+		// An explicit zero disables reconciliation
+		dur, err := time.ParseDuration(c.Queue.ReconcileIntervalStr)
+		if err != nil {
+			return fmt.Errorf("invalid reconcile_interval duration: %w", err)
+		}
+		c.Queue.ReconcileInterval = dur
+	} else if c.Queue.ReconcileInterval == 0 {
+		c.Queue.ReconcileInterval = DefaultReconcileInterval
+	}
+	if c.Queue.StuckAfterStr != "" {
+		dur, err := time.ParseDuration(c.Queue.StuckAfterStr)
+		if err != nil {
+			return fmt.Errorf("invalid stuck_after duration: %w", err)
+		}
+		c.Queue.StuckAfter = dur
+	}
+	if c.Queue.StuckAfter == 0 {
+		c.Queue.StuckAfter = DefaultStuckAfter
+	}
+	if c.Queue.LedgerPath == "" && c.Queue.StatePath != "" {
+		c.Queue.LedgerPath = filepath.Join(filepath.Dir(c.Queue.StatePath), DefaultLedgerFile)
+	}
+	if c.Queue.HookOutboxPath == "" && c.Queue.StatePath != "" {
+		c.Queue.HookOutboxPath = filepath.Join(filepath.Dir(c.Queue.StatePath), DefaultHookOutboxFile)
+	}
+
+	// Hook defaults
+	for i := range c.Hooks {
+		hook := &c.Hooks[i]
+		if hook.TimeoutStr != "" {
+			dur, err := time.ParseDuration(hook.TimeoutStr)
+			if err != nil {
+				return fmt.Errorf("invalid timeout duration of hook %q: %w", hook.Name, err)
+			}
+			hook.Timeout = dur
+		}
+		if hook.Timeout == 0 {
+			hook.Timeout = DefaultHookTimeout
+		}
+		if hook.MaxRetries == 0 {
+			hook.MaxRetries = DefaultHookMaxRetries
+		}
+	}
+
+	// Telemetry defaults
+	if c.Telemetry != nil {
+		if c.Telemetry.HealthCheckIntervalStr != "" {
+			dur, err := time.ParseDuration(c.Telemetry.HealthCheckIntervalStr)
+			if err != nil {
+				return fmt.Errorf("invalid health_check_interval duration: %w", err)
+			}
+			c.Telemetry.HealthCheckInterval = dur
+		}
+		if c.Telemetry.HealthCheckInterval == 0 {
+			c.Telemetry.HealthCheckInterval = DefaultHealthCheckInterval
+		}
+
+		if c.Telemetry.VaultUnreachableTimeoutStr != "" {
+			dur, err := time.ParseDuration(c.Telemetry.VaultUnreachableTimeoutStr)
+			if err != nil {
+				return fmt.Errorf("invalid vault_unreachable_timeout duration: %w", err)
+			}
+			c.Telemetry.VaultUnreachableTimeout = dur
+		}
+		if c.Telemetry.VaultUnreachableTimeout == 0 {
+			c.Telemetry.VaultUnreachableTimeout = DefaultVaultUnreachableTimeout
+		}
+
+		if c.Telemetry.AdminListen == "" {
+			c.Telemetry.AdminListen = DefaultAdminListen
+		}
+		if c.Telemetry.AdminToken == "" {
+			c.Telemetry.AdminToken = os.Getenv(AdminTokenEnv)
+		}
+	}
 
 	// Logging defaults
 	if c.Logging.Level == "" {
@@ -225,6 +529,150 @@ func (c *Config) SetDefaults() error {
 	return nil
 }
 
+// EncryptionRules returns the default (unlabelled) encryption block followed
+// by the named ones. Name, TransitMount and KeyName are always set; the key
+// defaults to the vault block's.
+func (c *Config) EncryptionRules() []EncryptionConfig {
+	rules := append([]EncryptionConfig{c.Encryption}, c.NamedEncryption...)
+	for i := range rules {
+		if rules[i].Name == "" {
+			rules[i].Name = DefaultRuleName
+		}
+		rules[i].TransitMount, rules[i].KeyName = c.transitKey(rules[i].TransitMount, rules[i].KeyName)
+	}
+	return rules
+}
+
+// DecryptionRules returns the decryption blocks, default first, with Name,
+// TransitMount and KeyName set as for EncryptionRules. Named decryption
+// blocks are always validated, as if enabled were set.
+func (c *Config) DecryptionRules() []DecryptionConfig {
+	var rules []DecryptionConfig
+	if c.Decryption != nil {
+		rules = append(rules, *c.Decryption)
+	}
+	rules = append(rules, c.NamedDecryption...)
+
+	for i := range rules {
+		if rules[i].Name == "" {
+			rules[i].Name = DefaultRuleName
+		}
+		rules[i].TransitMount, rules[i].KeyName = c.transitKey(rules[i].TransitMount, rules[i].KeyName)
+	}
+	return rules
+}
+
+// transitKey applies the vault block's key to a rule's key overrides
+func (c *Config) transitKey(transitMount, keyName string) (string, string) {
+	if transitMount == "" {
+		transitMount = c.Vault.TransitMount
+	}
+	if keyName == "" {
+		keyName = c.Vault.KeyName
+	}
+	return transitMount, keyName
+}
+
+// ArchiveDir returns the archive directory of this encryption block
+func (c *EncryptionConfig) ArchiveDir() string {
+	return filepath.Join(c.SourceDir, "archive")
+}
+
+// FailedDir returns the failed directory of this encryption block
+func (c *EncryptionConfig) FailedDir() string {
+	return filepath.Join(c.SourceDir, "failed")
+}
+
+// DLQDir returns the dead letter queue directory of this encryption block
+func (c *EncryptionConfig) DLQDir() string {
+	return filepath.Join(c.SourceDir, "dlq")
+}
+
+// ArchiveDir returns the archive directory of this decryption block
+func (c *DecryptionConfig) ArchiveDir() string {
+	return filepath.Join(c.SourceDir, "archive")
+}
+
+// FailedDir returns the failed directory of this decryption block
+func (c *DecryptionConfig) FailedDir() string {
+	return filepath.Join(c.SourceDir, "failed")
+}
+
+// DLQDir returns the dead letter queue directory of this decryption block
+func (c *DecryptionConfig) DLQDir() string {
+	return filepath.Join(c.SourceDir, "dlq")
+}
+
+// MarkerSuffixes returns the suffixes of the marker files that trigger this
+// encryption block
+func (c *EncryptionConfig) MarkerSuffixes() []string {
+	return markerSuffixes(c.MarkerSuffix)
+}
+
+// MarkerSuffixes returns the suffixes of the marker files that trigger this
+// decryption block
+func (c *DecryptionConfig) MarkerSuffixes() []string {
+	return markerSuffixes(c.MarkerSuffix)
+}
+
+// markerSuffixes returns the configured marker suffix, or the defaults
+func markerSuffixes(suffix string) []string {
+	if suffix != "" {
+		return []string{suffix}
+	}
+	return DefaultMarkerSuffixes
+}
+
+// setTriggerDefaults defaults the trigger of a block and parses its
+// marker_timeout
+func setTriggerDefaults(trigger *string, timeoutStr string, timeout *time.Duration) error {
+	if *trigger == "" {
+		*trigger = TriggerStability
+	}
+	if timeoutStr != "" {
+		dur, err := time.ParseDuration(timeoutStr)
+		if err != nil {
+			return fmt.Errorf("invalid marker_timeout duration: %w", err)
+		}
+		*timeout = dur
+	}
+	if *timeout == 0 {
+		*timeout = DefaultMarkerTimeout
+	}
+	return nil
+}
+
+// setWatchDefaults defaults the watch mode of a block and parses its
+// poll_interval
+func setWatchDefaults(mode *string, intervalStr string, interval *time.Duration) error {
+	if *mode == "" {
+		*mode = WatchModeEvents
+	}
+	if intervalStr != "" {
+		dur, err := time.ParseDuration(intervalStr)
+		if err != nil {
+			return fmt.Errorf("invalid poll_interval duration: %w", err)
+		}
+		*interval = dur
+	}
+	if *interval == 0 {
+		*interval = DefaultPollInterval
+	}
+	return nil
+}
+
+// QuarantineDir returns the directory of this decryption block that receives
+// decrypted files failing checksum verification: quarantine_dir, or else a
+// sibling of dest_dir, so plaintext never lands in the source directory that
+// producers of encrypted files write to
+func (c *DecryptionConfig) QuarantineDir() string {
+	if c.QuarantinePath != "" {
+		return c.QuarantinePath
+	}
+	dest := filepath.Clean(c.DestDir)
+	return filepath.Join(filepath.Dir(dest), filepath.Base(dest)+"-quarantine")
+}
+
 // ArchiveDir returns the archive directory path for the given operation
 func (c *Config) ArchiveDir(operation string) string {
 
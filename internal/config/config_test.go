@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -82,6 +83,7 @@ encryption {
   source_dir = "/tmp/source"
   dest_dir = "/tmp/dest"
   source_file_behavior = "delete"
+  recursive = true
 }
 
 decryption {
@@ -90,6 +92,7 @@ decryption {
   dest_dir = "/tmp/dec"
   source_file_behavior = "keep"
   verify_checksum = true
+  recursive = true
 }
 
 queue {
@@ -112,6 +115,8 @@ logging {
 	assert.Equal(t, "/tmp/dec", cfg.Decryption.DestDir)
 	assert.Equal(t, "keep", cfg.Decryption.SourceFileBehavior)
 	assert.True(t, cfg.Decryption.VerifyChecksum)
+	assert.True(t, cfg.Decryption.Recursive)
+	assert.True(t, cfg.Encryption.Recursive)
 }
 
 func TestSetDefaults(t *testing.T) {
@@ -145,6 +150,10 @@ func TestSetDefaults(t *testing.T) {
 	assert.Equal(t, 1*time.Second, cfg.Queue.BaseDelay)
 	assert.Equal(t, 5*time.Minute, cfg.Queue.MaxDelay)
 	assert.Equal(t, 1*time.Second, cfg.Queue.StabilityDuration)
+	assert.Equal(t, 1, cfg.Queue.Workers)
+	assert.Equal(t, 5*time.Minute, cfg.Queue.ReconcileInterval)
+	assert.Equal(t, 1*time.Hour, cfg.Queue.StuckAfter)
+	assert.Equal(t, FormatSplit, cfg.Encryption.Format)
 
 	// Logging defaults
 	assert.Equal(t, "info", cfg.Logging.Level)
@@ -249,6 +258,14 @@ func TestDLQDir(t *testing.T) {
 	assert.Equal(t, filepath.Join("/tmp/enc", "dlq"), cfg.DLQDir("decrypt"))
 }
 
+func TestQuarantineDir(t *testing.T) {
+	dec := &DecryptionConfig{SourceDir: "/tmp/enc", DestDir: "/tmp/dec/"}
+	assert.Equal(t, filepath.Join("/tmp", "dec-quarantine"), dec.QuarantineDir())
+
+	dec.QuarantinePath = "/secure/quarantine"
+	assert.Equal(t, "/secure/quarantine", dec.QuarantineDir())
+}
+
 func TestLoad(t *testing.T) {
 	// Create a temporary config file
 	tmpDir := t.TempDir()
@@ -583,6 +600,7 @@ queue {
   base_delay = "2s"
   max_delay = "10m"
   stability_duration = "500ms"
+  workers = 8
 }
 
 logging {
@@ -607,6 +625,7 @@ logging {
 
 	// Verify other fields
 	assert.Equal(t, 10, cfg.Queue.MaxRetries)
+	assert.Equal(t, 8, cfg.Queue.Workers)
 }
 
 func TestLoadFromString_InvalidDuration(t *testing.T) {
@@ -721,3 +740,518 @@ logging {
 	assert.Nil(t, cfg)
 	assert.Contains(t, err.Error(), "multiple authentication methods configured")
 }
+
+func TestLoadFromString_IncludeExclude(t *testing.T) {
+	hclContent := `
+vault {
+  agent_address = "http://127.0.0.1:8200"
+  transit_mount = "transit"
+  key_name = "test-key"
+}
+
+encryption {
+  source_dir = "/tmp/source"
+  dest_dir = "/tmp/dest"
+  source_file_behavior = "archive"
+  file_pattern = "*.txt"
+  include = ["*.csv", "reports/**/*.xlsx"]
+  exclude = ["*.tmp", "~$*"]
+}
+
+queue {
+  state_path = "/tmp/queue.json"
+}
+
+logging {
+  level = "info"
+  output = "stdout"
+}
+`
+
+	cfg, err := LoadFromString("test.hcl", hclContent)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"*.csv", "reports/**/*.xlsx"}, cfg.Encryption.Include)
+	assert.Equal(t, []string{"*.tmp", "~$*"}, cfg.Encryption.Exclude)
+	assert.Equal(t, []string{"*.csv", "reports/**/*.xlsx", "*.txt"}, cfg.Encryption.IncludePatterns())
+}
+
+func TestLoadFromString_NamedRules(t *testing.T) {
+	hclContent := `
+vault {
+  agent_address = "http://127.0.0.1:8200"
+  transit_mount = "transit"
+  key_name = "default-key"
+}
+
+encryption {
+  source_dir = "/tmp/source"
+  dest_dir = "/tmp/dest"
+  source_file_behavior = "archive"
+  chunk_size = "2MB"
+}
+
+encryption "finance" {
+  source_dir = "/tmp/finance/in"
+  dest_dir = "/tmp/finance/out"
+  source_file_behavior = "delete"
+  key_name = "finance"
+}
+
+encryption "hr" {
+  source_dir = "/tmp/hr/in"
+  dest_dir = "/tmp/hr/out"
+  source_file_behavior = "keep"
+  transit_mount = "transit-hr"
+  key_name = "hr"
+  format = "container"
+}
+
+decryption "finance" {
+  source_dir = "/tmp/finance/enc"
+  dest_dir = "/tmp/finance/dec"
+  source_file_behavior = "archive"
+  key_name = "finance"
+}
+
+queue {
+  state_path = "/tmp/queue.json"
+}
+
+logging {
+  level = "info"
+  output = "stdout"
+}
+`
+
+	cfg, err := LoadFromString("test.hcl", hclContent)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/tmp/source", cfg.Encryption.SourceDir)
+	require.Len(t, cfg.NamedEncryption, 2)
+	require.Len(t, cfg.NamedDecryption, 1)
+	assert.Nil(t, cfg.Decryption)
+
+	rules := cfg.EncryptionRules()
+	require.Len(t, rules, 3)
+
+	assert.Equal(t, DefaultRuleName, rules[0].Name)
+	assert.Equal(t, "transit", rules[0].TransitMount)
+	assert.Equal(t, "default-key", rules[0].KeyName)
+
+	assert.Equal(t, "finance", rules[1].Name)
+	assert.Equal(t, "transit", rules[1].TransitMount)
+	assert.Equal(t, "finance", rules[1].KeyName)
+	assert.Equal(t, 2*1000*1000, rules[1].ChunkSize, "named blocks share the default chunk size")
+	assert.Equal(t, FormatSplit, rules[1].Format)
+
+	assert.Equal(t, "hr", rules[2].Name)
+	assert.Equal(t, "transit-hr", rules[2].TransitMount)
+	assert.Equal(t, "hr", rules[2].KeyName)
+	assert.Equal(t, FormatContainer, rules[2].Format)
+	assert.Equal(t, "/tmp/hr/in/archive", rules[2].ArchiveDir())
+
+	decryptRules := cfg.DecryptionRules()
+	require.Len(t, decryptRules, 1)
+	assert.Equal(t, "finance", decryptRules[0].Name)
+	assert.Equal(t, "finance", decryptRules[0].KeyName)
+	assert.Equal(t, "/tmp/finance/enc/dlq", decryptRules[0].DLQDir())
+}
+
+func TestLoadFromString_JSON(t *testing.T) {
+	jsonContent := `{
+  "vault": {
+    "agent_address": "http://127.0.0.1:8200",
+    "transit_mount": "transit",
+    "key_name": "test-key"
+  },
+  "encryption": {
+    "source_dir": "/tmp/source",
+    "dest_dir": "/tmp/dest",
+    "source_file_behavior": "archive",
+    "include": ["*.csv"]
+  },
+  "queue": {
+    "state_path": "/tmp/queue.json"
+  },
+  "logging": {
+    "level": "info",
+    "output": "stdout"
+  }
+}`
+
+	cfg, err := LoadFromString("test.json", jsonContent)
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/source", cfg.Encryption.SourceDir)
+	assert.Equal(t, []string{"*.csv"}, cfg.Encryption.Include)
+	assert.Empty(t, cfg.NamedEncryption)
+
+	named := strings.Replace(jsonContent, `"queue": {`, `"decryption": {
+    "finance": {
+      "source_dir": "/tmp/finance/enc",
+      "dest_dir": "/tmp/finance/dec",
+      "source_file_behavior": "archive"
+    }
+  },
+  "queue": {`, 1)
+
+	_, err = LoadFromString("test.json", named)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Named rules are not supported in JSON")
+	assert.Contains(t, err.Error(), `decryption block "finance"`)
+}
+
+func TestLoadFromString_Ledger(t *testing.T) {
+	base := `
+vault {
+  agent_address = "http://127.0.0.1:8200"
+  transit_mount = "transit"
+  key_name = "test-key"
+}
+
+encryption {
+  source_dir = "/tmp/source"
+  dest_dir = "/tmp/dest"
+  source_file_behavior = "keep"
+}
+
+logging {}
+`
+
+	cfg, err := LoadFromString("test.hcl", base+`
+queue {
+  state_path = "/var/lib/file-encryptor/queue.json"
+}
+`)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/var/lib/file-encryptor", DefaultLedgerFile), cfg.Queue.LedgerPath)
+	assert.False(t, cfg.Queue.LedgerHash)
+
+	cfg, err = LoadFromString("test.hcl", base+`
+queue {
+  state_path  = "/var/lib/file-encryptor/queue.json"
+  ledger_path = "/data/ledger.json"
+  ledger_hash = true
+}
+`)
+	require.NoError(t, err)
+	assert.Equal(t, "/data/ledger.json", cfg.Queue.LedgerPath)
+	assert.True(t, cfg.Queue.LedgerHash)
+}
+
+func TestLoadFromString_Reconcile(t *testing.T) {
+	base := `
+vault {
+  agent_address = "http://127.0.0.1:8200"
+  transit_mount = "transit"
+  key_name = "test-key"
+}
+
+encryption {
+  source_dir = "/tmp/source"
+  dest_dir = "/tmp/dest"
+  source_file_behavior = "archive"
+}
+
+logging {}
+`
+
+	cfg, err := LoadFromString("test.hcl", base+`
+queue {
+  state_path         = "/tmp/queue.json"
+  reconcile_interval = "1m"
+  stuck_after        = "30m"
+}
+`)
+	require.NoError(t, err)
+	assert.Equal(t, 1*time.Minute, cfg.Queue.ReconcileInterval)
+	assert.Equal(t, 30*time.Minute, cfg.Queue.StuckAfter)
+
+	cfg, err = LoadFromString("test.hcl", base+`
+queue {
+  state_path         = "/tmp/queue.json"
+  reconcile_interval = "0"
+}
+`)
+	require.NoError(t, err)
+	assert.Zero(t, cfg.Queue.ReconcileInterval, "zero disables reconciliation")
+
+	_, err = LoadFromString("test.hcl", base+`
+queue {
+  state_path  = "/tmp/queue.json"
+  stuck_after = "soon"
+}
+`)
+	assert.ErrorContains(t, err, "invalid stuck_after duration")
+}
+
+func TestLoadFromString_Telemetry(t *testing.T) {
+	base := `
+vault {
+  agent_address = "http://127.0.0.1:8200"
+  transit_mount = "transit"
+  key_name = "test-key"
+}
+
+encryption {
+  source_dir = "/tmp/source"
+  dest_dir = "/tmp/dest"
+  source_file_behavior = "archive"
+}
+
+queue {
+  state_path = "/tmp/queue.json"
+}
+
+logging {
+  level = "info"
+  output = "stdout"
+}
+`
+
+	t.Run("not configured", func(t *testing.T) {
+		cfg, err := LoadFromString("test.hcl", base)
+		require.NoError(t, err)
+		assert.Nil(t, cfg.Telemetry)
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		cfg, err := LoadFromString("test.hcl", base+`
+telemetry {
+  listen = ":9102"
+}
+`)
+		require.NoError(t, err)
+		require.NotNil(t, cfg.Telemetry)
+		assert.Equal(t, ":9102", cfg.Telemetry.Listen)
+		assert.Equal(t, DefaultHealthCheckInterval, cfg.Telemetry.HealthCheckInterval)
+		assert.Equal(t, DefaultVaultUnreachableTimeout, cfg.Telemetry.VaultUnreachableTimeout)
+		assert.Equal(t, DefaultAdminListen, cfg.Telemetry.AdminListen)
+	})
+
+	t.Run("admin token from environment", func(t *testing.T) {
+		t.Setenv(AdminTokenEnv, "env-token")
+		cfg, err := LoadFromString("test.hcl", base+`
+telemetry {
+  listen = ":9102"
+  admin = true
+  admin_listen = ":9103"
+}
+`)
+		require.NoError(t, err)
+		assert.Equal(t, "env-token", cfg.Telemetry.AdminToken)
+	})
+
+	t.Run("durations", func(t *testing.T) {
+		cfg, err := LoadFromString("test.hcl", base+`
+telemetry {
+  listen = "127.0.0.1:9102"
+  health_check_interval = "10s"
+  vault_unreachable_timeout = "5m"
+}
+`)
+		require.NoError(t, err)
+		assert.Equal(t, 10*time.Second, cfg.Telemetry.HealthCheckInterval)
+		assert.Equal(t, 5*time.Minute, cfg.Telemetry.VaultUnreachableTimeout)
+	})
+
+	t.Run("invalid health check interval", func(t *testing.T) {
+		_, err := LoadFromString("test.hcl", base+`
+telemetry {
+  listen = ":9102"
+  health_check_interval = "often"
+}
+`)
+		assert.Error(t, err)
+	})
+}
+
+func TestLoadFromString_Destination(t *testing.T) {
+	cfg, err := LoadFromString("test.hcl", `
+vault {
+  agent_address = "http://127.0.0.1:8200"
+  transit_mount = "transit"
+  key_name = "test-key"
+}
+
+encryption {
+  source_dir = "/tmp/source"
+  source_file_behavior = "archive"
+
+  destination "s3" {
+    endpoint = "http://127.0.0.1:9000"
+    bucket = "encrypted"
+    prefix = "reports/"
+    path_style = true
+
+    credentials {
+      access_key_id = "minio"
+      secret_access_key = "minio-secret"
+    }
+  }
+}
+
+queue {
+  state_path = "/tmp/queue.json"
+}
+
+logging {
+  level = "info"
+  output = "stdout"
+}
+`)
+	require.NoError(t, err)
+
+	d := cfg.Encryption.Destination
+	require.NotNil(t, d)
+	assert.Equal(t, DestinationS3, d.Type)
+	assert.Equal(t, "encrypted", d.Bucket)
+	assert.Equal(t, "reports/", d.Prefix)
+	assert.True(t, d.PathStyle)
+	assert.Equal(t, DefaultS3Region, d.Region)
+	assert.Equal(t, KeyStorageObject, d.KeyStorage)
+	assert.Equal(t, DefaultPartSize, d.PartSize)
+	require.NotNil(t, d.Credentials)
+	assert.Equal(t, "minio", d.Credentials.AccessKeyID)
+}
+
+func TestLoadFromString_Hooks(t *testing.T) {
+	cfg, err := LoadFromString("test.hcl", `
+vault {
+  agent_address = "http://127.0.0.1:8200"
+  transit_mount = "transit"
+  key_name = "test-key"
+}
+
+encryption {
+  source_dir = "/tmp/source"
+  dest_dir = "/tmp/dest"
+  source_file_behavior = "archive"
+}
+
+queue {
+  state_path = "/tmp/state/queue.json"
+}
+
+logging {
+  level = "info"
+  output = "stdout"
+}
+
+hook "notify" {
+  command = ["/usr/local/bin/notify", "--channel", "ops"]
+  events = ["failed", "dlq"]
+}
+
+hook "siem" {
+  operations = ["encrypt"]
+  url = "https://siem.example.com/events"
+  secret = "s3cret"
+  timeout = "3s"
+  max_retries = 10
+}
+`)
+	require.NoError(t, err)
+	require.Len(t, cfg.Hooks, 2)
+
+	assert.Equal(t, "notify", cfg.Hooks[0].Name)
+	assert.Equal(t, []string{"/usr/local/bin/notify", "--channel", "ops"}, cfg.Hooks[0].Command)
+	assert.Equal(t, DefaultHookTimeout, cfg.Hooks[0].Timeout)
+	assert.Equal(t, DefaultHookMaxRetries, cfg.Hooks[0].MaxRetries)
+	assert.True(t, cfg.Hooks[0].Matches("decrypt", HookEventDLQ))
+	assert.False(t, cfg.Hooks[0].Matches("decrypt", HookEventCompleted))
+
+	assert.Equal(t, 3*time.Second, cfg.Hooks[1].Timeout)
+	assert.Equal(t, 10, cfg.Hooks[1].MaxRetries)
+	assert.True(t, cfg.Hooks[1].Matches("encrypt", HookEventCompleted))
+	assert.False(t, cfg.Hooks[1].Matches("decrypt", HookEventCompleted))
+
+	assert.Equal(t, filepath.Join("/tmp/state", DefaultHookOutboxFile), cfg.Queue.HookOutboxPath)
+}
+
+func TestLoadFromString_MarkerTrigger(t *testing.T) {
+	cfg, err := LoadFromString("test.hcl", `
+vault {
+  agent_address = "http://127.0.0.1:8200"
+  transit_mount = "transit"
+  key_name = "test-key"
+}
+
+encryption {
+  source_dir = "/tmp/source"
+  dest_dir = "/tmp/dest"
+  source_file_behavior = "archive"
+  trigger = "marker"
+}
+
+decryption {
+  enabled = true
+  source_dir = "/tmp/encrypted"
+  dest_dir = "/tmp/decrypted"
+  source_file_behavior = "archive"
+  trigger = "marker"
+  marker_suffix = ".ok"
+  marker_timeout = "30m"
+}
+
+queue {
+  state_path = "/tmp/queue.json"
+}
+
+logging {
+  level = "info"
+  output = "stdout"
+}
+`)
+	require.NoError(t, err)
+
+	assert.Equal(t, TriggerMarker, cfg.Encryption.Trigger)
+	assert.Equal(t, []string{".ready", ".done"}, cfg.Encryption.MarkerSuffixes())
+	assert.Equal(t, DefaultMarkerTimeout, cfg.Encryption.MarkerTimeout)
+
+	require.NotNil(t, cfg.Decryption)
+	assert.Equal(t, []string{".ok"}, cfg.Decryption.MarkerSuffixes())
+	assert.Equal(t, 30*time.Minute, cfg.Decryption.MarkerTimeout)
+}
+
+func TestLoadFromString_WatchMode(t *testing.T) {
+	cfg, err := LoadFromString("test.hcl", `
+vault {
+  agent_address = "http://127.0.0.1:8200"
+  transit_mount = "transit"
+  key_name = "test-key"
+}
+
+encryption {
+  source_dir = "/tmp/source"
+  dest_dir = "/tmp/dest"
+  source_file_behavior = "archive"
+}
+
+decryption {
+  enabled = true
+  source_dir = "/mnt/nfs/encrypted"
+  dest_dir = "/tmp/decrypted"
+  source_file_behavior = "archive"
+  watch_mode = "poll"
+  poll_interval = "1m"
+}
+
+queue {
+  state_path = "/tmp/queue.json"
+}
+
+logging {
+  level = "info"
+  output = "stdout"
+}
+`)
+	require.NoError(t, err)
+
+	assert.Equal(t, WatchModeEvents, cfg.Encryption.WatchMode)
+	assert.Equal(t, DefaultPollInterval, cfg.Encryption.PollInterval)
+
+	require.NotNil(t, cfg.Decryption)
+	assert.Equal(t, WatchModePoll, cfg.Decryption.WatchMode)
+	assert.Equal(t, time.Minute, cfg.Decryption.PollInterval)
+}
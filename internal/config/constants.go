@@ -18,4 +18,135 @@ const (
 
 	// DefaultMaxRetries is the default maximum number of retry attempts
 	DefaultMaxRetries = 3
+
+	// DefaultWorkers is the default number of concurrent processor workers
+	DefaultWorkers = 1
+
+	// DefaultHealthCheckInterval is how often the service checks Vault health
+	// when telemetry is enabled
+	DefaultHealthCheckInterval = 30 * time.Second
+
+	// DefaultVaultUnreachableTimeout is how long data key requests may fail
+	// to reach Vault before the service reports itself not ready
+	DefaultVaultUnreachableTimeout = 2 * time.Minute
+
+	// DefaultReconcileInterval is how often source directories are rescanned
+	// for files whose events were missed
+	DefaultReconcileInterval = 5 * time.Minute
+
+	// DefaultStuckAfter is how long a file may sit unprocessed in a source,
+	// failed or dead letter directory before it is reported
+	DefaultStuckAfter = 1 * time.Hour
+)
+
+// Encrypted output formats
+const (
+	// FormatSplit writes the encrypted file and its wrapped data key to
+	// separate .enc and .key files
+	FormatSplit = "split"
+
+	// FormatContainer writes a single self-describing .enc file that embeds
+	// the wrapped data key in its header
+	FormatContainer = "container"
+)
+
+// DefaultLedgerFile is the processed-file ledger written next to the queue
+// state file unless ledger_path is set
+const DefaultLedgerFile = "ledger.json"
+
+// DefaultHookOutboxFile holds pending hook deliveries next to the queue state
+// file unless hook_outbox_path is set
+const DefaultHookOutboxFile = "hooks-outbox.json"
+
+// DefaultRuleName names the unlabelled encryption and decryption blocks
+// among the per-directory rules (see Config.EncryptionRules)
+const DefaultRuleName = "default"
+
+// Object storage destinations
+const (
+	// DestinationS3 uploads encrypted files to an S3-compatible bucket
+	DestinationS3 = "s3"
+
+	// KeyStorageObject stores the wrapped data key as a <name>.key object
+	// next to the encrypted object
+	KeyStorageObject = "object"
+
+	// KeyStorageMetadata stores the wrapped data key in the metadata of the
+	// encrypted object
+	KeyStorageMetadata = "metadata"
+
+	// DefaultS3Region is used when a destination sets no region
+	DefaultS3Region = "us-east-1"
+
+	// DefaultPartSize is the size of multipart upload parts
+	DefaultPartSize = 8 * 1024 * 1024
+
+	// MinPartSize is the smallest part S3 accepts, except for the last one
+	MinPartSize = 5 * 1024 * 1024
+)
+
+// Hook events
+const (
+	// HookEventCompleted is sent when an item was processed successfully
+	HookEventCompleted = "completed"
+
+	// HookEventFailed is sent when a processing attempt failed and the item
+	// will be retried
+	HookEventFailed = "failed"
+
+	// HookEventDLQ is sent when an item exhausted its retries and was moved
+	// to the dead letter queue
+	HookEventDLQ = "dlq"
+
+	// DefaultHookTimeout bounds one run of a hook command or webhook request
+	DefaultHookTimeout = 10 * time.Second
+
+	// DefaultHookMaxRetries is how often a failed hook delivery is retried
+	DefaultHookMaxRetries = 5
+)
+
+// Triggers decide when a file in a source directory is complete
+const (
+	// TriggerStability processes a file once its size and modification time
+	// stop changing for stability_duration
+	TriggerStability = "stability"
+
+	// TriggerMarker processes a file once a companion marker file appears,
+	// e.g. data.csv.ready next to data.csv
+	TriggerMarker = "marker"
+
+	// DefaultMarkerTimeout is how long a file may wait for its marker, or a
+	// marker for its file, before it is reported
+	DefaultMarkerTimeout = 1 * time.Hour
 )
+
+// Watch modes decide how new files in a source directory are found
+const (
+	// WatchModeEvents relies on file system events (inotify, FSEvents,
+	// ReadDirectoryChangesW)
+	WatchModeEvents = "events"
+
+	// WatchModePoll lists the source directory every poll_interval, for NFS,
+	// SMB and FUSE mounts where changes made by other hosts raise no events
+	WatchModePoll = "poll"
+
+	// WatchModeHybrid uses events and polling together
+	WatchModeHybrid = "hybrid"
+
+	// DefaultPollInterval is how often polled source directories are listed
+	DefaultPollInterval = 10 * time.Second
+
+	// MinPollInterval bounds how often polled source directories are listed
+	MinPollInterval = 1 * time.Second
+)
+
+// DefaultAdminListen is where the queue administration API is served unless
+// admin_listen is set
+const DefaultAdminListen = "127.0.0.1:9103"
+
+// AdminTokenEnv holds the admin API bearer token when admin_token is not set
+const AdminTokenEnv = "FILE_ENCRYPTOR_ADMIN_TOKEN"
+
+// DefaultMarkerSuffixes are the marker suffixes accepted unless
+// marker_suffix is set
+var DefaultMarkerSuffixes = []string{".ready", ".done"}
@@ -3,8 +3,12 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
-	"github.com/hashicorp/hcl/v2/hclsimple"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 )
 
 // Load loads configuration from an HCL file
@@ -14,9 +18,18 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("configuration file not found: %s", path)
 	}
 
-	// Parse HCL file
-	var cfg Config
-	if err := hclsimple.DecodeFile(path, nil, &cfg); err != nil {
+	src, err := os.ReadFile(path) // #nosec G304 - configuration file path is user-provided
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+
+	return LoadFromString(path, string(src))
+}
+
+// LoadFromString loads configuration from an HCL string
+func LoadFromString(filename, content string) (*Config, error) {
+	cfg, err := decode(filename, []byte(content))
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse configuration: %w", err)
 	}
 
@@ -25,20 +38,126 @@ func Load(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to set defaults: %w", err)
 	}
 
-	return &cfg, nil
+	return cfg, nil
 }
 
-// LoadFromString loads configuration from an HCL string
-func LoadFromString(filename, content string) (*Config, error) {
+// decode parses HCL (.hcl) or JSON (.json) source into a Config. Labelled
+// encryption and decryption blocks become NamedEncryption and NamedDecryption
+// rules; the unlabelled blocks are decoded as before. Labelled blocks are
+// only supported in HCL.
+func decode(filename string, src []byte) (*Config, error) {
+	parser := hclparse.NewParser()
+
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	switch suffix := filepath.Ext(filename); suffix {
+	case ".hcl":
+		file, diags = parser.ParseHCL(src, filename)
+	case ".json":
+		file, diags = parser.ParseJSON(src, filename)
+	default:
+		return nil, fmt.Errorf("unrecognized file format suffix %q", suffix)
+	}
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
 	var cfg Config
-	if err := hclsimple.Decode(filename, []byte(content), nil, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse configuration: %w", err)
+	body := file.Body
+	if syntaxBody, ok := body.(*hclsyntax.Body); ok {
+		var ruleDiags hcl.Diagnostics
+		body, ruleDiags = cfg.decodeNamedRules(syntaxBody)
+		if ruleDiags.HasErrors() {
+			return nil, ruleDiags
+		}
+	} else if ruleDiags := rejectNamedRules(body); ruleDiags.HasErrors() {
+		return nil, ruleDiags
 	}
 
-	// Set defaults and parse durations
-	if err := cfg.SetDefaults(); err != nil {
-		return nil, fmt.Errorf("failed to set defaults: %w", err)
+	if diags := gohcl.DecodeBody(body, nil, &cfg); diags.HasErrors() {
+		return nil, diags
 	}
 
 	return &cfg, nil
 }
+
+// decodeNamedRules decodes the labelled encryption and decryption blocks of
+// body and returns the remaining body for the regular struct decoding
+func (c *Config) decodeNamedRules(body *hclsyntax.Body) (hcl.Body, hcl.Diagnostics) {
+	var diags hcl.Diagnostics
+
+	rest := *body
+	rest.Blocks = nil
+
+	for _, block := range body.Blocks {
+		if len(block.Labels) != 1 {
+			rest.Blocks = append(rest.Blocks, block)
+			continue
+		}
+
+		switch block.Type {
+		case "encryption":
+			rule := EncryptionConfig{Name: block.Labels[0]}
+			diags = append(diags, gohcl.DecodeBody(block.Body, nil, &rule)...)
+			c.NamedEncryption = append(c.NamedEncryption, rule)
+		case "decryption":
+			rule := DecryptionConfig{Name: block.Labels[0]}
+			diags = append(diags, gohcl.DecodeBody(block.Body, nil, &rule)...)
+			c.NamedDecryption = append(c.NamedDecryption, rule)
+		default:
+			rest.Blocks = append(rest.Blocks, block)
+		}
+	}
+
+	return &rest, diags
+}
+
+// rejectNamedRules reports labelled encryption and decryption blocks in a JSON
+// body. JSON cannot tell them apart from the unlabelled blocks, so a label
+// is any property of those blocks that is not one of their arguments or
+// nested blocks.
+func rejectNamedRules(body hcl.Body) hcl.Diagnostics {
+	encSchema, _ := gohcl.ImpliedBodySchema(EncryptionConfig{})
+	decSchema, _ := gohcl.ImpliedBodySchema(DecryptionConfig{})
+	fields := map[string]*hcl.BodySchema{"encryption": encSchema, "decryption": decSchema}
+
+	// Properties that are not labelled blocks fail to decode here; those
+	// diagnostics are left to the regular struct decoding
+	content, _, _ := body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{
+			{Type: "encryption", LabelNames: []string{"name"}},
+			{Type: "decryption", LabelNames: []string{"name"}},
+		},
+	})
+
+	var diags hcl.Diagnostics
+	for _, block := range content.Blocks {
+		if isSchemaField(fields[block.Type], block.Labels[0]) {
+			continue
+		}
+		diags = append(diags, &hcl.Diagnostic{
+			Severity: hcl.DiagError,
+			Summary:  "Named rules are not supported in JSON",
+			Detail: fmt.Sprintf("The %s block %q is labelled; named %s blocks can only be set in an HCL (.hcl) configuration file.",
+				block.Type, block.Labels[0], block.Type),
+			Subject: block.DefRange.Ptr(),
+		})
+	}
+
+	return diags
+}
+
+// isSchemaField reports whether name is an argument or nested block of schema
+func isSchemaField(schema *hcl.BodySchema, name string) bool {
+	for _, attr := range schema.Attributes {
+		if attr.Name == name {
+			return true
+		}
+	}
+	for _, block := range schema.Blocks {
+		if block.Type == name {
+			return true
+		}
+	}
+	return false
+}
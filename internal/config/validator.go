@@ -2,8 +2,14 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
 )
 
 // ValidationFunc is a function that validates a config and returns an error
@@ -14,17 +20,32 @@ var validationRules = []ValidationFunc{
 	validateVaultAddress,
 	validateVaultTransitMount,
 	validateVaultKeyName,
+	validateVaultTLS,
+	validateCertAuth,
 	validateEncryptionSourceDir,
 	validateEncryptionDestDir,
 	validateEncryptionSourceDirExists,
 	validateEncryptionDestDirExists,
 	validateEncryptionSourceFileBehavior,
 	validateEncryptionChunkSize,
+	validateEncryptionFilePatterns,
+	validateEncryptionFormat,
+	validateEncryptionArchiveDirectories,
+	validateEncryptionDestination,
+	validateEncryptionTrigger,
+	validateEncryptionWatchMode,
 	validateDecryptionIfEnabled,
+	validateNamedEncryption,
+	validateNamedDecryption,
+	validateRuleSourceDirs,
 	validateQueueStatePath,
 	validateQueueMaxRetries,
+	validateQueueWorkers,
+	validateQueueReconcile,
 	validateLoggingLevel,
 	validateLoggingFormat,
+	validateTelemetry,
+	validateHooks,
 }
 
 // Validate validates the configuration using all validation rules
@@ -59,6 +80,58 @@ func validateVaultKeyName(c *Config) error {
 	return nil
 }
 
+func validateVaultTLS(c *Config) error {
+	t := c.Vault.TLS
+	if t == nil {
+		return nil
+	}
+	if (t.ClientCert == "") != (t.ClientKey == "") {
+		return fmt.Errorf("vault tls config: client_cert and client_key must be set together")
+	}
+	files := []struct{ name, path string }{
+		{"ca_cert", t.CACert},
+		{"ca_path", t.CAPath},
+		{"client_cert", t.ClientCert},
+		{"client_key", t.ClientKey},
+	}
+	for _, f := range files {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			return fmt.Errorf("vault tls config: %s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// validateCertAuth checks that TLS certificate auth can present its
+// certificate: it needs an https address, and the certificate is the one
+// used for the TLS connection
+func validateCertAuth(c *Config) error {
+	if c.Vault.Auth == nil || c.Vault.Auth.Method != "cert" {
+		return nil
+	}
+	cert := c.Vault.Auth.Cert
+	if cert == nil {
+		return fmt.Errorf("vault auth config: cert block is required for method 'cert'")
+	}
+	if !strings.HasPrefix(strings.ToLower(c.Vault.AgentAddress), "https://") {
+		return fmt.Errorf("vault auth config: cert auth requires an https agent_address")
+	}
+	if _, err := os.Stat(cert.ClientCert); err != nil {
+		return fmt.Errorf("vault auth config: cert client_cert: %w", err)
+	}
+	if _, err := os.Stat(cert.ClientKey); err != nil {
+		return fmt.Errorf("vault auth config: cert client_key: %w", err)
+	}
+	if t := c.Vault.TLS; t != nil && t.ClientCert != "" &&
+		(t.ClientCert != cert.ClientCert || t.ClientKey != cert.ClientKey) {
+		return fmt.Errorf("vault auth config: cert client_cert/client_key must match vault tls client_cert/client_key")
+	}
+	return nil
+}
+
 // Encryption validation rules
 func validateEncryptionSourceDir(c *Config) error {
 	if c.Encryption.SourceDir == "" {
@@ -68,6 +141,12 @@ func validateEncryptionSourceDir(c *Config) error {
 }
 
 func validateEncryptionDestDir(c *Config) error {
+	if c.Encryption.Destination != nil {
+		if c.Encryption.DestDir != "" {
+			return fmt.Errorf("encryption config: dest_dir cannot be combined with a destination block")
+		}
+		return nil
+	}
 	if c.Encryption.DestDir == "" {
 		return fmt.Errorf("encryption config: dest_dir is required")
 	}
@@ -82,6 +161,9 @@ func validateEncryptionSourceDirExists(c *Config) error {
 }
 
 func validateEncryptionDestDirExists(c *Config) error {
+	if c.Encryption.Destination != nil {
+		return nil
+	}
 	if err := ensureDirectoryExists(c.Encryption.DestDir); err != nil {
 		return fmt.Errorf("encryption config: dest_dir: %w", err)
 	}
@@ -97,6 +179,129 @@ func validateEncryptionSourceFileBehavior(c *Config) error {
 	return nil
 }
 
+func validateEncryptionFormat(c *Config) error {
+	format := strings.ToLower(c.Encryption.Format)
+	if format != "" && format != FormatSplit && format != FormatContainer {
+		return fmt.Errorf("encryption config: format must be '%s' or '%s', got '%s'", FormatSplit, FormatContainer, format)
+	}
+	c.Encryption.Format = format
+	return nil
+}
+
+func validateEncryptionArchiveDirectories(c *Config) error {
+	compression := strings.ToLower(c.Encryption.ArchiveCompression)
+	if compression != "" && compression != "none" && compression != "gzip" {
+		return fmt.Errorf("encryption config: archive_compression must be 'none' or 'gzip', got '%s'", compression)
+	}
+	c.Encryption.ArchiveCompression = compression
+
+	if !c.Encryption.ArchiveDirectories {
+		return nil
+	}
+	// Files inside a marked directory belong to its archive
+	if c.Encryption.Recursive {
+		return fmt.Errorf("encryption config: archive_directories cannot be combined with recursive")
+	}
+	if c.Encryption.SourceFileBehavior == "keep" {
+		return fmt.Errorf("encryption config: archive_directories cannot be combined with source_file_behavior 'keep'")
+	}
+	return nil
+}
+
+func validateEncryptionTrigger(c *Config) error {
+	if err := validateTrigger(&c.Encryption.Trigger, c.Encryption.MarkerSuffix, c.Encryption.MarkerTimeout); err != nil {
+		return fmt.Errorf("encryption config: %w", err)
+	}
+	return nil
+}
+
+// validateTrigger checks the trigger settings of an encryption or decryption
+// block, lowercasing the trigger
+func validateTrigger(trigger *string, markerSuffix string, markerTimeout time.Duration) error {
+	t := strings.ToLower(*trigger)
+	if t != "" && t != TriggerStability && t != TriggerMarker {
+		return fmt.Errorf("trigger must be '%s' or '%s', got '%s'", TriggerStability, TriggerMarker, *trigger)
+	}
+	*trigger = t
+
+	// Markers must not be mistaken for the files the service writes or reads
+	if markerSuffix != "" {
+		if len(markerSuffix) < 2 || !strings.HasPrefix(markerSuffix, ".") || strings.ContainsAny(markerSuffix, `/\`) {
+			return fmt.Errorf("marker_suffix must be a dot followed by a name, got '%s'", markerSuffix)
+		}
+		if markerSuffix == ".enc" || markerSuffix == ".key" || markerSuffix == ".sha256" {
+			return fmt.Errorf("marker_suffix cannot be '%s'", markerSuffix)
+		}
+	}
+
+	if markerTimeout < 0 {
+		return fmt.Errorf("marker_timeout must be positive, got %s", markerTimeout)
+	}
+	return nil
+}
+
+func validateEncryptionWatchMode(c *Config) error {
+	if err := validateWatchMode(&c.Encryption.WatchMode, c.Encryption.PollInterval); err != nil {
+		return fmt.Errorf("encryption config: %w", err)
+	}
+	return nil
+}
+
+// validateWatchMode checks the watch settings of an encryption or decryption
+// block, lowercasing the watch mode
+func validateWatchMode(mode *string, pollInterval time.Duration) error {
+	m := strings.ToLower(*mode)
+	if m != "" && m != WatchModeEvents && m != WatchModePoll && m != WatchModeHybrid {
+		return fmt.Errorf("watch_mode must be '%s', '%s' or '%s', got '%s'", WatchModeEvents, WatchModePoll, WatchModeHybrid, *mode)
+	}
+	*mode = m
+
+	if pollInterval != 0 && pollInterval < MinPollInterval {
+		return fmt.Errorf("poll_interval must be at least %s, got %s", MinPollInterval, pollInterval)
+	}
+	return nil
+}
+
+func validateEncryptionDestination(c *Config) error {
+	d := c.Encryption.Destination
+	if d == nil {
+		return nil
+	}
+
+	if d.Type != DestinationS3 {
+		return fmt.Errorf("encryption config: destination type must be '%s', got '%s'", DestinationS3, d.Type)
+	}
+	if d.Bucket == "" {
+		return fmt.Errorf("encryption config: destination bucket is required")
+	}
+	if d.Endpoint != "" {
+		u, err := url.Parse(d.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("encryption config: destination endpoint must be an http or https URL, got '%s'", d.Endpoint)
+		}
+	}
+
+	keyStorage := strings.ToLower(d.KeyStorage)
+	if keyStorage != KeyStorageObject && keyStorage != KeyStorageMetadata {
+		return fmt.Errorf("encryption config: destination key_storage must be '%s' or '%s', got '%s'", KeyStorageObject, KeyStorageMetadata, d.KeyStorage)
+	}
+	d.KeyStorage = keyStorage
+
+	if d.PartSize < MinPartSize {
+		return fmt.Errorf("encryption config: destination part_size must be >= 5MiB, got %s", FormatSize(d.PartSize))
+	}
+
+	if creds := d.Credentials; creds != nil && (creds.AccessKeyID == "") != (creds.SecretAccessKey == "") {
+		return fmt.Errorf("encryption config: destination credentials need both access_key_id and secret_access_key")
+	}
+
+	// Containers are completed in place once written, which an upload cannot do
+	if c.Encryption.Format == FormatContainer {
+		return fmt.Errorf("encryption config: format '%s' cannot be used with a destination", FormatContainer)
+	}
+	return nil
+}
+
 func validateEncryptionChunkSize(c *Config) error {
 	const (
 		minChunkSize = 64 * 1000        // 64KB (SI units)
@@ -119,6 +324,16 @@ func validateEncryptionChunkSize(c *Config) error {
 	return nil
 }
 
+func validateEncryptionFilePatterns(c *Config) error {
+	if err := validatePatterns(c.Encryption.IncludePatterns()); err != nil {
+		return fmt.Errorf("encryption config: include: %w", err)
+	}
+	if err := validatePatterns(c.Encryption.Exclude); err != nil {
+		return fmt.Errorf("encryption config: exclude: %w", err)
+	}
+	return nil
+}
+
 // Decryption validation rules
 func validateDecryptionIfEnabled(c *Config) error {
 	if c.Decryption == nil || !c.Decryption.Enabled {
@@ -147,6 +362,118 @@ func validateDecryptionIfEnabled(c *Config) error {
 	}
 	c.Decryption.SourceFileBehavior = behavior
 
+	if err := validatePatterns(c.Decryption.Include); err != nil {
+		return fmt.Errorf("decryption config: include: %w", err)
+	}
+	if err := validatePatterns(c.Decryption.Exclude); err != nil {
+		return fmt.Errorf("decryption config: exclude: %w", err)
+	}
+
+	if err := validateTrigger(&c.Decryption.Trigger, c.Decryption.MarkerSuffix, c.Decryption.MarkerTimeout); err != nil {
+		return fmt.Errorf("decryption config: %w", err)
+	}
+
+	if err := validateWatchMode(&c.Decryption.WatchMode, c.Decryption.PollInterval); err != nil {
+		return fmt.Errorf("decryption config: %w", err)
+	}
+
+	quarantine := c.Decryption.QuarantineDir()
+	if isWithinDir(quarantine, c.Decryption.SourceDir) || isWithinDir(quarantine, c.Decryption.DestDir) {
+		return fmt.Errorf("decryption config: quarantine_dir must be outside source_dir and dest_dir, got '%s'", quarantine)
+	}
+
+	return nil
+}
+
+// namedEncryptionRules are applied to each named encryption block
+var namedEncryptionRules = []ValidationFunc{
+	validateEncryptionSourceDir,
+	validateEncryptionDestDir,
+	validateEncryptionSourceDirExists,
+	validateEncryptionDestDirExists,
+	validateEncryptionSourceFileBehavior,
+	validateEncryptionFilePatterns,
+	validateEncryptionFormat,
+	validateEncryptionArchiveDirectories,
+	validateEncryptionDestination,
+	validateEncryptionTrigger,
+	validateEncryptionWatchMode,
+}
+
+// Named rule validation rules
+func validateNamedEncryption(c *Config) error {
+	seen := map[string]bool{}
+	for i := range c.NamedEncryption {
+		rule := &c.NamedEncryption[i]
+		if err := validateRuleName(rule.Name, seen); err != nil {
+			return fmt.Errorf("encryption %q: %w", rule.Name, err)
+		}
+		if rule.ChunkSizeStr != "" {
+			return fmt.Errorf("encryption %q: chunk_size can only be set on the default encryption block", rule.Name)
+		}
+
+		// Reuse the default block's rules on a copy, keeping normalized values
+		sub := &Config{Encryption: *rule}
+		for _, validate := range namedEncryptionRules {
+			if err := validate(sub); err != nil {
+				return fmt.Errorf("encryption %q: %w", rule.Name, err)
+			}
+		}
+		*rule = sub.Encryption
+	}
+	return nil
+}
+
+func validateNamedDecryption(c *Config) error {
+	seen := map[string]bool{}
+	for i := range c.NamedDecryption {
+		rule := &c.NamedDecryption[i]
+		if err := validateRuleName(rule.Name, seen); err != nil {
+			return fmt.Errorf("decryption %q: %w", rule.Name, err)
+		}
+
+		// Named decryption blocks are always active
+		rule.Enabled = true
+		sub := &Config{Decryption: rule}
+		if err := validateDecryptionIfEnabled(sub); err != nil {
+			return fmt.Errorf("decryption %q: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+// isWithinDir reports whether path is dir or inside it
+func isWithinDir(path, dir string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// validateRuleSourceDirs rejects rules that watch the same source directory
+func validateRuleSourceDirs(c *Config) error {
+	owners := map[string]string{}
+	claim := func(operation, name, dir string) error {
+		key := filepath.Clean(dir)
+		owner := fmt.Sprintf("%s %q", operation, name)
+		if previous, ok := owners[key]; ok {
+			return fmt.Errorf("%s: source_dir '%s' is already used by %s", owner, dir, previous)
+		}
+		owners[key] = owner
+		return nil
+	}
+
+	for _, rule := range c.EncryptionRules() {
+		if err := claim("encryption", rule.Name, rule.SourceDir); err != nil {
+			return err
+		}
+	}
+	for _, rule := range c.DecryptionRules() {
+		if !rule.Enabled {
+			continue
+		}
+		if err := claim("decryption", rule.Name, rule.SourceDir); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -165,6 +492,23 @@ func validateQueueMaxRetries(c *Config) error {
 	return nil
 }
 
+func validateQueueWorkers(c *Config) error {
+	if c.Queue.Workers < 0 {
+		return fmt.Errorf("queue config: workers must be >= 0 (0 uses the default), got %d", c.Queue.Workers)
+	}
+	return nil
+}
+
+func validateQueueReconcile(c *Config) error {
+	if c.Queue.ReconcileInterval < 0 {
+		return fmt.Errorf("queue config: reconcile_interval must not be negative, got %s", c.Queue.ReconcileInterval)
+	}
+	if c.Queue.StuckAfter < 0 {
+		return fmt.Errorf("queue config: stuck_after must be positive, got %s", c.Queue.StuckAfter)
+	}
+	return nil
+}
+
 // Logging validation rules
 func validateLoggingLevel(c *Config) error {
 	level := strings.ToLower(c.Logging.Level)
@@ -184,7 +528,120 @@ func validateLoggingFormat(c *Config) error {
 	return nil
 }
 
+// Telemetry validation rules
+func validateTelemetry(c *Config) error {
+	if c.Telemetry == nil {
+		return nil
+	}
+	if c.Telemetry.Listen == "" {
+		return fmt.Errorf("telemetry config: listen is required")
+	}
+	if _, _, err := net.SplitHostPort(c.Telemetry.Listen); err != nil {
+		return fmt.Errorf("telemetry config: listen must be host:port, got '%s'", c.Telemetry.Listen)
+	}
+	if c.Telemetry.HealthCheckInterval < 0 {
+		return fmt.Errorf("telemetry config: health_check_interval must be positive, got %s", c.Telemetry.HealthCheckInterval)
+	}
+	if c.Telemetry.VaultUnreachableTimeout < 0 {
+		return fmt.Errorf("telemetry config: vault_unreachable_timeout must be positive, got %s", c.Telemetry.VaultUnreachableTimeout)
+	}
+	if c.Telemetry.Admin {
+		addr := c.Telemetry.AdminListen
+		if addr == "" {
+			addr = DefaultAdminListen
+		}
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("telemetry config: admin_listen must be host:port, got '%s'", addr)
+		}
+		if addr == c.Telemetry.Listen {
+			return fmt.Errorf("telemetry config: admin_listen must differ from listen, got '%s'", addr)
+		}
+		if !isLoopbackHost(host) && c.Telemetry.AdminToken == "" {
+			return fmt.Errorf("telemetry config: admin_token is required when admin_listen is not a loopback address, got '%s'", addr)
+		}
+	}
+	return nil
+}
+
+// isLoopbackHost reports whether host only accepts local connections
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func validateHooks(c *Config) error {
+	seen := map[string]bool{}
+	for i := range c.Hooks {
+		hook := &c.Hooks[i]
+		if hook.Name == "" || seen[hook.Name] {
+			return fmt.Errorf("hook config: hook labels must be unique and not empty, got '%s'", hook.Name)
+		}
+		seen[hook.Name] = true
+
+		if (len(hook.Command) == 0) == (hook.URL == "") {
+			return fmt.Errorf("hook %q: exactly one of command and url is required", hook.Name)
+		}
+		if hook.URL != "" {
+			u, err := url.Parse(hook.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("hook %q: url must be an http or https URL, got '%s'", hook.Name, hook.URL)
+			}
+			if hook.Secret == "" {
+				return fmt.Errorf("hook %q: secret is required to sign webhook events", hook.Name)
+			}
+		}
+
+		for j, op := range hook.Operations {
+			hook.Operations[j] = strings.ToLower(op)
+			if hook.Operations[j] != "encrypt" && hook.Operations[j] != "decrypt" {
+				return fmt.Errorf("hook %q: operations must be 'encrypt' or 'decrypt', got '%s'", hook.Name, op)
+			}
+		}
+		for j, event := range hook.Events {
+			hook.Events[j] = strings.ToLower(event)
+			switch hook.Events[j] {
+			case HookEventCompleted, HookEventFailed, HookEventDLQ:
+			default:
+				return fmt.Errorf("hook %q: events must be '%s', '%s' or '%s', got '%s'",
+					hook.Name, HookEventCompleted, HookEventFailed, HookEventDLQ, event)
+			}
+		}
+
+		if hook.Timeout <= 0 {
+			return fmt.Errorf("hook %q: timeout must be positive, got %s", hook.Name, hook.Timeout)
+		}
+		if hook.MaxRetries < 0 {
+			return fmt.Errorf("hook %q: max_retries must not be negative, got %d", hook.Name, hook.MaxRetries)
+		}
+	}
+	return nil
+}
+
 // Helper functions
+func validateRuleName(name string, seen map[string]bool) error {
+	if name == "" || name == DefaultRuleName {
+		return fmt.Errorf("block label must not be empty or '%s'", DefaultRuleName)
+	}
+	if seen[name] {
+		return fmt.Errorf("duplicate block label")
+	}
+	seen[name] = true
+	return nil
+}
+
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if pattern == "" || !doublestar.ValidatePattern(pattern) {
+			return fmt.Errorf("invalid glob pattern '%s'", pattern)
+		}
+	}
+	return nil
+}
+
 func ensureDirectoryExists(path string) error {
 	info, err := os.Stat(path)
 	if os.IsNotExist(err) {
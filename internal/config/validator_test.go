@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -216,6 +217,81 @@ func TestValidate_NegativeMaxRetries(t *testing.T) {
 	assert.Contains(t, err.Error(), "max_retries must be >= -1")
 }
 
+func TestValidate_QueueWorkers(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newConfig := func(workers int) *Config {
+		return &Config{
+			Vault: VaultConfig{
+				AgentAddress: "http://127.0.0.1:8200",
+				TransitMount: "transit",
+				KeyName:      "test-key",
+			},
+			Encryption: EncryptionConfig{
+				SourceDir:          filepath.Join(tmpDir, "source"),
+				DestDir:            filepath.Join(tmpDir, "dest"),
+				SourceFileBehavior: "archive",
+				ChunkSize:          1024 * 1024, // 1MB
+			},
+			Queue: QueueConfig{
+				StatePath: filepath.Join(tmpDir, "queue.json"),
+				Workers:   workers,
+			},
+			Logging: LoggingConfig{
+				Level:  "info",
+				Format: "text",
+			},
+		}
+	}
+
+	// 0 uses the default
+	assert.NoError(t, newConfig(0).Validate())
+	assert.NoError(t, newConfig(1).Validate())
+
+	err := newConfig(-1).Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "workers must be >= 0 (0 uses the default), got -1")
+
+	cfg := newConfig(0)
+	cfg.SetDefaults()
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, DefaultWorkers, cfg.Queue.Workers)
+}
+
+func TestValidate_NegativeReconcileInterval(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	cfg := &Config{
+		Vault: VaultConfig{
+			AgentAddress: "http://127.0.0.1:8200",
+			TransitMount: "transit",
+			KeyName:      "test-key",
+		},
+		Encryption: EncryptionConfig{
+			SourceDir:          filepath.Join(tmpDir, "source"),
+			DestDir:            filepath.Join(tmpDir, "dest"),
+			SourceFileBehavior: "archive",
+			ChunkSize:          1024 * 1024, // 1MB
+		},
+		Queue: QueueConfig{
+			StatePath:         filepath.Join(tmpDir, "queue.json"),
+			ReconcileInterval: -time.Minute,
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "text",
+		},
+	}
+
+	err := cfg.Validate()
+	assert.ErrorContains(t, err, "reconcile_interval must not be negative")
+
+	cfg.Queue.ReconcileInterval = 0
+	cfg.Queue.StuckAfter = -time.Minute
+	err = cfg.Validate()
+	assert.ErrorContains(t, err, "stuck_after must be positive")
+}
+
 func TestValidate_WithDecryption(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -256,6 +332,49 @@ func TestValidate_WithDecryption(t *testing.T) {
 	assert.DirExists(t, filepath.Join(tmpDir, "dec-dest"))
 }
 
+func TestValidate_QuarantineDir(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newConfig := func(quarantine string) *Config {
+		return &Config{
+			Vault: VaultConfig{
+				AgentAddress: "http://127.0.0.1:8200",
+				TransitMount: "transit",
+				KeyName:      "test-key",
+			},
+			Encryption: EncryptionConfig{
+				SourceDir:          filepath.Join(tmpDir, "enc-source"),
+				DestDir:            filepath.Join(tmpDir, "enc-dest"),
+				SourceFileBehavior: "archive",
+				ChunkSize:          1024 * 1024, // 1MB
+			},
+			Decryption: &DecryptionConfig{
+				Enabled:            true,
+				SourceDir:          filepath.Join(tmpDir, "dec-source"),
+				DestDir:            filepath.Join(tmpDir, "dec-dest"),
+				SourceFileBehavior: "archive",
+				QuarantinePath:     quarantine,
+			},
+			Queue: QueueConfig{
+				StatePath: filepath.Join(tmpDir, "queue.json"),
+			},
+			Logging: LoggingConfig{
+				Level:  "info",
+				Format: "text",
+			},
+		}
+	}
+
+	assert.NoError(t, newConfig("").Validate())
+	assert.NoError(t, newConfig(filepath.Join(tmpDir, "secure", "quarantine")).Validate())
+
+	for _, dir := range []string{"dec-source", filepath.Join("dec-source", "quarantine"), filepath.Join("dec-dest", "bad")} {
+		err := newConfig(filepath.Join(tmpDir, dir)).Validate()
+		require.Error(t, err, dir)
+		assert.Contains(t, err.Error(), "quarantine_dir must be outside source_dir and dest_dir")
+	}
+}
+
 func TestValidate_DecryptionDisabled(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -315,3 +434,517 @@ func TestEnsureDirectoryExists_PathIsFile(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "path exists but is not a directory")
 }
+
+func TestValidate_InvalidFilePattern(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	cfg := &Config{
+		Vault: VaultConfig{
+			AgentAddress: "http://127.0.0.1:8200",
+			TransitMount: "transit",
+			KeyName:      "test-key",
+		},
+		Encryption: EncryptionConfig{
+			SourceDir:          filepath.Join(tmpDir, "source"),
+			DestDir:            filepath.Join(tmpDir, "dest"),
+			SourceFileBehavior: "archive",
+			ChunkSize:          1024 * 1024, // 1MB
+			Exclude:            []string{"[unterminated"},
+		},
+		Queue: QueueConfig{
+			StatePath: filepath.Join(tmpDir, "queue.json"),
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "text",
+		},
+	}
+
+	err := cfg.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid glob pattern")
+}
+
+func TestValidate_EncryptionFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newConfig := func(format string) *Config {
+		return &Config{
+			Vault: VaultConfig{
+				AgentAddress: "http://127.0.0.1:8200",
+				TransitMount: "transit",
+				KeyName:      "test-key",
+			},
+			Encryption: EncryptionConfig{
+				SourceDir:          filepath.Join(tmpDir, "source"),
+				DestDir:            filepath.Join(tmpDir, "dest"),
+				SourceFileBehavior: "archive",
+				ChunkSize:          1024 * 1024, // 1MB
+				Format:             format,
+			},
+			Queue: QueueConfig{
+				StatePath: filepath.Join(tmpDir, "queue.json"),
+			},
+			Logging: LoggingConfig{
+				Level:  "info",
+				Format: "text",
+			},
+		}
+	}
+
+	cfg := newConfig("Container")
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, FormatContainer, cfg.Encryption.Format)
+
+	err := newConfig("zip").Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "format must be")
+}
+
+func TestValidate_ArchiveDirectories(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newConfig := func(enc EncryptionConfig) *Config {
+		enc.SourceDir = filepath.Join(tmpDir, "source")
+		enc.DestDir = filepath.Join(tmpDir, "dest")
+		enc.ChunkSize = 1024 * 1024 // 1MB
+		enc.ArchiveDirectories = true
+		return &Config{
+			Vault: VaultConfig{
+				AgentAddress: "http://127.0.0.1:8200",
+				TransitMount: "transit",
+				KeyName:      "test-key",
+			},
+			Encryption: enc,
+			Queue: QueueConfig{
+				StatePath: filepath.Join(tmpDir, "queue.json"),
+			},
+			Logging: LoggingConfig{
+				Level:  "info",
+				Format: "text",
+			},
+		}
+	}
+
+	cfg := newConfig(EncryptionConfig{SourceFileBehavior: "archive", ArchiveCompression: "GZIP"})
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, "gzip", cfg.Encryption.ArchiveCompression)
+
+	err := newConfig(EncryptionConfig{SourceFileBehavior: "archive", ArchiveCompression: "zstd"}).Validate()
+	assert.ErrorContains(t, err, "archive_compression must be")
+
+	err = newConfig(EncryptionConfig{SourceFileBehavior: "archive", Recursive: true}).Validate()
+	assert.ErrorContains(t, err, "cannot be combined with recursive")
+
+	err = newConfig(EncryptionConfig{SourceFileBehavior: "keep"}).Validate()
+	assert.ErrorContains(t, err, "cannot be combined with source_file_behavior 'keep'")
+}
+
+func TestValidate_Destination(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newConfig := func(enc EncryptionConfig, dest DestinationConfig) *Config {
+		enc.SourceDir = filepath.Join(tmpDir, "source")
+		enc.SourceFileBehavior = "archive"
+		enc.ChunkSize = 1024 * 1024 // 1MB
+		dest.Type = DestinationS3
+		dest.Bucket = "encrypted"
+		if dest.PartSize == 0 {
+			dest.PartSize = DefaultPartSize
+		}
+		enc.Destination = &dest
+		return &Config{
+			Vault: VaultConfig{
+				AgentAddress: "http://127.0.0.1:8200",
+				TransitMount: "transit",
+				KeyName:      "test-key",
+			},
+			Encryption: enc,
+			Queue: QueueConfig{
+				StatePath: filepath.Join(tmpDir, "queue.json"),
+			},
+			Logging: LoggingConfig{
+				Level:  "info",
+				Format: "text",
+			},
+		}
+	}
+
+	cfg := newConfig(EncryptionConfig{}, DestinationConfig{Endpoint: "http://127.0.0.1:9000", KeyStorage: "Metadata"})
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, KeyStorageMetadata, cfg.Encryption.Destination.KeyStorage)
+
+	err := newConfig(EncryptionConfig{DestDir: filepath.Join(tmpDir, "dest")}, DestinationConfig{KeyStorage: KeyStorageObject}).Validate()
+	assert.ErrorContains(t, err, "dest_dir cannot be combined with a destination block")
+
+	err = newConfig(EncryptionConfig{}, DestinationConfig{Endpoint: "minio:9000", KeyStorage: KeyStorageObject}).Validate()
+	assert.ErrorContains(t, err, "endpoint must be an http or https URL")
+
+	err = newConfig(EncryptionConfig{}, DestinationConfig{KeyStorage: "tags"}).Validate()
+	assert.ErrorContains(t, err, "key_storage must be")
+
+	err = newConfig(EncryptionConfig{}, DestinationConfig{KeyStorage: KeyStorageObject, PartSize: 1024 * 1024}).Validate()
+	assert.ErrorContains(t, err, "part_size must be >= 5MiB")
+
+	err = newConfig(EncryptionConfig{}, DestinationConfig{
+		KeyStorage:  KeyStorageObject,
+		Credentials: &S3CredentialsConfig{AccessKeyID: "key"},
+	}).Validate()
+	assert.ErrorContains(t, err, "need both access_key_id and secret_access_key")
+
+	err = newConfig(EncryptionConfig{Format: FormatContainer}, DestinationConfig{KeyStorage: KeyStorageObject}).Validate()
+	assert.ErrorContains(t, err, "cannot be used with a destination")
+}
+
+func TestValidate_Hooks(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newConfig := func(hooks ...HookConfig) *Config {
+		for i := range hooks {
+			hooks[i].Timeout = DefaultHookTimeout
+		}
+		return &Config{
+			Vault: VaultConfig{
+				AgentAddress: "http://127.0.0.1:8200",
+				TransitMount: "transit",
+				KeyName:      "test-key",
+			},
+			Encryption: EncryptionConfig{
+				SourceDir:          filepath.Join(tmpDir, "source"),
+				DestDir:            filepath.Join(tmpDir, "dest"),
+				SourceFileBehavior: "archive",
+				ChunkSize:          1024 * 1024, // 1MB
+			},
+			Queue: QueueConfig{
+				StatePath: filepath.Join(tmpDir, "queue.json"),
+			},
+			Logging: LoggingConfig{
+				Level:  "info",
+				Format: "text",
+			},
+			Hooks: hooks,
+		}
+	}
+
+	cfg := newConfig(
+		HookConfig{Name: "notify", Command: []string{"/usr/local/bin/notify"}, Events: []string{"DLQ"}},
+		HookConfig{Name: "siem", URL: "https://siem.example.com/events", Secret: "s3cret", Operations: []string{"Encrypt"}},
+	)
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, []string{HookEventDLQ}, cfg.Hooks[0].Events)
+	assert.Equal(t, []string{"encrypt"}, cfg.Hooks[1].Operations)
+
+	err := newConfig(HookConfig{Name: "both", Command: []string{"notify"}, URL: "https://siem.example.com", Secret: "s"}).Validate()
+	assert.ErrorContains(t, err, "exactly one of command and url is required")
+
+	err = newConfig(HookConfig{Name: "unsigned", URL: "https://siem.example.com"}).Validate()
+	assert.ErrorContains(t, err, "secret is required")
+
+	err = newConfig(HookConfig{Name: "ftp", URL: "ftp://siem.example.com", Secret: "s"}).Validate()
+	assert.ErrorContains(t, err, "url must be an http or https URL")
+
+	err = newConfig(HookConfig{Name: "notify", Command: []string{"notify"}, Events: []string{"started"}}).Validate()
+	assert.ErrorContains(t, err, "events must be")
+
+	err = newConfig(HookConfig{Name: "notify", Command: []string{"notify"}, Operations: []string{"rewrap"}}).Validate()
+	assert.ErrorContains(t, err, "operations must be")
+
+	err = newConfig(HookConfig{Name: "notify", Command: []string{"a"}}, HookConfig{Name: "notify", Command: []string{"b"}}).Validate()
+	assert.ErrorContains(t, err, "hook labels must be unique")
+}
+
+func TestValidate_NamedRules(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newConfig := func() *Config {
+		return &Config{
+			Vault: VaultConfig{
+				AgentAddress: "http://127.0.0.1:8200",
+				TransitMount: "transit",
+				KeyName:      "test-key",
+			},
+			Encryption: EncryptionConfig{
+				SourceDir:          filepath.Join(tmpDir, "source"),
+				DestDir:            filepath.Join(tmpDir, "dest"),
+				SourceFileBehavior: "archive",
+				ChunkSize:          1024 * 1024, // 1MB
+			},
+			NamedEncryption: []EncryptionConfig{{
+				Name:               "finance",
+				KeyName:            "finance",
+				SourceDir:          filepath.Join(tmpDir, "finance", "source"),
+				DestDir:            filepath.Join(tmpDir, "finance", "dest"),
+				SourceFileBehavior: "Delete",
+				ChunkSize:          1024 * 1024,
+			}},
+			Queue: QueueConfig{
+				StatePath: filepath.Join(tmpDir, "queue.json"),
+			},
+			Logging: LoggingConfig{
+				Level:  "info",
+				Format: "text",
+			},
+		}
+	}
+
+	cfg := newConfig()
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, "delete", cfg.NamedEncryption[0].SourceFileBehavior)
+	assert.DirExists(t, filepath.Join(tmpDir, "finance", "source"))
+
+	cfg = newConfig()
+	cfg.NamedEncryption[0].DestDir = ""
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `encryption "finance": encryption config: dest_dir is required`)
+
+	cfg = newConfig()
+	cfg.NamedEncryption = append(cfg.NamedEncryption, cfg.NamedEncryption[0])
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "duplicate block label")
+
+	cfg = newConfig()
+	cfg.NamedEncryption[0].Name = DefaultRuleName
+	require.Error(t, cfg.Validate())
+
+	cfg = newConfig()
+	cfg.NamedEncryption[0].ChunkSizeStr = "2MB"
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "chunk_size can only be set on the default encryption block")
+
+	cfg = newConfig()
+	cfg.NamedEncryption[0].SourceDir = cfg.Encryption.SourceDir
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `is already used by encryption "default"`)
+
+	cfg = newConfig()
+	cfg.NamedDecryption = []DecryptionConfig{{
+		Name:               "finance",
+		Enabled:            true,
+		SourceDir:          filepath.Join(tmpDir, "finance", "dest"),
+		DestDir:            filepath.Join(tmpDir, "finance", "plain"),
+		SourceFileBehavior: "archive",
+	}}
+	require.NoError(t, cfg.Validate(), "encryption and decryption rules may share a label")
+}
+
+func TestValidate_Telemetry(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newConfig := func(telemetry *TelemetryConfig) *Config {
+		return &Config{
+			Vault: VaultConfig{
+				AgentAddress: "http://127.0.0.1:8200",
+				TransitMount: "transit",
+				KeyName:      "test-key",
+			},
+			Encryption: EncryptionConfig{
+				SourceDir:          filepath.Join(tmpDir, "source"),
+				DestDir:            filepath.Join(tmpDir, "dest"),
+				SourceFileBehavior: "archive",
+				ChunkSize:          1024 * 1024, // 1MB
+			},
+			Queue: QueueConfig{
+				StatePath: filepath.Join(tmpDir, "queue.json"),
+			},
+			Logging: LoggingConfig{
+				Level:  "info",
+				Format: "text",
+			},
+			Telemetry: telemetry,
+		}
+	}
+
+	assert.NoError(t, newConfig(&TelemetryConfig{Listen: ":9102"}).Validate())
+	assert.NoError(t, newConfig(&TelemetryConfig{Listen: "127.0.0.1:9102"}).Validate())
+
+	err := newConfig(&TelemetryConfig{}).Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "listen is required")
+
+	err = newConfig(&TelemetryConfig{Listen: "9102"}).Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "listen must be host:port")
+
+	err = newConfig(&TelemetryConfig{Listen: ":9102", HealthCheckInterval: -time.Second}).Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "health_check_interval")
+
+	// The admin API needs a token unless it only listens on loopback
+	assert.NoError(t, newConfig(&TelemetryConfig{Listen: ":9102", Admin: true}).Validate())
+	assert.NoError(t, newConfig(&TelemetryConfig{Listen: ":9102", Admin: true, AdminListen: "localhost:9103"}).Validate())
+	assert.NoError(t, newConfig(&TelemetryConfig{Listen: ":9102", Admin: true, AdminListen: "[::1]:9103"}).Validate())
+	assert.NoError(t, newConfig(&TelemetryConfig{Listen: ":9102", Admin: true, AdminListen: ":9103", AdminToken: "secret"}).Validate())
+
+	for _, addr := range []string{":9103", "0.0.0.0:9103", "10.0.0.5:9103"} {
+		err = newConfig(&TelemetryConfig{Listen: ":9102", Admin: true, AdminListen: addr}).Validate()
+		require.Error(t, err, addr)
+		assert.Contains(t, err.Error(), "admin_token is required")
+	}
+
+	err = newConfig(&TelemetryConfig{Listen: "127.0.0.1:9102", Admin: true, AdminListen: "127.0.0.1:9102"}).Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "admin_listen must differ from listen")
+}
+
+func TestValidate_VaultTLS(t *testing.T) {
+	tmpDir := t.TempDir()
+	certFile := filepath.Join(tmpDir, "client.crt")
+	keyFile := filepath.Join(tmpDir, "client-key.pem")
+	require.NoError(t, os.WriteFile(certFile, []byte("cert"), 0600))
+	require.NoError(t, os.WriteFile(keyFile, []byte("key"), 0600))
+
+	newConfig := func() *Config {
+		return &Config{
+			Vault: VaultConfig{
+				AgentAddress: "https://127.0.0.1:8200",
+				TransitMount: "transit",
+				KeyName:      "test-key",
+			},
+			Encryption: EncryptionConfig{
+				SourceDir:          filepath.Join(tmpDir, "source"),
+				DestDir:            filepath.Join(tmpDir, "dest"),
+				SourceFileBehavior: "archive",
+				ChunkSize:          1024 * 1024, // 1MB
+			},
+			Queue: QueueConfig{
+				StatePath: filepath.Join(tmpDir, "queue.json"),
+			},
+			Logging: LoggingConfig{
+				Level:  "info",
+				Format: "text",
+			},
+		}
+	}
+
+	cfg := newConfig()
+	cfg.Vault.TLS = &TLSConfig{CACert: certFile, CAPath: tmpDir, ClientCert: certFile, ClientKey: keyFile}
+	assert.NoError(t, cfg.Validate())
+
+	cfg = newConfig()
+	cfg.Vault.TLS = &TLSConfig{ClientCert: certFile}
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "client_cert and client_key must be set together")
+
+	cfg = newConfig()
+	cfg.Vault.TLS = &TLSConfig{CACert: filepath.Join(tmpDir, "missing.crt")}
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "vault tls config: ca_cert")
+
+	// Cert auth
+	certAuth := func() *AuthConfig {
+		return &AuthConfig{
+			Method: "cert",
+			Cert:   &CertAuthConfig{ClientCert: certFile, ClientKey: keyFile},
+		}
+	}
+
+	cfg = newConfig()
+	cfg.Vault.Auth = certAuth()
+	assert.NoError(t, cfg.Validate())
+
+	cfg = newConfig()
+	cfg.Vault.AgentAddress = "http://127.0.0.1:8200"
+	cfg.Vault.Auth = certAuth()
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cert auth requires an https agent_address")
+
+	cfg = newConfig()
+	cfg.Vault.Auth = certAuth()
+	cfg.Vault.Auth.Cert.ClientKey = filepath.Join(tmpDir, "missing.pem")
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cert client_key")
+
+	cfg = newConfig()
+	cfg.Vault.Auth = certAuth()
+	cfg.Vault.TLS = &TLSConfig{ClientCert: keyFile, ClientKey: certFile}
+	err = cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must match vault tls")
+}
+
+func TestValidate_Trigger(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newConfig := func(enc EncryptionConfig) *Config {
+		enc.SourceDir = filepath.Join(tmpDir, "source")
+		enc.DestDir = filepath.Join(tmpDir, "dest")
+		enc.SourceFileBehavior = "archive"
+		enc.ChunkSize = 1024 * 1024 // 1MB
+		return &Config{
+			Vault: VaultConfig{
+				AgentAddress: "http://127.0.0.1:8200",
+				TransitMount: "transit",
+				KeyName:      "test-key",
+			},
+			Encryption: enc,
+			Queue: QueueConfig{
+				StatePath: filepath.Join(tmpDir, "queue.json"),
+			},
+			Logging: LoggingConfig{
+				Level:  "info",
+				Format: "text",
+			},
+		}
+	}
+
+	cfg := newConfig(EncryptionConfig{Trigger: "Marker", MarkerSuffix: ".ok"})
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, TriggerMarker, cfg.Encryption.Trigger)
+	assert.Equal(t, []string{".ok"}, cfg.Encryption.MarkerSuffixes())
+
+	err := newConfig(EncryptionConfig{Trigger: "inotify"}).Validate()
+	assert.ErrorContains(t, err, "trigger must be 'stability' or 'marker'")
+
+	err = newConfig(EncryptionConfig{Trigger: TriggerMarker, MarkerSuffix: "ok"}).Validate()
+	assert.ErrorContains(t, err, "marker_suffix must be a dot followed by a name")
+
+	err = newConfig(EncryptionConfig{Trigger: TriggerMarker, MarkerSuffix: ".key"}).Validate()
+	assert.ErrorContains(t, err, "marker_suffix cannot be '.key'")
+
+	err = newConfig(EncryptionConfig{Trigger: TriggerMarker, MarkerTimeout: -time.Minute}).Validate()
+	assert.ErrorContains(t, err, "marker_timeout must be positive")
+}
+
+func TestValidate_WatchMode(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	newConfig := func(enc EncryptionConfig) *Config {
+		enc.SourceDir = filepath.Join(tmpDir, "source")
+		enc.DestDir = filepath.Join(tmpDir, "dest")
+		enc.SourceFileBehavior = "archive"
+		enc.ChunkSize = 1024 * 1024 // 1MB
+		return &Config{
+			Vault: VaultConfig{
+				AgentAddress: "http://127.0.0.1:8200",
+				TransitMount: "transit",
+				KeyName:      "test-key",
+			},
+			Encryption: enc,
+			Queue: QueueConfig{
+				StatePath: filepath.Join(tmpDir, "queue.json"),
+			},
+			Logging: LoggingConfig{
+				Level:  "info",
+				Format: "text",
+			},
+		}
+	}
+
+	cfg := newConfig(EncryptionConfig{WatchMode: "Hybrid", PollInterval: 30 * time.Second})
+	require.NoError(t, cfg.Validate())
+	assert.Equal(t, WatchModeHybrid, cfg.Encryption.WatchMode)
+
+	err := newConfig(EncryptionConfig{WatchMode: "inotify"}).Validate()
+	assert.ErrorContains(t, err, "watch_mode must be 'events', 'poll' or 'hybrid'")
+
+	err = newConfig(EncryptionConfig{WatchMode: WatchModePoll, PollInterval: 100 * time.Millisecond}).Validate()
+	assert.ErrorContains(t, err, "poll_interval must be at least 1s")
+}
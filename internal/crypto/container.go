@@ -0,0 +1,211 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/vault"
+)
+
+// Self-describing container layout:
+//
+//	magic "VFEC" (4 bytes) | format version (1 byte) | header region size (uint32, big endian)
+//	header region: JSON ContainerHeader padded with spaces
+//	body: encrypted file content
+//
+// The header region is larger than the JSON it holds so the wrapped data key
+// can be replaced in place (e.g. by rewrap) without rewriting the body.
+const (
+	// ContainerVersion is the current container format version
+	ContainerVersion = 1
+
+	// containerPrefixSize is the size of magic + version + region size
+	containerPrefixSize = 4 + 1 + 4
+
+	// containerHeaderRegion is the minimum size reserved for the JSON header
+	containerHeaderRegion = 4096
+
+	// maxContainerHeaderRegion guards against reading corrupt region sizes
+	maxContainerHeaderRegion = 1024 * 1024
+)
+
+var containerMagic = []byte("VFEC")
+
+// ErrNotContainer is returned when a file is not a self-describing container
+var ErrNotContainer = errors.New("not an encrypted container")
+
+// ContainerHeader describes the encrypted body of a container file
+type ContainerHeader struct {
+	Ciphertext   string `json:"ciphertext"` // Wrapped DEK (vault:vN:...)
+	Namespace    string `json:"namespace,omitempty"`
+	TransitMount string `json:"transit_mount"`
+	KeyName      string `json:"key_name"`
+	ChunkSize    int    `json:"chunk_size"`
+	Filename     string `json:"filename"` // Original file name
+	Size         int64  `json:"size"`     // Original file size in bytes
+	Checksum     string `json:"checksum,omitempty"`
+}
+
+// IsContainer reports whether the file at path starts with the container magic
+func IsContainer(path string) (bool, error) {
+	f, err := os.Open(path) // #nosec G304 - intentional file encryption tool
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+
+	magic := make([]byte, len(containerMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return bytes.Equal(magic, containerMagic), nil
+}
+
+// ReadContainerHeader reads the header of the container file at path
+func ReadContainerHeader(path string) (*ContainerHeader, error) {
+	f, err := os.Open(path) // #nosec G304 - intentional file encryption tool
+	if err != nil {
+		return nil, fmt.Errorf("failed to open container: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	header, _, err := readContainerHeader(f)
+	return header, err
+}
+
+// KeyRef returns the transit key that wrapped the embedded data key
+func (h *ContainerHeader) KeyRef() vault.KeyRef {
+	return vault.KeyRef{
+		Namespace:    h.Namespace,
+		TransitMount: h.TransitMount,
+		KeyName:      h.KeyName,
+	}
+}
+
+// UpdateContainerHeader replaces the header of the container file at path in
+// place. The encrypted body is not modified.
+func UpdateContainerHeader(path string, header *ContainerHeader) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0) // #nosec G304 - intentional file encryption tool
+	if err != nil {
+		return fmt.Errorf("failed to open container: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	_, region, err := readContainerHeader(f)
+	if err != nil {
+		return err
+	}
+
+	data, err := encodeContainerHeader(header, region)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.WriteAt(data, containerPrefixSize); err != nil {
+		return fmt.Errorf("failed to write container header: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync container: %w", err)
+	}
+
+	return nil
+}
+
+// writeContainerHeader writes the prefix and padded header region to w and
+// returns the region size
+func writeContainerHeader(w io.Writer, header *ContainerHeader) (int, error) {
+	data, err := json.Marshal(header)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode container header: %w", err)
+	}
+
+	// Leave room for the wrapped key to grow (e.g. vault:v9 -> vault:v10)
+	region := containerHeaderRegion
+	for region < len(data)*2 {
+		region *= 2
+	}
+
+	padded, err := encodeContainerHeader(header, region)
+	if err != nil {
+		return 0, err
+	}
+
+	prefix := make([]byte, containerPrefixSize)
+	copy(prefix, containerMagic)
+	prefix[4] = ContainerVersion
+	binary.BigEndian.PutUint32(prefix[5:], uint32(region)) // #nosec G115 - region is bounded above
+
+	if _, err := w.Write(prefix); err != nil {
+		return 0, fmt.Errorf("failed to write container prefix: %w", err)
+	}
+	if _, err := w.Write(padded); err != nil {
+		return 0, fmt.Errorf("failed to write container header: %w", err)
+	}
+
+	return region, nil
+}
+
+// encodeContainerHeader marshals header and pads it to exactly region bytes
+func encodeContainerHeader(header *ContainerHeader, region int) ([]byte, error) {
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode container header: %w", err)
+	}
+
+	if len(data) > region {
+		return nil, fmt.Errorf("container header (%d bytes) exceeds reserved space (%d bytes)", len(data), region)
+	}
+
+	return append(data, bytes.Repeat([]byte(" "), region-len(data))...), nil
+}
+
+// readContainerHeader reads the prefix and header from r, leaving r positioned
+// at the start of the encrypted body. It returns the header region size.
+func readContainerHeader(r io.Reader) (*ContainerHeader, int, error) {
+	prefix := make([]byte, containerPrefixSize)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, 0, ErrNotContainer
+		}
+		return nil, 0, fmt.Errorf("failed to read container prefix: %w", err)
+	}
+
+	if !bytes.Equal(prefix[:4], containerMagic) {
+		return nil, 0, ErrNotContainer
+	}
+
+	if prefix[4] != ContainerVersion {
+		return nil, 0, fmt.Errorf("unsupported container version %d", prefix[4])
+	}
+
+	region := int(binary.BigEndian.Uint32(prefix[5:]))
+	if region <= 0 || region > maxContainerHeaderRegion {
+		return nil, 0, fmt.Errorf("invalid container header size %d", region)
+	}
+
+	data := make([]byte, region)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, 0, fmt.Errorf("failed to read container header: %w", err)
+	}
+
+	var header ContainerHeader
+	if err := json.Unmarshal(bytes.TrimRight(data, " "), &header); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse container header: %w", err)
+	}
+
+	if header.Ciphertext == "" {
+		return nil, 0, fmt.Errorf("container header is missing the wrapped data key")
+	}
+
+	return &header, region, nil
+}
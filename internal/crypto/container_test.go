@@ -0,0 +1,173 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptor_EncryptFileContainer_RoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceFile := filepath.Join(tmpDir, "report.csv")
+	containerFile := filepath.Join(tmpDir, "report.csv.enc")
+	decryptedFile := filepath.Join(tmpDir, "report.decrypted.csv")
+
+	testContent := bytes.Repeat([]byte("container test content\n"), 5000)
+	require.NoError(t, os.WriteFile(sourceFile, testContent, 0600))
+
+	cfg := &EncryptorConfig{ChunkSize: 64 * 1024, TransitMount: "transit", KeyName: "test-key"}
+	encryptor := NewEncryptor(&mockVaultClient{}, cfg)
+
+	var lastProgress float64
+	header, err := encryptor.EncryptFileContainer(context.Background(), sourceFile, containerFile, func(p float64) {
+		lastProgress = p
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 100.0, lastProgress)
+
+	assert.Equal(t, "vault:v1:test-encrypted-key", header.Ciphertext)
+	assert.Equal(t, "transit", header.TransitMount)
+	assert.Equal(t, "test-key", header.KeyName)
+	assert.Equal(t, 64*1024, header.ChunkSize)
+	assert.Equal(t, "report.csv", header.Filename)
+	assert.Equal(t, int64(len(testContent)), header.Size)
+
+	expectedChecksum, err := CalculateChecksum(sourceFile)
+	require.NoError(t, err)
+	assert.Equal(t, expectedChecksum, header.Checksum)
+
+	isContainer, err := IsContainer(containerFile)
+	require.NoError(t, err)
+	assert.True(t, isContainer)
+
+	// No key file is needed: the key path is ignored for containers
+	decryptor := NewDecryptor(&mockVaultClient{}, cfg)
+	err = decryptor.DecryptFile(context.Background(), containerFile, "", decryptedFile, nil)
+	require.NoError(t, err)
+
+	decrypted, err := os.ReadFile(decryptedFile)
+	require.NoError(t, err)
+	assert.Equal(t, testContent, decrypted)
+}
+
+func TestUpdateContainerHeader_InPlace(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceFile := filepath.Join(tmpDir, "data.txt")
+	containerFile := filepath.Join(tmpDir, "data.txt.enc")
+	require.NoError(t, os.WriteFile(sourceFile, []byte("rewrap me"), 0600))
+
+	encryptor := NewEncryptor(&mockVaultClient{}, nil)
+	header, err := encryptor.EncryptFileContainer(context.Background(), sourceFile, containerFile, nil)
+	require.NoError(t, err)
+
+	before, err := os.ReadFile(containerFile)
+	require.NoError(t, err)
+
+	header.Ciphertext = "vault:v12:rewrapped-key"
+	require.NoError(t, UpdateContainerHeader(containerFile, header))
+
+	after, err := os.ReadFile(containerFile)
+	require.NoError(t, err)
+	require.Equal(t, len(before), len(after))
+
+	// The encrypted body is byte-for-byte unchanged
+	bodyOffset := containerPrefixSize + containerHeaderRegion
+	assert.Equal(t, before[bodyOffset:], after[bodyOffset:])
+
+	updated, err := ReadContainerHeader(containerFile)
+	require.NoError(t, err)
+	assert.Equal(t, "vault:v12:rewrapped-key", updated.Ciphertext)
+	assert.Equal(t, header.Checksum, updated.Checksum)
+}
+
+func TestUpdateContainerHeader_TooLarge(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceFile := filepath.Join(tmpDir, "data.txt")
+	containerFile := filepath.Join(tmpDir, "data.txt.enc")
+	require.NoError(t, os.WriteFile(sourceFile, []byte("data"), 0600))
+
+	encryptor := NewEncryptor(&mockVaultClient{}, nil)
+	header, err := encryptor.EncryptFileContainer(context.Background(), sourceFile, containerFile, nil)
+	require.NoError(t, err)
+
+	header.Ciphertext = "vault:v2:" + string(bytes.Repeat([]byte("A"), containerHeaderRegion))
+	err = UpdateContainerHeader(containerFile, header)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds reserved space")
+}
+
+func TestIsContainer_LegacyFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceFile := filepath.Join(tmpDir, "data.txt")
+	encFile := filepath.Join(tmpDir, "data.txt.enc")
+	emptyFile := filepath.Join(tmpDir, "empty.enc")
+	require.NoError(t, os.WriteFile(sourceFile, []byte("legacy"), 0600))
+	require.NoError(t, os.WriteFile(emptyFile, nil, 0600))
+
+	encryptor := NewEncryptor(&mockVaultClient{}, nil)
+	_, err := encryptor.EncryptFile(context.Background(), sourceFile, encFile, nil)
+	require.NoError(t, err)
+
+	for _, path := range []string{sourceFile, encFile, emptyFile} {
+		isContainer, err := IsContainer(path)
+		require.NoError(t, err)
+		assert.False(t, isContainer, path)
+	}
+
+	_, err = ReadContainerHeader(encFile)
+	assert.ErrorIs(t, err, ErrNotContainer)
+}
+
+func TestDecryptor_DecryptContainer_KeyMismatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceFile := filepath.Join(tmpDir, "data.txt")
+	containerFile := filepath.Join(tmpDir, "data.txt.enc")
+	require.NoError(t, os.WriteFile(sourceFile, []byte("data"), 0600))
+
+	encryptor := NewEncryptor(&mockVaultClient{}, &EncryptorConfig{TransitMount: "transit", KeyName: "key-a"})
+	_, err := encryptor.EncryptFileContainer(context.Background(), sourceFile, containerFile, nil)
+	require.NoError(t, err)
+
+	called := false
+	mock := &mockVaultClient{
+		decryptKeyFunc: func(string) (*vault.DataKey, error) {
+			called = true
+			return nil, nil
+		},
+	}
+	decryptor := NewDecryptor(mock, &EncryptorConfig{TransitMount: "transit", KeyName: "key-b"})
+	err = decryptor.DecryptFile(context.Background(), containerFile, "", filepath.Join(tmpDir, "out.txt"), nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "key-a")
+	assert.False(t, called)
+}
+
+func TestDecryptor_DecryptContainer_SizeMismatch(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceFile := filepath.Join(tmpDir, "data.txt")
+	containerFile := filepath.Join(tmpDir, "data.txt.enc")
+	decryptedFile := filepath.Join(tmpDir, "data.decrypted.txt")
+	require.NoError(t, os.WriteFile(sourceFile, []byte("size matters"), 0600))
+
+	encryptor := NewEncryptor(&mockVaultClient{}, nil)
+	header, err := encryptor.EncryptFileContainer(context.Background(), sourceFile, containerFile, nil)
+	require.NoError(t, err)
+
+	// Tamper with the size recorded in the header
+	header.Size++
+	require.NoError(t, UpdateContainerHeader(containerFile, header))
+
+	decryptor := NewDecryptor(&mockVaultClient{}, nil)
+	err = decryptor.DecryptFile(context.Background(), containerFile, "", decryptedFile, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "does not match container header size")
+
+	_, err = os.Stat(decryptedFile)
+	assert.True(t, os.IsNotExist(err), "output file should be removed")
+}
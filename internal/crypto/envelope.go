@@ -3,7 +3,9 @@ package crypto
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 
 	fileencrypt "github.com/gitrgoliveira/go-fileencrypt"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/vault"
@@ -15,6 +17,13 @@ type VaultClient interface {
 	DecryptDataKey(ciphertext string) (*vault.DataKey, error)
 }
 
+// KeyedVaultClient is implemented by vault clients that can generate and
+// unwrap data keys with a transit key other than the configured one
+type KeyedVaultClient interface {
+	GenerateDataKeyWithKey(ref vault.KeyRef) (*vault.DataKey, error)
+	DecryptDataKeyWithKey(ref vault.KeyRef, ciphertext string) (*vault.DataKey, error)
+}
+
 const (
 	// DefaultChunkSize for file operations: 1MB
 	DefaultChunkSize = 1024 * 1024
@@ -26,6 +35,23 @@ const (
 // EncryptorConfig holds configuration for the Encryptor
 type EncryptorConfig struct {
 	ChunkSize int // Chunk size in bytes
+
+	// Transit key identity, recorded in key files and container headers
+	Namespace    string
+	TransitMount string
+	KeyName      string
+}
+
+// withDefaults returns a copy of cfg with defaults applied
+func (cfg *EncryptorConfig) withDefaults() *EncryptorConfig {
+	c := EncryptorConfig{}
+	if cfg != nil {
+		c = *cfg
+	}
+	if c.ChunkSize == 0 {
+		c.ChunkSize = DefaultChunkSize
+	}
+	return &c
 }
 
 // Encryptor handles file encryption using envelope encryption
@@ -36,14 +62,24 @@ type Encryptor struct {
 
 // NewEncryptor creates a new Encryptor with the given configuration
 func NewEncryptor(vaultClient VaultClient, cfg *EncryptorConfig) *Encryptor {
-	if cfg == nil || cfg.ChunkSize == 0 {
-		cfg = &EncryptorConfig{ChunkSize: DefaultChunkSize}
-	}
-
 	return &Encryptor{
 		vaultClient: vaultClient,
-		config:      cfg,
+		config:      cfg.withDefaults(),
+	}
+}
+
+// ForKey returns an Encryptor that wraps data keys with the given transit key.
+// Empty fields of ref keep the configured values; the receiver is returned
+// when the key is unchanged. Other keys need a KeyedVaultClient.
+func (e *Encryptor) ForKey(ref vault.KeyRef) (*Encryptor, error) {
+	client, cfg, err := bindKey(e.vaultClient, e.config, ref)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == e.config {
+		return e, nil
 	}
+	return &Encryptor{vaultClient: client, config: cfg}, nil
 }
 
 // EncryptFile encrypts a file using envelope encryption and returns the encrypted data key
@@ -85,36 +121,57 @@ type Decryptor struct {
 
 // NewDecryptor creates a new Decryptor with the given configuration
 func NewDecryptor(vaultClient VaultClient, cfg *EncryptorConfig) *Decryptor {
-	if cfg == nil || cfg.ChunkSize == 0 {
-		cfg = &EncryptorConfig{ChunkSize: DefaultChunkSize}
-	}
-
 	return &Decryptor{
 		vaultClient: vaultClient,
-		config:      cfg,
+		config:      cfg.withDefaults(),
 	}
 }
 
-// DecryptFile decrypts a file using envelope encryption
+// ForKey returns a Decryptor whose configured transit key is ref, used for
+// legacy key files that do not record their key. Empty fields of ref keep
+// the configured values; the receiver is returned when the key is unchanged.
+func (d *Decryptor) ForKey(ref vault.KeyRef) (*Decryptor, error) {
+	client, cfg, err := bindKey(d.vaultClient, d.config, ref)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == d.config {
+		return d, nil
+	}
+	return &Decryptor{vaultClient: client, config: cfg}, nil
+}
+
+// DecryptFile decrypts a file using envelope encryption. Self-describing
+// containers are detected automatically, in which case keyPath is ignored.
 func (d *Decryptor) DecryptFile(ctx context.Context, encryptedPath, keyPath, destPath string, progressCallback func(float64)) error {
-	// Read encrypted data key from file
-	encryptedKeyData, err := os.ReadFile(keyPath) // #nosec G304 - intentional file encryption tool
+	if isContainer, err := IsContainer(encryptedPath); err == nil && isContainer {
+		return d.decryptContainer(ctx, encryptedPath, destPath, progressCallback)
+	}
+
+	// Read encrypted data key from file (legacy raw ciphertext or v2 JSON)
+	keyFile, err := ReadKeyFile(keyPath)
 	if err != nil {
-		return fmt.Errorf("failed to read key file: %w", err)
+		return err
 	}
 
-	// Decrypt the data key using Vault
-	dataKey, err := d.vaultClient.DecryptDataKey(string(encryptedKeyData))
+	// Decrypt the data key using Vault, with the transit key that wrapped it
+	dataKey, err := d.unwrapDataKey(keyFile.KeyRef(), keyFile.Ciphertext)
 	if err != nil {
 		return fmt.Errorf("failed to decrypt data key: %w", err)
 	}
 	// Ensure the plaintext key is wiped from memory when we're done
 	defer dataKey.Destroy()
 
+	// Use the chunk size recorded at encryption time when available
+	chunkSize := d.config.ChunkSize
+	if keyFile.ChunkSize != 0 {
+		chunkSize = keyFile.ChunkSize
+	}
+
 	// Decrypt the file using the plaintext key
 	var opts []fileencrypt.Option
-	if d.config.ChunkSize != 0 {
-		opt, err := fileencrypt.WithChunkSize(d.config.ChunkSize)
+	if chunkSize != 0 {
+		opt, err := fileencrypt.WithChunkSize(chunkSize)
 		if err != nil {
 			return fmt.Errorf("invalid chunk size: %w", err)
 		}
@@ -130,3 +187,234 @@ func (d *Decryptor) DecryptFile(ctx context.Context, encryptedPath, keyPath, des
 
 	return nil
 }
+
+// EncryptFileContainer encrypts a file into a single self-describing container
+// that embeds the wrapped data key, so no separate .key file is needed.
+func (e *Encryptor) EncryptFileContainer(ctx context.Context, sourcePath, destPath string, progressCallback func(float64)) (*ContainerHeader, error) {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat source file: %w", err)
+	}
+
+	checksum, err := CalculateChecksum(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+
+	// Generate a new data encryption key from Vault
+	dataKey, err := e.vaultClient.GenerateDataKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	// Ensure the plaintext key is wiped from memory when we're done
+	defer dataKey.Destroy()
+
+	header := &ContainerHeader{
+		Ciphertext:   dataKey.Ciphertext,
+		Namespace:    e.config.Namespace,
+		TransitMount: e.config.TransitMount,
+		KeyName:      e.config.KeyName,
+		ChunkSize:    e.config.ChunkSize,
+		Filename:     filepath.Base(sourcePath),
+		Size:         info.Size(),
+		Checksum:     checksum,
+	}
+
+	opt, err := fileencrypt.WithChunkSize(e.config.ChunkSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chunk size: %w", err)
+	}
+
+	src, err := os.Open(sourcePath) // #nosec G304 - intentional file encryption tool
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+
+	dst, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600) // #nosec G304 - intentional file encryption tool
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container: %w", err)
+	}
+
+	_, err = writeContainerHeader(dst, header)
+	if err == nil {
+		reader := newProgressReader(src, info.Size(), progressCallback)
+		if err = fileencrypt.EncryptStream(ctx, reader, dst, dataKey.Plaintext, opt); err != nil {
+			err = fmt.Errorf("failed to encrypt file: %w", err)
+		}
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(destPath)
+		return nil, err
+	}
+
+	return header, nil
+}
+
+// decryptContainer decrypts a self-describing container using its embedded key
+func (d *Decryptor) decryptContainer(ctx context.Context, encryptedPath, destPath string, progressCallback func(float64)) error {
+	src, err := os.Open(encryptedPath) // #nosec G304 - intentional file encryption tool
+	if err != nil {
+		return fmt.Errorf("failed to open container: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+
+	header, region, err := readContainerHeader(src)
+	if err != nil {
+		return err
+	}
+
+	// Decrypt the embedded data key using Vault
+	dataKey, err := d.unwrapDataKey(header.KeyRef(), header.Ciphertext)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	defer dataKey.Destroy()
+
+	chunkSize := header.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = d.config.ChunkSize
+	}
+	opt, err := fileencrypt.WithChunkSize(chunkSize)
+	if err != nil {
+		return fmt.Errorf("invalid chunk size: %w", err)
+	}
+
+	var bodySize int64
+	if info, err := src.Stat(); err == nil {
+		bodySize = info.Size() - int64(containerPrefixSize+region)
+	}
+
+	dst, err := os.OpenFile(destPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600) // #nosec G304 - intentional file encryption tool
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+
+	reader := newProgressReader(src, bodySize, progressCallback)
+	if err = fileencrypt.DecryptStream(ctx, reader, dst, dataKey.Plaintext, opt); err != nil {
+		err = fmt.Errorf("failed to decrypt file: %w", err)
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(destPath)
+		return err
+	}
+
+	if info, err := os.Stat(destPath); err == nil && header.Size != info.Size() {
+		_ = os.Remove(destPath)
+		return fmt.Errorf("decrypted size %d does not match container header size %d", info.Size(), header.Size)
+	}
+
+	return nil
+}
+
+// unwrapDataKey decrypts a wrapped data key with the transit key identified
+// by ref. Keys wrapped by a transit key other than the configured one need a
+// vault client that implements KeyedVaultClient.
+func (d *Decryptor) unwrapDataKey(ref vault.KeyRef, ciphertext string) (*vault.DataKey, error) {
+	sameKey := (ref.Namespace == "" || ref.Namespace == d.config.Namespace) &&
+		(ref.TransitMount == "" || ref.TransitMount == d.config.TransitMount) &&
+		(ref.KeyName == "" || ref.KeyName == d.config.KeyName)
+	if sameKey {
+		return d.vaultClient.DecryptDataKey(ciphertext)
+	}
+
+	keyed, ok := d.vaultClient.(KeyedVaultClient)
+	if !ok {
+		return nil, fmt.Errorf("data key was wrapped by transit key '%s/%s', configured key is '%s/%s'",
+			ref.TransitMount, ref.KeyName, d.config.TransitMount, d.config.KeyName)
+	}
+
+	return keyed.DecryptDataKeyWithKey(ref, ciphertext)
+}
+
+// bindKey applies ref to cfg and returns a vault client whose default key is
+// the resulting transit key. cfg itself is returned when nothing changes.
+func bindKey(client VaultClient, cfg *EncryptorConfig, ref vault.KeyRef) (VaultClient, *EncryptorConfig, error) {
+	bound := *cfg
+	if ref.Namespace != "" {
+		bound.Namespace = ref.Namespace
+	}
+	if ref.TransitMount != "" {
+		bound.TransitMount = ref.TransitMount
+	}
+	if ref.KeyName != "" {
+		bound.KeyName = ref.KeyName
+	}
+	if bound == *cfg {
+		return client, cfg, nil
+	}
+
+	keyed, ok := client.(KeyedVaultClient)
+	if !ok {
+		return nil, nil, fmt.Errorf("vault client cannot use transit key '%s/%s', configured key is '%s/%s'",
+			bound.TransitMount, bound.KeyName, cfg.TransitMount, cfg.KeyName)
+	}
+
+	return &boundVaultClient{
+		client: keyed,
+		ref: vault.KeyRef{
+			Namespace:    bound.Namespace,
+			TransitMount: bound.TransitMount,
+			KeyName:      bound.KeyName,
+		},
+	}, &bound, nil
+}
+
+// boundVaultClient uses a fixed transit key as its default key
+type boundVaultClient struct {
+	client KeyedVaultClient
+	ref    vault.KeyRef
+}
+
+func (b *boundVaultClient) GenerateDataKey() (*vault.DataKey, error) {
+	return b.client.GenerateDataKeyWithKey(b.ref)
+}
+
+func (b *boundVaultClient) DecryptDataKey(ciphertext string) (*vault.DataKey, error) {
+	return b.client.DecryptDataKeyWithKey(b.ref, ciphertext)
+}
+
+func (b *boundVaultClient) GenerateDataKeyWithKey(ref vault.KeyRef) (*vault.DataKey, error) {
+	return b.client.GenerateDataKeyWithKey(ref)
+}
+
+func (b *boundVaultClient) DecryptDataKeyWithKey(ref vault.KeyRef, ciphertext string) (*vault.DataKey, error) {
+	return b.client.DecryptDataKeyWithKey(ref, ciphertext)
+}
+
+// progressReader reports read progress as a percentage of total
+type progressReader struct {
+	r        io.Reader
+	total    int64
+	read     int64
+	callback func(float64)
+}
+
+// newProgressReader wraps r; it returns r unchanged when there is nothing to report
+func newProgressReader(r io.Reader, total int64, callback func(float64)) io.Reader {
+	if callback == nil || total <= 0 {
+		return r
+	}
+	return &progressReader{r: r, total: total, callback: callback}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.read += int64(n)
+		p.callback(float64(p.read) * 100 / float64(p.total))
+	}
+	return n, err
+}
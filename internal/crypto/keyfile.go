@@ -0,0 +1,154 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/vault"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/version"
+)
+
+const (
+	// KeyFileVersionLegacy is a .key file holding only the raw ciphertext
+	KeyFileVersionLegacy = 1
+
+	// KeyFileVersion is the current structured (JSON) .key file format
+	KeyFileVersion = 2
+)
+
+// KeyFile describes the wrapped data key of an encrypted file and the
+// transit key that produced it.
+//
+// Version 1 (legacy) files contain only the "vault:vN:..." ciphertext; they
+// are parsed into a KeyFile with just Version, Ciphertext and KeyVersion set.
+type KeyFile struct {
+	Version      int       `json:"version"`
+	Ciphertext   string    `json:"ciphertext"`
+	KeyVersion   int       `json:"key_version"`
+	Namespace    string    `json:"namespace,omitempty"`
+	TransitMount string    `json:"transit_mount"`
+	KeyName      string    `json:"key_name"`
+	ChunkSize    int       `json:"chunk_size"`
+	ToolVersion  string    `json:"tool_version"`
+	Filename     string    `json:"filename"`
+	Size         int64     `json:"size"`
+	Checksum     string    `json:"checksum,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// KeyRef returns the transit key that wrapped this data key. Legacy key
+// files return an empty KeyRef (the client's configured key).
+func (k *KeyFile) KeyRef() vault.KeyRef {
+	return vault.KeyRef{
+		Namespace:    k.Namespace,
+		TransitMount: k.TransitMount,
+		KeyName:      k.KeyName,
+	}
+}
+
+// SetCiphertext replaces the wrapped data key and updates KeyVersion
+func (k *KeyFile) SetCiphertext(ciphertext string) {
+	k.Ciphertext = ciphertext
+	if v, err := vault.GetKeyVersion(ciphertext); err == nil {
+		k.KeyVersion = v
+	}
+}
+
+// Marshal encodes the key file in its on-disk format
+func (k *KeyFile) Marshal() ([]byte, error) {
+	if k.Version == KeyFileVersionLegacy {
+		return []byte(k.Ciphertext), nil
+	}
+
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode key file: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// ParseKeyFile parses a legacy (raw ciphertext) or v2 (JSON) key file
+func ParseKeyFile(data []byte) (*KeyFile, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("key file is empty")
+	}
+
+	if trimmed[0] != '{' {
+		kf := &KeyFile{Version: KeyFileVersionLegacy}
+		kf.SetCiphertext(string(trimmed))
+		return kf, nil
+	}
+
+	var kf KeyFile
+	if err := json.Unmarshal(trimmed, &kf); err != nil {
+		return nil, fmt.Errorf("failed to parse key file: %w", err)
+	}
+
+	if kf.Version != KeyFileVersion {
+		return nil, fmt.Errorf("unsupported key file version %d", kf.Version)
+	}
+
+	if kf.Ciphertext == "" {
+		return nil, fmt.Errorf("key file is missing the wrapped data key")
+	}
+
+	return &kf, nil
+}
+
+// ReadKeyFile reads and parses the key file at path
+func ReadKeyFile(path string) (*KeyFile, error) {
+	data, err := os.ReadFile(path) // #nosec G304 - intentional file encryption tool
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	return ParseKeyFile(data)
+}
+
+// WriteKeyFile writes the key file to path
+func WriteKeyFile(path string, kf *KeyFile) error {
+	data, err := kf.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil { // #nosec G306 - intentional key file write
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	return nil
+}
+
+// NewKeyFile builds v2 key file metadata for a file encrypted by this
+// Encryptor. checksum may be empty when checksums are disabled.
+func (e *Encryptor) NewKeyFile(sourcePath, ciphertext, checksum string) (*KeyFile, error) {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat source file: %w", err)
+	}
+
+	return e.NewStreamKeyFile(filepath.Base(sourcePath), info.Size(), ciphertext, checksum), nil
+}
+
+// NewStreamKeyFile builds v2 key file metadata for data encrypted by
+// EncryptStream. filename may be empty when the data did not come from a file.
+func (e *Encryptor) NewStreamKeyFile(filename string, size int64, ciphertext, checksum string) *KeyFile {
+	kf := &KeyFile{
+		Version:      KeyFileVersion,
+		Namespace:    e.config.Namespace,
+		TransitMount: e.config.TransitMount,
+		KeyName:      e.config.KeyName,
+		ChunkSize:    e.config.ChunkSize,
+		ToolVersion:  version.Version,
+		Filename:     filename,
+		Size:         size,
+		Checksum:     checksum,
+		CreatedAt:    time.Now().UTC(),
+	}
+	kf.SetCiphertext(ciphertext)
+
+	return kf
+}
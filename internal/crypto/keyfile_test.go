@@ -0,0 +1,221 @@
+package crypto
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeyFile_Legacy(t *testing.T) {
+	kf, err := ParseKeyFile([]byte("vault:v4:legacy-ciphertext\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, KeyFileVersionLegacy, kf.Version)
+	assert.Equal(t, "vault:v4:legacy-ciphertext", kf.Ciphertext)
+	assert.Equal(t, 4, kf.KeyVersion)
+	assert.Equal(t, vault.KeyRef{}, kf.KeyRef())
+
+	// Legacy files are written back as raw ciphertext
+	data, err := kf.Marshal()
+	require.NoError(t, err)
+	assert.Equal(t, "vault:v4:legacy-ciphertext", string(data))
+}
+
+func TestParseKeyFile_V2(t *testing.T) {
+	data := []byte(`{
+  "version": 2,
+  "ciphertext": "vault:v3:abc",
+  "key_version": 3,
+  "namespace": "team-a",
+  "transit_mount": "transit-eu",
+  "key_name": "finance",
+  "chunk_size": 2000000,
+  "tool_version": "1.0.0",
+  "filename": "report.csv",
+  "size": 42,
+  "checksum": "deadbeef",
+  "created_at": "2024-01-02T03:04:05Z"
+}`)
+
+	kf, err := ParseKeyFile(data)
+	require.NoError(t, err)
+
+	assert.Equal(t, KeyFileVersion, kf.Version)
+	assert.Equal(t, "vault:v3:abc", kf.Ciphertext)
+	assert.Equal(t, vault.KeyRef{Namespace: "team-a", TransitMount: "transit-eu", KeyName: "finance"}, kf.KeyRef())
+	assert.Equal(t, 2000000, kf.ChunkSize)
+	assert.Equal(t, "report.csv", kf.Filename)
+	assert.Equal(t, int64(42), kf.Size)
+
+	kf.SetCiphertext("vault:v5:def")
+	assert.Equal(t, 5, kf.KeyVersion)
+
+	roundTrip, err := kf.Marshal()
+	require.NoError(t, err)
+	parsed, err := ParseKeyFile(roundTrip)
+	require.NoError(t, err)
+	assert.Equal(t, kf, parsed)
+}
+
+func TestParseKeyFile_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"empty":              "  \n",
+		"malformed json":     `{"version": 2,`,
+		"unknown version":    `{"version": 9, "ciphertext": "vault:v1:abc"}`,
+		"missing ciphertext": `{"version": 2}`,
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseKeyFile([]byte(data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestEncryptor_NewKeyFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceFile := filepath.Join(tmpDir, "data.txt")
+	require.NoError(t, os.WriteFile(sourceFile, []byte("hello"), 0600))
+
+	encryptor := NewEncryptor(&mockVaultClient{}, &EncryptorConfig{
+		Namespace:    "team-a",
+		TransitMount: "transit",
+		KeyName:      "test-key",
+	})
+
+	kf, err := encryptor.NewKeyFile(sourceFile, "vault:v2:abc", "checksum")
+	require.NoError(t, err)
+
+	assert.Equal(t, KeyFileVersion, kf.Version)
+	assert.Equal(t, 2, kf.KeyVersion)
+	assert.Equal(t, "team-a", kf.Namespace)
+	assert.Equal(t, "transit", kf.TransitMount)
+	assert.Equal(t, "test-key", kf.KeyName)
+	assert.Equal(t, DefaultChunkSize, kf.ChunkSize)
+	assert.Equal(t, "data.txt", kf.Filename)
+	assert.Equal(t, int64(5), kf.Size)
+	assert.Equal(t, "checksum", kf.Checksum)
+	assert.NotEmpty(t, kf.ToolVersion)
+	assert.False(t, kf.CreatedAt.IsZero())
+}
+
+// keyedMockVaultClient records which transit key was used to wrap or unwrap
+type keyedMockVaultClient struct {
+	mockVaultClient
+	usedRef *vault.KeyRef
+}
+
+func (m *keyedMockVaultClient) GenerateDataKeyWithKey(ref vault.KeyRef) (*vault.DataKey, error) {
+	m.usedRef = &ref
+	return m.GenerateDataKey()
+}
+
+func (m *keyedMockVaultClient) DecryptDataKeyWithKey(ref vault.KeyRef, ciphertext string) (*vault.DataKey, error) {
+	m.usedRef = &ref
+	return m.DecryptDataKey(ciphertext)
+}
+
+func TestDecryptor_DecryptFile_V2KeyFileOtherTransitKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceFile := filepath.Join(tmpDir, "data.txt")
+	encFile := filepath.Join(tmpDir, "data.txt.enc")
+	keyPath := filepath.Join(tmpDir, "data.txt.key")
+	decryptedFile := filepath.Join(tmpDir, "decrypted.txt")
+	require.NoError(t, os.WriteFile(sourceFile, []byte("encrypted elsewhere"), 0600))
+
+	// Encrypted by a deployment using another transit key
+	encryptor := NewEncryptor(&mockVaultClient{}, &EncryptorConfig{TransitMount: "transit-eu", KeyName: "finance"})
+	ciphertext, err := encryptor.EncryptFile(context.Background(), sourceFile, encFile, nil)
+	require.NoError(t, err)
+	kf, err := encryptor.NewKeyFile(sourceFile, ciphertext, "")
+	require.NoError(t, err)
+	require.NoError(t, WriteKeyFile(keyPath, kf))
+
+	client := &keyedMockVaultClient{}
+	decryptor := NewDecryptor(client, &EncryptorConfig{TransitMount: "transit", KeyName: "test-key"})
+	require.NoError(t, decryptor.DecryptFile(context.Background(), encFile, keyPath, decryptedFile, nil))
+
+	require.NotNil(t, client.usedRef)
+	assert.Equal(t, "transit-eu", client.usedRef.TransitMount)
+	assert.Equal(t, "finance", client.usedRef.KeyName)
+
+	decrypted, err := os.ReadFile(decryptedFile)
+	require.NoError(t, err)
+	assert.Equal(t, "encrypted elsewhere", string(decrypted))
+
+	// A legacy key file uses the configured key
+	require.NoError(t, os.WriteFile(keyPath, []byte(ciphertext), 0600))
+	client.usedRef = nil
+	require.NoError(t, decryptor.DecryptFile(context.Background(), encFile, keyPath, decryptedFile, nil))
+	assert.Nil(t, client.usedRef)
+}
+
+func TestEncryptor_ForKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceFile := filepath.Join(tmpDir, "data.txt")
+	encFile := filepath.Join(tmpDir, "data.txt.enc")
+	require.NoError(t, os.WriteFile(sourceFile, []byte("finance data"), 0600))
+
+	client := &keyedMockVaultClient{}
+	encryptor := NewEncryptor(client, &EncryptorConfig{TransitMount: "transit", KeyName: "test-key"})
+
+	// Unchanged key returns the same encryptor
+	same, err := encryptor.ForKey(vault.KeyRef{KeyName: "test-key"})
+	require.NoError(t, err)
+	assert.Same(t, encryptor, same)
+
+	finance, err := encryptor.ForKey(vault.KeyRef{KeyName: "finance"})
+	require.NoError(t, err)
+
+	ciphertext, err := finance.EncryptFile(context.Background(), sourceFile, encFile, nil)
+	require.NoError(t, err)
+	require.NotNil(t, client.usedRef)
+	assert.Equal(t, "transit", client.usedRef.TransitMount)
+	assert.Equal(t, "finance", client.usedRef.KeyName)
+
+	kf, err := finance.NewKeyFile(sourceFile, ciphertext, "")
+	require.NoError(t, err)
+	assert.Equal(t, "finance", kf.KeyName)
+
+	// The original encryptor keeps its key
+	kf, err = encryptor.NewKeyFile(sourceFile, ciphertext, "")
+	require.NoError(t, err)
+	assert.Equal(t, "test-key", kf.KeyName)
+}
+
+func TestEncryptor_ForKey_RequiresKeyedClient(t *testing.T) {
+	encryptor := NewEncryptor(&mockVaultClient{}, &EncryptorConfig{TransitMount: "transit", KeyName: "test-key"})
+
+	_, err := encryptor.ForKey(vault.KeyRef{KeyName: "finance"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot use transit key 'transit/finance'")
+}
+
+func TestDecryptor_ForKey_LegacyKeyFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceFile := filepath.Join(tmpDir, "data.txt")
+	encFile := filepath.Join(tmpDir, "data.txt.enc")
+	keyPath := filepath.Join(tmpDir, "data.txt.key")
+	decryptedFile := filepath.Join(tmpDir, "decrypted.txt")
+	require.NoError(t, os.WriteFile(sourceFile, []byte("hr data"), 0600))
+
+	client := &keyedMockVaultClient{}
+	encryptor := NewEncryptor(client, &EncryptorConfig{TransitMount: "transit", KeyName: "hr"})
+	ciphertext, err := encryptor.EncryptFile(context.Background(), sourceFile, encFile, nil)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyPath, []byte(ciphertext), 0600))
+
+	decryptor, err := NewDecryptor(client, &EncryptorConfig{TransitMount: "transit", KeyName: "test-key"}).
+		ForKey(vault.KeyRef{KeyName: "hr"})
+	require.NoError(t, err)
+
+	require.NoError(t, decryptor.DecryptFile(context.Background(), encFile, keyPath, decryptedFile, nil))
+	require.NotNil(t, client.usedRef)
+	assert.Equal(t, "hr", client.usedRef.KeyName)
+}
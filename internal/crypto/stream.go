@@ -0,0 +1,210 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+
+	fileencrypt "github.com/gitrgoliveira/go-fileencrypt"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/vault"
+)
+
+// StreamInfo describes the plaintext of an encrypted or decrypted stream
+type StreamInfo struct {
+	Size     int64  // Plaintext size in bytes
+	Checksum string // SHA256 of the plaintext
+
+	// Header of the container a stream was decrypted from (nil for streams
+	// decrypted with a key file)
+	Header *ContainerHeader
+}
+
+// EncryptStream encrypts src to dst using envelope encryption and returns the
+// encrypted data key. The output is the same as EncryptFile produces, so it
+// is decrypted with a key file built by NewStreamKeyFile.
+func (e *Encryptor) EncryptStream(ctx context.Context, src io.Reader, dst io.Writer) (string, *StreamInfo, error) {
+	return e.EncryptStreamTo(ctx, src, func(string) (io.Writer, error) {
+		return dst, nil
+	})
+}
+
+// EncryptStreamTo is EncryptStream for outputs that need the encrypted data
+// key before the first byte is written, such as an upload that stores it in
+// the object metadata: open is called with it once it has been generated.
+func (e *Encryptor) EncryptStreamTo(ctx context.Context, src io.Reader, open func(ciphertext string) (io.Writer, error)) (string, *StreamInfo, error) {
+	opt, err := fileencrypt.WithChunkSize(e.config.ChunkSize)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid chunk size: %w", err)
+	}
+
+	// Generate a new data encryption key from Vault
+	dataKey, err := e.vaultClient.GenerateDataKey()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	// Ensure the plaintext key is wiped from memory when we're done
+	defer dataKey.Destroy()
+
+	dst, err := open(dataKey.Ciphertext)
+	if err != nil {
+		return "", nil, err
+	}
+
+	digest := newDigestWriter()
+	if err := fileencrypt.EncryptStream(ctx, io.TeeReader(src, digest), dst, dataKey.Plaintext, opt); err != nil {
+		return "", nil, fmt.Errorf("failed to encrypt stream: %w", err)
+	}
+
+	return dataKey.Ciphertext, digest.info(), nil
+}
+
+// EncryptStreamContainer encrypts src into a self-describing container
+// written to dst. The size and checksum of a stream are only known at the
+// end, so the header is written first and completed once the body has been
+// written; dst must be positioned at the start of the container.
+func (e *Encryptor) EncryptStreamContainer(ctx context.Context, src io.Reader, dst io.WriteSeeker, filename string) (*ContainerHeader, error) {
+	opt, err := fileencrypt.WithChunkSize(e.config.ChunkSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chunk size: %w", err)
+	}
+
+	start, err := dst.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("container output is not seekable: %w", err)
+	}
+
+	// Generate a new data encryption key from Vault
+	dataKey, err := e.vaultClient.GenerateDataKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	// Ensure the plaintext key is wiped from memory when we're done
+	defer dataKey.Destroy()
+
+	header := &ContainerHeader{
+		Ciphertext:   dataKey.Ciphertext,
+		Namespace:    e.config.Namespace,
+		TransitMount: e.config.TransitMount,
+		KeyName:      e.config.KeyName,
+		ChunkSize:    e.config.ChunkSize,
+		Filename:     filename,
+	}
+
+	region, err := writeContainerHeader(dst, header)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := newDigestWriter()
+	if err := fileencrypt.EncryptStream(ctx, io.TeeReader(src, digest), dst, dataKey.Plaintext, opt); err != nil {
+		return nil, fmt.Errorf("failed to encrypt stream: %w", err)
+	}
+
+	// Complete the header in place; the region leaves room for the checksum
+	info := digest.info()
+	header.Size = info.Size
+	header.Checksum = info.Checksum
+
+	data, err := encodeContainerHeader(header, region)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dst.Seek(start+containerPrefixSize, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek to container header: %w", err)
+	}
+	if _, err := dst.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to write container header: %w", err)
+	}
+	if _, err := dst.Seek(0, io.SeekEnd); err != nil {
+		return nil, fmt.Errorf("failed to seek to end of container: %w", err)
+	}
+
+	return header, nil
+}
+
+// DecryptStream decrypts src to dst. Self-describing containers are detected
+// from the stream, in which case keyFile is ignored; otherwise keyFile holds
+// the wrapped data key.
+func (d *Decryptor) DecryptStream(ctx context.Context, src io.Reader, keyFile *KeyFile, dst io.Writer) (*StreamInfo, error) {
+	reader := bufio.NewReader(src)
+
+	var (
+		header     *ContainerHeader
+		ref        vault.KeyRef
+		ciphertext string
+		chunkSize  = d.config.ChunkSize
+	)
+
+	if magic, err := reader.Peek(len(containerMagic)); err == nil && bytes.Equal(magic, containerMagic) {
+		if header, _, err = readContainerHeader(reader); err != nil {
+			return nil, err
+		}
+		ref, ciphertext = header.KeyRef(), header.Ciphertext
+		if header.ChunkSize != 0 {
+			chunkSize = header.ChunkSize
+		}
+	} else {
+		if keyFile == nil {
+			return nil, fmt.Errorf("a key file is required unless the input is a self-describing container")
+		}
+		ref, ciphertext = keyFile.KeyRef(), keyFile.Ciphertext
+		// Use the chunk size recorded at encryption time when available
+		if keyFile.ChunkSize != 0 {
+			chunkSize = keyFile.ChunkSize
+		}
+	}
+
+	opt, err := fileencrypt.WithChunkSize(chunkSize)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chunk size: %w", err)
+	}
+
+	// Decrypt the data key using Vault, with the transit key that wrapped it
+	dataKey, err := d.unwrapDataKey(ref, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	defer dataKey.Destroy()
+
+	digest := newDigestWriter()
+	if err := fileencrypt.DecryptStream(ctx, reader, io.MultiWriter(dst, digest), dataKey.Plaintext, opt); err != nil {
+		return nil, fmt.Errorf("failed to decrypt stream: %w", err)
+	}
+
+	info := digest.info()
+	info.Header = header
+	if header != nil && header.Size != info.Size {
+		return nil, fmt.Errorf("decrypted size %d does not match container header size %d", info.Size, header.Size)
+	}
+
+	return info, nil
+}
+
+// digestWriter counts and hashes the bytes written to it
+type digestWriter struct {
+	hash hash.Hash
+	size int64
+}
+
+func newDigestWriter() *digestWriter {
+	return &digestWriter{hash: sha256.New()}
+}
+
+func (d *digestWriter) Write(p []byte) (int, error) {
+	n, err := d.hash.Write(p)
+	d.size += int64(n)
+	return n, err
+}
+
+// info returns the size and hex SHA256 checksum of the bytes written so far
+func (d *digestWriter) info() *StreamInfo {
+	return &StreamInfo{
+		Size:     d.size,
+		Checksum: hex.EncodeToString(d.hash.Sum(nil)),
+	}
+}
@@ -0,0 +1,105 @@
+package crypto
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptor_EncryptStream_RoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := bytes.Repeat([]byte("streamed content "), 10000)
+
+	mock := &mockVaultClient{}
+	encryptor := NewEncryptor(mock, &EncryptorConfig{ChunkSize: 4096})
+	decryptor := NewDecryptor(mock, nil)
+
+	var encrypted bytes.Buffer
+	ciphertext, info, err := encryptor.EncryptStream(context.Background(), bytes.NewReader(content), &encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "vault:v1:test-encrypted-key", ciphertext)
+	assert.Equal(t, int64(len(content)), info.Size)
+
+	// The checksum matches the file checksum of the same content
+	sourceFile := filepath.Join(tmpDir, "source.txt")
+	require.NoError(t, os.WriteFile(sourceFile, content, 0600))
+	checksum, err := CalculateChecksum(sourceFile)
+	require.NoError(t, err)
+	assert.Equal(t, checksum, info.Checksum)
+
+	keyFile := encryptor.NewStreamKeyFile("", info.Size, ciphertext, info.Checksum)
+	assert.Equal(t, 4096, keyFile.ChunkSize)
+
+	var decrypted bytes.Buffer
+	decryptedInfo, err := decryptor.DecryptStream(context.Background(), bytes.NewReader(encrypted.Bytes()), keyFile, &decrypted)
+	require.NoError(t, err)
+	assert.Equal(t, content, decrypted.Bytes())
+	assert.Equal(t, info.Checksum, decryptedInfo.Checksum)
+	assert.Nil(t, decryptedInfo.Header)
+
+	// Streamed output is an ordinary encrypted file
+	encryptedFile := filepath.Join(tmpDir, "stream.enc")
+	keyPath := filepath.Join(tmpDir, "stream.key")
+	outputFile := filepath.Join(tmpDir, "output.txt")
+	require.NoError(t, os.WriteFile(encryptedFile, encrypted.Bytes(), 0600))
+	require.NoError(t, WriteKeyFile(keyPath, keyFile))
+	require.NoError(t, decryptor.DecryptFile(context.Background(), encryptedFile, keyPath, outputFile, nil))
+
+	output, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, content, output)
+}
+
+func TestEncryptor_EncryptStreamContainer_RoundTrip(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := bytes.Repeat([]byte("container stream "), 5000)
+
+	mock := &mockVaultClient{}
+	encryptor := NewEncryptor(mock, &EncryptorConfig{TransitMount: "transit", KeyName: "my-key"})
+	decryptor := NewDecryptor(mock, &EncryptorConfig{TransitMount: "transit", KeyName: "my-key"})
+
+	containerFile := filepath.Join(tmpDir, "dump.enc")
+	dst, err := os.Create(containerFile)
+	require.NoError(t, err)
+	header, err := encryptor.EncryptStreamContainer(context.Background(), bytes.NewReader(content), dst, "dump")
+	require.NoError(t, err)
+	require.NoError(t, dst.Close())
+
+	assert.Equal(t, int64(len(content)), header.Size)
+	assert.NotEmpty(t, header.Checksum)
+
+	// The completed header is read back from the file
+	stored, err := ReadContainerHeader(containerFile)
+	require.NoError(t, err)
+	assert.Equal(t, header, stored)
+
+	outputFile := filepath.Join(tmpDir, "dump")
+	require.NoError(t, decryptor.DecryptFile(context.Background(), containerFile, "", outputFile, nil))
+	output, err := os.ReadFile(outputFile)
+	require.NoError(t, err)
+	assert.Equal(t, content, output)
+
+	// Containers are detected when decrypting a stream
+	src, err := os.Open(containerFile)
+	require.NoError(t, err)
+	defer func() { _ = src.Close() }()
+
+	var decrypted bytes.Buffer
+	info, err := decryptor.DecryptStream(context.Background(), src, nil, &decrypted)
+	require.NoError(t, err)
+	assert.Equal(t, content, decrypted.Bytes())
+	require.NotNil(t, info.Header)
+	assert.Equal(t, header.Checksum, info.Checksum)
+}
+
+func TestDecryptor_DecryptStream_RequiresKeyFile(t *testing.T) {
+	decryptor := NewDecryptor(&mockVaultClient{}, nil)
+
+	_, err := decryptor.DecryptStream(context.Background(), bytes.NewReader([]byte("not a container")), nil, &bytes.Buffer{})
+	assert.Error(t, err)
+}
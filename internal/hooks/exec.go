@@ -0,0 +1,82 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// maxOutput bounds the command output included in errors
+	maxOutput = 1024
+
+	// waitDelay bounds the wait for the output of a command's children
+	// once the command was killed at its timeout
+	waitDelay = 1 * time.Second
+)
+
+// inheritedEnv lists the variables of the service environment that hook
+// commands get; the rest, such as VAULT_TOKEN or cloud credentials, is not
+// passed on. The Windows ones are needed by many programs there.
+var inheritedEnv = []string{
+	"PATH", "HOME", "USER", "LANG", "LC_ALL", "TZ", "TMPDIR",
+	"SYSTEMROOT", "COMSPEC", "PATHEXT", "TEMP", "TMP", "USERPROFILE",
+}
+
+// runCommand runs a hook command with the event as JSON on stdin and item
+// fields in FILE_ENCRYPTOR_* environment variables, in a minimal environment.
+// A non-zero exit status fails the delivery.
+func runCommand(ctx context.Context, command []string, ev Event, body []byte) error {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...) // #nosec G204 - command from the hook configuration
+	cmd.Env = append(baseEnvironment(), environment(ev)...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.WaitDelay = waitDelay
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		out := strings.TrimSpace(string(output))
+		if len(out) > maxOutput {
+			out = out[:maxOutput] + "..."
+		}
+		if out == "" {
+			return fmt.Errorf("hook command failed: %w", err)
+		}
+		return fmt.Errorf("hook command failed: %w: %s", err, out)
+	}
+	return nil
+}
+
+// baseEnvironment returns the inherited variables that are set
+func baseEnvironment() []string {
+	var env []string
+	for _, name := range inheritedEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// environment returns the variables describing an event to a hook command
+func environment(ev Event) []string {
+	item := ev.Item
+	return []string{
+		"FILE_ENCRYPTOR_EVENT=" + ev.Event,
+		"FILE_ENCRYPTOR_EVENT_ID=" + ev.ID,
+		"FILE_ENCRYPTOR_OPERATION=" + string(item.Operation),
+		"FILE_ENCRYPTOR_RULE=" + item.Rule,
+		"FILE_ENCRYPTOR_ITEM_ID=" + item.ID,
+		"FILE_ENCRYPTOR_SOURCE_PATH=" + item.SourcePath,
+		"FILE_ENCRYPTOR_DEST_PATH=" + item.DestPath,
+		"FILE_ENCRYPTOR_KEY_PATH=" + item.KeyPath,
+		"FILE_ENCRYPTOR_CHECKSUM=" + item.Checksum,
+		"FILE_ENCRYPTOR_FILE_SIZE=" + strconv.FormatInt(item.FileSize, 10),
+		"FILE_ENCRYPTOR_ATTEMPT=" + strconv.Itoa(item.AttemptCount),
+		"FILE_ENCRYPTOR_ERROR=" + item.Error,
+	}
+}
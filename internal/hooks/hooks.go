@@ -0,0 +1,387 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/metrics"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
+	"github.com/google/uuid"
+)
+
+const (
+	// outboxCapacity bounds the deliveries kept in the outbox; the oldest one
+	// is dropped when an event arrives while it is full
+	outboxCapacity = 1000
+
+	// pollInterval is how often the outbox is checked when no retry is due
+	pollInterval = 1 * time.Second
+
+	// Delays between attempts of a failed delivery
+	retryBaseDelay = 2 * time.Second
+	retryMaxDelay  = 5 * time.Minute
+)
+
+// Delivery results used as the result label of metrics.HookDeliveries
+const (
+	resultDelivered = "delivered"
+	resultFailed    = "failed"
+	resultDropped   = "dropped"
+)
+
+// Event is the JSON document sent to hooks
+type Event struct {
+	ID    string     `json:"id"`
+	Event string     `json:"event"` // config.HookEventCompleted, HookEventFailed or HookEventDLQ
+	Time  time.Time  `json:"time"`
+	Item  model.Item `json:"item"`
+}
+
+// delivery is an event waiting to be delivered to one hook
+type delivery struct {
+	ID          string    `json:"id"`
+	Hook        string    `json:"hook"`
+	Event       Event     `json:"event"`
+	Attempts    int       `json:"attempts"`
+	NextAttempt time.Time `json:"next_attempt"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+// Dispatcher runs the configured hooks for processed items. Events are
+// recorded in an outbox file and delivered in the background, so a slow or
+// unreachable receiver never holds up processing. Each hook gets its events
+// in order; a failed delivery is retried with exponential backoff until the
+// hook's max_retries are exhausted.
+type Dispatcher struct {
+	path   string
+	logger logger.Logger
+	client *http.Client
+
+	// Delays between attempts; fields so tests can shorten them
+	baseDelay time.Duration
+	maxDelay  time.Duration
+
+	mu       sync.Mutex
+	hooks    []config.HookConfig
+	outbox   []*delivery
+	inFlight map[string]bool // hooks with a delivery in progress
+	wake     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Open loads the outbox at path, creating its directory if needed, and
+// returns a dispatcher for hooks. Deliveries left by a previous run are made
+// once Run is called.
+func Open(path string, hooks []config.HookConfig, log logger.Logger) (*Dispatcher, error) {
+	if path == "" {
+		return nil, fmt.Errorf("hook outbox path cannot be empty")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil { // #nosec G301 - configurable directory path
+		return nil, fmt.Errorf("failed to create hook outbox directory: %w", err)
+	}
+
+	d := &Dispatcher{
+		path:      path,
+		logger:    log,
+		client:    &http.Client{},
+		baseDelay: retryBaseDelay,
+		maxDelay:  retryMaxDelay,
+		hooks:     hooks,
+		inFlight:  map[string]bool{},
+		wake:      make(chan struct{}, 1),
+	}
+
+	data, err := os.ReadFile(path) // #nosec G304 - configurable outbox path
+	if os.IsNotExist(err) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hook outbox: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &d.outbox); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal hook outbox: %w", err)
+	}
+	metrics.HookOutboxDepth.Set(float64(len(d.outbox)))
+
+	return d, nil
+}
+
+// Update replaces the configured hooks. Pending deliveries of hooks that no
+// longer exist are dropped.
+func (d *Dispatcher) Update(hooks []config.HookConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.hooks = hooks
+	d.signal()
+}
+
+// Pending returns the number of deliveries in the outbox
+func (d *Dispatcher) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.outbox)
+}
+
+// Notify records an event for every hook that matches it and the item's
+// operation. It does not wait for the deliveries. item is a copy, taken
+// while the caller still owns the queue item.
+func (d *Dispatcher) Notify(event string, item model.Item) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ev := Event{
+		ID:    uuid.New().String(),
+		Event: event,
+		Time:  time.Now().UTC(),
+		Item:  item,
+	}
+
+	added := false
+	for _, hook := range d.hooks {
+		if !hook.Matches(string(item.Operation), event) {
+			continue
+		}
+
+		if len(d.outbox) >= outboxCapacity {
+			dropped := d.outbox[0]
+			d.outbox = d.outbox[1:]
+			metrics.HookDeliveries.WithLabelValues(dropped.Hook, resultDropped).Inc()
+			d.logger.Error("Hook outbox is full, dropping the oldest delivery",
+				"hook", dropped.Hook,
+				"event", dropped.Event.Event,
+				"file", dropped.Event.Item.SourcePath,
+			)
+		}
+
+		d.outbox = append(d.outbox, &delivery{
+			ID:          uuid.New().String(),
+			Hook:        hook.Name,
+			Event:       ev,
+			NextAttempt: ev.Time,
+		})
+		added = true
+	}
+
+	if !added {
+		return nil
+	}
+
+	d.signal()
+	return d.saveLocked()
+}
+
+// Run delivers events until ctx is cancelled, then waits for the deliveries
+// in progress. Deliveries interrupted by the cancellation stay in the outbox.
+func (d *Dispatcher) Run(ctx context.Context) {
+	timer := time.NewTimer(pollInterval)
+	defer timer.Stop()
+
+	for {
+		timer.Reset(d.startDue(ctx))
+
+		select {
+		case <-ctx.Done():
+			d.wg.Wait()
+			return
+		case <-d.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// startDue starts the oldest delivery of every idle hook once it is due and
+// returns how long to wait for the next retry. Later deliveries of a hook
+// wait for it, so events arrive in order.
+func (d *Dispatcher) startDue(ctx context.Context) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	wait := pollInterval
+	if ctx.Err() != nil {
+		return wait
+	}
+
+	d.dropRemovedLocked()
+
+	now := time.Now()
+	seen := map[string]bool{}
+	for _, dl := range d.outbox {
+		if seen[dl.Hook] {
+			continue
+		}
+		seen[dl.Hook] = true
+
+		if d.inFlight[dl.Hook] {
+			continue
+		}
+		if due := dl.NextAttempt.Sub(now); due > 0 {
+			wait = min(wait, due)
+			continue
+		}
+
+		hook, _ := d.hookLocked(dl.Hook)
+		d.inFlight[dl.Hook] = true
+		d.wg.Add(1)
+		go d.deliver(ctx, hook, dl)
+	}
+
+	return wait
+}
+
+// deliver makes one attempt of a delivery and records its outcome
+func (d *Dispatcher) deliver(ctx context.Context, hook config.HookConfig, dl *delivery) {
+	defer d.wg.Done()
+
+	err := d.send(ctx, hook, dl)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.inFlight, hook.Name)
+	d.signal()
+
+	if err != nil && ctx.Err() != nil {
+		// Interrupted by shutdown: made again on the next start
+		return
+	}
+
+	fields := []interface{}{
+		"hook", hook.Name,
+		"event", dl.Event.Event,
+		"file", dl.Event.Item.SourcePath,
+	}
+
+	switch {
+	case err == nil:
+		metrics.HookDeliveries.WithLabelValues(hook.Name, resultDelivered).Inc()
+		d.logger.Debug("Hook delivered", fields...)
+		d.removeLocked(dl)
+
+	case dl.Attempts >= hook.MaxRetries:
+		metrics.HookDeliveries.WithLabelValues(hook.Name, resultDropped).Inc()
+		d.logger.Error("Hook delivery failed, giving up", append(fields, "attempts", dl.Attempts+1, "error", err)...)
+		d.removeLocked(dl)
+
+	default:
+		metrics.HookDeliveries.WithLabelValues(hook.Name, resultFailed).Inc()
+		dl.Attempts++
+		dl.LastError = err.Error()
+		delay := d.backoff(dl.Attempts)
+		dl.NextAttempt = time.Now().Add(delay)
+		d.logger.Error("Hook delivery failed, will retry", append(fields, "retry_in", delay, "error", err)...)
+	}
+
+	if err := d.saveLocked(); err != nil {
+		d.logger.Error("Failed to save hook outbox", "error", err)
+	}
+}
+
+// send runs the hook's command or posts to its webhook
+func (d *Dispatcher) send(ctx context.Context, hook config.HookConfig, dl *delivery) error {
+	body, err := json.Marshal(dl.Event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hook.Timeout)
+	defer cancel()
+
+	if hook.URL != "" {
+		return d.post(ctx, hook, dl.ID, dl.Event.Event, body)
+	}
+	return runCommand(ctx, hook.Command, dl.Event, body)
+}
+
+// backoff returns the delay before the attempt following the given number
+// of failed ones
+func (d *Dispatcher) backoff(failed int) time.Duration {
+	delay := d.baseDelay
+	for i := 1; i < failed && delay < d.maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, d.maxDelay)
+}
+
+// hookLocked returns the configured hook with the given name; the caller
+// must hold d.mu
+func (d *Dispatcher) hookLocked(name string) (config.HookConfig, bool) {
+	for _, hook := range d.hooks {
+		if hook.Name == name {
+			return hook, true
+		}
+	}
+	return config.HookConfig{}, false
+}
+
+// dropRemovedLocked drops the deliveries of hooks that are no longer
+// configured; the caller must hold d.mu
+func (d *Dispatcher) dropRemovedLocked() {
+	kept := d.outbox[:0]
+	for _, dl := range d.outbox {
+		if _, ok := d.hookLocked(dl.Hook); ok || d.inFlight[dl.Hook] {
+			kept = append(kept, dl)
+			continue
+		}
+		metrics.HookDeliveries.WithLabelValues(dl.Hook, resultDropped).Inc()
+		d.logger.Info("Dropping delivery of a removed hook", "hook", dl.Hook, "event", dl.Event.Event)
+	}
+
+	if len(kept) == len(d.outbox) {
+		return
+	}
+	clear(d.outbox[len(kept):])
+	d.outbox = kept
+	if err := d.saveLocked(); err != nil {
+		d.logger.Error("Failed to save hook outbox", "error", err)
+	}
+}
+
+// removeLocked removes a delivery from the outbox, unless it was already
+// dropped; the caller must hold d.mu
+func (d *Dispatcher) removeLocked(dl *delivery) {
+	if i := slices.Index(d.outbox, dl); i >= 0 {
+		d.outbox = slices.Delete(d.outbox, i, i+1)
+	}
+}
+
+// signal wakes Run without blocking
+func (d *Dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// saveLocked writes the outbox atomically; the caller must hold d.mu
+func (d *Dispatcher) saveLocked() error {
+	metrics.HookOutboxDepth.Set(float64(len(d.outbox)))
+
+	data, err := json.MarshalIndent(d.outbox, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal hook outbox: %w", err)
+	}
+
+	tmpPath := d.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil { // #nosec G306 - outbox file
+		return fmt.Errorf("failed to write hook outbox: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, d.path); err != nil {
+		return fmt.Errorf("failed to save hook outbox: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,276 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDispatcher(t *testing.T, path string, hooks ...config.HookConfig) *Dispatcher {
+	t.Helper()
+
+	log, err := logger.New("error", os.DevNull)
+	require.NoError(t, err)
+
+	for i := range hooks {
+		if hooks[i].Timeout == 0 {
+			hooks[i].Timeout = 5 * time.Second
+		}
+	}
+
+	d, err := Open(path, hooks, log)
+	require.NoError(t, err)
+	d.baseDelay = 10 * time.Millisecond
+	d.maxDelay = 50 * time.Millisecond
+	return d
+}
+
+// run runs d until the test ends
+func run(t *testing.T, d *Dispatcher) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func testItem(source string) model.Item {
+	item := model.NewItem(model.OperationEncrypt, source, source+".enc")
+	item.Rule = config.DefaultRuleName
+	item.FileSize = 42
+	return *item
+}
+
+func TestDispatcher_Webhook(t *testing.T) {
+	var mu sync.Mutex
+	var received []Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, Sign("s3cret", body), r.Header.Get(SignatureHeader))
+		assert.Equal(t, config.HookEventCompleted, r.Header.Get(EventHeader))
+		assert.NotEmpty(t, r.Header.Get(DeliveryHeader))
+
+		var ev Event
+		require.NoError(t, json.Unmarshal(body, &ev))
+		mu.Lock()
+		received = append(received, ev)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	d := newTestDispatcher(t, filepath.Join(t.TempDir(), "outbox.json"),
+		config.HookConfig{Name: "siem", URL: server.URL, Secret: "s3cret", MaxRetries: 1})
+	run(t, d)
+
+	require.NoError(t, d.Notify(config.HookEventCompleted, testItem("/data/in/report.csv")))
+
+	require.Eventually(t, func() bool { return d.Pending() == 0 }, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, received, 1)
+	assert.Equal(t, config.HookEventCompleted, received[0].Event)
+	assert.Equal(t, "/data/in/report.csv", received[0].Item.SourcePath)
+	assert.Equal(t, int64(42), received[0].Item.FileSize)
+}
+
+func TestDispatcher_RetriesInOrder(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	var delivered []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&ev))
+
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		delivered = append(delivered, ev.Item.SourcePath)
+	}))
+	defer server.Close()
+
+	d := newTestDispatcher(t, filepath.Join(t.TempDir(), "outbox.json"),
+		config.HookConfig{Name: "siem", URL: server.URL, Secret: "s3cret", MaxRetries: 3})
+
+	// Both events wait for the first one to be delivered
+	require.NoError(t, d.Notify(config.HookEventCompleted, testItem("/data/in/first.csv")))
+	require.NoError(t, d.Notify(config.HookEventCompleted, testItem("/data/in/second.csv")))
+	run(t, d)
+
+	require.Eventually(t, func() bool { return d.Pending() == 0 }, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 4, requests)
+	assert.Equal(t, []string{"/data/in/first.csv", "/data/in/second.csv"}, delivered)
+}
+
+func TestDispatcher_GivesUpAfterMaxRetries(t *testing.T) {
+	var mu sync.Mutex
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	d := newTestDispatcher(t, filepath.Join(t.TempDir(), "outbox.json"),
+		config.HookConfig{Name: "siem", URL: server.URL, Secret: "s3cret", MaxRetries: 2})
+	run(t, d)
+
+	require.NoError(t, d.Notify(config.HookEventDLQ, testItem("/data/in/report.csv")))
+
+	require.Eventually(t, func() bool { return d.Pending() == 0 }, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 3, requests)
+}
+
+func TestDispatcher_Command(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	outDir := t.TempDir()
+	script := `printf '%s %s %s' "$FILE_ENCRYPTOR_EVENT" "$FILE_ENCRYPTOR_OPERATION" "$FILE_ENCRYPTOR_SOURCE_PATH" > "$1/env"; cat > "$1/event.json"`
+
+	d := newTestDispatcher(t, filepath.Join(t.TempDir(), "outbox.json"),
+		config.HookConfig{Name: "notify", Command: []string{"sh", "-c", script, "sh", outDir}, MaxRetries: 1})
+	run(t, d)
+
+	item := testItem("/data/in/report.csv")
+	item.Error = "vault unreachable"
+	require.NoError(t, d.Notify(config.HookEventFailed, item))
+
+	require.Eventually(t, func() bool { return d.Pending() == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	env, err := os.ReadFile(filepath.Join(outDir, "env"))
+	require.NoError(t, err)
+	assert.Equal(t, "failed encrypt /data/in/report.csv", string(env))
+
+	data, err := os.ReadFile(filepath.Join(outDir, "event.json"))
+	require.NoError(t, err)
+	var ev Event
+	require.NoError(t, json.Unmarshal(data, &ev))
+	assert.Equal(t, "vault unreachable", ev.Item.Error)
+}
+
+func TestDispatcher_CommandFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	err := runCommand(context.Background(), []string{"sh", "-c", "echo receiver down >&2; exit 3"}, Event{}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exit status 3")
+	assert.Contains(t, err.Error(), "receiver down")
+}
+
+func TestRunCommand_Environment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+
+	t.Setenv("VAULT_TOKEN", "hvs.secret")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("FILE_ENCRYPTOR_ADMIN_TOKEN", "secret")
+
+	out := filepath.Join(t.TempDir(), "env")
+	script := `env > "$1"`
+	require.NoError(t, runCommand(context.Background(), []string{"sh", "-c", script, "sh", out},
+		Event{Event: config.HookEventCompleted, Item: testItem("/data/in/report.csv")}, nil))
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	env := string(data)
+
+	// Credentials of the service are not passed on
+	assert.NotContains(t, env, "secret")
+	assert.Contains(t, env, "PATH="+os.Getenv("PATH"))
+	assert.Contains(t, env, "FILE_ENCRYPTOR_SOURCE_PATH=/data/in/report.csv")
+}
+
+func TestDispatcher_Filters(t *testing.T) {
+	d := newTestDispatcher(t, filepath.Join(t.TempDir(), "outbox.json"),
+		config.HookConfig{Name: "dlq-only", URL: "http://127.0.0.1:1", Secret: "s", Events: []string{config.HookEventDLQ}},
+		config.HookConfig{Name: "decrypt-only", URL: "http://127.0.0.1:1", Secret: "s", Operations: []string{"decrypt"}},
+	)
+
+	require.NoError(t, d.Notify(config.HookEventCompleted, testItem("/data/in/a.csv")))
+	assert.Equal(t, 0, d.Pending())
+
+	require.NoError(t, d.Notify(config.HookEventDLQ, testItem("/data/in/b.csv")))
+	assert.Equal(t, 1, d.Pending())
+}
+
+func TestDispatcher_OutboxSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "outbox.json")
+	hook := config.HookConfig{Name: "siem", Secret: "s3cret", MaxRetries: 1}
+
+	// Not running: the event stays in the outbox
+	hook.URL = "http://127.0.0.1:1"
+	d := newTestDispatcher(t, path, hook)
+	require.NoError(t, d.Notify(config.HookEventCompleted, testItem("/data/in/report.csv")))
+
+	delivered := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&ev))
+		delivered <- ev.Item.SourcePath
+	}))
+	defer server.Close()
+
+	hook.URL = server.URL
+	reopened := newTestDispatcher(t, path, hook)
+	assert.Equal(t, 1, reopened.Pending())
+	run(t, reopened)
+
+	select {
+	case source := <-delivered:
+		assert.Equal(t, "/data/in/report.csv", source)
+	case <-time.After(5 * time.Second):
+		t.Fatal("event from the previous run was not delivered")
+	}
+	require.Eventually(t, func() bool { return reopened.Pending() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestDispatcher_RemovedHook(t *testing.T) {
+	d := newTestDispatcher(t, filepath.Join(t.TempDir(), "outbox.json"),
+		config.HookConfig{Name: "old", URL: "http://127.0.0.1:1", Secret: "s", MaxRetries: 1})
+	require.NoError(t, d.Notify(config.HookEventCompleted, testItem("/data/in/report.csv")))
+	require.Equal(t, 1, d.Pending())
+
+	d.Update(nil)
+	run(t, d)
+
+	require.Eventually(t, func() bool { return d.Pending() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSign(t *testing.T) {
+	sig := Sign("key", []byte("The quick brown fox jumps over the lazy dog"))
+	assert.Equal(t, "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8", sig)
+}
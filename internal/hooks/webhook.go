@@ -0,0 +1,59 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+)
+
+// Webhook request headers
+const (
+	// EventHeader holds the event type
+	EventHeader = "X-File-Encryptor-Event"
+
+	// DeliveryHeader identifies a delivery; retries of a delivery reuse it,
+	// so receivers can ignore duplicates
+	DeliveryHeader = "X-File-Encryptor-Delivery"
+
+	// SignatureHeader holds Sign(secret, body)
+	SignatureHeader = "X-File-Encryptor-Signature"
+)
+
+// Sign returns the signature of a webhook body: "sha256=" followed by the
+// hex encoded HMAC-SHA256 of the body keyed with the hook's secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post sends an event to a webhook. Any 2xx response is a delivery.
+func (d *Dispatcher) post(ctx context.Context, hook config.HookConfig, deliveryID, event string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
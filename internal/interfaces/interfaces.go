@@ -35,6 +35,8 @@ type Queue interface {
 	Enqueue(item *model.Item) error
 	Dequeue() *model.Item
 	Requeue(item *model.Item, err error) error
+	Complete(item *model.Item) error
+	Notify() <-chan struct{}
 }
 
 // Watcher defines the interface for the file watcher.
@@ -0,0 +1,380 @@
+package ledger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
+)
+
+// Entry is the state of a source file when it was processed
+type Entry struct {
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	Checksum    string    `json:"checksum,omitempty"` // SHA256, when hashing is enabled
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// The ledger file is a journal of JSON lines: a header, then one record per
+// processed file. Recording a file appends a line; the journal is compacted to
+// one record per file once it holds more than twice as many records.
+//
+//	{"format":"file-encryptor-ledger","version":1}
+//	{"path":"/data/a.csv","size":3,"mod_time":"...","processed_at":"..."}
+const (
+	journalFormat  = "file-encryptor-ledger"
+	journalVersion = 1
+
+	// compactThreshold is the number of records below which the journal is
+	// not compacted
+	compactThreshold = 1000
+)
+
+type journalHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+type journalRecord struct {
+	Path string `json:"path"`
+	Entry
+}
+
+// Ledger records source files that were processed and kept in place
+// (source_file_behavior = "keep"), so the watcher does not process them again
+// unless their content changes. Files are identified by path, size and
+// modification time; with hashing enabled a file whose modification time
+// changed but whose content did not is still considered processed.
+type Ledger struct {
+	path string
+	hash bool
+
+	mu        sync.Mutex
+	entries   map[string]Entry
+	records   int // records in the journal
+	compactAt int // record count of the next compaction
+}
+
+// Open loads the ledger at path, creating its directory if needed. Entries of
+// files that no longer exist are dropped. A ledger saved as a single JSON
+// object by earlier versions is converted to a journal.
+func Open(path string, hash bool) (*Ledger, error) {
+	if path == "" {
+		return nil, fmt.Errorf("ledger path cannot be empty")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil { // #nosec G301 - configurable directory path
+		return nil, fmt.Errorf("failed to create ledger directory: %w", err)
+	}
+
+	l := &Ledger{
+		path:      path,
+		hash:      hash,
+		entries:   make(map[string]Entry),
+		compactAt: compactThreshold,
+	}
+
+	data, err := os.ReadFile(path) // #nosec G304 - configurable ledger path
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ledger: %w", err)
+	}
+
+	clean := true
+	if isJournal(data) {
+		clean, err = l.replay(data)
+	} else {
+		clean = false
+		err = json.Unmarshal(data, &l.entries)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal ledger: %w", err)
+	}
+
+	for filePath := range l.entries {
+		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+			delete(l.entries, filePath)
+			clean = false
+		}
+	}
+
+	// Rewrite legacy ledgers, torn writes and entries of removed files
+	if !clean {
+		if err := l.compactLocked(); err != nil {
+			return nil, err
+		}
+	}
+
+	return l, nil
+}
+
+// Len returns the number of recorded files
+func (l *Ledger) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.entries)
+}
+
+// Snapshot returns the current state of a file, to be recorded once it has
+// been processed
+func (l *Ledger) Snapshot(filePath string) (Entry, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	entry := Entry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+
+	if l.hash {
+		checksum, err := crypto.CalculateChecksum(filePath)
+		if err != nil {
+			return Entry{}, err
+		}
+		entry.Checksum = checksum
+	}
+
+	return entry, nil
+}
+
+// Processed reports whether the file was recorded and has not changed since.
+// Files that cannot be read are reported as not processed.
+func (l *Ledger) Processed(filePath string) bool {
+	key := ledgerKey(filePath)
+
+	l.mu.Lock()
+	entry, ok := l.entries[key]
+	l.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil || info.Size() != entry.Size {
+		return false
+	}
+
+	if info.ModTime().Equal(entry.ModTime) {
+		return true
+	}
+
+	// Touched but possibly unchanged: compare content when hashing is enabled
+	if !l.hash || entry.Checksum == "" {
+		return false
+	}
+
+	checksum, err := crypto.CalculateChecksum(filePath)
+	if err != nil || checksum != entry.Checksum {
+		return false
+	}
+
+	// Remember the new modification time to avoid hashing again; losing it
+	// only costs another hash, so it is not synced to disk
+	entry.ModTime = info.ModTime()
+	l.mu.Lock()
+	_ = l.recordLocked(key, entry, false)
+	l.mu.Unlock()
+
+	return true
+}
+
+// Record stores the state of a processed file and appends it to the journal.
+// A failed compaction is returned too, though the file is recorded.
+func (l *Ledger) Record(filePath string, entry Entry) error {
+	if entry.ProcessedAt.IsZero() {
+		entry.ProcessedAt = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.recordLocked(ledgerKey(filePath), entry, true)
+}
+
+// recordLocked appends an entry, synced to disk with sync, and compacts the
+// journal once it holds twice as many records as files; after a failed
+// compaction the next attempt waits for twice as many records. The caller
+// must hold l.mu.
+func (l *Ledger) recordLocked(key string, entry Entry, sync bool) error {
+	if err := l.appendLocked(journalRecord{Path: key, Entry: entry}, sync); err != nil {
+		return err
+	}
+	l.entries[key] = entry
+
+	if l.records < l.compactAt || l.records < 2*len(l.entries) {
+		return nil
+	}
+	if err := l.compactLocked(); err != nil {
+		l.compactAt = 2 * l.records
+		return err
+	}
+	return nil
+}
+
+// appendLocked appends a record to the journal, creating it if needed; the
+// caller must hold l.mu
+func (l *Ledger) appendLocked(rec journalRecord, sync bool) error {
+	if l.records == 0 {
+		if _, err := os.Stat(l.path); os.IsNotExist(err) {
+			if err := l.compactLocked(); err != nil {
+				return err
+			}
+		}
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ledger record: %w", err)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0600) // #nosec G304 - configurable ledger path
+	if err != nil {
+		return fmt.Errorf("failed to open ledger: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write ledger: %w", err)
+	}
+	if sync {
+		if err := f.Sync(); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("failed to sync ledger: %w", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write ledger: %w", err)
+	}
+
+	l.records++
+	return nil
+}
+
+// replay applies the records of a journal, skipping a torn final write and
+// corrupt records, and reports whether every record was valid
+func (l *Ledger) replay(data []byte) (bool, error) {
+	clean := true
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+
+	first := true
+	for scanner.Scan() {
+		if first {
+			first = false
+			var header journalHeader
+			if err := json.Unmarshal(scanner.Bytes(), &header); err != nil || header.Version != journalVersion {
+				return false, fmt.Errorf("unsupported ledger version %d", header.Version)
+			}
+			continue
+		}
+
+		var rec journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil || rec.Path == "" {
+			clean = false
+			continue
+		}
+		l.entries[rec.Path] = rec.Entry
+		l.records++
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+
+	// A final line without a newline may be torn
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		clean = false
+	}
+
+	return clean, nil
+}
+
+// compactLocked atomically replaces the journal with one record per file;
+// the caller must hold l.mu
+func (l *Ledger) compactLocked() error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(journalHeader{Format: journalFormat, Version: journalVersion}); err != nil {
+		return fmt.Errorf("failed to marshal ledger: %w", err)
+	}
+
+	paths := make([]string, 0, len(l.entries))
+	for path := range l.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if err := enc.Encode(journalRecord{Path: path, Entry: l.entries[path]}); err != nil {
+			return fmt.Errorf("failed to marshal ledger: %w", err)
+		}
+	}
+
+	tmpPath := l.path + ".tmp"
+	if err := writeFileSync(tmpPath, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write ledger: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, l.path); err != nil {
+		return fmt.Errorf("failed to save ledger: %w", err)
+	}
+	syncDir(filepath.Dir(l.path))
+
+	l.records = len(l.entries)
+	l.compactAt = compactThreshold
+	return nil
+}
+
+// isJournal reports whether data starts with a journal header
+func isJournal(data []byte) bool {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	var header journalHeader
+	return json.Unmarshal(line, &header) == nil && header.Format == journalFormat
+}
+
+// writeFileSync writes data to path and syncs it to disk
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) // #nosec G304 - configurable ledger path
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir makes a rename in dir durable. Directories cannot be synced on all
+// platforms, so errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir) // #nosec G304 - configurable ledger directory
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+// ledgerKey identifies a file by its absolute, cleaned path
+func ledgerKey(filePath string) string {
+	if abs, err := filepath.Abs(filePath); err == nil {
+		return abs
+	}
+	return filepath.Clean(filePath)
+}
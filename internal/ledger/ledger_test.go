@@ -0,0 +1,222 @@
+package ledger
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedger_RecordAndProcessed(t *testing.T) {
+	tmpDir := t.TempDir()
+	ledgerPath := filepath.Join(tmpDir, "state", "ledger.json")
+	file := filepath.Join(tmpDir, "data.txt")
+	require.NoError(t, os.WriteFile(file, []byte("original"), 0600))
+
+	l, err := Open(ledgerPath, false)
+	require.NoError(t, err)
+	assert.False(t, l.Processed(file))
+
+	entry, err := l.Snapshot(file)
+	require.NoError(t, err)
+	assert.Empty(t, entry.Checksum)
+	require.NoError(t, l.Record(file, entry))
+	assert.True(t, l.Processed(file))
+
+	// The ledger survives a restart
+	reopened, err := Open(ledgerPath, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reopened.Len())
+	assert.True(t, reopened.Processed(file))
+
+	// Changed content is processed again
+	require.NoError(t, os.WriteFile(file, []byte("changed content"), 0600))
+	assert.False(t, reopened.Processed(file))
+}
+
+func TestLedger_TouchedFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "data.txt")
+	require.NoError(t, os.WriteFile(file, []byte("original"), 0600))
+	touched := time.Now().Add(time.Hour)
+
+	t.Run("without hash", func(t *testing.T) {
+		l, err := Open(filepath.Join(tmpDir, "plain.json"), false)
+		require.NoError(t, err)
+
+		entry, err := l.Snapshot(file)
+		require.NoError(t, err)
+		require.NoError(t, l.Record(file, entry))
+
+		require.NoError(t, os.Chtimes(file, touched, touched))
+		assert.False(t, l.Processed(file))
+	})
+
+	t.Run("with hash", func(t *testing.T) {
+		require.NoError(t, os.Chtimes(file, time.Now(), time.Now()))
+
+		l, err := Open(filepath.Join(tmpDir, "hashed.json"), true)
+		require.NoError(t, err)
+
+		entry, err := l.Snapshot(file)
+		require.NoError(t, err)
+		assert.NotEmpty(t, entry.Checksum)
+		require.NoError(t, l.Record(file, entry))
+
+		// Same content, new modification time
+		require.NoError(t, os.Chtimes(file, touched, touched))
+		assert.True(t, l.Processed(file))
+
+		// Same size, different content
+		require.NoError(t, os.WriteFile(file, []byte("modified"), 0600))
+		assert.False(t, l.Processed(file))
+	})
+}
+
+func TestOpen_DropsMissingFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	ledgerPath := filepath.Join(tmpDir, "ledger.json")
+	file := filepath.Join(tmpDir, "data.txt")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+
+	l, err := Open(ledgerPath, false)
+	require.NoError(t, err)
+	entry, err := l.Snapshot(file)
+	require.NoError(t, err)
+	require.NoError(t, l.Record(file, entry))
+
+	require.NoError(t, os.Remove(file))
+
+	reopened, err := Open(ledgerPath, false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, reopened.Len())
+}
+
+func TestOpen_Errors(t *testing.T) {
+	_, err := Open("", false)
+	assert.Error(t, err)
+
+	ledgerPath := filepath.Join(t.TempDir(), "ledger.json")
+	require.NoError(t, os.WriteFile(ledgerPath, []byte("not json"), 0600))
+	_, err = Open(ledgerPath, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to unmarshal ledger")
+}
+
+func TestLedger_Journal(t *testing.T) {
+	tmpDir := t.TempDir()
+	ledgerPath := filepath.Join(tmpDir, "ledger.json")
+	file := filepath.Join(tmpDir, "data.txt")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+
+	l, err := Open(ledgerPath, false)
+	require.NoError(t, err)
+	entry, err := l.Snapshot(file)
+	require.NoError(t, err)
+
+	// Each record appends a line rather than rewriting the ledger
+	require.NoError(t, l.Record(file, entry))
+	require.NoError(t, l.Record(file, entry))
+	data, err := os.ReadFile(ledgerPath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[0], journalFormat)
+
+	// Records of the same file are compacted once there are enough of them
+	for l.records < compactThreshold-1 {
+		require.NoError(t, l.Record(file, entry))
+	}
+	require.NoError(t, l.Record(file, entry))
+	assert.Equal(t, 1, l.records)
+	data, err = os.ReadFile(ledgerPath)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 2)
+
+	reopened, err := Open(ledgerPath, false)
+	require.NoError(t, err)
+	assert.True(t, reopened.Processed(file))
+}
+
+func TestLedger_CompactionFailureBacksOff(t *testing.T) {
+	tmpDir := t.TempDir()
+	ledgerPath := filepath.Join(tmpDir, "ledger.json")
+	file := filepath.Join(tmpDir, "data.txt")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+
+	l, err := Open(ledgerPath, false)
+	require.NoError(t, err)
+	entry, err := l.Snapshot(file)
+	require.NoError(t, err)
+	require.NoError(t, l.Record(file, entry))
+
+	// A directory in the way of the temporary file makes compaction fail
+	require.NoError(t, os.Mkdir(ledgerPath+".tmp", 0700))
+	for l.records < compactThreshold-1 {
+		require.NoError(t, l.Record(file, entry))
+	}
+	assert.ErrorContains(t, l.Record(file, entry), "failed to write ledger")
+	assert.True(t, l.Processed(file))
+
+	// The next attempt waits for twice as many records
+	require.NoError(t, os.Remove(ledgerPath+".tmp"))
+	require.NoError(t, l.Record(file, entry))
+	assert.Equal(t, compactThreshold+1, l.records)
+	assert.Equal(t, 2*compactThreshold, l.compactAt)
+}
+
+func TestOpen_LegacyLedger(t *testing.T) {
+	tmpDir := t.TempDir()
+	ledgerPath := filepath.Join(tmpDir, "ledger.json")
+	file := filepath.Join(tmpDir, "data.txt")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+
+	legacy := map[string]Entry{file: {Size: info.Size(), ModTime: info.ModTime(), ProcessedAt: time.Now()}}
+	data, err := json.MarshalIndent(legacy, "", "  ")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(ledgerPath, data, 0600))
+
+	l, err := Open(ledgerPath, false)
+	require.NoError(t, err)
+	assert.True(t, l.Processed(file))
+
+	// Converted to a journal
+	data, err = os.ReadFile(ledgerPath)
+	require.NoError(t, err)
+	assert.True(t, isJournal(data))
+}
+
+func TestOpen_TornWrite(t *testing.T) {
+	tmpDir := t.TempDir()
+	ledgerPath := filepath.Join(tmpDir, "ledger.json")
+	file := filepath.Join(tmpDir, "data.txt")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+
+	l, err := Open(ledgerPath, false)
+	require.NoError(t, err)
+	entry, err := l.Snapshot(file)
+	require.NoError(t, err)
+	require.NoError(t, l.Record(file, entry))
+
+	f, err := os.OpenFile(ledgerPath, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"path":"/tmp/torn`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reopened, err := Open(ledgerPath, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reopened.Len())
+	assert.True(t, reopened.Processed(file))
+
+	data, err := os.ReadFile(ledgerPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "torn")
+}
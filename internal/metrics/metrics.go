@@ -0,0 +1,127 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+)
+
+// Default is the registry served on the telemetry /metrics endpoint
+var Default = NewRegistry()
+
+// Histogram buckets in seconds
+var (
+	// ProcessingBuckets cover small files up to multi-gigabyte files
+	ProcessingBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+	// VaultBuckets cover typical Vault API latencies
+	VaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+// Vault endpoints used as the endpoint label
+const (
+	EndpointDataKey = "datakey"
+	EndpointDecrypt = "decrypt"
+	EndpointRewrap  = "rewrap"
+	EndpointHealth  = "health"
+)
+
+// Watch service metrics
+var (
+	QueueDepth = Default.NewGaugeVec(
+		"file_encryptor_queue_depth",
+		"Number of queue items by status (pending, failed awaiting retry, processing).",
+		"status",
+	)
+
+	ItemsProcessed = Default.NewCounterVec(
+		"file_encryptor_items_processed_total",
+		"Files processed successfully.",
+		"operation",
+	)
+
+	ItemsFailed = Default.NewCounterVec(
+		"file_encryptor_items_failed_total",
+		"Failed processing attempts.",
+		"operation",
+	)
+
+	ItemsDeadLettered = Default.NewCounterVec(
+		"file_encryptor_items_dead_lettered_total",
+		"Items moved to the dead letter queue after exhausting their retries.",
+		"operation",
+	)
+
+	BytesProcessed = Default.NewCounterVec(
+		"file_encryptor_bytes_processed_total",
+		"Bytes of source files encrypted or decrypted successfully.",
+		"operation",
+	)
+
+	ProcessingDuration = Default.NewHistogramVec(
+		"file_encryptor_processing_duration_seconds",
+		"Time taken to encrypt or decrypt a file.",
+		ProcessingBuckets,
+		"operation",
+	)
+
+	VaultRequestDuration = Default.NewHistogramVec(
+		"file_encryptor_vault_request_duration_seconds",
+		"Latency of Vault requests by endpoint.",
+		VaultBuckets,
+		"endpoint",
+	)
+
+	VaultRequestErrors = Default.NewCounterVec(
+		"file_encryptor_vault_request_errors_total",
+		"Failed Vault requests by endpoint.",
+		"endpoint",
+	)
+
+	HookDeliveries = Default.NewCounterVec(
+		"file_encryptor_hook_deliveries_total",
+		"Hook deliveries by hook and result (delivered, failed, dropped).",
+		"hook", "result",
+	)
+
+	HookOutboxDepth = Default.NewGauge(
+		"file_encryptor_hook_outbox_depth",
+		"Hook deliveries waiting in the outbox.",
+	)
+
+	MarkerWaiting = Default.NewGaugeVec(
+		"file_encryptor_marker_waiting",
+		"Files waiting for their marker, and markers for their file, longer than marker_timeout by rule and kind (file, marker).",
+		"operation", "rule", "kind",
+	)
+
+	ReconciledFiles = Default.NewCounterVec(
+		"file_encryptor_reconciled_files_total",
+		"Files whose events were missed, found by the periodic rescan of source directories.",
+		"operation", "rule",
+	)
+
+	StuckFiles = Default.NewGaugeVec(
+		"file_encryptor_stuck_files",
+		"Files left unprocessed longer than stuck_after by rule and location (source, failed, dlq).",
+		"operation", "rule", "location",
+	)
+
+	VaultLastHealthy = Default.NewGauge(
+		"file_encryptor_vault_last_healthy_timestamp_seconds",
+		"Unix time of the last successful Vault health check.",
+	)
+)
+
+// ObserveVaultRequest records the latency and outcome of a Vault request
+// that started at start
+func ObserveVaultRequest(endpoint string, start time.Time, err error) {
+	VaultRequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	if err != nil {
+		VaultRequestErrors.WithLabelValues(endpoint).Inc()
+	}
+}
+
+// Handler serves the Default registry
+func Handler() http.Handler {
+	return Default.Handler()
+}
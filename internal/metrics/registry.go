@@ -0,0 +1,328 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric types of the Prometheus text exposition format
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// Registry holds metric families and renders them in the Prometheus text
+// exposition format (version 0.0.4)
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// family is a metric name with one series per combination of label values
+type family struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64 // histograms only, sorted upper bounds
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// series holds the value of one label combination. For histograms value is
+// the sum of observations.
+type series struct {
+	labelValues []string
+	value       float64
+	counts      []uint64 // per bucket, non-cumulative
+	count       uint64
+}
+
+// register adds a family; registering a name twice is a programming error
+func (r *Registry) register(name, help, kind string, buckets []float64, labels []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.families[name]; exists {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.families[name] = f
+
+	// Metrics without labels are exported from the start, like the
+	// official client does
+	if len(labels) == 0 {
+		f.with(nil)
+	}
+
+	return f
+}
+
+// with returns the series for the given label values, creating it on first use
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), values...)}
+		if f.kind == typeHistogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// update applies fn to a series under the family lock
+func (f *family) update(s *series, fn func(s *series)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn(s)
+}
+
+// value reads a series value under the family lock
+func (f *family) value(s *series) float64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return s.value
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct{ f *family }
+
+// NewCounterVec registers a counter with the given label names
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{f: r.register(name, help, typeCounter, nil, labels)}
+}
+
+// WithLabelValues returns the counter for the given label values
+func (v *CounterVec) WithLabelValues(values ...string) Counter {
+	return Counter{f: v.f, s: v.f.with(values)}
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	f *family
+	s *series
+}
+
+// Inc increments the counter by 1
+func (c Counter) Inc() { c.Add(1) }
+
+// Add increases the counter; negative values are ignored
+func (c Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.f.update(c.s, func(s *series) { s.value += v })
+}
+
+// Value returns the current count
+func (c Counter) Value() float64 { return c.f.value(c.s) }
+
+// GaugeVec is a gauge partitioned by labels
+type GaugeVec struct{ f *family }
+
+// NewGaugeVec registers a gauge with the given label names
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{f: r.register(name, help, typeGauge, nil, labels)}
+}
+
+// NewGauge registers a gauge without labels
+func (r *Registry) NewGauge(name, help string) Gauge {
+	return r.NewGaugeVec(name, help).WithLabelValues()
+}
+
+// WithLabelValues returns the gauge for the given label values
+func (v *GaugeVec) WithLabelValues(values ...string) Gauge {
+	return Gauge{f: v.f, s: v.f.with(values)}
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	f *family
+	s *series
+}
+
+// Set sets the gauge
+func (g Gauge) Set(v float64) { g.f.update(g.s, func(s *series) { s.value = v }) }
+
+// Add adds v (which may be negative) to the gauge
+func (g Gauge) Add(v float64) { g.f.update(g.s, func(s *series) { s.value += v }) }
+
+// Inc increments the gauge by 1
+func (g Gauge) Inc() { g.Add(1) }
+
+// Dec decrements the gauge by 1
+func (g Gauge) Dec() { g.Add(-1) }
+
+// Value returns the current value of the gauge
+func (g Gauge) Value() float64 { return g.f.value(g.s) }
+
+// SetToCurrentTime sets the gauge to the current Unix time in seconds
+func (g Gauge) SetToCurrentTime() {
+	g.Set(float64(time.Now().UnixNano()) / 1e9)
+}
+
+// HistogramVec is a histogram partitioned by labels
+type HistogramVec struct{ f *family }
+
+// NewHistogramVec registers a histogram with the given bucket upper bounds
+// and label names
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &HistogramVec{f: r.register(name, help, typeHistogram, sorted, labels)}
+}
+
+// WithLabelValues returns the histogram for the given label values
+func (v *HistogramVec) WithLabelValues(values ...string) Histogram {
+	return Histogram{f: v.f, s: v.f.with(values)}
+}
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	f *family
+	s *series
+}
+
+// Observe adds an observation
+func (h Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.f.buckets, v)
+	h.f.update(h.s, func(s *series) {
+		if i < len(s.counts) {
+			s.counts[i]++
+		}
+		s.count++
+		s.value += v
+	})
+}
+
+// Write renders all metrics in the Prometheus text exposition format,
+// ordered by name and label values
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// write renders one family; the series are copied under the lock
+func (f *family) write(w *bufio.Writer) {
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	snapshot := make([]series, 0, len(keys))
+	for _, key := range keys {
+		s := *f.series[key]
+		s.counts = append([]uint64(nil), s.counts...)
+		snapshot = append(snapshot, s)
+	}
+	f.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+
+	for _, s := range snapshot {
+		if f.kind != typeHistogram {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelString(s.labelValues, ""), formatFloat(s.value))
+			continue
+		}
+
+		var cumulative uint64
+		for i, upper := range f.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(s.labelValues, formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelString(s.labelValues, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.labelString(s.labelValues, ""), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.labelString(s.labelValues, ""), s.count)
+	}
+}
+
+// labelString renders {name="value",...}, adding le for histogram buckets
+func (f *family) labelString(values []string, le string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, name := range f.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, escapeLabelValue(values[i])))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf(`le="%s"`, le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Handler serves the registry in the Prometheus text exposition format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.Write(w)
+	})
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string       { return helpEscaper.Replace(s) }
+func escapeLabelValue(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func render(t *testing.T, r *Registry) string {
+	t.Helper()
+	var sb strings.Builder
+	require.NoError(t, r.Write(&sb))
+	return sb.String()
+}
+
+func TestRegistry_CounterAndGauge(t *testing.T) {
+	r := NewRegistry()
+	processed := r.NewCounterVec("test_processed_total", "Processed items.", "operation")
+	depth := r.NewGaugeVec("test_queue_depth", "Queue depth.", "status")
+	healthy := r.NewGauge("test_last_healthy", "Last healthy.")
+
+	processed.WithLabelValues("encrypt").Inc()
+	processed.WithLabelValues("encrypt").Add(2)
+	processed.WithLabelValues("decrypt").Inc()
+	processed.WithLabelValues("decrypt").Add(-5) // ignored
+
+	depth.WithLabelValues("pending").Add(3)
+	depth.WithLabelValues("pending").Dec()
+
+	assert.Equal(t, 3.0, processed.WithLabelValues("encrypt").Value())
+	assert.Equal(t, 2.0, depth.WithLabelValues("pending").Value())
+
+	expected := `# HELP test_last_healthy Last healthy.
+# TYPE test_last_healthy gauge
+test_last_healthy 0
+# HELP test_processed_total Processed items.
+# TYPE test_processed_total counter
+test_processed_total{operation="decrypt"} 1
+test_processed_total{operation="encrypt"} 3
+# HELP test_queue_depth Queue depth.
+# TYPE test_queue_depth gauge
+test_queue_depth{status="pending"} 2
+`
+	assert.Equal(t, expected, render(t, r))
+
+	healthy.SetToCurrentTime()
+	assert.NotContains(t, render(t, r), "test_last_healthy 0\n")
+}
+
+func TestRegistry_Histogram(t *testing.T) {
+	r := NewRegistry()
+	duration := r.NewHistogramVec("test_duration_seconds", "Duration.", []float64{1, 0.1}, "endpoint")
+
+	h := duration.WithLabelValues("datakey")
+	h.Observe(0.05)
+	h.Observe(0.1)
+	h.Observe(0.5)
+	h.Observe(2)
+
+	expected := `# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{endpoint="datakey",le="0.1"} 2
+test_duration_seconds_bucket{endpoint="datakey",le="1"} 3
+test_duration_seconds_bucket{endpoint="datakey",le="+Inf"} 4
+test_duration_seconds_sum{endpoint="datakey"} 2.65
+test_duration_seconds_count{endpoint="datakey"} 4
+`
+	assert.Equal(t, expected, render(t, r))
+}
+
+func TestRegistry_Escaping(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("test_total", "Help with \\ and\nnewline.", "path").
+		WithLabelValues(`C:\dir "quoted"` + "\n").Inc()
+
+	out := render(t, r)
+	assert.Contains(t, out, `# HELP test_total Help with \\ and\nnewline.`)
+	assert.Contains(t, out, `test_total{path="C:\\dir \"quoted\"\n"} 1`)
+}
+
+func TestRegistry_RegisterTwicePanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("test_total", "Test.")
+	assert.Panics(t, func() { r.NewGaugeVec("test_total", "Test.") })
+}
+
+func TestRegistry_WrongLabelCountPanics(t *testing.T) {
+	r := NewRegistry()
+	v := r.NewCounterVec("test_total", "Test.", "operation")
+	assert.Panics(t, func() { v.WithLabelValues("encrypt", "extra") })
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("test_total", "Test.", "operation").WithLabelValues("encrypt").Inc()
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `test_total{operation="encrypt"} 1`)
+}
@@ -73,6 +73,19 @@ type Item struct {
 
 	// Checksum is the original file checksum
 	Checksum string `json:"checksum,omitempty"`
+
+	// Rule is the name of the encryption or decryption block that matched
+	// the file (empty for items queued before rules existed)
+	Rule string `json:"rule,omitempty"`
+
+	// TransitMount and KeyName identify the Vault Transit key chosen by the
+	// rule, so retries after a restart or reload still use the same key
+	TransitMount string `json:"transit_mount,omitempty"`
+	KeyName      string `json:"key_name,omitempty"`
+
+	// Archive is the compression of the tar archive a directory is encrypted
+	// as ("none" or "gzip"); empty when SourcePath is a single file
+	Archive string `json:"archive,omitempty"`
 }
 
 // NewItem creates a new queue item.
@@ -121,3 +134,12 @@ func (i *Item) MarkFailed(err error, retryDelay time.Duration) {
 func (i *Item) MarkDLQ() {
 	i.Status = StatusDLQ
 }
+
+// MarkInterrupted returns the item to pending after an attempt was aborted
+// by shutdown, so the interrupted attempt is not counted against its retries.
+func (i *Item) MarkInterrupted() {
+	i.Status = StatusPending
+	if i.AttemptCount > 0 {
+		i.AttemptCount--
+	}
+}
@@ -0,0 +1,442 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+)
+
+// URLScheme prefixes object locations such as s3://bucket/key
+const URLScheme = "s3://"
+
+// metadataHeaderPrefix starts the headers that carry user metadata
+const metadataHeaderPrefix = "X-Amz-Meta-"
+
+// ErrNotFound is matched by errors for objects that do not exist
+var ErrNotFound = errors.New("object not found")
+
+// Config describes an S3-compatible bucket and how to reach it
+type Config struct {
+	Endpoint  string // e.g. http://localhost:9000 (default: AWS endpoint of Region)
+	Bucket    string
+	Prefix    string // Prepended to object keys
+	Region    string
+	PathStyle bool // endpoint/bucket/key instead of bucket.endpoint/key
+
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	PartSize   int          // Size of multipart upload parts (default config.DefaultPartSize)
+	HTTPClient *http.Client // default http.DefaultClient
+}
+
+// Client reads and writes the objects of one bucket
+type Client struct {
+	bucket    string
+	prefix    string
+	pathStyle bool
+	partSize  int
+	endpoint  *url.URL
+	signer    signer
+	http      *http.Client
+	now       func() time.Time
+}
+
+// Error is an error response of the object store
+type Error struct {
+	StatusCode int
+	Code       string // e.g. NoSuchKey; empty if the response had no error document
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("object store request failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("object store request failed with status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Is matches ErrNotFound for missing objects
+func (e *Error) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// NewClientFromConfig creates a client for a destination block. Credentials
+// missing from the block are read from AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+func NewClientFromConfig(cfg *config.DestinationConfig) (*Client, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	var creds config.S3CredentialsConfig
+	if cfg.Credentials != nil {
+		creds = *cfg.Credentials
+	}
+	if creds.AccessKeyID == "" && creds.SecretAccessKey == "" {
+		creds.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		creds.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if creds.SessionToken == "" {
+			creds.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+	}
+
+	return NewClient(&Config{
+		Endpoint:        cfg.Endpoint,
+		Bucket:          cfg.Bucket,
+		Prefix:          cfg.Prefix,
+		Region:          cfg.Region,
+		PathStyle:       cfg.PathStyle,
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		PartSize:        cfg.PartSize,
+	})
+}
+
+// NewClient creates a client for a bucket
+func NewClient(cfg *Config) (*Client, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("bucket is required")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, fmt.Errorf("access key ID and secret access key are required")
+	}
+
+	region := cfg.Region
+	if region == "" {
+		region = config.DefaultS3Region
+	}
+
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint: %s", endpoint)
+	}
+
+	partSize := cfg.PartSize
+	if partSize == 0 {
+		partSize = config.DefaultPartSize
+	}
+	if partSize < config.MinPartSize {
+		return nil, fmt.Errorf("part size must be at least %d bytes", config.MinPartSize)
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		bucket:    cfg.Bucket,
+		prefix:    strings.Trim(cfg.Prefix, "/"),
+		pathStyle: cfg.PathStyle,
+		partSize:  partSize,
+		endpoint:  u,
+		signer: signer{
+			accessKeyID:     cfg.AccessKeyID,
+			secretAccessKey: cfg.SecretAccessKey,
+			sessionToken:    cfg.SessionToken,
+			region:          region,
+		},
+		http: httpClient,
+		now:  time.Now,
+	}, nil
+}
+
+// Bucket returns the name of the bucket
+func (c *Client) Bucket() string {
+	return c.bucket
+}
+
+// Key returns the object key of a name relative to the prefix
+func (c *Client) Key(name string) string {
+	return strings.TrimPrefix(path.Join(c.prefix, name), "/")
+}
+
+// URL returns the s3://bucket/key location of an object
+func (c *Client) URL(key string) string {
+	return URLScheme + c.bucket + "/" + key
+}
+
+// IsURL reports whether s is an s3://bucket/key location
+func IsURL(s string) bool {
+	return strings.HasPrefix(s, URLScheme)
+}
+
+// ParseURL splits an s3://bucket/key location
+func ParseURL(s string) (bucket, key string, err error) {
+	if !IsURL(s) {
+		return "", "", fmt.Errorf("not an %s URL: %s", URLScheme, s)
+	}
+
+	bucket, key, _ = strings.Cut(strings.TrimPrefix(s, URLScheme), "/")
+	if bucket == "" || key == "" {
+		return "", "", fmt.Errorf("invalid object URL, expected %sbucket/key: %s", URLScheme, s)
+	}
+	return bucket, key, nil
+}
+
+// Upload streams r to an object. Data that fits in one part is uploaded
+// with a single request; larger data is sent as a multipart upload, one
+// part in memory at a time, which is aborted if anything fails.
+func (c *Client) Upload(ctx context.Context, key string, r io.Reader, metadata map[string]string) error {
+	buf := make([]byte, c.partSize)
+
+	n, readErr := io.ReadFull(r, buf)
+	if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+		return c.Put(ctx, key, buf[:n], metadata)
+	}
+	if readErr != nil {
+		return fmt.Errorf("failed to read upload data: %w", readErr)
+	}
+
+	uploadID, err := c.createMultipartUpload(ctx, key, metadata)
+	if err != nil {
+		return err
+	}
+
+	var parts []completedPart
+	for number := 1; n > 0; number++ {
+		etag, err := c.uploadPart(ctx, key, uploadID, number, buf[:n])
+		if err != nil {
+			return c.abort(ctx, key, uploadID, err)
+		}
+		parts = append(parts, completedPart{PartNumber: number, ETag: etag})
+
+		// A short part is the last one
+		if readErr != nil {
+			break
+		}
+
+		n, readErr = io.ReadFull(r, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return c.abort(ctx, key, uploadID, fmt.Errorf("failed to read upload data: %w", readErr))
+		}
+	}
+
+	if err := c.completeMultipartUpload(ctx, key, uploadID, parts); err != nil {
+		return c.abort(ctx, key, uploadID, err)
+	}
+	return nil
+}
+
+// Put writes data to an object with a single request
+func (c *Client) Put(ctx context.Context, key string, data []byte, metadata map[string]string) error {
+	resp, err := c.do(ctx, http.MethodPut, key, nil, data, metadataHeader(metadata))
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", c.URL(key), err)
+	}
+	return resp.Body.Close()
+}
+
+// Get opens an object and returns its metadata, with lowercase names
+func (c *Client) Get(ctx context.Context, key string) (io.ReadCloser, map[string]string, error) {
+	resp, err := c.do(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to download %s: %w", c.URL(key), err)
+	}
+
+	metadata := map[string]string{}
+	for name, values := range resp.Header {
+		canonical := http.CanonicalHeaderKey(name)
+		if strings.HasPrefix(canonical, metadataHeaderPrefix) && len(values) > 0 {
+			metadata[strings.ToLower(strings.TrimPrefix(canonical, metadataHeaderPrefix))] = values[0]
+		}
+	}
+
+	return resp.Body, metadata, nil
+}
+
+// ReadAll returns the content of a small object
+func (c *Client) ReadAll(ctx context.Context, key string) ([]byte, error) {
+	body, _, err := c.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", c.URL(key), err)
+	}
+	return data, nil
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (c *Client) createMultipartUpload(ctx context.Context, key string, metadata map[string]string) (string, error) {
+	resp, err := c.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, metadataHeader(metadata))
+	if err != nil {
+		return "", fmt.Errorf("failed to start upload of %s: %w", c.URL(key), err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var result initiateMultipartUploadResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil || result.UploadID == "" {
+		return "", fmt.Errorf("failed to start upload of %s: invalid response", c.URL(key))
+	}
+	return result.UploadID, nil
+}
+
+func (c *Client) uploadPart(ctx context.Context, key, uploadID string, number int, data []byte) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadID}}
+	resp, err := c.do(ctx, http.MethodPut, key, query, data, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload part %d of %s: %w", number, c.URL(key), err)
+	}
+	_ = resp.Body.Close()
+
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		return "", fmt.Errorf("failed to upload part %d of %s: no ETag in response", number, c.URL(key))
+	}
+	return etag, nil
+}
+
+func (c *Client) completeMultipartUpload(ctx context.Context, key, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(completeMultipartUpload{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body, nil)
+	if err != nil {
+		return fmt.Errorf("failed to complete upload of %s: %w", c.URL(key), err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// The request may fail after the 200 status has been sent
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to complete upload of %s: %w", c.URL(key), err)
+	}
+	if respErr := parseError(resp.StatusCode, data); respErr.Code != "" {
+		return fmt.Errorf("failed to complete upload of %s: %w", c.URL(key), respErr)
+	}
+	return nil
+}
+
+// abort cancels a multipart upload so its parts are not kept, and returns err
+func (c *Client) abort(ctx context.Context, key, uploadID string, err error) error {
+	resp, abortErr := c.do(context.WithoutCancel(ctx), http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if abortErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to abort upload of %s: %w", c.URL(key), abortErr))
+	}
+	_ = resp.Body.Close()
+	return err
+}
+
+// do sends a signed request for an object and returns responses with a
+// success status; other responses become an *Error
+func (c *Client) do(ctx context.Context, method, key string, query url.Values, body []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.objectURL(key, query), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = hashHex(body)
+	}
+	c.signer.sign(req, payloadHash, c.now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		_ = resp.Body.Close()
+		return nil, parseError(resp.StatusCode, data)
+	}
+
+	return resp, nil
+}
+
+// objectURL returns the URL of an object, path-style or virtual-hosted
+func (c *Client) objectURL(key string, query url.Values) string {
+	u := *c.endpoint
+
+	objectPath := "/" + key
+	if c.pathStyle {
+		objectPath = "/" + c.bucket + objectPath
+	} else {
+		u.Host = c.bucket + "." + u.Host
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + objectPath
+	u.RawPath = encodePath(u.Path)
+
+	if len(query) > 0 {
+		var pairs []string
+		for name, values := range query {
+			for _, v := range values {
+				pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(v, true))
+			}
+		}
+		sort.Strings(pairs)
+		u.RawQuery = strings.Join(pairs, "&")
+	}
+
+	return u.String()
+}
+
+// metadataHeader returns user metadata as request headers
+func metadataHeader(metadata map[string]string) http.Header {
+	header := http.Header{}
+	for name, value := range metadata {
+		header.Set(metadataHeaderPrefix+name, value)
+	}
+	return header
+}
+
+// parseError reads an XML error document, if there is one
+func parseError(statusCode int, data []byte) *Error {
+	respErr := &Error{StatusCode: statusCode}
+	var doc struct {
+		XMLName xml.Name
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(data, &doc) == nil && doc.XMLName.Local == "Error" {
+		respErr.Code = doc.Code
+		respErr.Message = doc.Message
+	}
+	return respErr
+}
@@ -0,0 +1,125 @@
+package objectstore_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/objectstore"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/objectstore/objectstoretest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_UploadSinglePart(t *testing.T) {
+	server := objectstoretest.NewServer()
+	defer server.Close()
+
+	client, err := server.Client("bucket", "backups/", 0)
+	require.NoError(t, err)
+
+	key := client.Key("reports/q1 data.csv.enc")
+	assert.Equal(t, "backups/reports/q1 data.csv.enc", key)
+
+	metadata := map[string]string{"vault-key-file": "abc"}
+	require.NoError(t, client.Upload(context.Background(), key, bytes.NewReader([]byte("ciphertext")), metadata))
+
+	obj := server.Object("bucket", key)
+	require.NotNil(t, obj)
+	assert.Equal(t, []byte("ciphertext"), obj.Data)
+	assert.Equal(t, 0, server.MultipartUploads)
+
+	body, got, err := client.Get(context.Background(), key)
+	require.NoError(t, err)
+	defer func() { _ = body.Close() }()
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("ciphertext"), data)
+	assert.Equal(t, metadata, got)
+}
+
+func TestClient_UploadMultipart(t *testing.T) {
+	server := objectstoretest.NewServer()
+	defer server.Close()
+
+	client, err := server.Client("bucket", "", config.MinPartSize)
+	require.NoError(t, err)
+
+	// Two full parts and a short one
+	data := bytes.Repeat([]byte("0123456789"), (2*config.MinPartSize+1000)/10)
+	require.NoError(t, client.Upload(context.Background(), "big.enc", bytes.NewReader(data), nil))
+
+	assert.Equal(t, 1, server.MultipartUploads)
+	assert.Equal(t, 0, server.PendingUploads())
+	stored, err := client.ReadAll(context.Background(), "big.enc")
+	require.NoError(t, err)
+	assert.Equal(t, data, stored)
+}
+
+func TestClient_UploadAbortsOnReadError(t *testing.T) {
+	server := objectstoretest.NewServer()
+	defer server.Close()
+
+	client, err := server.Client("bucket", "", config.MinPartSize)
+	require.NoError(t, err)
+
+	// The first part is sent before the source fails
+	readErr := errors.New("encryption failed")
+	src := io.MultiReader(bytes.NewReader(make([]byte, config.MinPartSize+1)), &failingReader{err: readErr})
+
+	err = client.Upload(context.Background(), "broken.enc", src, nil)
+	require.ErrorIs(t, err, readErr)
+	assert.Equal(t, 0, server.PendingUploads())
+	assert.Nil(t, server.Object("bucket", "broken.enc"))
+}
+
+func TestClient_GetNotFound(t *testing.T) {
+	server := objectstoretest.NewServer()
+	defer server.Close()
+
+	client, err := server.Client("bucket", "", 0)
+	require.NoError(t, err)
+
+	_, _, err = client.Get(context.Background(), "missing.key")
+	require.ErrorIs(t, err, objectstore.ErrNotFound)
+
+	var storeErr *objectstore.Error
+	require.ErrorAs(t, err, &storeErr)
+	assert.Equal(t, "NoSuchKey", storeErr.Code)
+}
+
+func TestParseURL(t *testing.T) {
+	bucket, key, err := objectstore.ParseURL("s3://bucket/reports/data.csv.enc")
+	require.NoError(t, err)
+	assert.Equal(t, "bucket", bucket)
+	assert.Equal(t, "reports/data.csv.enc", key)
+
+	for _, invalid := range []string{"bucket/key", "s3://bucket", "s3://bucket/", "s3:///key"} {
+		_, _, err := objectstore.ParseURL(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestNewClientFromConfig_EnvironmentCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "env-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+
+	client, err := objectstore.NewClientFromConfig(&config.DestinationConfig{Type: config.DestinationS3, Bucket: "bucket"})
+	require.NoError(t, err)
+	assert.Equal(t, "s3://bucket/a.enc", client.URL("a.enc"))
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	_, err = objectstore.NewClientFromConfig(&config.DestinationConfig{Type: config.DestinationS3, Bucket: "bucket"})
+	assert.ErrorContains(t, err, "access key ID and secret access key are required")
+}
+
+type failingReader struct {
+	err error
+}
+
+func (r *failingReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
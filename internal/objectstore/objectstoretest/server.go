@@ -0,0 +1,221 @@
+package objectstoretest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/objectstore"
+)
+
+// Test credentials accepted by Server
+const (
+	AccessKeyID     = "test-access-key"
+	SecretAccessKey = "test-secret-key"
+	Region          = "us-east-1"
+)
+
+// Object is an object stored by Server
+type Object struct {
+	Data     []byte
+	Metadata map[string]string // Lowercase names without the x-amz-meta- prefix
+}
+
+// Server is an in-memory, path-style S3 stand-in. It implements the
+// requests objectstore.Client sends and checks that they are signed with
+// AccessKeyID; signatures themselves are not verified.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]*Object // bucket/key
+	uploads map[string]*upload // upload ID
+	nextID  int
+
+	// MultipartUploads counts completed multipart uploads
+	MultipartUploads int
+}
+
+type upload struct {
+	name     string
+	metadata map[string]string
+	parts    map[int][]byte
+}
+
+// NewServer starts a server; close it with Close
+func NewServer() *Server {
+	s := &Server{
+		objects: map[string]*Object{},
+		uploads: map[string]*upload{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Client returns a client for bucket with the test credentials
+func (s *Server) Client(bucket, prefix string, partSize int) (*objectstore.Client, error) {
+	return objectstore.NewClient(&objectstore.Config{
+		Endpoint:        s.URL,
+		Bucket:          bucket,
+		Prefix:          prefix,
+		Region:          Region,
+		PathStyle:       true,
+		AccessKeyID:     AccessKeyID,
+		SecretAccessKey: SecretAccessKey,
+		PartSize:        partSize,
+	})
+}
+
+// Object returns a stored object, or nil
+func (s *Server) Object(bucket, key string) *Object {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.objects[bucket+"/"+key]
+}
+
+// Keys returns the keys stored in bucket, sorted
+func (s *Server) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var keys []string
+	for name := range s.objects {
+		if key, ok := strings.CutPrefix(name, bucket+"/"); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PendingUploads returns the number of multipart uploads neither completed
+// nor aborted
+func (s *Server) PendingUploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.uploads)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Authorization"), "Credential="+AccessKeyID+"/") {
+		writeError(w, http.StatusForbidden, "AccessDenied", "request is not signed")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if _, key, ok := strings.Cut(name, "/"); !ok || key == "" {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "bucket and key are required")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.nextID++
+		id := "upload-" + strconv.Itoa(s.nextID)
+		s.uploads[id] = &upload{name: name, metadata: metadata(r.Header), parts: map[int][]byte{}}
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			UploadID string   `xml:"UploadId"`
+		}{UploadID: id})
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		u, ok := s.uploads[query.Get("uploadId")]
+		number, err := strconv.Atoi(query.Get("partNumber"))
+		if !ok || err != nil {
+			writeError(w, http.StatusNotFound, "NoSuchUpload", "unknown upload")
+			return
+		}
+		u.parts[number] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, number))
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		u, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchUpload", "unknown upload")
+			return
+		}
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+			return
+		}
+		var data []byte
+		for _, part := range complete.Parts {
+			data = append(data, u.parts[part.PartNumber]...)
+		}
+		s.objects[u.name] = &Object{Data: data, Metadata: u.metadata}
+		delete(s.uploads, query.Get("uploadId"))
+		s.MultipartUploads++
+		writeXML(w, struct {
+			XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		}{})
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut:
+		s.objects[name] = &Object{Data: body, Metadata: metadata(r.Header)}
+
+	case r.Method == http.MethodGet:
+		obj, ok := s.objects[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+			return
+		}
+		for k, v := range obj.Metadata {
+			w.Header().Set("X-Amz-Meta-"+k, v)
+		}
+		_, _ = w.Write(obj.Data)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+func metadata(header http.Header) map[string]string {
+	m := map[string]string{}
+	for name, values := range header {
+		if k, ok := strings.CutPrefix(strings.ToLower(name), "x-amz-meta-"); ok && len(values) > 0 {
+			m[k] = values[0]
+		}
+	}
+	return m
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: message})
+}
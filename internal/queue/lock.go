@@ -0,0 +1,52 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrLocked is returned by LockState when another process holds the lock
+var ErrLocked = errors.New("queue state is locked by another process")
+
+// StateLock gives one process exclusive use of a queue state file. The watch
+// service holds it while running; offline queue commands take it before
+// changing the journal.
+type StateLock struct {
+	file *os.File
+}
+
+// LockState locks the queue state at statePath using a .lock file next to
+// it. The lock is released by Unlock or when the process exits.
+func LockState(statePath string) (*StateLock, error) {
+	if statePath == "" {
+		return nil, fmt.Errorf("state path cannot be empty")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(statePath), 0750); err != nil { // #nosec G301 - configurable directory path
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	file, err := lockFile(statePath + ".lock")
+	if err != nil {
+		return nil, err
+	}
+
+	return &StateLock{file: file}, nil
+}
+
+// Unlock releases the lock
+func (l *StateLock) Unlock() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+
+	err := unlockFile(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+
+	return err
+}
@@ -1,17 +1,75 @@
 package queue
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 
 	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
 )
 
+// Queue state is a write-ahead journal of JSON lines: a header followed by
+// one record per queue change, each synced to disk before the change is
+// acknowledged. Replaying the journal rebuilds the queue after a crash.
+// Compaction rewrites the journal with one put record per live item.
+//
+//	{"format":"file-encryptor-queue-journal","version":1}
+//	{"op":"put","id":"...","item":{...}}  item added, requeued or dead-lettered
+//	{"op":"take","id":"..."}              item handed to a worker
+//	{"op":"delete","id":"..."}            item completed
+const (
+	journalFormat  = "file-encryptor-queue-journal"
+	journalVersion = 1
+
+	// compactThreshold is the number of records appended since the last
+	// compaction after which the journal is compacted, provided it holds
+	// more than twice as many records as live items
+	compactThreshold = 1000
+)
+
+// Journal operations
+const (
+	opPut    = "put"
+	opTake   = "take"
+	opDelete = "delete"
+)
+
+type journalHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+type journalRecord struct {
+	Op   string          `json:"op"`
+	ID   string          `json:"id,omitempty"`
+	Item json.RawMessage `json:"item,omitempty"`
+}
+
+// journalEntry is the durable state of one item
+type journalEntry struct {
+	id    string
+	seq   uint64          // position in FIFO order
+	item  json.RawMessage // last put
+	taken bool            // handed to a worker and not yet completed or requeued
+}
+
 // Persistence handles saving and loading queue state
 type Persistence struct {
 	statePath string
+
+	mu         sync.Mutex
+	file       *os.File // journal opened for appending; nil until first use
+	entries    map[string]*journalEntry
+	seq        uint64
+	appended   int   // records appended since the last compaction
+	compactAt  int   // appended count of the next automatic compaction
+	compactErr error // last automatic compaction failure, nil once one succeeds
 }
 
 // NewPersistence creates a new persistence handler
@@ -28,52 +86,420 @@ func NewPersistence(statePath string) (*Persistence, error) {
 
 	return &Persistence{
 		statePath: statePath,
+		compactAt: compactThreshold,
 	}, nil
 }
 
-// Save saves queue items to disk
+// Save replaces the queue state with items
 func (p *Persistence) Save(items []*model.Item) error {
-	// Create temporary file
-	tmpPath := p.statePath + ".tmp"
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entries := make(map[string]*journalEntry, len(items))
+	var seq uint64
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return fmt.Errorf("failed to marshal queue state: %w", err)
+		}
+		seq++
+		entries[item.ID] = &journalEntry{id: item.ID, seq: seq, item: data}
+	}
+
+	p.entries = entries
+	p.seq = seq
+
+	return p.compactLocked()
+}
+
+// Load loads queue items from disk in FIFO order. A JSON state file written
+// by earlier versions is migrated to the journal (the original is kept with a
+// .legacy suffix). Items that were handed to a worker when the journal was
+// last written are returned with StatusProcessing.
+func (p *Persistence) Load() ([]*model.Item, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.openLocked(); err != nil {
+		return nil, err
+	}
+
+	ordered := p.orderedLocked()
+	items := make([]*model.Item, 0, len(ordered))
+	for _, entry := range ordered {
+		var item model.Item
+		if err := json.Unmarshal(entry.item, &item); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal queue state: %w", err)
+		}
+		if entry.taken {
+			item.Status = model.StatusProcessing
+		}
+		items = append(items, &item)
+	}
+
+	return items, nil
+}
+
+// Put records that an item was added or updated; it moves to the back of the
+// queue
+func (p *Persistence) Put(item *model.Item) error {
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue item: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.recordLocked(journalRecord{Op: opPut, ID: item.ID, Item: data})
+}
+
+// Take records that an item was handed to a worker
+func (p *Persistence) Take(id string) error {
+	return p.record(journalRecord{Op: opTake, ID: id})
+}
 
-	// Marshal items to JSON
-	data, err := json.MarshalIndent(items, "", "  ")
+// Delete records that an item was completed
+func (p *Persistence) Delete(id string) error {
+	return p.record(journalRecord{Op: opDelete, ID: id})
+}
+
+// Compact rewrites the journal with one record per live item
+func (p *Persistence) Compact() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.openLocked(); err != nil {
+		return err
+	}
+
+	return p.compactLocked()
+}
+
+// CompactErr returns the last automatic journal compaction failure, or nil
+// once the journal is compacted successfully again
+func (p *Persistence) CompactErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.compactErr
+}
+
+// Close closes the journal
+func (p *Persistence) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.file == nil {
+		return nil
+	}
+
+	err := p.file.Close()
+	p.file = nil
+	p.entries = nil
+	return err
+}
+
+// record appends and applies a record
+func (p *Persistence) record(rec journalRecord) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.recordLocked(rec)
+}
+
+// recordLocked appends and applies a record; the caller must hold p.mu. A
+// failed compaction does not fail the record, which is already on disk; it is
+// retried later and reported by CompactErr.
+func (p *Persistence) recordLocked(rec journalRecord) error {
+	if err := p.appendLocked(rec); err != nil {
+		return err
+	}
+	p.applyLocked(rec)
+
+	p.maybeCompactLocked()
+	return nil
+}
+
+// appendLocked writes a record and syncs it to disk; the caller must hold p.mu
+func (p *Persistence) appendLocked(rec journalRecord) error {
+	if err := p.openLocked(); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(rec)
 	if err != nil {
+		return fmt.Errorf("failed to marshal journal record: %w", err)
+	}
+
+	if _, err := p.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write queue journal: %w", err)
+	}
+	if err := p.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync queue journal: %w", err)
+	}
+
+	p.appended++
+	return nil
+}
+
+// applyLocked updates the in-memory state with a record; the caller must hold p.mu
+func (p *Persistence) applyLocked(rec journalRecord) {
+	switch rec.Op {
+	case opPut:
+		p.seq++
+		p.entries[rec.ID] = &journalEntry{id: rec.ID, seq: p.seq, item: rec.Item}
+	case opTake:
+		if entry, ok := p.entries[rec.ID]; ok {
+			entry.taken = true
+		}
+	case opDelete:
+		delete(p.entries, rec.ID)
+	}
+}
+
+// maybeCompactLocked compacts the journal once enough records were appended,
+// keeping any failure in p.compactErr; the caller must hold p.mu. After a
+// failure the next attempt waits for twice as many records, so a journal that
+// cannot be compacted is not rewritten on every record.
+func (p *Persistence) maybeCompactLocked() {
+	if p.appended < p.compactAt || p.appended < 2*len(p.entries) {
+		return
+	}
+	if err := p.compactLocked(); err != nil {
+		p.compactErr = fmt.Errorf("failed to compact queue journal: %w", err)
+		p.compactAt = 2 * p.appended
+	}
+}
+
+// openLocked replays the journal, migrating a legacy state file, and opens it
+// for appending; the caller must hold p.mu
+func (p *Persistence) openLocked() error {
+	if p.file != nil {
+		return nil
+	}
+
+	p.entries = make(map[string]*journalEntry)
+	p.seq = 0
+	p.appended = 0
+
+	data, err := os.ReadFile(p.statePath) // #nosec G304 - configurable state path
+	switch {
+	case os.IsNotExist(err) || (err == nil && len(bytes.TrimSpace(data)) == 0):
+		// New journal
+		return p.compactLocked()
+	case err != nil:
+		return fmt.Errorf("failed to read queue state: %w", err)
+	}
+
+	if isLegacyState(data) {
+		return p.migrateLocked(data)
+	}
+
+	valid, clean, err := p.replayLocked(data)
+	if err != nil {
+		return err
+	}
+
+	// Drop corrupt records and a torn final write by rewriting the journal
+	if !clean {
+		return p.compactLocked()
+	}
+
+	file, err := os.OpenFile(p.statePath, os.O_WRONLY, 0600) // #nosec G304 - configurable state path
+	if err != nil {
+		return fmt.Errorf("failed to open queue journal: %w", err)
+	}
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to open queue journal: %w", err)
+	}
+	p.file = file
+
+	return nil
+}
+
+// replayLocked applies the records of a journal. It returns the length of the
+// data up to the last complete line, and whether every record was valid.
+func (p *Persistence) replayLocked(data []byte) (int64, bool, error) {
+	var valid int64
+	clean := true
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+
+	first := true
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		end := valid + int64(len(line)) + 1
+		complete := end <= int64(len(data))
+
+		if first {
+			first = false
+			var header journalHeader
+			if err := json.Unmarshal(line, &header); err != nil || header.Format != journalFormat {
+				return 0, false, fmt.Errorf("unrecognized queue state file: %s", p.statePath)
+			}
+			if header.Version != journalVersion {
+				return 0, false, fmt.Errorf("unsupported queue journal version %d", header.Version)
+			}
+			valid = end
+			continue
+		}
+
+		var rec journalRecord
+		if !complete || json.Unmarshal(line, &rec) != nil || !rec.valid() {
+			clean = false
+			if complete {
+				valid = end
+			}
+			continue
+		}
+
+		p.applyLocked(rec)
+		p.appended++
+		valid = end
+	}
+
+	if err := scanner.Err(); err != nil {
+		return 0, false, fmt.Errorf("failed to read queue journal: %w", err)
+	}
+
+	return valid, clean, nil
+}
+
+// valid reports whether a decoded record is well formed
+func (r journalRecord) valid() bool {
+	switch r.Op {
+	case opPut:
+		return r.ID != "" && len(r.Item) > 0
+	case opTake, opDelete:
+		return r.ID != ""
+	}
+	return false
+}
+
+// migrateLocked converts a legacy JSON array state file to the journal,
+// keeping the original next to it; the caller must hold p.mu
+func (p *Persistence) migrateLocked(data []byte) error {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return fmt.Errorf("failed to unmarshal queue state: %w", err)
+	}
+
+	for _, raw := range items {
+		var item struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(raw, &item); err != nil || item.ID == "" {
+			return fmt.Errorf("failed to unmarshal queue state: invalid item %s", raw)
+		}
+		p.applyLocked(journalRecord{Op: opPut, ID: item.ID, Item: raw})
+	}
+
+	if err := os.WriteFile(p.statePath+".legacy", data, 0600); err != nil { // #nosec G306 - queue state file
+		return fmt.Errorf("failed to back up legacy queue state: %w", err)
+	}
+
+	return p.compactLocked()
+}
+
+// compactLocked atomically replaces the journal with the current state and
+// reopens it for appending; the caller must hold p.mu
+func (p *Persistence) compactLocked() error {
+	if p.entries == nil {
+		p.entries = make(map[string]*journalEntry)
+	}
+
+	ordered := p.orderedLocked()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(journalHeader{Format: journalFormat, Version: journalVersion}); err != nil {
 		return fmt.Errorf("failed to marshal queue state: %w", err)
 	}
+	for _, entry := range ordered {
+		if err := enc.Encode(journalRecord{Op: opPut, ID: entry.id, Item: entry.item}); err != nil {
+			return fmt.Errorf("failed to marshal queue state: %w", err)
+		}
+	}
+	for _, entry := range ordered {
+		if entry.taken {
+			if err := enc.Encode(journalRecord{Op: opTake, ID: entry.id}); err != nil {
+				return fmt.Errorf("failed to marshal queue state: %w", err)
+			}
+		}
+	}
 
-	// Write to temporary file
-	if err := os.WriteFile(tmpPath, data, 0600); err != nil { // #nosec G306 - queue state file
+	tmpPath := p.statePath + ".tmp"
+	if err := writeFileSync(tmpPath, buf.Bytes()); err != nil {
 		return fmt.Errorf("failed to write queue state: %w", err)
 	}
 
+	// Closed before the rename, which fails on open files on Windows
+	if p.file != nil {
+		_ = p.file.Close()
+		p.file = nil
+	}
+
 	// Atomic rename
 	if err := os.Rename(tmpPath, p.statePath); err != nil {
 		return fmt.Errorf("failed to save queue state: %w", err)
 	}
+	syncDir(filepath.Dir(p.statePath))
+
+	file, err := os.OpenFile(p.statePath, os.O_WRONLY|os.O_APPEND, 0600) // #nosec G304 - configurable state path
+	if err != nil {
+		return fmt.Errorf("failed to open queue journal: %w", err)
+	}
+	p.file = file
+	p.appended = 0
+	p.compactAt = compactThreshold
+	p.compactErr = nil
 
 	return nil
 }
 
-// Load loads queue items from disk
-func (p *Persistence) Load() ([]*model.Item, error) {
-	// Check if file exists
-	if _, err := os.Stat(p.statePath); os.IsNotExist(err) {
-		// No state file, return empty list
-		return []*model.Item{}, nil
+// orderedLocked returns the entries in FIFO order; the caller must hold p.mu
+func (p *Persistence) orderedLocked() []*journalEntry {
+	ordered := make([]*journalEntry, 0, len(p.entries))
+	for _, entry := range p.entries {
+		ordered = append(ordered, entry)
 	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].seq < ordered[j].seq })
+	return ordered
+}
 
-	// Read file
-	data, err := os.ReadFile(p.statePath)
+// isLegacyState reports whether data is a JSON array state file
+func isLegacyState(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && trimmed[0] == '['
+}
+
+// writeFileSync writes data to path and syncs it to disk
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600) // #nosec G304 - configurable state path
 	if err != nil {
-		return nil, fmt.Errorf("failed to read queue state: %w", err)
+		return err
 	}
-
-	// Unmarshal JSON
-	var items []*model.Item
-	if err := json.Unmarshal(data, &items); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal queue state: %w", err)
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
 	}
+	return f.Close()
+}
 
-	return items, nil
+// syncDir makes a rename in dir durable. Directories cannot be synced on all
+// platforms, so errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir) // #nosec G304 - configurable state directory
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
 }
@@ -2,15 +2,24 @@ package queue
 
 import (
 	"container/list"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/metrics"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
 )
 
+// Errors returned by the queue administration methods
+var (
+	ErrNotFound        = errors.New("item not found")
+	ErrDeadLettered    = errors.New("item is in the dead letter queue")
+	ErrNotDeadLettered = errors.New("item is not in the dead letter queue")
+)
+
 // Queue is a thread-safe FIFO queue with persistence
 type Queue struct {
 	mu    sync.RWMutex
@@ -19,13 +28,32 @@ type Queue struct {
 	// Map for quick lookup by ID
 	itemMap map[string]*list.Element
 
+	// Dead-lettered items, oldest first. They are not processed, but stay
+	// in the journal until they are replayed or purged.
+	deadLetters []*model.Item
+
+	// sources counts the queued and in-flight items of each source path, so
+	// that a file is not queued twice
+	sources map[string]int
+
+	// inFlight holds the source path of each dequeued item until it is
+	// completed, requeued or dead-lettered
+	inFlight map[string]string
+
 	// Configuration
 	maxRetries int
 	baseDelay  time.Duration
 	maxDelay   time.Duration
 
-	// Persistence
+	// Persistence: every change is journaled before it is acknowledged
 	persistence *Persistence
+
+	// journalErr is the last journal write failure, cleared by the next
+	// successful write
+	journalErr error
+
+	// notify is signalled (non-blocking) whenever items may be ready
+	notify chan struct{}
 }
 
 // Config holds queue configuration
@@ -57,10 +85,13 @@ func NewQueue(cfg *Config) (*Queue, error) {
 	q := &Queue{
 		items:       list.New(),
 		itemMap:     make(map[string]*list.Element),
+		sources:     make(map[string]int),
+		inFlight:    make(map[string]string),
 		maxRetries:  cfg.MaxRetries,
 		baseDelay:   cfg.BaseDelay,
 		maxDelay:    cfg.MaxDelay,
 		persistence: persistence,
+		notify:      make(chan struct{}, 1),
 	}
 
 	return q, nil
@@ -76,9 +107,15 @@ func (q *Queue) Enqueue(item *model.Item) error {
 		return fmt.Errorf("item with ID %s already exists", item.ID)
 	}
 
+	// Journal the item before acknowledging it
+	if err := q.journal(q.persistence.Put(item)); err != nil {
+		return fmt.Errorf("failed to persist item %s: %w", item.ID, err)
+	}
+
 	// Add to queue
-	element := q.items.PushBack(item)
-	q.itemMap[item.ID] = element
+	q.pushLocked(item)
+
+	q.signal()
 
 	return nil
 }
@@ -105,9 +142,18 @@ func (q *Queue) Dequeue() *model.Item {
 			continue
 		}
 
-		// Remove from queue
+		// Remove from queue. If the take cannot be journaled, the item is
+		// replayed as not yet attempted after a crash.
 		q.items.Remove(e)
 		delete(q.itemMap, item.ID)
+		trackDepth(item.Status, -1)
+		q.inFlight[item.ID] = item.SourcePath
+		_ = q.journal(q.persistence.Take(item.ID))
+
+		// Wake another waiting consumer if more items remain
+		if q.items.Len() > 0 {
+			q.signal()
+		}
 
 		return item
 	}
@@ -127,15 +173,254 @@ func (q *Queue) Requeue(item *model.Item, err error) error {
 	// Check if item should be retried
 	if !item.ShouldRetry(q.maxRetries) {
 		item.MarkDLQ()
-		// Don't add back to queue, but keep in itemMap for tracking
+		metrics.ItemsDeadLettered.WithLabelValues(string(item.Operation)).Inc()
+		// Don't add back to queue; the journal keeps dead-lettered items
+		_ = q.journal(q.persistence.Put(item))
+		q.releaseLocked(item.ID, item.SourcePath)
+		q.deadLetters = append(q.deadLetters, item)
 		return fmt.Errorf("item %s exceeded max retries, moved to DLQ", item.ID)
 	}
 
+	// If the retry cannot be journaled, the attempt is replayed as
+	// interrupted after a crash
+	_ = q.journal(q.persistence.Put(item))
+
 	// Add back to end of queue
+	q.pushLocked(item)
+
+	return nil
+}
+
+// Complete records that a dequeued item was processed successfully
+func (q *Queue) Complete(item *model.Item) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.releaseLocked(item.ID, item.SourcePath)
+
+	if err := q.journal(q.persistence.Delete(item.ID)); err != nil {
+		return fmt.Errorf("failed to persist completion of item %s: %w", item.ID, err)
+	}
+	return nil
+}
+
+// Queued reports whether an item for sourcePath is waiting in the queue or
+// being processed
+func (q *Queue) Queued(sourcePath string) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	return q.sources[sourcePath] > 0
+}
+
+// Get returns a copy of a queued or dead-lettered item
+func (q *Queue) Get(id string) (*model.Item, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if e, ok := q.itemMap[id]; ok {
+		item := *e.Value.(*model.Item)
+		return &item, nil
+	}
+	if i := q.deadLetterIndexLocked(id); i >= 0 {
+		item := *q.deadLetters[i]
+		return &item, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+}
+
+// DeadLetters returns copies of the dead-lettered items, oldest first
+func (q *Queue) DeadLetters() []*model.Item {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	items := make([]*model.Item, 0, len(q.deadLetters))
+	for _, dead := range q.deadLetters {
+		item := *dead
+		items = append(items, &item)
+	}
+
+	return items
+}
+
+// Retry makes a queued item ready for processing now instead of waiting for
+// its retry delay; it moves to the back of the queue. prepare, if not nil,
+// runs before the change is journaled (e.g. to restore the source file) and
+// aborts the retry if it fails.
+func (q *Queue) Retry(id string, prepare func(item *model.Item) error) (*model.Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, ok := q.itemMap[id]
+	if !ok {
+		if q.deadLetterIndexLocked(id) >= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrDeadLettered, id)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	// Items are replaced rather than modified, as callers may hold copies
+	item := *e.Value.(*model.Item)
+	if prepare != nil {
+		if err := prepare(&item); err != nil {
+			return nil, err
+		}
+	}
+	item.NextRetry = time.Time{}
+
+	if err := q.journal(q.persistence.Put(&item)); err != nil {
+		return nil, fmt.Errorf("failed to persist retry of item %s: %w", id, err)
+	}
+
+	e.Value = &item
+	q.items.MoveToBack(e)
+	q.signal()
+
+	result := item
+	return &result, nil
+}
+
+// Replay queues a dead-lettered item again as if it were new: its attempt
+// count and error are reset. prepare, if not nil, runs first (e.g. to move
+// the file back from the dead letter directory) and aborts the replay if it
+// fails.
+func (q *Queue) Replay(id string, prepare func(item *model.Item) error) (*model.Item, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := q.deadLetterIndexLocked(id)
+	if i < 0 {
+		if _, ok := q.itemMap[id]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrNotDeadLettered, id)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	item := *q.deadLetters[i]
+	if prepare != nil {
+		if err := prepare(&item); err != nil {
+			return nil, err
+		}
+	}
+	item.Status = model.StatusPending
+	item.AttemptCount = 0
+	item.Error = ""
+	item.NextRetry = time.Time{}
+
+	if err := q.journal(q.persistence.Put(&item)); err != nil {
+		return nil, fmt.Errorf("failed to persist replay of item %s: %w", id, err)
+	}
+
+	q.deadLetters = append(q.deadLetters[:i], q.deadLetters[i+1:]...)
+	q.pushLocked(&item)
+	q.signal()
+
+	result := item
+	return &result, nil
+}
+
+// Remove deletes a queued or dead-lettered item without processing it.
+// Items being processed cannot be removed.
+func (q *Queue) Remove(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, queued := q.itemMap[id]
+	i := q.deadLetterIndexLocked(id)
+	if !queued && i < 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	if err := q.journal(q.persistence.Delete(id)); err != nil {
+		return fmt.Errorf("failed to persist removal of item %s: %w", id, err)
+	}
+
+	if queued {
+		item := e.Value.(*model.Item)
+		q.items.Remove(e)
+		delete(q.itemMap, id)
+		trackDepth(item.Status, -1)
+		q.releaseLocked(id, item.SourcePath)
+	} else {
+		q.deadLetters = append(q.deadLetters[:i], q.deadLetters[i+1:]...)
+	}
+
+	return nil
+}
+
+// pushLocked appends an item to the queue; the caller must hold q.mu
+func (q *Queue) pushLocked(item *model.Item) {
 	element := q.items.PushBack(item)
 	q.itemMap[item.ID] = element
+	trackDepth(item.Status, 1)
 
-	return nil
+	// An in-flight item coming back keeps the source it already counts
+	if _, ok := q.inFlight[item.ID]; ok {
+		delete(q.inFlight, item.ID)
+		return
+	}
+	q.sources[item.SourcePath]++
+}
+
+// releaseLocked stops counting the source of an item that left the queue for
+// good; the caller must hold q.mu
+func (q *Queue) releaseLocked(id, sourcePath string) {
+	if path, ok := q.inFlight[id]; ok {
+		delete(q.inFlight, id)
+		sourcePath = path
+	}
+
+	if q.sources[sourcePath] <= 1 {
+		delete(q.sources, sourcePath)
+		return
+	}
+	q.sources[sourcePath]--
+}
+
+// deadLetterIndexLocked returns the position of a dead-lettered item, or -1;
+// the caller must hold q.mu
+func (q *Queue) deadLetterIndexLocked(id string) int {
+	for i, item := range q.deadLetters {
+		if item.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// JournalErr returns the last journal write failure, or nil once the journal
+// is written successfully again; failing that, the last journal compaction
+// failure, which does not lose items but lets the journal grow
+func (q *Queue) JournalErr() error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.journalErr != nil {
+		return q.journalErr
+	}
+	return q.persistence.CompactErr()
+}
+
+// journal records the outcome of a journal write; the caller must hold q.mu
+func (q *Queue) journal(err error) error {
+	q.journalErr = err
+	return err
+}
+
+// Notify returns a channel that receives a value whenever items may be
+// available for Dequeue. Notifications are coalesced, so consumers should
+// keep calling Dequeue until it returns nil before waiting again.
+func (q *Queue) Notify() <-chan struct{} {
+	return q.notify
+}
+
+// signal performs a non-blocking send on the notification channel
+func (q *Queue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
 }
 
 // Size returns the number of items in the queue
@@ -146,11 +431,22 @@ func (q *Queue) Size() int {
 	return q.items.Len()
 }
 
-// List returns all items in the queue
+// List returns copies of all items in the queue, in order
 func (q *Queue) List() []*model.Item {
 	q.mu.RLock()
 	defer q.mu.RUnlock()
 
+	items := q.listLocked()
+	for i, item := range items {
+		c := *item
+		items[i] = &c
+	}
+
+	return items
+}
+
+// listLocked returns all items in the queue; the caller must hold q.mu
+func (q *Queue) listLocked() []*model.Item {
 	items := make([]*model.Item, 0, q.items.Len())
 	for e := q.items.Front(); e != nil; e = e.Next() {
 		items = append(items, e.Value.(*model.Item))
@@ -159,15 +455,27 @@ func (q *Queue) List() []*model.Item {
 	return items
 }
 
-// Save persists the queue state to disk
+// Save compacts the queue journal. Changes are journaled as they happen, so
+// Save is not needed for durability.
 func (q *Queue) Save() error {
-	q.mu.RLock()
-	defer q.mu.RUnlock()
+	q.mu.Lock()
+	defer q.mu.Unlock()
 
-	return q.persistence.Save(q.List())
+	return q.journal(q.persistence.Compact())
 }
 
-// Load restores the queue state from disk
+// Close closes the queue journal
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.persistence.Close()
+}
+
+// Load restores the queue state from disk. Items that were being processed
+// when the service stopped count that attempt and are queued again, or
+// dead-lettered once they are out of retries. Dead-lettered items are listed
+// by DeadLetters but not queued.
 func (q *Queue) Load() error {
 	q.mu.Lock()
 	defer q.mu.Unlock()
@@ -178,18 +486,60 @@ func (q *Queue) Load() error {
 	}
 
 	// Clear existing queue
+	for _, item := range q.listLocked() {
+		trackDepth(item.Status, -1)
+	}
 	q.items = list.New()
 	q.itemMap = make(map[string]*list.Element)
+	q.deadLetters = nil
+	q.sources = make(map[string]int)
+	q.inFlight = make(map[string]string)
 
 	// Add loaded items
 	for _, item := range items {
-		element := q.items.PushBack(item)
-		q.itemMap[item.ID] = element
+		switch item.Status {
+		case model.StatusDLQ:
+			q.deadLetters = append(q.deadLetters, item)
+			continue
+		case model.StatusProcessing:
+			if !q.recoverLocked(item) {
+				q.deadLetters = append(q.deadLetters, item)
+				continue
+			}
+		}
+
+		q.pushLocked(item)
+	}
+
+	if q.items.Len() > 0 {
+		q.signal()
 	}
 
 	return nil
 }
 
+// recoverLocked settles an item whose processing was cut short by a crash.
+// It returns false if the item was dead-lettered; the caller must hold q.mu.
+func (q *Queue) recoverLocked(item *model.Item) bool {
+	item.AttemptCount++
+	item.Error = "processing was interrupted"
+
+	if item.ShouldRetry(q.maxRetries) {
+		item.Status = model.StatusPending
+	} else {
+		item.MarkDLQ()
+		metrics.ItemsDeadLettered.WithLabelValues(string(item.Operation)).Inc()
+	}
+
+	_ = q.journal(q.persistence.Put(item))
+	return item.Status != model.StatusDLQ
+}
+
+// trackDepth adjusts the queue depth metric for items of the given status
+func trackDepth(status model.ItemStatus, delta float64) {
+	metrics.QueueDepth.WithLabelValues(string(status)).Add(delta)
+}
+
 // calculateBackoff calculates exponential backoff delay using cenkalti/backoff library
 func (q *Queue) calculateBackoff(attempts int) time.Duration {
 	// For 0 attempts, return initial delay
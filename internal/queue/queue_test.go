@@ -1,11 +1,15 @@
 package queue
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gitrgoliveira/vault-file-encryption/internal/metrics"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -90,6 +94,50 @@ func TestQueue_Dequeue(t *testing.T) {
 	assert.Equal(t, 0, q.Size())
 }
 
+func TestQueue_Notify(t *testing.T) {
+	tmpDir := t.TempDir()
+	statePath := filepath.Join(tmpDir, "queue-state.json")
+
+	q, err := NewQueue(&Config{
+		MaxRetries: 3,
+		BaseDelay:  1 * time.Second,
+		StatePath:  statePath,
+	})
+	require.NoError(t, err)
+
+	// No notification on an empty queue
+	select {
+	case <-q.Notify():
+		t.Fatal("unexpected notification on empty queue")
+	default:
+	}
+
+	// Enqueue signals waiting consumers; repeated signals are coalesced
+	require.NoError(t, q.Enqueue(model.NewItem(model.OperationEncrypt, "/tmp/a.txt", "/tmp/a.enc")))
+	require.NoError(t, q.Enqueue(model.NewItem(model.OperationEncrypt, "/tmp/b.txt", "/tmp/b.enc")))
+
+	select {
+	case <-q.Notify():
+	default:
+		t.Fatal("expected notification after enqueue")
+	}
+
+	// Dequeue re-signals while items remain so another consumer can wake up
+	require.NotNil(t, q.Dequeue())
+	select {
+	case <-q.Notify():
+	default:
+		t.Fatal("expected notification while items remain")
+	}
+
+	require.NotNil(t, q.Dequeue())
+	select {
+	case <-q.Notify():
+		t.Fatal("unexpected notification after queue drained")
+	default:
+	}
+}
+
 func TestQueue_Requeue(t *testing.T) {
 	tmpDir := t.TempDir()
 	statePath := filepath.Join(tmpDir, "queue-state.json")
@@ -326,3 +374,433 @@ func TestPersistence_LoadNonExistent(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Empty(t, items)
 }
+
+func TestQueue_Metrics(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	q, err := NewQueue(&Config{
+		MaxRetries: 1,
+		BaseDelay:  1 * time.Second,
+		StatePath:  filepath.Join(tmpDir, "queue-state.json"),
+	})
+	require.NoError(t, err)
+
+	// Metrics are process-wide, so compare against the starting values
+	pending := metrics.QueueDepth.WithLabelValues(string(model.StatusPending))
+	deadLettered := metrics.ItemsDeadLettered.WithLabelValues(string(model.OperationDecrypt))
+	startPending, startDeadLettered := pending.Value(), deadLettered.Value()
+
+	item := model.NewItem(model.OperationDecrypt, "/tmp/test.enc", "/tmp/test.txt")
+	require.NoError(t, q.Enqueue(item))
+	assert.Equal(t, startPending+1, pending.Value())
+
+	dequeued := q.Dequeue()
+	require.NotNil(t, dequeued)
+	assert.Equal(t, startPending, pending.Value())
+
+	dequeued.MarkProcessing()
+	require.Error(t, q.Requeue(dequeued, assert.AnError))
+	assert.Equal(t, startDeadLettered+1, deadLettered.Value())
+}
+
+func TestQueue_JournalRecovery(t *testing.T) {
+	cfg := &Config{
+		MaxRetries: 3,
+		BaseDelay:  1 * time.Second,
+		StatePath:  filepath.Join(t.TempDir(), "queue-state.json"),
+	}
+
+	q, err := NewQueue(cfg)
+	require.NoError(t, err)
+
+	completed := model.NewItem(model.OperationEncrypt, "/tmp/a.txt", "/tmp/a.enc")
+	inFlight := model.NewItem(model.OperationEncrypt, "/tmp/b.txt", "/tmp/b.enc")
+	pending := model.NewItem(model.OperationEncrypt, "/tmp/c.txt", "/tmp/c.enc")
+	for _, item := range []*model.Item{completed, inFlight, pending} {
+		require.NoError(t, q.Enqueue(item))
+	}
+
+	item := q.Dequeue()
+	item.MarkProcessing()
+	item.MarkCompleted()
+	require.NoError(t, q.Complete(item))
+
+	q.Dequeue().MarkProcessing()
+
+	// Crash: no Save, a new queue replays the journal
+	q2, err := NewQueue(cfg)
+	require.NoError(t, err)
+	require.NoError(t, q2.Load())
+
+	items := q2.List()
+	require.Len(t, items, 2)
+	assert.Equal(t, inFlight.ID, items[0].ID)
+	assert.Equal(t, model.StatusPending, items[0].Status)
+	assert.Equal(t, 1, items[0].AttemptCount, "the interrupted attempt is counted")
+	assert.Equal(t, pending.ID, items[1].ID)
+	assert.Equal(t, 0, items[1].AttemptCount)
+	assert.NoError(t, q2.JournalErr())
+}
+
+func TestQueue_JournalRecovery_DeadLetter(t *testing.T) {
+	cfg := &Config{
+		MaxRetries: 1,
+		BaseDelay:  1 * time.Second,
+		StatePath:  filepath.Join(t.TempDir(), "queue-state.json"),
+	}
+
+	q, err := NewQueue(cfg)
+	require.NoError(t, err)
+
+	failed := model.NewItem(model.OperationEncrypt, "/tmp/a.txt", "/tmp/a.enc")
+	crashed := model.NewItem(model.OperationEncrypt, "/tmp/b.txt", "/tmp/b.enc")
+	require.NoError(t, q.Enqueue(failed))
+	require.NoError(t, q.Enqueue(crashed))
+
+	item := q.Dequeue()
+	item.MarkProcessing()
+	require.Error(t, q.Requeue(item, assert.AnError))
+
+	q.Dequeue().MarkProcessing()
+
+	q2, err := NewQueue(cfg)
+	require.NoError(t, err)
+	require.NoError(t, q2.Load())
+	assert.Equal(t, 0, q2.Size())
+
+	// Both items are kept in the journal as dead-lettered
+	p, err := NewPersistence(cfg.StatePath)
+	require.NoError(t, err)
+	items, err := p.Load()
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	for _, item := range items {
+		assert.Equal(t, model.StatusDLQ, item.Status)
+	}
+}
+
+func TestPersistence_MigratesLegacyState(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "queue-state.json")
+
+	items := []*model.Item{
+		model.NewItem(model.OperationEncrypt, "/tmp/test1.txt", "/tmp/test1.enc"),
+		model.NewItem(model.OperationDecrypt, "/tmp/test2.enc", "/tmp/test2.txt"),
+	}
+	legacy, err := json.MarshalIndent(items, "", "  ")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(statePath, legacy, 0600))
+
+	p, err := NewPersistence(statePath)
+	require.NoError(t, err)
+
+	loaded, err := p.Load()
+	require.NoError(t, err)
+	require.Len(t, loaded, 2)
+	assert.Equal(t, items[0].ID, loaded[0].ID)
+	assert.Equal(t, items[1].ID, loaded[1].ID)
+
+	// The original is kept and the state file is now a journal
+	backup, err := os.ReadFile(statePath + ".legacy")
+	require.NoError(t, err)
+	assert.Equal(t, legacy, backup)
+
+	data, err := os.ReadFile(statePath)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), `{"format":"file-encryptor-queue-journal"`))
+	require.NoError(t, p.Close())
+}
+
+func TestPersistence_TornWrite(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "queue-state.json")
+
+	p, err := NewPersistence(statePath)
+	require.NoError(t, err)
+
+	first := model.NewItem(model.OperationEncrypt, "/tmp/a.txt", "/tmp/a.enc")
+	second := model.NewItem(model.OperationEncrypt, "/tmp/b.txt", "/tmp/b.enc")
+	require.NoError(t, p.Put(first))
+	require.NoError(t, p.Put(second))
+	require.NoError(t, p.Close())
+
+	// A crash in the middle of a write leaves a partial record
+	f, err := os.OpenFile(statePath, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"op":"delete","id":"` + first.ID[:8])
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	p2, err := NewPersistence(statePath)
+	require.NoError(t, err)
+	loaded, err := p2.Load()
+	require.NoError(t, err)
+	require.Len(t, loaded, 2)
+
+	// New records are appended after the last complete one
+	require.NoError(t, p2.Delete(first.ID))
+	require.NoError(t, p2.Close())
+
+	p3, err := NewPersistence(statePath)
+	require.NoError(t, err)
+	loaded, err = p3.Load()
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	assert.Equal(t, second.ID, loaded[0].ID)
+	require.NoError(t, p3.Close())
+}
+
+func TestPersistence_Compaction(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "queue-state.json")
+
+	p, err := NewPersistence(statePath)
+	require.NoError(t, err)
+
+	kept := model.NewItem(model.OperationEncrypt, "/tmp/kept.txt", "/tmp/kept.enc")
+	require.NoError(t, p.Put(kept))
+
+	for i := 0; i < compactThreshold; i++ {
+		item := model.NewItem(model.OperationEncrypt, "/tmp/a.txt", "/tmp/a.enc")
+		require.NoError(t, p.Put(item))
+		require.NoError(t, p.Take(item.ID))
+		require.NoError(t, p.Delete(item.ID))
+	}
+
+	data, err := os.ReadFile(statePath)
+	require.NoError(t, err)
+	lines := strings.Count(string(data), "\n")
+	assert.Less(t, lines, compactThreshold, "journal should have been compacted")
+
+	loaded, err := p.Load()
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	assert.Equal(t, kept.ID, loaded[0].ID)
+	require.NoError(t, p.Close())
+}
+
+func TestQueue_CompactionFailureKeepsItems(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "queue-state.json")
+
+	q, err := NewQueue(&Config{
+		MaxRetries: 3,
+		BaseDelay:  1 * time.Second,
+		MaxDelay:   5 * time.Minute,
+		StatePath:  statePath,
+	})
+	require.NoError(t, err)
+	defer func() { _ = q.persistence.Close() }()
+
+	// The first record creates the journal; after that, a directory in the
+	// way of the temporary file makes compaction fail
+	for i := 0; q.persistence.appended < compactThreshold-1; i++ {
+		if i == 1 {
+			require.NoError(t, os.Mkdir(statePath+".tmp", 0700))
+		}
+		item := model.NewItem(model.OperationEncrypt, "/tmp/a.txt", "/tmp/a.enc")
+		require.NoError(t, q.Enqueue(item))
+		require.NotNil(t, q.Dequeue())
+		require.NoError(t, q.Complete(item))
+	}
+	require.NoError(t, q.JournalErr())
+
+	// This record triggers the failing compaction
+	kept := model.NewItem(model.OperationEncrypt, "/tmp/kept.txt", "/tmp/kept.enc")
+	require.NoError(t, q.Enqueue(kept))
+	assert.Equal(t, 1, q.Size())
+	assert.ErrorContains(t, q.JournalErr(), "failed to compact queue journal")
+
+	loaded, err := q.persistence.Load()
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	assert.Equal(t, kept.ID, loaded[0].ID)
+
+	// The compaction is not retried on every record but once twice as many
+	// records were appended
+	require.NoError(t, os.Remove(statePath+".tmp"))
+	require.NoError(t, q.Enqueue(model.NewItem(model.OperationEncrypt, "/tmp/b.txt", "/tmp/b.enc")))
+	assert.Equal(t, 2, q.Size())
+	assert.Error(t, q.JournalErr())
+	assert.Equal(t, 2*compactThreshold, q.persistence.compactAt)
+
+	for q.persistence.appended < 2*compactThreshold-1 {
+		item := model.NewItem(model.OperationEncrypt, "/tmp/c.txt", "/tmp/c.enc")
+		require.NoError(t, q.Enqueue(item))
+		require.NoError(t, q.Remove(item.ID))
+		require.Error(t, q.JournalErr())
+	}
+	require.NoError(t, q.Enqueue(model.NewItem(model.OperationEncrypt, "/tmp/d.txt", "/tmp/d.enc")))
+	assert.NoError(t, q.JournalErr())
+	assert.Equal(t, 0, q.persistence.appended)
+	assert.Equal(t, compactThreshold, q.persistence.compactAt)
+	assert.Equal(t, 3, q.Size())
+}
+
+func TestQueue_ReplayDeadLetter(t *testing.T) {
+	cfg := &Config{
+		MaxRetries: 1,
+		BaseDelay:  1 * time.Second,
+		StatePath:  filepath.Join(t.TempDir(), "queue-state.json"),
+	}
+
+	q, err := NewQueue(cfg)
+	require.NoError(t, err)
+
+	dead := model.NewItem(model.OperationEncrypt, "/tmp/a.txt", "/tmp/a.enc")
+	require.NoError(t, q.Enqueue(dead))
+	item := q.Dequeue()
+	item.MarkProcessing()
+	require.Error(t, q.Requeue(item, assert.AnError))
+	assert.False(t, q.Queued("/tmp/a.txt"))
+
+	// Dead letters survive a restart
+	q2, err := NewQueue(cfg)
+	require.NoError(t, err)
+	require.NoError(t, q2.Load())
+	require.Len(t, q2.DeadLetters(), 1)
+
+	_, err = q2.Retry(dead.ID, nil)
+	assert.ErrorIs(t, err, ErrDeadLettered)
+
+	var prepared string
+	replayed, err := q2.Replay(dead.ID, func(item *model.Item) error {
+		prepared = item.ID
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, dead.ID, prepared)
+	assert.Equal(t, model.StatusPending, replayed.Status)
+	assert.Equal(t, 0, replayed.AttemptCount)
+	assert.Empty(t, replayed.Error)
+	assert.Empty(t, q2.DeadLetters())
+	assert.Equal(t, 1, q2.Size())
+	assert.True(t, q2.Queued("/tmp/a.txt"))
+
+	_, err = q2.Replay(dead.ID, nil)
+	assert.ErrorIs(t, err, ErrNotDeadLettered)
+
+	// The replay is journaled
+	q3, err := NewQueue(cfg)
+	require.NoError(t, err)
+	require.NoError(t, q3.Load())
+	assert.Empty(t, q3.DeadLetters())
+	require.Equal(t, 1, q3.Size())
+	assert.Equal(t, 0, q3.List()[0].AttemptCount)
+}
+
+func TestQueue_ReplayPrepareFailure(t *testing.T) {
+	cfg := &Config{
+		MaxRetries: 0,
+		StatePath:  filepath.Join(t.TempDir(), "queue-state.json"),
+	}
+
+	q, err := NewQueue(cfg)
+	require.NoError(t, err)
+
+	dead := model.NewItem(model.OperationEncrypt, "/tmp/a.txt", "/tmp/a.enc")
+	require.NoError(t, q.Enqueue(dead))
+	require.Error(t, q.Requeue(q.Dequeue(), assert.AnError))
+
+	_, err = q.Replay(dead.ID, func(*model.Item) error { return assert.AnError })
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Len(t, q.DeadLetters(), 1)
+	assert.Equal(t, 0, q.Size())
+}
+
+func TestQueue_Retry(t *testing.T) {
+	cfg := &Config{
+		MaxRetries: 3,
+		BaseDelay:  time.Hour,
+		StatePath:  filepath.Join(t.TempDir(), "queue-state.json"),
+	}
+
+	q, err := NewQueue(cfg)
+	require.NoError(t, err)
+
+	item := model.NewItem(model.OperationEncrypt, "/tmp/a.txt", "/tmp/a.enc")
+	require.NoError(t, q.Enqueue(item))
+	failed := q.Dequeue()
+	failed.MarkProcessing()
+	require.NoError(t, q.Requeue(failed, assert.AnError))
+
+	// Waiting for its retry delay
+	assert.Nil(t, q.Dequeue())
+
+	retried, err := q.Retry(item.ID, nil)
+	require.NoError(t, err)
+	assert.True(t, retried.NextRetry.IsZero())
+	assert.Equal(t, 1, retried.AttemptCount)
+
+	ready := q.Dequeue()
+	require.NotNil(t, ready)
+	assert.Equal(t, item.ID, ready.ID)
+
+	_, err = q.Retry("missing", nil)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestQueue_Remove(t *testing.T) {
+	cfg := &Config{
+		MaxRetries: 0,
+		StatePath:  filepath.Join(t.TempDir(), "queue-state.json"),
+	}
+
+	q, err := NewQueue(cfg)
+	require.NoError(t, err)
+
+	queued := model.NewItem(model.OperationEncrypt, "/tmp/a.txt", "/tmp/a.enc")
+	dead := model.NewItem(model.OperationEncrypt, "/tmp/b.txt", "/tmp/b.enc")
+	require.NoError(t, q.Enqueue(dead))
+	require.Error(t, q.Requeue(q.Dequeue(), assert.AnError))
+	require.NoError(t, q.Enqueue(queued))
+
+	require.NoError(t, q.Remove(queued.ID))
+	require.NoError(t, q.Remove(dead.ID))
+	assert.ErrorIs(t, q.Remove(dead.ID), ErrNotFound)
+	assert.Equal(t, 0, q.Size())
+	assert.Empty(t, q.DeadLetters())
+	assert.False(t, q.Queued("/tmp/a.txt"))
+
+	q2, err := NewQueue(cfg)
+	require.NoError(t, err)
+	require.NoError(t, q2.Load())
+	assert.Equal(t, 0, q2.Size())
+	assert.Empty(t, q2.DeadLetters())
+}
+
+func TestQueue_Queued(t *testing.T) {
+	q, err := NewQueue(&Config{
+		MaxRetries: 3,
+		StatePath:  filepath.Join(t.TempDir(), "queue-state.json"),
+	})
+	require.NoError(t, err)
+
+	item := model.NewItem(model.OperationEncrypt, "/tmp/a.txt", "/tmp/a.enc")
+	require.NoError(t, q.Enqueue(item))
+	assert.True(t, q.Queued("/tmp/a.txt"))
+
+	// Still tracked while being processed and when retried
+	dequeued := q.Dequeue()
+	assert.True(t, q.Queued("/tmp/a.txt"))
+	require.NoError(t, q.Requeue(dequeued, assert.AnError))
+	assert.True(t, q.Queued("/tmp/a.txt"))
+
+	_, err = q.Retry(item.ID, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, q.Complete(q.Dequeue()))
+	assert.False(t, q.Queued("/tmp/a.txt"))
+}
+
+func TestLockState(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state", "queue-state.json")
+
+	lock, err := LockState(statePath)
+	require.NoError(t, err)
+
+	_, err = LockState(statePath)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	require.NoError(t, lock.Unlock())
+
+	lock, err = LockState(statePath)
+	require.NoError(t, err)
+	assert.NoError(t, lock.Unlock())
+}
@@ -7,8 +7,10 @@ import (
 	"path/filepath"
 	"sync"
 
+	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/vault"
+	"golang.org/x/time/rate"
 )
 
 // RewrapOptions configures the rewrap operation.
@@ -19,12 +21,15 @@ type RewrapOptions struct {
 	CreateBackup bool          // Whether to create backups
 	BackupSuffix string        // Backup file suffix (default: ".bak")
 	Logger       logger.Logger // Logger interface (not pointer)
+	Parallel     int           // Number of files rewrapped at once by RewrapBatch (default: 1)
+	Rate         float64       // Maximum Vault rewrap requests per second (0: no limit)
 }
 
 // Rewrapper orchestrates the key re-wrapping process.
 type Rewrapper struct {
 	options       RewrapOptions
 	backupManager *BackupManager
+	limiter       *rate.Limiter // nil without a rate limit
 }
 
 // NewRewrapper creates a new key re-wrapper.
@@ -41,32 +46,48 @@ func NewRewrapper(options RewrapOptions) (*Rewrapper, error) {
 		return nil, fmt.Errorf("logger is required")
 	}
 
+	if options.Rate < 0 {
+		return nil, fmt.Errorf("rate must be >= 0")
+	}
+
+	if options.Parallel < 1 {
+		options.Parallel = 1
+	}
+
 	// Create backup manager
 	backupManager := NewBackupManager(BackupOptions{
 		Enabled: options.CreateBackup,
 		Suffix:  options.BackupSuffix,
 	})
 
+	// A token bucket holding a single token spaces Vault requests evenly
+	var limiter *rate.Limiter
+	if options.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(options.Rate), 1)
+	}
+
 	return &Rewrapper{
 		options:       options,
 		backupManager: backupManager,
+		limiter:       limiter,
 	}, nil
 }
 
-// RewrapFile processes a single .key file.
+// RewrapFile processes a single .key file or self-describing container.
+// For containers only the header is rewritten; the encrypted body is untouched.
 func (r *Rewrapper) RewrapFile(ctx context.Context, keyFilePath string) (*vault.RewrapResult, error) {
 	result := &vault.RewrapResult{
 		FilePath: keyFilePath,
 	}
 
-	// Read current key file
-	ciphertext, err := os.ReadFile(keyFilePath) // #nosec G304 - user-provided key file path
+	// Read current wrapped key
+	wk, err := readWrappedKey(keyFilePath)
 	if err != nil {
-		result.Error = fmt.Errorf("failed to read key file: %w", err)
+		result.Error = err
 		return result, result.Error
 	}
 
-	oldCiphertext := string(ciphertext)
+	oldCiphertext := wk.ciphertext
 	result.OldCiphertext = oldCiphertext
 
 	// Get current version
@@ -98,6 +119,15 @@ func (r *Rewrapper) RewrapFile(ctx context.Context, keyFilePath string) (*vault.
 		return result, nil
 	}
 
+	// Wait for the rate limit before the file is touched, so a cancelled
+	// wait leaves it as it was
+	if r.limiter != nil {
+		if err := r.limiter.Wait(ctx); err != nil {
+			result.Error = fmt.Errorf("rate limit wait cancelled: %w", err)
+			return result, result.Error
+		}
+	}
+
 	// Create backup if enabled
 	if r.options.CreateBackup {
 		backupPath, err := r.backupManager.CreateBackup(keyFilePath)
@@ -109,8 +139,12 @@ func (r *Rewrapper) RewrapFile(ctx context.Context, keyFilePath string) (*vault.
 		r.options.Logger.Info("backup created", "file", keyFilePath, "backup", backupPath)
 	}
 
-	// Call Vault to rewrap the key
-	newCiphertext, err := r.options.VaultClient.RewrapDataKey(ctx, oldCiphertext)
+	// From here on the file is finished even if ctx is cancelled, so a
+	// cancelled batch drains the rewraps in progress instead of failing them
+	ctx = context.WithoutCancel(ctx)
+
+	// Call Vault to rewrap the key with the transit key that wrapped it
+	newCiphertext, err := r.options.VaultClient.RewrapDataKeyWithKey(ctx, wk.ref, oldCiphertext)
 	if err != nil {
 		result.Error = fmt.Errorf("vault rewrap failed: %w", err)
 
@@ -138,8 +172,9 @@ func (r *Rewrapper) RewrapFile(ctx context.Context, keyFilePath string) (*vault.
 
 	result.NewVersion = newVersion
 
-	// Write new ciphertext atomically
-	if err := r.writeKeyFileAtomic(keyFilePath, []byte(newCiphertext)); err != nil {
+	// Write new ciphertext atomically, keeping the file's format
+	// (containers are updated in place)
+	if err := r.writeWrappedKey(keyFilePath, wk, newCiphertext); err != nil {
 		result.Error = fmt.Errorf("failed to write new key file: %w", err)
 
 		// Restore backup if write failed
@@ -163,46 +198,131 @@ func (r *Rewrapper) RewrapFile(ctx context.Context, keyFilePath string) (*vault.
 	return result, nil
 }
 
-// RewrapBatch processes multiple key files.
+// RewrapBatch processes multiple key files with up to Parallel workers and
+// returns the results in the order of keyFiles. A cancelled context stops
+// the files not yet started, including those waiting for the rate limit;
+// the files whose rewrap has begun are finished. The results of the files
+// started are returned together with the context error.
 func (r *Rewrapper) RewrapBatch(ctx context.Context, keyFiles []string) ([]*vault.RewrapResult, error) {
-	results := make([]*vault.RewrapResult, 0, len(keyFiles))
-	var mu sync.Mutex
+	results := make([]*vault.RewrapResult, len(keyFiles))
 
 	r.options.Logger.Info("starting batch rewrap",
 		"total_files", len(keyFiles),
 		"min_version", r.options.MinVersion,
-		"dry_run", r.options.DryRun)
+		"dry_run", r.options.DryRun,
+		"parallel", r.options.Parallel,
+		"rate", r.options.Rate)
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < r.options.Parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				keyFile := keyFiles[i]
+				r.options.Logger.Info("processing file",
+					"file", keyFile,
+					"progress", fmt.Sprintf("%d/%d", i+1, len(keyFiles)))
+
+				result, err := r.RewrapFile(ctx, keyFile)
+				results[i] = result
+
+				if err != nil {
+					r.options.Logger.Error("failed to rewrap file",
+						"file", keyFile,
+						"error", err)
+				}
+			}
+		}()
+	}
 
-	for i, keyFile := range keyFiles {
+dispatch:
+	for i := range keyFiles {
 		// Check context cancellation
+		if ctx.Err() != nil {
+			break
+		}
 		select {
+		case next <- i:
 		case <-ctx.Done():
-			return results, ctx.Err()
-		default:
+			break dispatch
 		}
+	}
+	close(next)
+	wg.Wait()
+
+	// Files not started have no result
+	processed := results[:0]
+	for _, result := range results {
+		if result != nil {
+			processed = append(processed, result)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		r.options.Logger.Error("batch rewrap cancelled",
+			"total_files", len(keyFiles),
+			"processed", len(processed))
+		return processed, err
+	}
 
-		r.options.Logger.Info("processing file",
-			"file", keyFile,
-			"progress", fmt.Sprintf("%d/%d", i+1, len(keyFiles)))
+	r.options.Logger.Info("batch rewrap complete",
+		"total_files", len(keyFiles),
+		"processed", len(processed))
 
-		result, err := r.RewrapFile(ctx, keyFile)
+	return processed, nil
+}
 
-		mu.Lock()
-		results = append(results, result)
-		mu.Unlock()
+// ReadWrappedKey returns the wrapped data key stored in a .key file (legacy
+// or v2) or in the header of a self-describing container.
+func ReadWrappedKey(filePath string) (string, error) {
+	wk, err := readWrappedKey(filePath)
+	if err != nil {
+		return "", err
+	}
+	return wk.ciphertext, nil
+}
+
+// wrappedKey is a data key read from a key file or container, together with
+// what is needed to write it back in the same format
+type wrappedKey struct {
+	ciphertext string
+	ref        vault.KeyRef
+	container  *crypto.ContainerHeader // set for containers
+	keyFile    *crypto.KeyFile         // set for .key files
+}
 
+// readWrappedKey reads the wrapped data key from filePath
+func readWrappedKey(filePath string) (*wrappedKey, error) {
+	if isContainer, err := crypto.IsContainer(filePath); err == nil && isContainer {
+		header, err := crypto.ReadContainerHeader(filePath)
 		if err != nil {
-			r.options.Logger.Error("failed to rewrap file",
-				"file", keyFile,
-				"error", err)
+			return nil, fmt.Errorf("failed to read container header: %w", err)
 		}
+		return &wrappedKey{ciphertext: header.Ciphertext, ref: header.KeyRef(), container: header}, nil
 	}
 
-	r.options.Logger.Info("batch rewrap complete",
-		"total_files", len(keyFiles),
-		"processed", len(results))
+	keyFile, err := crypto.ReadKeyFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedKey{ciphertext: keyFile.Ciphertext, ref: keyFile.KeyRef(), keyFile: keyFile}, nil
+}
 
-	return results, nil
+// writeWrappedKey stores a new ciphertext in the same format it was read from
+func (r *Rewrapper) writeWrappedKey(filePath string, wk *wrappedKey, ciphertext string) error {
+	if wk.container != nil {
+		wk.container.Ciphertext = ciphertext
+		return crypto.UpdateContainerHeader(filePath, wk.container)
+	}
+
+	wk.keyFile.SetCiphertext(ciphertext)
+	data, err := wk.keyFile.Marshal()
+	if err != nil {
+		return err
+	}
+	return r.writeKeyFileAtomic(filePath, data)
 }
 
 // writeKeyFileAtomic writes a key file atomically using temp file + rename.
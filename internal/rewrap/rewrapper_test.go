@@ -1,14 +1,19 @@
 package rewrap
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/vault"
 	"github.com/stretchr/testify/assert"
@@ -64,6 +69,17 @@ func TestNewRewrapper(t *testing.T) {
 			expectError: true,
 			errorMsg:    "logger is required",
 		},
+		{
+			name: "negative rate",
+			options: RewrapOptions{
+				VaultClient: &vault.Client{},
+				MinVersion:  3,
+				Logger:      log,
+				Rate:        -1,
+			},
+			expectError: true,
+			errorMsg:    "rate must be >= 0",
+		},
 	}
 
 	for _, tt := range tests {
@@ -334,6 +350,161 @@ func TestRewrapper_RewrapBatch(t *testing.T) {
 	})
 }
 
+// newSlowVaultServer returns a Vault client whose rewrap requests take
+// delay, and the highest number of requests seen at once
+func newSlowVaultServer(t *testing.T, delay time.Duration) (*vault.Client, *atomic.Int32) {
+	t.Helper()
+
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/transit/rewrap/test-key" {
+			http.NotFound(w, r)
+			return
+		}
+
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if n <= seen || maxInFlight.CompareAndSwap(seen, n) {
+				break
+			}
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintln(w, `{"data": {"ciphertext": "vault:v3:rewrapped"}}`)
+	}))
+	t.Cleanup(server.Close)
+
+	vaultClient, err := vault.NewClient(&vault.Config{
+		AgentAddress: server.URL,
+		TransitMount: "transit",
+		KeyName:      "test-key",
+	})
+	require.NoError(t, err)
+
+	return vaultClient, &maxInFlight
+}
+
+// writeTestKeyFiles writes count key files at version 1
+func writeTestKeyFiles(t *testing.T, count int) []string {
+	t.Helper()
+
+	tmpDir := t.TempDir()
+	var keyFiles []string
+	for i := 0; i < count; i++ {
+		keyFile := filepath.Join(tmpDir, fmt.Sprintf("file%03d.key", i))
+		require.NoError(t, os.WriteFile(keyFile, []byte("vault:v1:old"), 0644))
+		keyFiles = append(keyFiles, keyFile)
+	}
+	return keyFiles
+}
+
+func TestRewrapper_RewrapBatch_Parallel(t *testing.T) {
+	vaultClient, maxInFlight := newSlowVaultServer(t, 50*time.Millisecond)
+	log, err := logger.New("error", os.DevNull)
+	require.NoError(t, err)
+
+	keyFiles := writeTestKeyFiles(t, 20)
+	rewrapper, err := NewRewrapper(RewrapOptions{
+		VaultClient: vaultClient,
+		MinVersion:  3,
+		Logger:      log,
+		Parallel:    4,
+	})
+	require.NoError(t, err)
+
+	results, err := rewrapper.RewrapBatch(context.Background(), keyFiles)
+	require.NoError(t, err)
+	require.Len(t, results, len(keyFiles))
+
+	// Results come in the order of the files, whatever order they finished in
+	for i, result := range results {
+		assert.Equal(t, keyFiles[i], result.FilePath)
+		assert.NoError(t, result.Error)
+		assert.Equal(t, 3, result.NewVersion)
+	}
+	assert.Greater(t, maxInFlight.Load(), int32(1), "files not rewrapped in parallel")
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(4))
+}
+
+func TestRewrapper_RewrapBatch_Rate(t *testing.T) {
+	vaultClient, _ := newSlowVaultServer(t, 0)
+	log, err := logger.New("error", os.DevNull)
+	require.NoError(t, err)
+
+	keyFiles := writeTestKeyFiles(t, 6)
+	rewrapper, err := NewRewrapper(RewrapOptions{
+		VaultClient: vaultClient,
+		MinVersion:  3,
+		Logger:      log,
+		Parallel:    4,
+		Rate:        20,
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	results, err := rewrapper.RewrapBatch(context.Background(), keyFiles)
+	require.NoError(t, err)
+	require.Len(t, results, len(keyFiles))
+
+	// The first request goes right away, the other five 50ms apart
+	assert.GreaterOrEqual(t, time.Since(start), 225*time.Millisecond)
+}
+
+func TestRewrapper_RewrapBatch_CancelDrainsInFlight(t *testing.T) {
+	vaultClient, _ := newSlowVaultServer(t, 100*time.Millisecond)
+	log, err := logger.New("error", os.DevNull)
+	require.NoError(t, err)
+
+	keyFiles := writeTestKeyFiles(t, 20)
+	rewrapper, err := NewRewrapper(RewrapOptions{
+		VaultClient:  vaultClient,
+		MinVersion:   3,
+		Logger:       log,
+		CreateBackup: true,
+		Parallel:     2,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(150 * time.Millisecond)
+		cancel()
+	}()
+
+	results, err := rewrapper.RewrapBatch(ctx, keyFiles)
+	wg.Wait()
+	require.ErrorIs(t, err, context.Canceled)
+	require.NotEmpty(t, results)
+	require.Less(t, len(results), len(keyFiles))
+
+	// Every file started is reported, in order, and was finished despite the
+	// cancellation; the others are left as they were
+	for i, result := range results {
+		assert.Equal(t, keyFiles[i], result.FilePath)
+		assert.NoError(t, result.Error)
+		assert.Equal(t, 3, result.NewVersion)
+	}
+	for i, keyFile := range keyFiles {
+		ciphertext, err := ReadWrappedKey(keyFile)
+		require.NoError(t, err)
+		if i < len(results) {
+			assert.Equal(t, "vault:v3:rewrapped", ciphertext, "file %d started but not finished", i)
+		} else {
+			assert.Equal(t, "vault:v1:old", ciphertext, "file %d not started but changed", i)
+		}
+	}
+}
+
 func TestRewrapper_writeKeyFileAtomic(t *testing.T) {
 	log, err := logger.New("info", "stderr")
 	require.NoError(t, err)
@@ -372,3 +543,141 @@ func TestRewrapper_writeKeyFileAtomic(t *testing.T) {
 		assert.Equal(t, newData, content)
 	})
 }
+
+func TestRewrapper_RewrapFile_Container(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/transit/rewrap/test-key" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintln(w, `{"data": {"ciphertext": "vault:v3:newencryptedkey123"}}`)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	vaultClient, err := vault.NewClient(&vault.Config{
+		AgentAddress: server.URL,
+		TransitMount: "transit",
+		KeyName:      "test-key",
+	})
+	require.NoError(t, err)
+
+	log, err := logger.New("info", "stderr")
+	require.NoError(t, err)
+
+	tmpDir := t.TempDir()
+	containerFile := filepath.Join(tmpDir, "data.txt.enc")
+	writeTestContainer(t, containerFile, "vault:v1:oldencryptedkey")
+
+	before, err := os.ReadFile(containerFile)
+	require.NoError(t, err)
+
+	rewrapper, err := NewRewrapper(RewrapOptions{
+		VaultClient: vaultClient,
+		MinVersion:  3,
+		Logger:      log,
+	})
+	require.NoError(t, err)
+
+	result, err := rewrapper.RewrapFile(context.Background(), containerFile)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.OldVersion)
+	assert.Equal(t, 3, result.NewVersion)
+
+	header, err := crypto.ReadContainerHeader(containerFile)
+	require.NoError(t, err)
+	assert.Equal(t, "vault:v3:newencryptedkey123", header.Ciphertext)
+
+	// Only the header changed; the file size (and body) is the same
+	after, err := os.ReadFile(containerFile)
+	require.NoError(t, err)
+	assert.Equal(t, len(before), len(after))
+	assert.Equal(t, before[len(before)-32:], after[len(after)-32:])
+}
+
+// writeTestContainer creates a container with the given wrapped key
+func writeTestContainer(t *testing.T, path, ciphertext string) {
+	t.Helper()
+
+	source := filepath.Join(t.TempDir(), filepath.Base(path)+".src")
+	require.NoError(t, os.WriteFile(source, bytes.Repeat([]byte("x"), 4096), 0600))
+
+	encryptor := crypto.NewEncryptor(&stubVaultClient{ciphertext: ciphertext}, nil)
+	_, err := encryptor.EncryptFileContainer(context.Background(), source, path, nil)
+	require.NoError(t, err)
+}
+
+// stubVaultClient hands out an all-zero data key wrapped as ciphertext
+type stubVaultClient struct {
+	ciphertext string
+}
+
+func (s *stubVaultClient) GenerateDataKey() (*vault.DataKey, error) {
+	return &vault.DataKey{Plaintext: make([]byte, 32), Ciphertext: s.ciphertext}, nil
+}
+
+func (s *stubVaultClient) DecryptDataKey(ciphertext string) (*vault.DataKey, error) {
+	return &vault.DataKey{Plaintext: make([]byte, 32), Ciphertext: ciphertext}, nil
+}
+
+func TestRewrapper_RewrapFile_V2KeyFile(t *testing.T) {
+	// The rewrap must go to the transit key recorded in the key file
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/transit-eu/rewrap/finance" {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintln(w, `{"data": {"ciphertext": "vault:v3:newencryptedkey123"}}`)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	vaultClient, err := vault.NewClient(&vault.Config{
+		AgentAddress: server.URL,
+		TransitMount: "transit",
+		KeyName:      "test-key",
+	})
+	require.NoError(t, err)
+
+	log, err := logger.New("info", "stderr")
+	require.NoError(t, err)
+
+	keyPath := filepath.Join(t.TempDir(), "report.csv.key")
+	original := &crypto.KeyFile{
+		Version:      crypto.KeyFileVersion,
+		TransitMount: "transit-eu",
+		KeyName:      "finance",
+		ChunkSize:    1024 * 1024,
+		Filename:     "report.csv",
+		Size:         42,
+		Checksum:     "deadbeef",
+	}
+	original.SetCiphertext("vault:v1:oldencryptedkey")
+	require.NoError(t, crypto.WriteKeyFile(keyPath, original))
+
+	rewrapper, err := NewRewrapper(RewrapOptions{
+		VaultClient: vaultClient,
+		MinVersion:  3,
+		Logger:      log,
+	})
+	require.NoError(t, err)
+
+	result, err := rewrapper.RewrapFile(context.Background(), keyPath)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.OldVersion)
+	assert.Equal(t, 3, result.NewVersion)
+
+	// The file stays in v2 format with its metadata preserved
+	updated, err := crypto.ReadKeyFile(keyPath)
+	require.NoError(t, err)
+	assert.Equal(t, crypto.KeyFileVersion, updated.Version)
+	assert.Equal(t, "vault:v3:newencryptedkey123", updated.Ciphertext)
+	assert.Equal(t, 3, updated.KeyVersion)
+	assert.Equal(t, "finance", updated.KeyName)
+	assert.Equal(t, "report.csv", updated.Filename)
+	assert.Equal(t, "deadbeef", updated.Checksum)
+
+	ciphertext, err := ReadWrappedKey(keyPath)
+	require.NoError(t, err)
+	assert.Equal(t, "vault:v3:newencryptedkey123", ciphertext)
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
 )
 
 // ScanOptions configures the key file scanner.
@@ -15,12 +17,13 @@ type ScanOptions struct {
 
 // ScanResult represents the outcome of scanning a directory for key files.
 type ScanResult struct {
-	Files []string // Discovered .key file paths
+	Files []string // Discovered .key files and self-describing containers
 	Count int      // Number of files found
 	Error error    // Error if scan failed
 }
 
-// Scanner finds .key files in a directory structure.
+// Scanner finds .key files and self-describing .enc containers in a
+// directory structure.
 type Scanner struct {
 	options ScanOptions
 }
@@ -45,7 +48,7 @@ func NewScanner(options ScanOptions) (*Scanner, error) {
 	}, nil
 }
 
-// Scan searches for .key files according to the configured options.
+// Scan searches for wrapped keys according to the configured options.
 func (s *Scanner) Scan() (*ScanResult, error) {
 	result := &ScanResult{
 		Files: make([]string, 0),
@@ -71,8 +74,8 @@ func (s *Scanner) Scan() (*ScanResult, error) {
 			return nil
 		}
 
-		// Check if file has .key extension
-		if strings.HasSuffix(info.Name(), ".key") {
+		// Check if file has .key extension or is a container with an embedded key
+		if strings.HasSuffix(info.Name(), ".key") || isContainerFile(path) {
 			result.Files = append(result.Files, path)
 		}
 
@@ -88,7 +91,7 @@ func (s *Scanner) Scan() (*ScanResult, error) {
 	return result, nil
 }
 
-// ScanSingleFile validates and returns a single .key file path.
+// ScanSingleFile validates and returns a single .key file or container path.
 // This is a convenience function for processing a single file.
 func ScanSingleFile(filePath string) (*ScanResult, error) {
 	result := &ScanResult{
@@ -107,9 +110,9 @@ func ScanSingleFile(filePath string) (*ScanResult, error) {
 		return result, result.Error
 	}
 
-	// Verify .key extension
-	if !strings.HasSuffix(filePath, ".key") {
-		result.Error = fmt.Errorf("file must have .key extension: %s", filePath)
+	// Verify .key extension (or an encrypted container)
+	if !strings.HasSuffix(filePath, ".key") && !isContainerFile(filePath) {
+		result.Error = fmt.Errorf("file must have .key extension or be an encrypted container: %s", filePath)
 		return result, result.Error
 	}
 
@@ -117,3 +120,12 @@ func ScanSingleFile(filePath string) (*ScanResult, error) {
 	result.Count = 1
 	return result, nil
 }
+
+// isContainerFile reports whether path is an .enc self-describing container
+func isContainerFile(path string) bool {
+	if !strings.HasSuffix(path, ".enc") {
+		return false
+	}
+	isContainer, err := crypto.IsContainer(path)
+	return err == nil && isContainer
+}
@@ -250,3 +250,28 @@ func TestScanSingleFile(t *testing.T) {
 		})
 	}
 }
+
+func TestScanner_Scan_FindsContainers(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "legacy.txt.key"), []byte("vault:v1:abc"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "legacy.txt.enc"), []byte("FENC-not-a-container"), 0600))
+	writeTestContainer(t, filepath.Join(tmpDir, "single.txt.enc"), "vault:v1:def")
+
+	scanner, err := NewScanner(ScanOptions{Directory: tmpDir})
+	require.NoError(t, err)
+
+	result, err := scanner.Scan()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(tmpDir, "legacy.txt.key"),
+		filepath.Join(tmpDir, "single.txt.enc"),
+	}, result.Files)
+
+	single, err := ScanSingleFile(filepath.Join(tmpDir, "single.txt.enc"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, single.Count)
+
+	_, err = ScanSingleFile(filepath.Join(tmpDir, "legacy.txt.enc"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/queue"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/watcher"
+)
+
+// queueAdmin is implemented by queues that can be inspected and changed by
+// the queue commands
+type queueAdmin interface {
+	List() []*model.Item
+	DeadLetters() []*model.Item
+	Get(id string) (*model.Item, error)
+	Retry(id string, prepare func(item *model.Item) error) (*model.Item, error)
+	Replay(id string, prepare func(item *model.Item) error) (*model.Item, error)
+	Remove(id string) error
+}
+
+// registerAdmin adds the queue administration API to mux. It is served on its
+// own listener, behind requireAdminToken.
+func (s *Service) registerAdmin(mux *http.ServeMux) bool {
+	q, ok := s.queue.(queueAdmin)
+	if !ok {
+		return false
+	}
+
+	mux.HandleFunc("GET /queue", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, http.StatusOK, q.List())
+	})
+
+	mux.HandleFunc("GET /queue/{id}", func(w http.ResponseWriter, r *http.Request) {
+		item, err := q.Get(r.PathValue("id"))
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, item)
+	})
+
+	mux.HandleFunc("POST /queue/{id}/retry", func(w http.ResponseWriter, r *http.Request) {
+		item, err := s.retryItem(q, r.PathValue("id"))
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, item)
+	})
+
+	mux.HandleFunc("DELETE /queue/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if err := q.Remove(id); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		s.log.Info("Purged queue item", "id", id, "via", "admin api")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("GET /dlq", func(w http.ResponseWriter, _ *http.Request) {
+		writeAdminJSON(w, http.StatusOK, q.DeadLetters())
+	})
+
+	mux.HandleFunc("POST /dlq/{id}/replay", func(w http.ResponseWriter, r *http.Request) {
+		item, err := s.replayItem(q, r.PathValue("id"))
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		writeAdminJSON(w, http.StatusOK, item)
+	})
+
+	return true
+}
+
+// requireAdminToken rejects requests to next that do not carry token as a
+// bearer token; with no token, every request is passed on
+func requireAdminToken(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+
+	want := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAdminJSON(w, http.StatusUnauthorized, adminError{Error: "missing or invalid admin token"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// retryItem makes a failed item ready now, moving its file back from the
+// failed directory if needed
+func (s *Service) retryItem(q queueAdmin, id string) (*model.Item, error) {
+	rules := watcher.RulesFromConfig(s.cfgMgr.Get())
+
+	var restoredFrom string
+	item, err := q.Retry(id, func(item *model.Item) error {
+		var err error
+		restoredFrom, err = watcher.RestoreSource(rules, item)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("Retrying queue item", "id", id, "file", item.SourcePath, "restored_from", restoredFrom, "via", "admin api")
+	return item, nil
+}
+
+// replayItem queues a dead-lettered item again, moving its file back from the
+// dead letter directory. Replays are recorded in the audit log.
+func (s *Service) replayItem(q queueAdmin, id string) (*model.Item, error) {
+	rules := watcher.RulesFromConfig(s.cfgMgr.Get())
+
+	var restoredFrom string
+	item, err := q.Replay(id, func(item *model.Item) error {
+		var err error
+		restoredFrom, err = watcher.RestoreSource(rules, item)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.log.Info("Replayed item from dead letter queue",
+		"id", id,
+		"operation", item.Operation,
+		"file", item.SourcePath,
+		"restored_from", restoredFrom,
+		"via", "admin api")
+	return item, nil
+}
+
+// adminError is the JSON body of failed admin requests
+type adminError struct {
+	Error string `json:"error"`
+}
+
+// writeAdminError maps queue errors to HTTP status codes
+func writeAdminError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, queue.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, queue.ErrDeadLettered), errors.Is(err, queue.ErrNotDeadLettered):
+		status = http.StatusConflict
+	}
+	writeAdminJSON(w, status, adminError{Error: err.Error()})
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
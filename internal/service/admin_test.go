@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_QueueStateLocked(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	configFile := createTestConfigFile(t, cfg)
+
+	svc, err := New(&Config{ConfigFile: configFile})
+	require.NoError(t, err)
+
+	// A second service cannot use the same queue state
+	_, err = New(&Config{ConfigFile: configFile})
+	assert.ErrorIs(t, err, queue.ErrLocked)
+
+	require.NoError(t, svc.Close())
+
+	svc, err = New(&Config{ConfigFile: configFile})
+	require.NoError(t, err)
+	require.NoError(t, svc.Close())
+}
+
+func TestService_AdminReplay(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	configFile := createTestConfigFile(t, cfg)
+
+	svc, err := New(&Config{ConfigFile: configFile})
+	require.NoError(t, err)
+	defer func() { _ = svc.Close() }()
+
+	mux := http.NewServeMux()
+	require.True(t, svc.registerAdmin(mux))
+
+	// Dead-letter an item whose file was moved to the DLQ directory
+	sourceFile := filepath.Join(cfg.Encryption.SourceDir, "data.txt")
+	dlqFile := filepath.Join(cfg.Encryption.SourceDir, "dlq", "data.txt")
+	require.NoError(t, os.MkdirAll(filepath.Dir(dlqFile), 0750))
+	require.NoError(t, os.WriteFile(dlqFile, []byte("data"), 0600))
+
+	item := model.NewItem(model.OperationEncrypt, sourceFile, filepath.Join(cfg.Encryption.DestDir, "data.txt.enc"))
+	require.NoError(t, svc.queue.Enqueue(item))
+	dead := svc.queue.Dequeue()
+	dead.AttemptCount = 3
+	require.Error(t, svc.queue.Requeue(dead, assert.AnError))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dlq", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var deadLetters []*model.Item
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &deadLetters))
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, item.ID, deadLetters[0].ID)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/dlq/"+item.ID+"/replay", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var replayed model.Item
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &replayed))
+	assert.Equal(t, 0, replayed.AttemptCount)
+	assert.Equal(t, model.StatusPending, replayed.Status)
+	assert.FileExists(t, sourceFile)
+	assert.NoFileExists(t, dlqFile)
+	assert.Equal(t, 1, svc.queue.Size())
+
+	// Replaying again conflicts; unknown items are not found
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/dlq/"+item.ID+"/replay", nil))
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/queue/missing", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/queue/"+item.ID, nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, 0, svc.queue.Size())
+}
+
+func TestService_AdminListener(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	configFile := createTestConfigFile(t, cfg)
+
+	svc, err := New(&Config{ConfigFile: configFile})
+	require.NoError(t, err)
+	defer func() { _ = svc.Close() }()
+
+	require.NoError(t, svc.startTelemetry(context.Background(), &config.TelemetryConfig{
+		Listen:      "127.0.0.1:0",
+		Admin:       true,
+		AdminListen: "127.0.0.1:0",
+		AdminToken:  "secret",
+	}))
+	defer svc.stopTelemetry()
+	require.NotNil(t, svc.adminServer)
+
+	// The admin API is not served next to the metrics
+	rec := httptest.NewRecorder()
+	svc.telemetryServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/queue", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	svc.adminServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/queue", nil))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest(http.MethodDelete, "/queue/missing", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rec = httptest.NewRecorder()
+	svc.adminServer.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/queue", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	svc.adminServer.Handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/watcher"
+)
+
+// Check status values reported by /healthz and /readyz
+const (
+	checkOK   = "ok"
+	checkFail = "fail"
+)
+
+// readinessTimeout bounds the Vault calls made by a single readiness probe
+const readinessTimeout = 5 * time.Second
+
+// tokenChecker is implemented by Vault clients that can validate their token
+type tokenChecker interface {
+	LookupToken(ctx context.Context) error
+}
+
+// reachabilityReporter is implemented by Vault clients that track whether
+// data key requests are reaching Vault
+type reachabilityReporter interface {
+	UnreachableSince() time.Time
+}
+
+// journalReporter is implemented by queues that journal every change
+type journalReporter interface {
+	JournalErr() error
+}
+
+// checkResult is the outcome of a single check
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// healthReport is the JSON body of /healthz and /readyz
+type healthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+func newHealthReport() *healthReport {
+	return &healthReport{
+		Status: checkOK,
+		Checks: make(map[string]checkResult),
+	}
+}
+
+// add records a check; any failing check fails the report
+func (r *healthReport) add(name string, err error) {
+	if err != nil {
+		r.Status = checkFail
+		r.Checks[name] = checkResult{Status: checkFail, Error: err.Error()}
+		return
+	}
+	r.Checks[name] = checkResult{Status: checkOK}
+}
+
+// write sends the report, with 503 Service Unavailable if any check failed
+func (r *healthReport) write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Status != checkOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(r)
+}
+
+// handleHealthz reports whether the process and its watcher and processor
+// goroutines are running
+func (s *Service) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	report := newHealthReport()
+	report.add("watcher", s.checkWatcher())
+	report.add("processor", s.checkProcessor())
+	report.write(w)
+}
+
+// handleReadyz reports whether the service can currently process files:
+// Vault is reachable and unsealed, the token is valid, data key requests
+// have not been failing for too long and the directories it writes to are
+// writable
+func (s *Service) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	cfg := s.cfgMgr.Get()
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	report := newHealthReport()
+
+	if checker, ok := s.vaultClient.(healthChecker); ok {
+		report.add("vault", checker.HealthWithRetry(0, 0))
+	}
+	if checker, ok := s.vaultClient.(tokenChecker); ok {
+		report.add("vault_token", checker.LookupToken(ctx))
+	}
+	if reporter, ok := s.vaultClient.(reachabilityReporter); ok {
+		timeout := config.DefaultVaultUnreachableTimeout
+		if cfg.Telemetry != nil {
+			timeout = cfg.Telemetry.VaultUnreachableTimeout
+		}
+		report.add("vault_requests", checkReachability(reporter.UnreachableSince(), timeout))
+	}
+
+	report.add("source_dirs", checkSourceDirs(cfg))
+	queueErr := checkQueueState(cfg.Queue.StatePath)
+	if reporter, ok := s.queue.(journalReporter); ok && queueErr == nil {
+		queueErr = reporter.JournalErr()
+	}
+	report.add("queue_state", queueErr)
+
+	report.write(w)
+}
+
+// checkWatcher fails once the watcher goroutine has exited
+func (s *Service) checkWatcher() error {
+	if !s.watcherRunning.Load() {
+		return fmt.Errorf("watcher is not running")
+	}
+	return nil
+}
+
+// checkProcessor fails once the processor goroutine has exited
+func (s *Service) checkProcessor() error {
+	if s.processorDone == nil {
+		return fmt.Errorf("processor has not started")
+	}
+	select {
+	case <-s.processorDone:
+		return fmt.Errorf("processor is not running")
+	default:
+		return nil
+	}
+}
+
+// checkReachability fails when data key requests have been failing to reach
+// Vault for longer than timeout
+func checkReachability(failingSince time.Time, timeout time.Duration) error {
+	if failingSince.IsZero() {
+		return nil
+	}
+	if elapsed := time.Since(failingSince); elapsed > timeout {
+		return fmt.Errorf("vault unreachable for %s", elapsed.Round(time.Second))
+	}
+	return nil
+}
+
+// checkSourceDirs fails if any rule's source directory is not writable. The
+// processor moves or deletes source files, so it needs write access.
+func checkSourceDirs(cfg *config.Config) error {
+	var errs []error
+	for _, rule := range watcher.RulesFromConfig(cfg) {
+		if err := checkWritable(rule.SourceDir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkQueueState fails if the queue journal cannot be written. Compaction
+// writes a temporary file and renames it, so the directory must be writable
+// too.
+func checkQueueState(statePath string) error {
+	if err := checkWritable(filepath.Dir(statePath)); err != nil {
+		return err
+	}
+	if err := checkWritable(statePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
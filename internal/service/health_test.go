@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeVaultClient implements the optional health interfaces of vault.Client
+type fakeVaultClient struct {
+	healthErr        error
+	tokenErr         error
+	unreachableSince time.Time
+}
+
+func (f *fakeVaultClient) Close() error { return nil }
+
+func (f *fakeVaultClient) HealthWithRetry(int, time.Duration) error { return f.healthErr }
+
+func (f *fakeVaultClient) LookupToken(context.Context) error { return f.tokenErr }
+
+func (f *fakeVaultClient) UnreachableSince() time.Time { return f.unreachableSince }
+
+func getReport(t *testing.T, handler http.HandlerFunc, path string) (int, healthReport) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var report healthReport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	return rec.Code, report
+}
+
+func TestService_Healthz(t *testing.T) {
+	svc := &Service{}
+
+	code, report := getReport(t, svc.handleHealthz, "/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, checkFail, report.Checks["watcher"].Status)
+	assert.Equal(t, checkFail, report.Checks["processor"].Status)
+
+	svc.watcherRunning.Store(true)
+	svc.processorDone = make(chan struct{})
+
+	code, report = getReport(t, svc.handleHealthz, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, checkOK, report.Status)
+
+	close(svc.processorDone)
+
+	code, report = getReport(t, svc.handleHealthz, "/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "processor is not running", report.Checks["processor"].Error)
+}
+
+func TestService_Readyz(t *testing.T) {
+	newService := func(t *testing.T) (*Service, *fakeVaultClient) {
+		cfg, _ := newTestConfig(t)
+		vaultClient := &fakeVaultClient{}
+		return &Service{
+			cfgMgr:      &MockConfigManager{cfg: cfg},
+			vaultClient: vaultClient,
+		}, vaultClient
+	}
+
+	t.Run("ready", func(t *testing.T) {
+		svc, _ := newService(t)
+
+		code, report := getReport(t, svc.handleReadyz, "/readyz")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, checkOK, report.Status)
+		for _, name := range []string{"vault", "vault_token", "vault_requests", "source_dirs", "queue_state"} {
+			assert.Equal(t, checkOK, report.Checks[name].Status, name)
+		}
+	})
+
+	t.Run("vault sealed and token invalid", func(t *testing.T) {
+		svc, vaultClient := newService(t)
+		vaultClient.healthErr = errors.New("vault is sealed")
+		vaultClient.tokenErr = errors.New("permission denied")
+
+		code, report := getReport(t, svc.handleReadyz, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Equal(t, "vault is sealed", report.Checks["vault"].Error)
+		assert.Equal(t, "permission denied", report.Checks["vault_token"].Error)
+	})
+
+	t.Run("vault unreachable", func(t *testing.T) {
+		svc, vaultClient := newService(t)
+
+		// Failures shorter than the timeout are tolerated
+		vaultClient.unreachableSince = time.Now().Add(-time.Second)
+		code, _ := getReport(t, svc.handleReadyz, "/readyz")
+		assert.Equal(t, http.StatusOK, code)
+
+		vaultClient.unreachableSince = time.Now().Add(-time.Hour)
+		code, report := getReport(t, svc.handleReadyz, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Contains(t, report.Checks["vault_requests"].Error, "vault unreachable for")
+	})
+
+	t.Run("missing source dir", func(t *testing.T) {
+		svc, _ := newService(t)
+		cfg := svc.cfgMgr.Get()
+		cfg.Encryption.SourceDir = filepath.Join(t.TempDir(), "missing")
+
+		code, report := getReport(t, svc.handleReadyz, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+		assert.Contains(t, report.Checks["source_dirs"].Error, "missing is not writable")
+		assert.Equal(t, checkOK, report.Checks["queue_state"].Status)
+	})
+}
@@ -3,18 +3,31 @@ package service
 import (
 	"context"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"sync/atomic"
 	"time"
 
 	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/hooks"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/interfaces"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/ledger"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/queue"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/vault"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/watcher"
 )
 
+// shutdownTimeout bounds how long Shutdown waits for in-flight items
+const shutdownTimeout = 30 * time.Second
+
+// tokenManager is implemented by Vault clients that keep their token valid
+type tokenManager interface {
+	ManageToken(ctx context.Context, log logger.Logger)
+}
+
 // Service encapsulates the watch service lifecycle
 type Service struct {
 	cfgMgr      interfaces.ConfigManager
@@ -25,7 +38,25 @@ type Service struct {
 	queue       interfaces.Queue
 	watcher     interfaces.Watcher
 	processor   interfaces.Processor
+	hooks       *hooks.Dispatcher
 	cancel      context.CancelFunc
+
+	// processorDone is closed when the processor's workers have stopped
+	processorDone chan struct{}
+
+	// watcherRunning is true while the watcher goroutine is running
+	watcherRunning atomic.Bool
+
+	// telemetryServer serves /metrics, /healthz and /readyz when a telemetry
+	// block is configured
+	telemetryServer *http.Server
+
+	// adminServer serves the queue administration API when admin is enabled
+	adminServer *http.Server
+
+	// stateLock keeps offline queue commands from changing the journal while
+	// the service runs
+	stateLock *queue.StateLock
 }
 
 // Config holds service configuration
@@ -105,30 +136,35 @@ func (s *Service) setupLogging(cfg *config.Config) error {
 
 // setupVaultAndCrypto creates Vault client and crypto components
 func (s *Service) setupVaultAndCrypto(cfg *config.Config) error {
-	vaultClient, err := vault.NewClient(&vault.Config{
-		AgentAddress: cfg.Vault.AgentAddress,
-		TransitMount: cfg.Vault.TransitMount,
-		KeyName:      cfg.Vault.KeyName,
-		Timeout:      cfg.Vault.RequestTimeout,
-		Auth:         cfg.Vault.Auth,
-	})
+	vaultClient, err := vault.NewClientFromConfig(&cfg.Vault)
 	if err != nil {
 		return fmt.Errorf("failed to create Vault client: %w", err)
 	}
 
 	s.vaultClient = vaultClient
 	s.encryptor = crypto.NewEncryptor(vaultClient, &crypto.EncryptorConfig{
-		ChunkSize: cfg.Encryption.ChunkSize,
+		ChunkSize:    cfg.Encryption.ChunkSize,
+		Namespace:    vaultClient.Namespace(),
+		TransitMount: cfg.Vault.TransitMount,
+		KeyName:      cfg.Vault.KeyName,
 	})
 	s.decryptor = crypto.NewDecryptor(vaultClient, &crypto.EncryptorConfig{
-		ChunkSize: cfg.Encryption.ChunkSize,
+		ChunkSize:    cfg.Encryption.ChunkSize,
+		Namespace:    vaultClient.Namespace(),
+		TransitMount: cfg.Vault.TransitMount,
+		KeyName:      cfg.Vault.KeyName,
 	})
 
 	return nil
 }
 
-// setupQueue creates and loads the queue
+// setupQueue locks, creates and loads the queue
 func (s *Service) setupQueue(cfg *config.Config) error {
+	lock, err := queue.LockState(cfg.Queue.StatePath)
+	if err != nil {
+		return fmt.Errorf("failed to lock queue state %s: %w", cfg.Queue.StatePath, err)
+	}
+
 	q, err := queue.NewQueue(&queue.Config{
 		MaxRetries: cfg.Queue.MaxRetries,
 		BaseDelay:  cfg.Queue.BaseDelay,
@@ -136,8 +172,10 @@ func (s *Service) setupQueue(cfg *config.Config) error {
 		StatePath:  cfg.Queue.StatePath,
 	})
 	if err != nil {
+		_ = lock.Unlock()
 		return fmt.Errorf("failed to create queue: %w", err)
 	}
+	s.stateLock = lock
 
 	// Load queue state if it exists
 	if err := q.Load(); err != nil {
@@ -152,28 +190,38 @@ func (s *Service) setupQueue(cfg *config.Config) error {
 
 // setupWatcherAndProcessor creates watcher and processor components
 func (s *Service) setupWatcherAndProcessor(cfg *config.Config) error {
+	// Every encryption and decryption block (default and named) is a rule
+	// with its own directories and transit key
+	rules := watcher.RulesFromConfig(cfg)
+
+	// Source files kept in place are tracked so they are not processed again
+	processed, err := ledger.Open(cfg.Queue.LedgerPath, cfg.Queue.LedgerHash)
+	if err != nil {
+		return fmt.Errorf("failed to open processed-file ledger: %w", err)
+	}
+
+	// Hook events wait in an outbox until they are delivered
+	dispatcher, err := hooks.Open(cfg.Queue.HookOutboxPath, cfg.Hooks, s.log)
+	if err != nil {
+		return fmt.Errorf("failed to open hook outbox: %w", err)
+	}
+
 	w, err := watcher.NewWatcher(&watcher.Config{
-		EncryptSourceDir:  cfg.Encryption.SourceDir,
-		EncryptDestDir:    cfg.Encryption.DestDir,
-		DecryptSourceDir:  cfg.Decryption.SourceDir,
-		DecryptDestDir:    cfg.Decryption.DestDir,
+		Rules:             rules,
 		StabilityDuration: cfg.Queue.StabilityDuration,
+		ReconcileInterval: cfg.Queue.ReconcileInterval,
+		StuckAfter:        cfg.Queue.StuckAfter,
+		Ledger:            processed,
 	}, s.queue, s.log)
 	if err != nil {
 		return fmt.Errorf("failed to create watcher: %w", err)
 	}
 
 	processor, err := watcher.NewProcessor(&watcher.ProcessorConfig{
-		EncryptSourceFileBehavior: cfg.Encryption.SourceFileBehavior,
-		EncryptArchiveDir:         cfg.ArchiveDir("encrypt"),
-		EncryptFailedDir:          cfg.FailedDir("encrypt"),
-		EncryptDLQDir:             cfg.DLQDir("encrypt"),
-		CalculateChecksum:         cfg.Encryption.CalculateChecksum,
-		DecryptSourceFileBehavior: cfg.Decryption.SourceFileBehavior,
-		DecryptArchiveDir:         cfg.ArchiveDir("decrypt"),
-		DecryptFailedDir:          cfg.FailedDir("decrypt"),
-		DecryptDLQDir:             cfg.DLQDir("decrypt"),
-		VerifyChecksum:            cfg.Decryption.VerifyChecksum,
+		Rules:   rules,
+		Workers: cfg.Queue.Workers,
+		Ledger:  processed,
+		Hooks:   dispatcher,
 	}, s.queue, s.encryptor, s.decryptor, s.log)
 	if err != nil {
 		return fmt.Errorf("failed to create processor: %w", err)
@@ -181,6 +229,7 @@ func (s *Service) setupWatcherAndProcessor(cfg *config.Config) error {
 
 	s.watcher = w
 	s.processor = processor
+	s.hooks = dispatcher
 
 	return nil
 }
@@ -212,6 +261,9 @@ func (s *Service) registerReloadCallback() {
 		// Update processor with new config
 		s.processor.UpdateConfig(newCfg)
 		s.log.Info("Processor configuration updated")
+
+		// Changes to hook_outbox_path need a restart
+		s.hooks.Update(newCfg.Hooks)
 	})
 }
 
@@ -222,14 +274,33 @@ func (s *Service) Run(ctx context.Context, sigChan <-chan os.Signal, isReloadSig
 	s.cancel = cancel
 	defer cancel()
 
+	// Serve metrics and health endpoints if configured (changes to the telemetry block need a restart)
+	if telemetryCfg := s.cfgMgr.Get().Telemetry; telemetryCfg != nil {
+		if err := s.startTelemetry(ctx, telemetryCfg); err != nil {
+			return err
+		}
+		defer s.stopTelemetry()
+	}
+
+	// Renew the Vault token and log in again when it expires
+	if manager, ok := s.vaultClient.(tokenManager); ok {
+		go manager.ManageToken(ctx, s.log)
+	}
+
 	// Start watcher and processor
+	s.watcherRunning.Store(true)
 	go func() {
+		defer s.watcherRunning.Store(false)
 		if err := s.watcher.Start(ctx); err != nil {
 			s.log.Error("Watcher stopped with error", "error", err)
 		}
 	}()
 
+	go s.hooks.Run(ctx)
+
+	s.processorDone = make(chan struct{})
 	go func() {
+		defer close(s.processorDone)
 		if err := s.processor.Start(ctx); err != nil {
 			s.log.Error("Processor stopped with error", "error", err)
 		}
@@ -268,9 +339,18 @@ func (s *Service) Shutdown() error {
 		s.cancel()
 	}
 
-	// Give goroutines time to finish current operations and stop queue modifications
+	// Wait for processor workers to finish (or abandon) their current items
+	// so the queue is no longer being modified when we save it
 	s.log.Info("Waiting for goroutines to finish")
-	time.Sleep(100 * time.Millisecond)
+	if s.processorDone != nil {
+		select {
+		case <-s.processorDone:
+		case <-time.After(shutdownTimeout):
+			s.log.Error("Timed out waiting for processor workers to stop", "timeout", shutdownTimeout)
+		}
+	} else {
+		time.Sleep(100 * time.Millisecond)
+	}
 
 	// Save queue state after all modifications have stopped
 	s.log.Info("Saving queue state")
@@ -290,5 +370,12 @@ func (s *Service) Close() error {
 	if s.vaultClient != nil {
 		_ = s.vaultClient.Close()
 	}
+	if closer, ok := s.queue.(io.Closer); ok {
+		_ = closer.Close()
+	}
+	if s.stateLock != nil {
+		_ = s.stateLock.Unlock()
+		s.stateLock = nil
+	}
 	return nil
 }
@@ -104,6 +104,13 @@ func (m *MockQueue) Requeue(item *model.Item, err error) error {
 	args := m.Called(item, err)
 	return args.Error(0)
 }
+func (m *MockQueue) Complete(item *model.Item) error {
+	args := m.Called(item)
+	return args.Error(0)
+}
+func (m *MockQueue) Notify() <-chan struct{} {
+	return nil
+}
 
 type MockWatcher struct {
 	mock.Mock
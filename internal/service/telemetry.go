@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/metrics"
+)
+
+// telemetryShutdownTimeout bounds how long in-flight scrapes may take on shutdown
+const telemetryShutdownTimeout = 5 * time.Second
+
+// healthChecker is implemented by Vault clients that can report Vault health
+type healthChecker interface {
+	HealthWithRetry(maxRetries int, retryDelay time.Duration) error
+}
+
+// startTelemetry serves /metrics, /healthz and /readyz on the configured
+// address, and the queue administration API on its own address if enabled,
+// and periodically checks Vault health so the last-healthy metric stays
+// current. The health checks stop when ctx is cancelled; the servers are
+// stopped by stopTelemetry.
+func (s *Service) startTelemetry(ctx context.Context, cfg *config.TelemetryConfig) error {
+	listener, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("failed to listen on telemetry address: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+
+	s.telemetryServer = s.serve(listener, mux, "Telemetry")
+	s.log.Info("Serving telemetry", "address", listener.Addr().String(), "paths", "/metrics, /healthz, /readyz")
+
+	if cfg.Admin {
+		if err := s.startAdmin(cfg); err != nil {
+			s.stopTelemetry()
+			return err
+		}
+	}
+
+	if checker, ok := s.vaultClient.(healthChecker); ok {
+		go s.runHealthChecks(ctx, checker, cfg.HealthCheckInterval)
+	}
+
+	return nil
+}
+
+// runHealthChecks checks Vault health every interval until ctx is cancelled
+func (s *Service) runHealthChecks(ctx context.Context, checker healthChecker, interval time.Duration) {
+	if interval <= 0 {
+		interval = config.DefaultHealthCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := checker.HealthWithRetry(0, 0); err != nil {
+			s.log.Error("Vault health check failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// startAdmin serves the queue administration API on its own listener, so it
+// is not exposed wherever metrics are scraped
+func (s *Service) startAdmin(cfg *config.TelemetryConfig) error {
+	mux := http.NewServeMux()
+	if !s.registerAdmin(mux) {
+		return nil
+	}
+
+	addr := cfg.AdminListen
+	if addr == "" {
+		addr = config.DefaultAdminListen
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on admin address: %w", err)
+	}
+
+	s.adminServer = s.serve(listener, requireAdminToken(cfg.AdminToken, mux), "Admin API")
+	s.log.Info("Serving queue admin API", "address", listener.Addr().String(), "paths", "/queue, /dlq",
+		"authentication", cfg.AdminToken != "")
+	return nil
+}
+
+// serve starts an HTTP server for handler on listener
+func (s *Service) serve(listener net.Listener, handler http.Handler, name string) *http.Server {
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Error(name+" server stopped with error", "error", err)
+		}
+	}()
+
+	return server
+}
+
+// stopTelemetry shuts down the telemetry and admin servers, if they are running
+func (s *Service) stopTelemetry() {
+	ctx, cancel := context.WithTimeout(context.Background(), telemetryShutdownTimeout)
+	defer cancel()
+
+	if s.adminServer != nil {
+		if err := s.adminServer.Shutdown(ctx); err != nil {
+			s.log.Error("Failed to stop admin server", "error", err)
+		}
+		s.adminServer = nil
+	}
+
+	if s.telemetryServer != nil {
+		if err := s.telemetryServer.Shutdown(ctx); err != nil {
+			s.log.Error("Failed to stop telemetry server", "error", err)
+		}
+		s.telemetryServer = nil
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package service
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// wOK is the access(2) mode for write permission
+const wOK = 0x2
+
+// checkWritable reports whether the process may write to path. It checks
+// permissions rather than writing a probe file, which would show up as a new
+// file in watched directories.
+func checkWritable(path string) error {
+	if err := syscall.Access(path, wOK); err != nil {
+		return fmt.Errorf("%s is not writable: %w", path, err)
+	}
+	return nil
+}
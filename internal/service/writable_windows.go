@@ -0,0 +1,21 @@
+//go:build windows
+
+package service
+
+import (
+	"fmt"
+	"os"
+)
+
+// checkWritable reports whether path exists and is not read-only. Windows
+// has no access(2), so only the read-only attribute is checked.
+func checkWritable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", path, err)
+	}
+	if info.Mode().Perm()&0200 == 0 {
+		return fmt.Errorf("%s is not writable: read-only", path)
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/metrics"
 	"github.com/hashicorp/vault/api"
 )
 
@@ -14,6 +15,12 @@ import (
 type Client struct {
 	client *api.Client
 	config *Config
+
+	// reach tracks whether data key requests are reaching Vault
+	reach reachability
+
+	// token tracks the login used by ManageToken
+	token tokenLifecycle
 }
 
 // Config holds Vault client configuration
@@ -30,8 +37,32 @@ type Config struct {
 	// Request timeout
 	Timeout time.Duration
 
+	// TLS configuration for https listeners
+	TLS *config.TLSConfig
+
 	// Auth configuration
 	Auth *config.AuthConfig
+
+	// Vault Enterprise namespace (overrides VAULT_NAMESPACE when set)
+	Namespace string
+}
+
+// NewClientFromConfig creates a Vault client from the vault block of the
+// configuration file
+func NewClientFromConfig(cfg *config.VaultConfig) (*Client, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("config cannot be nil")
+	}
+
+	return NewClient(&Config{
+		AgentAddress: cfg.AgentAddress,
+		TransitMount: cfg.TransitMount,
+		KeyName:      cfg.KeyName,
+		Timeout:      cfg.RequestTimeout,
+		TLS:          cfg.TLS,
+		Auth:         cfg.Auth,
+		Namespace:    cfg.Namespace,
+	})
 }
 
 // NewClient creates a new Vault client that connects via Vault Agent
@@ -64,6 +95,13 @@ func NewClient(cfg *Config) (*Client, error) {
 		vaultConfig.Timeout = cfg.Timeout
 	}
 
+	// Configure TLS (CA, client certificate, server name)
+	if tlsCfg := cfg.apiTLSConfig(); tlsCfg != nil {
+		if err := vaultConfig.ConfigureTLS(tlsCfg); err != nil {
+			return nil, fmt.Errorf("failed to configure TLS: %w", err)
+		}
+	}
+
 	// Create Vault client
 	apiClient, err := api.NewClient(vaultConfig)
 	if err != nil {
@@ -75,44 +113,63 @@ func NewClient(cfg *Config) (*Client, error) {
 		config: cfg,
 	}
 
+	// Auth methods mounted in a namespace need it set before logging in.
+	// VAULT_NAMESPACE takes precedence over the configured namespace, as it
+	// does in the CLI, where flags take precedence over both.
+	namespace := cfg.Namespace
+	if env := os.Getenv("VAULT_NAMESPACE"); env != "" {
+		namespace = env
+	}
+	if namespace != "" {
+		apiClient.SetNamespace(namespace)
+	}
+
 	// Authenticate if auth config is present
 	if cfg.Auth != nil {
 		if err := client.login(cfg.Auth); err != nil {
 			return nil, fmt.Errorf("failed to authenticate: %w", err)
 		}
 	} else {
-		// In development, support direct Vault access with token and namespace from environment
+		// In development, support direct Vault access with a token from the environment
 		// In production, Vault Agent handles authentication automatically
 		if token := os.Getenv("VAULT_TOKEN"); token != "" {
 			apiClient.SetToken(token)
 		}
-		if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
-			apiClient.SetNamespace(namespace)
-		}
 	}
 
 	return client, nil
 }
 
-// login handles authentication based on configuration
+// login handles authentication based on configuration. Methods that log in
+// to Vault record the auth response so ManageToken can renew the token.
 func (c *Client) login(authCfg *config.AuthConfig) error {
+	var secret *api.Secret
+	var err error
+
 	switch authCfg.Method {
 	case "token":
 		return c.authToken(authCfg.Token)
 	case "approle":
-		return c.authAppRole(authCfg.AppRole)
+		secret, err = c.authAppRole(authCfg.AppRole)
 	case "kubernetes":
-		return c.authKubernetes(authCfg.Kubernetes)
+		secret, err = c.authKubernetes(authCfg.Kubernetes)
 	case "jwt":
-		return c.authJWT(authCfg.JWT)
+		secret, err = c.authJWT(authCfg.JWT)
 	case "cert":
-		return c.authCert(authCfg.Cert)
+		secret, err = c.authCert(authCfg.Cert)
 	case "agent":
 		// Do nothing, rely on Agent
 		return nil
 	default:
 		return fmt.Errorf("unknown auth method: %s", authCfg.Method)
 	}
+	if err != nil {
+		return err
+	}
+
+	c.client.SetToken(secret.Auth.ClientToken)
+	c.token.setSecret(secret)
+	return nil
 }
 
 func (c *Client) authToken(cfg *config.TokenAuthConfig) error {
@@ -127,13 +184,13 @@ func (c *Client) authToken(cfg *config.TokenAuthConfig) error {
 	return nil
 }
 
-func (c *Client) authAppRole(cfg *config.AppRoleAuthConfig) error {
+func (c *Client) authAppRole(cfg *config.AppRoleAuthConfig) (*api.Secret, error) {
 	roleID := cfg.RoleID
 	if roleID == "" {
 		roleID = os.Getenv("VAULT_ROLE_ID")
 	}
 	if roleID == "" {
-		return fmt.Errorf("role_id is required")
+		return nil, fmt.Errorf("role_id is required")
 	}
 
 	secretID := cfg.SecretID
@@ -141,7 +198,7 @@ func (c *Client) authAppRole(cfg *config.AppRoleAuthConfig) error {
 		secretID = os.Getenv("VAULT_SECRET_ID")
 	}
 	if secretID == "" {
-		return fmt.Errorf("secret_id is required")
+		return nil, fmt.Errorf("secret_id is required")
 	}
 
 	mountPath := cfg.MountPath
@@ -157,20 +214,19 @@ func (c *Client) authAppRole(cfg *config.AppRoleAuthConfig) error {
 	path := fmt.Sprintf("%s/login", mountPath)
 	secret, err := c.client.Logical().Write(path, data)
 	if err != nil {
-		return fmt.Errorf("failed to login with approle: %w", err)
+		return nil, fmt.Errorf("failed to login with approle: %w", err)
 	}
 	if secret == nil || secret.Auth == nil {
-		return fmt.Errorf("login returned no auth info")
+		return nil, fmt.Errorf("login returned no auth info")
 	}
 
-	c.client.SetToken(secret.Auth.ClientToken)
-	return nil
+	return secret, nil
 }
 
-func (c *Client) authKubernetes(cfg *config.KubernetesAuthConfig) error {
+func (c *Client) authKubernetes(cfg *config.KubernetesAuthConfig) (*api.Secret, error) {
 	role := cfg.Role
 	if role == "" {
-		return fmt.Errorf("role is required")
+		return nil, fmt.Errorf("role is required")
 	}
 
 	tokenPath := cfg.TokenPath
@@ -182,7 +238,7 @@ func (c *Client) authKubernetes(cfg *config.KubernetesAuthConfig) error {
 	// #nosec G304 - tokenPath is from configuration, not user input
 	jwt, err := os.ReadFile(filepath.Clean(tokenPath))
 	if err != nil {
-		return fmt.Errorf("failed to read kubernetes service account token: %w", err)
+		return nil, fmt.Errorf("failed to read kubernetes service account token: %w", err)
 	}
 
 	mountPath := cfg.MountPath
@@ -198,32 +254,31 @@ func (c *Client) authKubernetes(cfg *config.KubernetesAuthConfig) error {
 	path := fmt.Sprintf("%s/login", mountPath)
 	secret, err := c.client.Logical().Write(path, data)
 	if err != nil {
-		return fmt.Errorf("failed to login with kubernetes: %w", err)
+		return nil, fmt.Errorf("failed to login with kubernetes: %w", err)
 	}
 	if secret == nil || secret.Auth == nil {
-		return fmt.Errorf("login returned no auth info")
+		return nil, fmt.Errorf("login returned no auth info")
 	}
 
-	c.client.SetToken(secret.Auth.ClientToken)
-	return nil
+	return secret, nil
 }
 
-func (c *Client) authJWT(cfg *config.JWTAuthConfig) error {
+func (c *Client) authJWT(cfg *config.JWTAuthConfig) (*api.Secret, error) {
 	role := cfg.Role
 	if role == "" {
-		return fmt.Errorf("role is required")
+		return nil, fmt.Errorf("role is required")
 	}
 
 	path := cfg.Path
 	if path == "" {
-		return fmt.Errorf("path to jwt is required")
+		return nil, fmt.Errorf("path to jwt is required")
 	}
 
 	// Read the JWT
 	// #nosec G304 - path is from configuration, not user input
 	jwt, err := os.ReadFile(filepath.Clean(path))
 	if err != nil {
-		return fmt.Errorf("failed to read jwt file: %w", err)
+		return nil, fmt.Errorf("failed to read jwt file: %w", err)
 	}
 
 	mountPath := cfg.MountPath
@@ -239,20 +294,19 @@ func (c *Client) authJWT(cfg *config.JWTAuthConfig) error {
 	loginPath := fmt.Sprintf("%s/login", mountPath)
 	secret, err := c.client.Logical().Write(loginPath, data)
 	if err != nil {
-		return fmt.Errorf("failed to login with jwt: %w", err)
+		return nil, fmt.Errorf("failed to login with jwt: %w", err)
 	}
 	if secret == nil || secret.Auth == nil {
-		return fmt.Errorf("login returned no auth info")
+		return nil, fmt.Errorf("login returned no auth info")
 	}
 
-	c.client.SetToken(secret.Auth.ClientToken)
-	return nil
+	return secret, nil
 }
 
-func (c *Client) authCert(cfg *config.CertAuthConfig) error {
-	// Cert auth requires TLS configuration which should be done during client creation.
-	// However, the login call is still needed to get a token.
-	// The client certificate is presented during the TLS handshake.
+func (c *Client) authCert(cfg *config.CertAuthConfig) (*api.Secret, error) {
+	// The client certificate is loaded into the TLS configuration by NewClient
+	// and presented during the TLS handshake; the login call exchanges it for
+	// a token.
 
 	mountPath := cfg.MountPath
 	if mountPath == "" {
@@ -267,14 +321,13 @@ func (c *Client) authCert(cfg *config.CertAuthConfig) error {
 	path := fmt.Sprintf("%s/login", mountPath)
 	secret, err := c.client.Logical().Write(path, data)
 	if err != nil {
-		return fmt.Errorf("failed to login with cert: %w", err)
+		return nil, fmt.Errorf("failed to login with cert: %w", err)
 	}
 	if secret == nil || secret.Auth == nil {
-		return fmt.Errorf("login returned no auth info")
+		return nil, fmt.Errorf("login returned no auth info")
 	}
 
-	c.client.SetToken(secret.Auth.ClientToken)
-	return nil
+	return secret, nil
 }
 
 // Health checks if Vault Agent is accessible
@@ -292,7 +345,9 @@ func (c *Client) HealthWithRetry(maxRetries int, retryDelay time.Duration) error
 		}
 
 		sys := c.client.Sys()
+		start := time.Now()
 		health, err := sys.Health()
+		metrics.ObserveVaultRequest(metrics.EndpointHealth, start, err)
 		if err != nil {
 			lastErr = fmt.Errorf("vault health check failed (attempt %d/%d): %w", attempt+1, maxRetries+1, err)
 			continue
@@ -309,6 +364,8 @@ func (c *Client) HealthWithRetry(maxRetries int, retryDelay time.Duration) error
 		}
 
 		// Success
+		metrics.VaultLastHealthy.SetToCurrentTime()
+		c.reach.record(nil)
 		return nil
 	}
 
@@ -1,7 +1,9 @@
 package vault
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -9,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hashicorp/vault/api"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -196,6 +199,74 @@ func TestDecryptDataKey(t *testing.T) {
 	// KeyVersion might be 0 due to type casting issues in the implementation
 }
 
+func TestDecryptDataKeyWithKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/other-transit/decrypt/other-key", r.URL.Path)
+		assert.Equal(t, "team-a", r.Header.Get("X-Vault-Namespace"))
+
+		response := map[string]interface{}{
+			"data": map[string]interface{}{
+				"plaintext": "ZGVjcnlwdGVkLWRhdGEta2V5LXBsYWludGV4dA==",
+			},
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&Config{
+		AgentAddress: server.URL,
+		TransitMount: "transit",
+		KeyName:      "test-key",
+		Timeout:      5 * time.Second,
+	})
+	require.NoError(t, err)
+
+	dataKey, err := client.DecryptDataKeyWithKey(KeyRef{
+		Namespace:    "team-a",
+		TransitMount: "other-transit",
+		KeyName:      "other-key",
+	}, "vault:v1:encrypted-data")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("decrypted-data-key-plaintext"), dataKey.Plaintext)
+
+	// The configured client is not affected by the per-key namespace
+	assert.Equal(t, "", client.Namespace())
+}
+
+func TestGenerateDataKeyWithKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/finance-transit/datakey/plaintext/finance-key", r.URL.Path)
+
+		response := map[string]interface{}{
+			"data": map[string]interface{}{
+				"plaintext":  "ZGVjcnlwdGVkLWRhdGEta2V5LXBsYWludGV4dA==",
+				"ciphertext": "vault:v1:finance-wrapped",
+			},
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&Config{
+		AgentAddress: server.URL,
+		TransitMount: "transit",
+		KeyName:      "test-key",
+		Timeout:      5 * time.Second,
+	})
+	require.NoError(t, err)
+
+	dataKey, err := client.GenerateDataKeyWithKey(KeyRef{
+		TransitMount: "finance-transit",
+		KeyName:      "finance-key",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "vault:v1:finance-wrapped", dataKey.Ciphertext)
+}
+
 func TestDecryptDataKey_VaultError(t *testing.T) {
 	// Create mock Vault server that returns error
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -530,6 +601,56 @@ func TestNewClient_AppRoleAuth(t *testing.T) {
 	assert.Equal(t, "test-token", client.client.Token())
 }
 
+func TestNewClientFromConfig_Namespace(t *testing.T) {
+	want := "team-a"
+
+	// The login must be sent to the namespace in effect
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/auth/approle/login" {
+			assert.Equal(t, want, r.Header.Get("X-Vault-Namespace"))
+
+			response := map[string]interface{}{
+				"auth": map[string]interface{}{
+					"client_token": "test-token",
+				},
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(response)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	newClient := func(namespace string) *Client {
+		client, err := NewClientFromConfig(&config.VaultConfig{
+			AgentAddress: server.URL,
+			TransitMount: "transit",
+			KeyName:      "test-key",
+			Namespace:    namespace,
+			Auth: &config.AuthConfig{
+				Method: "approle",
+				AppRole: &config.AppRoleAuthConfig{
+					RoleID:   "test-role-id",
+					SecretID: "test-secret-id",
+				},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "test-token", client.client.Token())
+		return client
+	}
+
+	t.Setenv("VAULT_NAMESPACE", "")
+	assert.Equal(t, "team-a", newClient("team-a").Namespace())
+
+	// VAULT_NAMESPACE takes precedence over the configuration file
+	t.Setenv("VAULT_NAMESPACE", "env-ns")
+	want = "env-ns"
+	assert.Equal(t, "env-ns", newClient("team-a").Namespace())
+	assert.Equal(t, "env-ns", newClient("").Namespace())
+}
+
 func TestNewClient_KubernetesAuth(t *testing.T) {
 	// Create temporary token file
 	tmpTokenFile := filepath.Join(t.TempDir(), "token")
@@ -629,3 +750,57 @@ func TestNewClient_JWTAuth(t *testing.T) {
 	assert.NotNil(t, client)
 	assert.Equal(t, "test-jwt-token-response", client.client.Token())
 }
+
+func TestLookupToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/token/lookup-self" || r.Header.Get("X-Vault-Token") != "valid-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":{"ttl":3600}}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(&Config{
+		AgentAddress: server.URL,
+		TransitMount: "transit",
+		KeyName:      "test-key",
+	})
+	require.NoError(t, err)
+
+	client.client.SetToken("valid-token")
+	assert.NoError(t, client.LookupToken(context.Background()))
+
+	client.client.SetToken("expired-token")
+	err = client.LookupToken(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "token lookup failed")
+}
+
+func TestUnreachableSince(t *testing.T) {
+	client, err := NewClient(&Config{
+		AgentAddress: "http://127.0.0.1:8200",
+		TransitMount: "transit",
+		KeyName:      "test-key",
+	})
+	require.NoError(t, err)
+	assert.True(t, client.UnreachableSince().IsZero())
+
+	// Transport errors and server errors mean Vault is unreachable
+	client.reach.record(errors.New("connection refused"))
+	since := client.UnreachableSince()
+	assert.False(t, since.IsZero())
+
+	client.reach.record(&api.ResponseError{StatusCode: http.StatusServiceUnavailable})
+	assert.Equal(t, since, client.UnreachableSince(), "keeps the time of the first failure")
+
+	// A client error is an answer from Vault
+	client.reach.record(&api.ResponseError{StatusCode: http.StatusForbidden})
+	assert.True(t, client.UnreachableSince().IsZero())
+
+	client.reach.record(errors.New("connection refused"))
+	client.reach.record(nil)
+	assert.True(t, client.UnreachableSince().IsZero())
+}
@@ -1,10 +1,13 @@
 package vault
 
 import (
+	"context"
 	"encoding/base64"
 	"fmt"
+	"time"
 
 	"github.com/gitrgoliveira/go-fileencrypt/secure"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/metrics"
 )
 
 // DataKey represents a Vault Transit data key
@@ -29,10 +32,21 @@ func (dk *DataKey) Destroy() {
 
 // GenerateDataKey generates a new data encryption key from Vault Transit
 func (c *Client) GenerateDataKey() (*DataKey, error) {
-	path := fmt.Sprintf("%s/datakey/plaintext/%s", c.config.TransitMount, c.config.KeyName)
+	return c.GenerateDataKeyWithKey(KeyRef{})
+}
+
+// GenerateDataKeyWithKey generates a new data encryption key wrapped by the
+// given transit key, which may differ from the configured one (e.g. for
+// per-directory encryption rules)
+func (c *Client) GenerateDataKeyWithKey(ref KeyRef) (*DataKey, error) {
+	ref = c.resolve(ref)
+	path := fmt.Sprintf("%s/datakey/plaintext/%s", ref.TransitMount, ref.KeyName)
 
 	// Request a data key from Vault
-	secret, err := c.client.Logical().Write(path, nil)
+	start := time.Now()
+	secret, err := c.write(context.Background(), ref.Namespace, path, nil)
+	metrics.ObserveVaultRequest(metrics.EndpointDataKey, start, err)
+	c.reach.record(err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate data key: %w", err)
 	}
@@ -69,7 +83,15 @@ func (c *Client) GenerateDataKey() (*DataKey, error) {
 
 // DecryptDataKey decrypts an encrypted data key using Vault Transit
 func (c *Client) DecryptDataKey(ciphertext string) (*DataKey, error) {
-	path := fmt.Sprintf("%s/decrypt/%s", c.config.TransitMount, c.config.KeyName)
+	return c.DecryptDataKeyWithKey(KeyRef{}, ciphertext)
+}
+
+// DecryptDataKeyWithKey decrypts an encrypted data key with the given transit
+// key, which may differ from the configured one (e.g. for files encrypted by
+// another deployment)
+func (c *Client) DecryptDataKeyWithKey(ref KeyRef, ciphertext string) (*DataKey, error) {
+	ref = c.resolve(ref)
+	path := fmt.Sprintf("%s/decrypt/%s", ref.TransitMount, ref.KeyName)
 
 	// Prepare request data
 	data := map[string]interface{}{
@@ -77,7 +99,10 @@ func (c *Client) DecryptDataKey(ciphertext string) (*DataKey, error) {
 	}
 
 	// Request decryption from Vault
-	secret, err := c.client.Logical().Write(path, data)
+	start := time.Now()
+	secret, err := c.write(context.Background(), ref.Namespace, path, data)
+	metrics.ObserveVaultRequest(metrics.EndpointDecrypt, start, err)
+	c.reach.record(err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decrypt data key: %w", err)
 	}
@@ -0,0 +1,52 @@
+package vault
+
+import (
+	"github.com/hashicorp/vault/api"
+)
+
+// KeyRef identifies a Vault Transit key. Empty fields fall back to the
+// client's configured namespace, transit mount and key name.
+type KeyRef struct {
+	Namespace    string
+	TransitMount string
+	KeyName      string
+}
+
+// KeyRef returns the transit key this client is configured for
+func (c *Client) KeyRef() KeyRef {
+	return KeyRef{
+		Namespace:    c.client.Namespace(),
+		TransitMount: c.config.TransitMount,
+		KeyName:      c.config.KeyName,
+	}
+}
+
+// Namespace returns the Vault namespace requests are sent to (empty for root)
+func (c *Client) Namespace() string {
+	return c.client.Namespace()
+}
+
+// resolve fills empty fields of ref from the client configuration
+func (c *Client) resolve(ref KeyRef) KeyRef {
+	configured := c.KeyRef()
+
+	if ref.TransitMount == "" {
+		ref.TransitMount = configured.TransitMount
+	}
+	if ref.KeyName == "" {
+		ref.KeyName = configured.KeyName
+	}
+	if ref.Namespace == "" {
+		ref.Namespace = configured.Namespace
+	}
+
+	return ref
+}
+
+// apiClientFor returns the API client to use for requests in namespace
+func (c *Client) apiClientFor(namespace string) *api.Client {
+	if namespace == "" || namespace == c.client.Namespace() {
+		return c.client
+	}
+	return c.client.WithNamespace(namespace)
+}
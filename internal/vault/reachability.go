@@ -0,0 +1,65 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// reachability tracks whether data key requests are reaching Vault
+type reachability struct {
+	mu           sync.Mutex
+	failingSince time.Time
+}
+
+// record notes the outcome of a Vault request. Errors Vault answered with a
+// client error (e.g. permission denied) prove Vault is reachable.
+func (r *reachability) record(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err == nil || !isUnreachable(err) {
+		r.failingSince = time.Time{}
+		return
+	}
+	if r.failingSince.IsZero() {
+		r.failingSince = time.Now()
+	}
+}
+
+// since returns when requests started failing, or the zero time
+func (r *reachability) since() time.Time {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failingSince
+}
+
+// isUnreachable reports whether err means Vault could not serve the request:
+// a transport error, or a server error such as 503 while sealed
+func isUnreachable(err error) bool {
+	var respErr *api.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// UnreachableSince returns when data key requests started failing to reach
+// Vault, or the zero time if the last request (or health check) succeeded
+func (c *Client) UnreachableSince() time.Time {
+	return c.reach.since()
+}
+
+// LookupToken checks that the client token is valid by looking it up. With
+// Vault Agent the agent's auto-auth token is used.
+func (c *Client) LookupToken(ctx context.Context) error {
+	if _, err := c.client.Auth().Token().LookupSelfWithContext(ctx); err != nil {
+		return fmt.Errorf("token lookup failed: %w", err)
+	}
+	return nil
+}
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"time"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/metrics"
 )
 
 // RewrapDataKey re-wraps an encrypted DEK with the latest Vault Transit key version.
@@ -17,18 +20,28 @@ import (
 //
 // The file content itself is NOT re-encrypted - only the DEK in the .key file is updated.
 func (c *Client) RewrapDataKey(ctx context.Context, ciphertext string) (string, error) {
+	return c.RewrapDataKeyWithKey(ctx, KeyRef{}, ciphertext)
+}
+
+// RewrapDataKeyWithKey re-wraps an encrypted DEK with the latest version of
+// the given transit key, which may differ from the configured one.
+func (c *Client) RewrapDataKeyWithKey(ctx context.Context, ref KeyRef, ciphertext string) (string, error) {
 	if ciphertext == "" {
 		return "", fmt.Errorf("ciphertext cannot be empty")
 	}
 
+	ref = c.resolve(ref)
+
 	// Prepare request
-	path := fmt.Sprintf("%s/rewrap/%s", c.config.TransitMount, c.config.KeyName)
+	path := fmt.Sprintf("%s/rewrap/%s", ref.TransitMount, ref.KeyName)
 	data := map[string]interface{}{
 		"ciphertext": ciphertext,
 	}
 
 	// Make API call
-	secret, err := c.client.Logical().WriteWithContext(ctx, path, data)
+	start := time.Now()
+	secret, err := c.write(ctx, ref.Namespace, path, data)
+	metrics.ObserveVaultRequest(metrics.EndpointRewrap, start, err)
 	if err != nil {
 		return "", fmt.Errorf("vault rewrap failed: %w", err)
 	}
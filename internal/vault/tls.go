@@ -0,0 +1,37 @@
+package vault
+
+import (
+	"github.com/hashicorp/vault/api"
+)
+
+// apiTLSConfig builds the API client TLS settings from the tls block. With
+// cert auth the client certificate is presented during the TLS handshake, so
+// the auth block's certificate is used when the tls block sets none. It
+// returns nil when there is nothing to configure, leaving the VAULT_CACERT
+// style environment variables in effect.
+func (cfg *Config) apiTLSConfig() *api.TLSConfig {
+	var tlsCfg *api.TLSConfig
+
+	if t := cfg.TLS; t != nil {
+		tlsCfg = &api.TLSConfig{
+			CACert:        t.CACert,
+			CAPath:        t.CAPath,
+			ClientCert:    t.ClientCert,
+			ClientKey:     t.ClientKey,
+			TLSServerName: t.TLSServerName,
+			Insecure:      t.TLSSkipVerify,
+		}
+	}
+
+	if cfg.Auth != nil && cfg.Auth.Method == "cert" && cfg.Auth.Cert != nil {
+		if tlsCfg == nil {
+			tlsCfg = &api.TLSConfig{}
+		}
+		if tlsCfg.ClientCert == "" {
+			tlsCfg.ClientCert = cfg.Auth.Cert.ClientCert
+			tlsCfg.ClientKey = cfg.Auth.Cert.ClientKey
+		}
+	}
+
+	return tlsCfg
+}
@@ -0,0 +1,243 @@
+package vault
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+)
+
+// testCertsDir holds the certificates created by generate-certs.sh
+const testCertsDir = "../../scripts/test-certs"
+
+// testCerts are the CA and client certificate used for cert auth tests
+type testCerts struct {
+	CACert     string
+	ClientCert string
+	ClientKey  string
+}
+
+// loadTestCerts returns the certificates from scripts/test-certs. When the
+// script has not been run, an equivalent CA and client certificate are
+// generated in a temporary directory.
+func loadTestCerts(t *testing.T) testCerts {
+	t.Helper()
+
+	certs := testCerts{
+		CACert:     filepath.Join(testCertsDir, "ca.crt"),
+		ClientCert: filepath.Join(testCertsDir, "client.crt"),
+		ClientKey:  filepath.Join(testCertsDir, "client-key.pem"),
+	}
+	if _, err := os.Stat(certs.ClientKey); err == nil {
+		return certs
+	}
+
+	dir := t.TempDir()
+	certs = testCerts{
+		CACert:     filepath.Join(dir, "ca.crt"),
+		ClientCert: filepath.Join(dir, "client.crt"),
+		ClientKey:  filepath.Join(dir, "client-key.pem"),
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{Organization: []string{"TestOrg"}, CommonName: "TestOrg-CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	writePEM(t, certs.CACert, "CERTIFICATE", caDER)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{Organization: []string{"TestOrg"}, CommonName: "file-encryptor.example.local"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, caTemplate, &clientKey.PublicKey, caKey)
+	require.NoError(t, err)
+	writePEM(t, certs.ClientCert, "CERTIFICATE", clientDER)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(clientKey)
+	require.NoError(t, err)
+	writePEM(t, certs.ClientKey, "PRIVATE KEY", keyDER)
+
+	return certs
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(path, data, 0600))
+}
+
+// serverCAFile writes the TLS test server's self-signed certificate so it
+// can be used as ca_cert
+func serverCAFile(t *testing.T, server *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "server-ca.crt")
+	writePEM(t, path, "CERTIFICATE", server.Certificate().Raw)
+	return path
+}
+
+func healthyHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"initialized": true,
+		"sealed":      false,
+	})
+}
+
+func TestNewClient_TLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(healthyHandler))
+	defer server.Close()
+
+	caCert := serverCAFile(t, server)
+
+	tests := []struct {
+		name    string
+		tls     *config.TLSConfig
+		wantErr string
+	}{
+		{
+			name:    "unknown authority",
+			tls:     nil,
+			wantErr: "certificate",
+		},
+		{
+			name: "ca_cert",
+			tls:  &config.TLSConfig{CACert: caCert},
+		},
+		{
+			name: "ca_path",
+			tls:  &config.TLSConfig{CAPath: filepath.Dir(caCert)},
+		},
+		{
+			name: "tls_server_name",
+			tls:  &config.TLSConfig{CACert: caCert, TLSServerName: "example.com"},
+		},
+		{
+			name:    "wrong tls_server_name",
+			tls:     &config.TLSConfig{CACert: caCert, TLSServerName: "vault.invalid"},
+			wantErr: "vault.invalid",
+		},
+		{
+			name: "tls_skip_verify",
+			tls:  &config.TLSConfig{TLSSkipVerify: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(&Config{
+				AgentAddress: server.URL,
+				TransitMount: "transit",
+				KeyName:      "test-key",
+				TLS:          tt.tls,
+			})
+			require.NoError(t, err)
+
+			err = client.HealthWithRetry(0, 0)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestNewClient_TLS_IncompleteClientCert(t *testing.T) {
+	certs := loadTestCerts(t)
+
+	_, err := NewClient(&Config{
+		AgentAddress: "https://127.0.0.1:8200",
+		TransitMount: "transit",
+		KeyName:      "test-key",
+		TLS:          &config.TLSConfig{ClientCert: certs.ClientCert},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to configure TLS")
+}
+
+func TestNewClient_CertAuth(t *testing.T) {
+	certs := loadTestCerts(t)
+
+	caPEM, err := os.ReadFile(certs.CACert)
+	require.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	require.True(t, clientCAs.AppendCertsFromPEM(caPEM))
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/cert/login" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		// Like Vault, identify the caller by the verified client certificate
+		require.NotEmpty(t, r.TLS.VerifiedChains)
+		assert.Equal(t, "file-encryptor.example.local", r.TLS.PeerCertificates[0].Subject.CommonName)
+
+		var req map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "file-encryptor", req["name"])
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token": "test-cert-token",
+			},
+		})
+	}))
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+		MinVersion: tls.VersionTLS12,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	client, err := NewClient(&Config{
+		AgentAddress: server.URL,
+		TransitMount: "transit",
+		KeyName:      "test-key",
+		TLS:          &config.TLSConfig{CACert: serverCAFile(t, server)},
+		Auth: &config.AuthConfig{
+			Method: "cert",
+			Cert: &config.CertAuthConfig{
+				ClientCert: certs.ClientCert,
+				ClientKey:  certs.ClientKey,
+				Name:       "file-encryptor",
+			},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "test-cert-token", client.client.Token())
+}
@@ -0,0 +1,285 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+	"github.com/hashicorp/vault/api"
+)
+
+// authEvent tags auth log entries so they are easy to find in the audit log
+const authEvent = "vault_auth"
+
+// maxReloginInterval caps the delay between failed re-authentication attempts
+const maxReloginInterval = time.Minute
+
+// Reasons for re-authenticating
+var (
+	errTokenExpiring = errors.New("token reached its max TTL or is not renewable")
+	errTokenRejected = errors.New("token was rejected by vault")
+)
+
+// tokenLifecycle tracks the login of the configured auth method so the
+// token can be renewed and, when that is no longer possible, replaced
+type tokenLifecycle struct {
+	mu      sync.Mutex
+	secret  *api.Secret   // auth response of the last login
+	managed bool          // true while ManageToken is running
+	paused  chan struct{} // non-nil during re-authentication, closed when done
+
+	// relogin asks ManageToken to re-authenticate now
+	relogin chan struct{}
+}
+
+func (t *tokenLifecycle) setSecret(secret *api.Secret) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.secret = secret
+}
+
+func (t *tokenLifecycle) current() *api.Secret {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.secret
+}
+
+// start marks the token as managed; it returns false if there is no login to
+// manage or another ManageToken is already running
+func (t *tokenLifecycle) start() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.secret == nil || t.managed {
+		return false
+	}
+	t.managed = true
+	t.relogin = make(chan struct{}, 1)
+	return true
+}
+
+func (t *tokenLifecycle) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.managed = false
+	t.resumeLocked()
+}
+
+func (t *tokenLifecycle) isManaged() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.managed
+}
+
+// pause makes new requests wait until resume is called
+func (t *tokenLifecycle) pause() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.paused == nil {
+		t.paused = make(chan struct{})
+	}
+}
+
+func (t *tokenLifecycle) resume() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.resumeLocked()
+}
+
+func (t *tokenLifecycle) resumeLocked() {
+	if t.paused != nil {
+		close(t.paused)
+		t.paused = nil
+	}
+}
+
+// requestRelogin pauses requests and asks ManageToken to re-authenticate
+func (t *tokenLifecycle) requestRelogin() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.managed {
+		return
+	}
+	if t.paused == nil {
+		t.paused = make(chan struct{})
+	}
+	select {
+	case t.relogin <- struct{}{}:
+	default:
+	}
+}
+
+// wait blocks while re-authentication is in progress, for at most timeout
+func (t *tokenLifecycle) wait(ctx context.Context, timeout time.Duration) error {
+	t.mu.Lock()
+	paused := t.paused
+	t.mu.Unlock()
+
+	if paused == nil {
+		return nil
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-paused:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return fmt.Errorf("timed out after %s waiting for vault re-authentication", timeout)
+	}
+}
+
+// ManageToken keeps the token of login-based auth methods (approle,
+// kubernetes, jwt and cert) valid until ctx is cancelled. Renewable tokens
+// are renewed; when renewal fails, the token reaches its max TTL or Vault
+// rejects it, the configured login is repeated. Requests made while logging
+// in again wait for the new token instead of failing. Static tokens and
+// Vault Agent tokens are not managed and ManageToken returns immediately.
+func (c *Client) ManageToken(ctx context.Context, log logger.Logger) {
+	if !c.token.start() {
+		return
+	}
+	defer c.token.stop()
+
+	method := c.config.Auth.Method
+	secret := c.token.current()
+	log.Info("Managing Vault token lifecycle",
+		"event", authEvent,
+		"method", method,
+		"ttl", tokenTTL(secret),
+		"renewable", secret.Auth.Renewable)
+
+	for {
+		reason := c.watchToken(ctx, log, secret)
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Info("Re-authenticating to Vault", "event", authEvent, "method", method, "reason", reason)
+		if secret = c.reauthenticate(ctx, log); secret == nil {
+			return
+		}
+	}
+}
+
+// watchToken renews secret's token until it can no longer be renewed or is
+// rejected, and returns why
+func (c *Client) watchToken(ctx context.Context, log logger.Logger, secret *api.Secret) error {
+	method := c.config.Auth.Method
+
+	// Tokens without a TTL never expire; only a rejection needs a new login
+	if secret.Auth.LeaseDuration == 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.token.relogin:
+			return errTokenRejected
+		}
+	}
+
+	watcher, err := c.client.NewLifetimeWatcher(&api.LifetimeWatcherInput{Secret: secret})
+	if err != nil {
+		return fmt.Errorf("failed to watch token: %w", err)
+	}
+	go watcher.Start()
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-c.token.relogin:
+			return errTokenRejected
+
+		case err := <-watcher.DoneCh():
+			if err != nil {
+				return fmt.Errorf("token renewal failed: %w", err)
+			}
+			return errTokenExpiring
+
+		case renewal := <-watcher.RenewCh():
+			log.Info("Vault token renewed", "event", authEvent, "method", method, "ttl", tokenTTL(renewal.Secret))
+		}
+	}
+}
+
+// reauthenticate repeats the configured login until it succeeds, pausing
+// requests meanwhile. It returns nil if ctx is cancelled first.
+func (c *Client) reauthenticate(ctx context.Context, log logger.Logger) *api.Secret {
+	method := c.config.Auth.Method
+
+	c.token.pause()
+	defer c.token.resume()
+
+	// Log in without the old token, which Vault may reject
+	c.client.ClearToken()
+
+	b := backoff.NewExponentialBackOff()
+	b.MaxInterval = maxReloginInterval
+	b.MaxElapsedTime = 0 // keep trying until ctx is cancelled
+
+	for {
+		err := c.login(c.config.Auth)
+		if err == nil {
+			secret := c.token.current()
+			log.Info("Re-authenticated to Vault", "event", authEvent, "method", method, "ttl", tokenTTL(secret))
+			return secret
+		}
+
+		delay := b.NextBackOff()
+		log.Error("Vault re-authentication failed", "event", authEvent, "method", method, "error", err, "retry_in", delay)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// write sends a write request in namespace. While the token is being
+// re-authenticated the request waits; if Vault rejects a managed token the
+// request triggers a re-login and is retried once with the new token.
+func (c *Client) write(ctx context.Context, namespace, path string, data map[string]interface{}) (*api.Secret, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.token.wait(ctx, c.config.Timeout); err != nil {
+			return nil, err
+		}
+
+		secret, err := c.apiClientFor(namespace).Logical().WriteWithContext(ctx, path, data)
+		if err == nil || attempt > 0 || !isPermissionDenied(err) || !c.token.isManaged() {
+			return secret, err
+		}
+
+		// Permission denied is usually a policy problem; only retry when the
+		// token itself is no longer valid
+		if c.LookupToken(ctx) == nil {
+			return secret, err
+		}
+		c.token.requestRelogin()
+	}
+}
+
+// isPermissionDenied reports whether err is a 403 response from Vault
+func isPermissionDenied(err error) bool {
+	var respErr *api.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusForbidden
+}
+
+// tokenTTL returns the lease duration of an auth response
+func tokenTTL(secret *api.Secret) time.Duration {
+	if secret == nil || secret.Auth == nil {
+		return 0
+	}
+	return time.Duration(secret.Auth.LeaseDuration) * time.Second
+}
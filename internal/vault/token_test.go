@@ -0,0 +1,184 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+)
+
+// tokenTestServer is a mock Vault that issues token-1, token-2, ... on each
+// approle login. Tokens listed in revoked are rejected.
+type tokenTestServer struct {
+	logins        atomic.Int32
+	leaseDuration int
+	revoked       map[string]bool
+	denyDataKey   bool
+}
+
+func (s *tokenTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.Header.Get("X-Vault-Token")
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.URL.Path == "/v1/auth/approle/login" {
+		n := s.logins.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{
+				"client_token":   fmt.Sprintf("token-%d", n),
+				"lease_duration": s.leaseDuration,
+				"renewable":      false,
+			},
+		})
+		return
+	}
+
+	if token == "" || s.revoked[token] {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1/auth/token/lookup-self":
+		_, _ = w.Write([]byte(`{"data":{"ttl":0}}`))
+	case "/v1/transit/datakey/plaintext/test-key":
+		if s.denyDataKey {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"plaintext":"YWJjZGVmZ2hpamtsbW5vcHFyc3R1dnd4eXoxMjM0NTY=","ciphertext":"vault:v1:abc"}}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTokenTestClient(t *testing.T, srv *tokenTestServer) *Client {
+	t.Helper()
+
+	server := httptest.NewServer(srv)
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(&Config{
+		AgentAddress: server.URL,
+		TransitMount: "transit",
+		KeyName:      "test-key",
+		Timeout:      5 * time.Second,
+		Auth: &config.AuthConfig{
+			Method: "approle",
+			AppRole: &config.AppRoleAuthConfig{
+				RoleID:   "role",
+				SecretID: "secret",
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "token-1", client.client.Token())
+
+	return client
+}
+
+func manageToken(t *testing.T, client *Client) {
+	t.Helper()
+
+	log, err := logger.New("error", "stderr")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.ManageToken(ctx, log)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	require.Eventually(t, client.token.isManaged, time.Second, 10*time.Millisecond)
+}
+
+func TestManageToken_ReloginAtMaxTTL(t *testing.T) {
+	srv := &tokenTestServer{leaseDuration: 1}
+	client := newTokenTestClient(t, srv)
+
+	manageToken(t, client)
+
+	// The non-renewable token expires, so the client logs in again
+	assert.Eventually(t, func() bool {
+		return srv.logins.Load() >= 2 && client.client.Token() != "token-1"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestManageToken_RejectedTokenRetriesRequest(t *testing.T) {
+	srv := &tokenTestServer{revoked: map[string]bool{"token-1": true}}
+	client := newTokenTestClient(t, srv)
+
+	manageToken(t, client)
+
+	dataKey, err := client.GenerateDataKey()
+	require.NoError(t, err)
+	assert.Equal(t, "vault:v1:abc", dataKey.Ciphertext)
+	assert.Equal(t, int32(2), srv.logins.Load())
+	assert.Equal(t, "token-2", client.client.Token())
+}
+
+func TestManageToken_PolicyDenialIsNotRetried(t *testing.T) {
+	srv := &tokenTestServer{denyDataKey: true}
+	client := newTokenTestClient(t, srv)
+
+	manageToken(t, client)
+
+	_, err := client.GenerateDataKey()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "permission denied")
+	assert.Equal(t, int32(1), srv.logins.Load(), "a valid token is not replaced")
+}
+
+func TestManageToken_NotManaged(t *testing.T) {
+	client, err := NewClient(&Config{
+		AgentAddress: "http://127.0.0.1:8200",
+		TransitMount: "transit",
+		KeyName:      "test-key",
+		Auth:         &config.AuthConfig{Method: "agent"},
+	})
+	require.NoError(t, err)
+
+	log, err := logger.New("error", "stderr")
+	require.NoError(t, err)
+
+	// Returns immediately: Vault Agent manages its own token
+	client.ManageToken(context.Background(), log)
+	assert.False(t, client.token.isManaged())
+}
+
+func TestTokenLifecycle_Wait(t *testing.T) {
+	var lifecycle tokenLifecycle
+	require.NoError(t, lifecycle.wait(context.Background(), time.Second))
+
+	lifecycle.pause()
+	err := lifecycle.wait(context.Background(), 10*time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "waiting for vault re-authentication")
+
+	done := make(chan error, 1)
+	go func() { done <- lifecycle.wait(context.Background(), 5*time.Second) }()
+
+	lifecycle.resume()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("wait did not return after resume")
+	}
+}
@@ -0,0 +1,156 @@
+//go:build linux
+
+package watcher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// closeWatcher reports files closed after being written (inotify
+// IN_CLOSE_WRITE), which fsnotify does not expose. It watches the same
+// directories as the fsnotify watcher.
+type closeWatcher struct {
+	fd     int
+	file   *os.File
+	events chan string
+	done   chan struct{}
+	closer sync.Once
+
+	mu   sync.Mutex
+	dirs map[int]string // watch descriptor -> directory
+	wds  map[string]int
+}
+
+// newCloseWatcher creates an inotify instance for close events
+func newCloseWatcher() (*closeWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create inotify instance: %w", err)
+	}
+
+	c := &closeWatcher{
+		fd: fd,
+		// Non-blocking, so Close interrupts a pending read
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan string),
+		done:   make(chan struct{}),
+		dirs:   map[int]string{},
+		wds:    map[string]int{},
+	}
+	go c.read()
+
+	return c, nil
+}
+
+// Events returns the paths of closed files; nil when close events are not
+// available
+func (c *closeWatcher) Events() <-chan string {
+	if c == nil {
+		return nil
+	}
+	return c.events
+}
+
+// Add watches a directory for files closed after writing
+func (c *closeWatcher) Add(dir string) error {
+	if c == nil {
+		return nil
+	}
+
+	wd, err := unix.InotifyAddWatch(c.fd, dir, unix.IN_CLOSE_WRITE|unix.IN_ONLYDIR)
+	if err != nil {
+		return fmt.Errorf("failed to watch %s for close events: %w", dir, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.dirs[wd] = dir
+	c.wds[dir] = wd
+	return nil
+}
+
+// Remove stops watching a directory
+func (c *closeWatcher) Remove(dir string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wd, ok := c.wds[dir]
+	if !ok {
+		return
+	}
+	delete(c.wds, dir)
+	delete(c.dirs, wd)
+	// Fails when the directory is already gone, which removes the watch too
+	_, _ = unix.InotifyRmWatch(c.fd, uint32(wd)) // #nosec G115 - watch descriptors are non-negative
+}
+
+// Close stops the watcher
+func (c *closeWatcher) Close() error {
+	if c == nil {
+		return nil
+	}
+
+	var err error
+	c.closer.Do(func() {
+		close(c.done)
+		err = c.file.Close()
+	})
+	return err
+}
+
+// read delivers close events until the watcher is closed. A queue overflow
+// loses events, and the files concerned wait for their quiet period instead.
+func (c *closeWatcher) read() {
+	buf := make([]byte, 64*1024)
+
+	for {
+		n, err := c.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			// struct inotify_event: wd, mask, cookie, len, then the name
+			wd := int(int32(binary.NativeEndian.Uint32(buf[offset:]))) // #nosec G115 - inotify_event.wd is an int32
+			mask := binary.NativeEndian.Uint32(buf[offset+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[offset+12:]))
+
+			start := offset + unix.SizeofInotifyEvent
+			offset = start + nameLen
+			if offset > n {
+				break
+			}
+			name := strings.TrimRight(string(buf[start:offset]), "\x00")
+
+			c.mu.Lock()
+			dir, ok := c.dirs[wd]
+			if mask&unix.IN_IGNORED != 0 && ok {
+				delete(c.dirs, wd)
+				delete(c.wds, dir)
+			}
+			c.mu.Unlock()
+
+			if !ok || mask&unix.IN_CLOSE_WRITE == 0 || name == "" {
+				continue
+			}
+
+			select {
+			case c.events <- filepath.Join(dir, name):
+			case <-c.done:
+				return
+			}
+		}
+	}
+}
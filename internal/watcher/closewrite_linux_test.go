@@ -0,0 +1,53 @@
+//go:build linux
+
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloseWatcher(t *testing.T) {
+	c, err := newCloseWatcher()
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+
+	dir := t.TempDir()
+	require.NoError(t, c.Add(dir))
+
+	// Opening without writing is not reported
+	file := filepath.Join(dir, "report.csv")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+	data, err := os.ReadFile(file) // #nosec G304 - test file
+	require.NoError(t, err)
+	require.Equal(t, "data", string(data))
+
+	select {
+	case path := <-c.Events():
+		assert.Equal(t, file, path)
+	case <-time.After(5 * time.Second):
+		t.Fatal("close event not reported")
+	}
+
+	select {
+	case path := <-c.Events():
+		t.Fatalf("unexpected close event for %s", path)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	c.Remove(dir)
+	require.NoError(t, os.WriteFile(file, []byte("more"), 0600))
+	select {
+	case path := <-c.Events():
+		t.Fatalf("close event after Remove for %s", path)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	require.NoError(t, c.Close())
+	require.NoError(t, c.Close())
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+
+package watcher
+
+// closeWatcher reports files closed after being written. Only Linux reports
+// close events, so elsewhere files are stable after their quiet period.
+type closeWatcher struct{}
+
+// newCloseWatcher returns nil: close events are not available
+func newCloseWatcher() (*closeWatcher, error) {
+	return nil, nil
+}
+
+// Events returns nil: no close events are reported
+func (c *closeWatcher) Events() <-chan string {
+	return nil
+}
+
+// Add does nothing
+func (c *closeWatcher) Add(dir string) error {
+	return nil
+}
+
+// Remove does nothing
+func (c *closeWatcher) Remove(dir string) {}
+
+// Close does nothing
+func (c *closeWatcher) Close() error {
+	return nil
+}
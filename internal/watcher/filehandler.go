@@ -1,8 +1,10 @@
 package watcher
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
@@ -11,6 +13,7 @@ import (
 // FileHandler manages post-processing file operations
 type FileHandler struct {
 	logger             logger.Logger
+	sourceDir          string
 	sourceFileBehavior string
 	archiveDir         string
 	failedDir          string
@@ -19,6 +22,7 @@ type FileHandler struct {
 
 // FileHandlerConfig holds file handler configuration
 type FileHandlerConfig struct {
+	SourceDir          string // Source root; nested files keep their relative path when moved
 	SourceFileBehavior string
 	ArchiveDir         string
 	FailedDir          string
@@ -38,6 +42,7 @@ func NewFileHandler(cfg *FileHandlerConfig, log logger.Logger) (*FileHandler, er
 
 	return &FileHandler{
 		logger:             log,
+		sourceDir:          cfg.SourceDir,
 		sourceFileBehavior: cfg.SourceFileBehavior,
 		archiveDir:         cfg.ArchiveDir,
 		failedDir:          cfg.FailedDir,
@@ -47,6 +52,7 @@ func NewFileHandler(cfg *FileHandlerConfig, log logger.Logger) (*FileHandler, er
 
 // UpdateConfig updates the file handler's configuration
 func (fh *FileHandler) UpdateConfig(cfg *FileHandlerConfig) {
+	fh.sourceDir = cfg.SourceDir
 	fh.sourceFileBehavior = cfg.SourceFileBehavior
 	fh.archiveDir = cfg.ArchiveDir
 	fh.failedDir = cfg.FailedDir
@@ -66,15 +72,20 @@ func (fh *FileHandler) UpdateConfig(cfg *FileHandlerConfig) {
 func (fh *FileHandler) HandleSourceFile(sourcePath string) {
 	switch fh.sourceFileBehavior {
 	case "delete":
-		if err := os.Remove(sourcePath); err != nil {
+		// Directories encrypted as one archive are removed with their files
+		remove := os.Remove
+		if info, err := os.Stat(sourcePath); err == nil && info.IsDir() {
+			remove = os.RemoveAll
+		}
+
+		if err := remove(sourcePath); err != nil {
 			fh.logger.Error("Failed to delete source file", "file", sourcePath, "error", err)
 		} else {
 			fh.logger.Info("Deleted source file", "file", sourcePath)
 		}
 
 	case "archive":
-		fileName := filepath.Base(sourcePath)
-		archivePath := filepath.Join(fh.archiveDir, fileName)
+		archivePath := fh.targetPath(fh.archiveDir, sourcePath)
 
 		if err := os.Rename(sourcePath, archivePath); err != nil {
 			fh.logger.Error("Failed to archive source file", "file", sourcePath, "error", err)
@@ -82,19 +93,26 @@ func (fh *FileHandler) HandleSourceFile(sourcePath string) {
 			fh.logger.Info("Archived source file", "file", sourcePath, "archive", archivePath)
 		}
 
+	case "keep":
+		fh.logger.Debug("Kept source file", "file", sourcePath)
+
 	default:
 		fh.logger.Error("Unknown source file behavior", "behavior", fh.sourceFileBehavior)
 	}
 }
 
+// keepsSource reports whether source files stay in place after processing
+func (fh *FileHandler) keepsSource() bool {
+	return fh.sourceFileBehavior == "keep"
+}
+
 // MoveToFailed moves a file to the failed directory
 func (fh *FileHandler) MoveToFailed(sourcePath string) {
 	if fh.failedDir == "" {
 		return
 	}
 
-	fileName := filepath.Base(sourcePath)
-	failedPath := filepath.Join(fh.failedDir, fileName)
+	failedPath := fh.targetPath(fh.failedDir, sourcePath)
 
 	if err := os.Rename(sourcePath, failedPath); err != nil {
 		fh.logger.Error("Failed to move file to failed directory", "file", sourcePath, "error", err)
@@ -109,12 +127,92 @@ func (fh *FileHandler) MoveToDLQ(item *model.Item) {
 		return
 	}
 
-	fileName := filepath.Base(item.SourcePath)
-	dlqPath := filepath.Join(fh.dlqDir, fileName)
+	dlqPath := fh.targetPath(fh.dlqDir, item.SourcePath)
 
 	if err := os.Rename(item.SourcePath, dlqPath); err != nil {
 		fh.logger.Error("Failed to move file to DLQ", "file", item.SourcePath, "error", err)
 	} else {
 		fh.logger.Info("Moved file to DLQ", "file", item.SourcePath, "dlq", dlqPath)
 	}
+
+	// A directory encrypted as one archive keeps its ready marker
+	if item.Archive != "" {
+		marker := readyMarker(item)
+		if err := os.Rename(marker, fh.targetPath(fh.dlqDir, marker)); err != nil {
+			fh.logger.Error("Failed to move ready marker to DLQ", "file", marker, "error", err)
+		}
+	}
+}
+
+// RestoreSource moves the source file of an item back from the dead letter
+// or failed directory of its rule, so that the item can be processed again.
+// It returns where the file was found, or "" if it was already in place.
+func RestoreSource(rules []RuleConfig, item *model.Item) (string, error) {
+	if _, err := os.Stat(item.SourcePath); err == nil {
+		return "", nil
+	}
+
+	rule, ok := ruleForItem(rules, item)
+	if !ok {
+		return "", fmt.Errorf("no %s rule for item %s", item.Operation, item.ID)
+	}
+
+	for _, dir := range []string{rule.DLQDir, rule.FailedDir} {
+		if dir == "" {
+			continue
+		}
+
+		movedPath := relocatedPath(rule.SourceDir, dir, item.SourcePath)
+		if _, err := os.Stat(movedPath); err != nil {
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(item.SourcePath), 0750); err != nil { // #nosec G301 - mirrors source directory layout
+			return "", fmt.Errorf("failed to create source directory: %w", err)
+		}
+		if err := os.Rename(movedPath, item.SourcePath); err != nil {
+			return "", fmt.Errorf("failed to restore source file: %w", err)
+		}
+
+		// The ready marker of a directory is not needed to process it again,
+		// but restoring it keeps the source tree as it was
+		if item.Archive != "" {
+			_ = os.Rename(movedPath+readyMarkerSuffix, readyMarker(item))
+		}
+		return movedPath, nil
+	}
+
+	return "", fmt.Errorf("source file %s not found in the dead letter or failed directory", item.SourcePath)
+}
+
+// targetPath returns where sourcePath should be moved inside baseDir,
+// creating the subdirectory it needs
+func (fh *FileHandler) targetPath(baseDir, sourcePath string) string {
+	target := relocatedPath(fh.sourceDir, baseDir, sourcePath)
+
+	if targetDir := filepath.Dir(target); targetDir != filepath.Clean(baseDir) {
+		if err := os.MkdirAll(targetDir, 0750); err != nil { // #nosec G301 - mirrors source directory layout
+			fh.logger.Error("Failed to create directory", "dir", targetDir, "error", err)
+		}
+	}
+
+	return target
+}
+
+// relocatedPath returns where sourcePath goes inside baseDir. Files in
+// subdirectories of the source directory (recursive mode) keep their relative
+// path so that files with the same name in different folders do not collide.
+func relocatedPath(sourceDir, baseDir, sourcePath string) string {
+	fileName := filepath.Base(sourcePath)
+
+	if sourceDir == "" {
+		return filepath.Join(baseDir, fileName)
+	}
+
+	rel, err := filepath.Rel(sourceDir, filepath.Dir(sourcePath))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Join(baseDir, fileName)
+	}
+
+	return filepath.Join(baseDir, rel, fileName)
 }
@@ -0,0 +1,78 @@
+package watcher
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// FileFilter decides which files in a source directory are processed,
+// based on include and exclude glob patterns.
+//
+// Patterns use doublestar syntax ("**" matches any number of directories).
+// A pattern without a "/" is matched against the file name only, so "*.swp"
+// excludes swap files at any depth; a pattern with a "/" is matched against
+// the path relative to the source directory (e.g. "reports/**/*.csv").
+type FileFilter struct {
+	include []string
+	exclude []string
+}
+
+// NewFileFilter creates a filter from include and exclude patterns.
+// An empty include list includes every file.
+func NewFileFilter(include, exclude []string) (*FileFilter, error) {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if pattern == "" || !doublestar.ValidatePattern(pattern) {
+			return nil, fmt.Errorf("invalid glob pattern '%s'", pattern)
+		}
+	}
+
+	return &FileFilter{
+		include: include,
+		exclude: exclude,
+	}, nil
+}
+
+// Match reports whether the file at relPath (relative to the source
+// directory) should be processed. When the file is skipped, rule describes
+// the rule that matched.
+func (f *FileFilter) Match(relPath string) (bool, string) {
+	if f == nil {
+		return true, ""
+	}
+
+	relPath = filepath.ToSlash(relPath)
+
+	// Exclusions take precedence over inclusions
+	for _, pattern := range f.exclude {
+		if matchPattern(pattern, relPath) {
+			return false, "exclude " + pattern
+		}
+	}
+
+	if len(f.include) == 0 {
+		return true, ""
+	}
+
+	for _, pattern := range f.include {
+		if matchPattern(pattern, relPath) {
+			return true, ""
+		}
+	}
+
+	return false, "no include pattern matched"
+}
+
+// matchPattern matches a single pattern against a slash-separated relative path
+func matchPattern(pattern, relPath string) bool {
+	target := relPath
+	if !strings.Contains(pattern, "/") {
+		target = path.Base(relPath)
+	}
+
+	matched, err := doublestar.Match(pattern, target)
+	return err == nil && matched
+}
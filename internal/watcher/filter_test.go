@@ -0,0 +1,60 @@
+package watcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileFilter_Match(t *testing.T) {
+	filter, err := NewFileFilter(
+		[]string{"*.csv", "reports/**/*.xlsx"},
+		[]string{"*.tmp", "~$*", "**/drafts/**"},
+	)
+	require.NoError(t, err)
+
+	tests := []struct {
+		relPath string
+		want    bool
+		rule    string
+	}{
+		{"data.csv", true, ""},
+		{"2024/01/data.csv", true, ""},
+		{"reports/q1/summary.xlsx", true, ""},
+		{"summary.xlsx", false, "no include pattern matched"},
+		{"notes.txt", false, "no include pattern matched"},
+		{"upload.tmp", false, "exclude *.tmp"},
+		{"~$data.csv", false, "exclude ~$*"},
+		{"team/drafts/data.csv", false, "exclude **/drafts/**"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.relPath, func(t *testing.T) {
+			got, rule := filter.Match(tt.relPath)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.rule, rule)
+		})
+	}
+}
+
+func TestFileFilter_NoPatternsMatchesEverything(t *testing.T) {
+	filter, err := NewFileFilter(nil, nil)
+	require.NoError(t, err)
+
+	ok, _ := filter.Match("any/file.bin")
+	assert.True(t, ok)
+
+	var nilFilter *FileFilter
+	ok, _ = nilFilter.Match("any/file.bin")
+	assert.True(t, ok)
+}
+
+func TestNewFileFilter_InvalidPattern(t *testing.T) {
+	_, err := NewFileFilter([]string{"[abc"}, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid glob pattern")
+
+	_, err = NewFileFilter(nil, []string{""})
+	assert.Error(t, err)
+}
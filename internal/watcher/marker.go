@@ -0,0 +1,184 @@
+package watcher
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/metrics"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
+)
+
+// markerCheckInterval is how often marker-triggered source trees are checked
+// for orphan markers and files still waiting for one
+const markerCheckInterval = 1 * time.Minute
+
+// Kinds of files reported by checkMarkers, used as the kind label of
+// metrics.MarkerWaiting
+const (
+	waitingFile   = "file"
+	waitingMarker = "marker"
+)
+
+// markerTrigger reports whether files of r wait for a marker
+func (r *route) markerTrigger() bool {
+	return len(r.markerSuffixes) > 0
+}
+
+// markerTarget returns what a marker file of r marks: data.csv.ready marks
+// data.csv, and reports.ready marks the directory reports/ of a route that
+// encrypts directories as archives
+func (r *route) markerTarget(path string) (string, bool) {
+	suffixes := r.markerSuffixes
+	if r.archiveCompression != "" {
+		suffixes = append(suffixes[:len(suffixes):len(suffixes)], readyMarkerSuffix)
+	}
+
+	base := filepath.Base(path)
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(base, suffix) && base != suffix {
+			return strings.TrimSuffix(path, suffix), true
+		}
+	}
+	return "", false
+}
+
+// findMarker returns the marker of a file of r, if one exists
+func (r *route) findMarker(path string) (string, bool) {
+	for _, suffix := range r.markerSuffixes {
+		if info, err := os.Stat(path + suffix); err == nil && !info.IsDir() {
+			return path + suffix, true
+		}
+	}
+	return "", false
+}
+
+// isSourceFile reports whether a file in a source directory is processed by
+// the operation: decryption takes .enc files, encryption everything but the
+// files it writes itself
+func isSourceFile(operation model.OperationType, path string) bool {
+	if operation == model.OperationDecrypt {
+		return strings.HasSuffix(path, ".enc")
+	}
+	return !strings.HasSuffix(path, ".enc") && !strings.HasSuffix(path, ".key") && !strings.HasSuffix(path, ".sha256") &&
+		!isPublishArtifact(path)
+}
+
+// handleMarkerLocked queues what a marker file marks: a directory to be
+// encrypted as one archive, or a file of a marker-triggered route. It
+// reports whether an item was queued; the caller must hold w.mu.
+func (w *Watcher) handleMarkerLocked(r *route, markerPath, target, destDir string) bool {
+	info, err := os.Stat(target)
+	if r.archiveCompression != "" && strings.HasSuffix(markerPath, readyMarkerSuffix) &&
+		(!r.markerTrigger() || (err == nil && info.IsDir())) {
+		return w.queueMarkedDirLocked(r, markerPath, destDir)
+	}
+
+	if err != nil || info.IsDir() {
+		// The file may still arrive; markers left waiting are reported
+		w.logger.Debug("Skipping marker without file", "marker", markerPath, "rule", r.rule)
+		return false
+	}
+
+	return w.queueMarkedFileLocked(r, target, markerPath, destDir)
+}
+
+// queueMarkedFileLocked queues a file whose marker appeared and consumes the
+// marker. The marker says the file is complete, so there is no stability
+// wait. It reports whether an item was queued; the caller must hold w.mu.
+func (w *Watcher) queueMarkedFileLocked(r *route, filePath, markerPath, destDir string) bool {
+	if !isSourceFile(r.operation, filePath) || !w.matchesFilterLocked(r, filePath) {
+		return false
+	}
+
+	// A marker written again for a file that needs no processing is spent
+	if w.alreadyProcessed(r, filePath) || w.alreadyQueued(filePath) {
+		w.consumeMarker(markerPath)
+		return false
+	}
+
+	// The key file may still be on its way. Waiting for it here would hold
+	// w.mu, so the file is left to the stability tracker, whose callback
+	// queueStableFile waits for the key without the lock.
+	keyPath := ""
+	if r.operation == model.OperationDecrypt {
+		var ok bool
+		if keyPath, ok = findDecryptionKey(filePath, 1); !ok {
+			if w.tracker.Track(filePath) {
+				w.logger.Debug("Marked file waiting for its key file", "file", filePath, "rule", r.rule)
+			}
+			return false
+		}
+	}
+
+	return w.enqueueFile(r, filePath, destDir, keyPath, markerPath)
+}
+
+// consumeMarker removes a marker once its file has been queued
+func (w *Watcher) consumeMarker(markerPath string) {
+	if err := os.Remove(markerPath); err != nil && !os.IsNotExist(err) {
+		w.logger.Error("Failed to remove marker file", "marker", markerPath, "error", err)
+	}
+}
+
+// checkMarkers reports markers whose file never arrived and files whose
+// marker never did, once they have waited longer than the marker timeout of
+// their rule. Each is logged once; the counts per rule are exported as
+// metrics.MarkerWaiting.
+func (w *Watcher) checkMarkers() {
+	w.mu.RLock()
+	routes := w.routes
+	w.mu.RUnlock()
+
+	now := time.Now()
+	reported := map[string]bool{}
+	report := func(r *route, path, msg string, age time.Duration) {
+		reported[path] = true
+		if !w.reportedMarkers[path] {
+			w.logger.Error(msg, "file", path, "operation", r.operation, "rule", r.rule, "age", age.Round(time.Second))
+		}
+	}
+
+	for _, r := range routes {
+		if !r.markerTrigger() {
+			continue
+		}
+
+		counts := map[string]int{}
+		w.walkRouteTree(context.Background(), r, func(path, _ string, d fs.DirEntry) {
+			info, err := d.Info()
+			if err != nil {
+				return
+			}
+			age := now.Sub(info.ModTime())
+			if age < r.markerTimeout {
+				return
+			}
+
+			if target, ok := r.markerTarget(path); ok {
+				if _, err := os.Stat(target); os.IsNotExist(err) {
+					counts[waitingMarker]++
+					report(r, path, "Marker file has no file to process", age)
+				}
+				return
+			}
+
+			w.mu.RLock()
+			matches := isSourceFile(r.operation, path) && w.matchesFilterLocked(r, path)
+			w.mu.RUnlock()
+			if matches && !w.alreadyProcessed(r, path) && !w.alreadyQueued(path) {
+				counts[waitingFile]++
+				report(r, path, "File is still waiting for its marker", age)
+			}
+		})
+
+		for _, kind := range []string{waitingFile, waitingMarker} {
+			metrics.MarkerWaiting.WithLabelValues(string(r.operation), r.rule, kind).Set(float64(counts[kind]))
+		}
+	}
+
+	w.reportedMarkers = reported
+}
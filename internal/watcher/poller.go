@@ -0,0 +1,206 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+)
+
+const (
+	// pollFullScanEvery is how often, in polls, every file is stat'ed to
+	// find files modified in place; other polls only list directories whose
+	// modification time changed
+	pollFullScanEvery = 10
+
+	// pollRacyWindow is the modification time granularity assumed for
+	// network file systems: a directory changed this close to its last
+	// listing is listed again, as a later change may not move its
+	// modification time
+	pollRacyWindow = 2 * time.Second
+)
+
+// poller finds the changes in a source tree by listing it, for NFS, SMB and
+// FUSE mounts where changes made by other hosts raise no events. Entries are
+// only created, removed or renamed when the modification time of their
+// directory changes, so unchanged directories are not listed again; files
+// are stat'ed when they appear and on every pollFullScanEvery'th poll.
+type poller struct {
+	root      string
+	recursive bool
+	logger    logger.Logger
+
+	dirs  map[string]*polledDir
+	polls int
+}
+
+// polledDir is a directory as seen by the last poll
+type polledDir struct {
+	modTime time.Time
+	listed  time.Time
+	files   map[string]polledFile // by name
+	subdirs []string
+}
+
+// polledFile is the metadata of a file as seen by the last poll
+type polledFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// pollKey identifies a running poller
+type pollKey struct {
+	dir       string
+	recursive bool
+	interval  time.Duration
+}
+
+// newPoller creates a poller for the tree at root
+func newPoller(root string, recursive bool, log logger.Logger) *poller {
+	return &poller{
+		root:      root,
+		recursive: recursive,
+		logger:    log,
+		dirs:      map[string]*polledDir{},
+	}
+}
+
+// poll lists the tree and returns its changes since the previous poll as the
+// events fsnotify raises: Create for new files, Write for files whose size
+// or modification time changed and Remove for files that are gone. The first
+// poll only records the tree.
+func (p *poller) poll() []fsnotify.Event {
+	first := p.polls == 0
+	full := p.polls%pollFullScanEvery == 0
+	p.polls++
+
+	var events []fsnotify.Event
+	seen := map[string]bool{}
+	p.pollDir(p.root, full, seen, &events)
+
+	for dir, d := range p.dirs {
+		if seen[dir] {
+			continue
+		}
+		for name := range d.files {
+			events = append(events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Remove})
+		}
+		delete(p.dirs, dir)
+	}
+
+	if first {
+		return nil
+	}
+	return events
+}
+
+// pollDir polls one directory and, in recursive mode, its subdirectories
+func (p *poller) pollDir(dir string, full bool, seen map[string]bool, events *[]fsnotify.Event) {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		// Gone: its files are reported removed
+		return
+	}
+	seen[dir] = true
+
+	prev := p.dirs[dir]
+	if prev != nil && !full && info.ModTime().Equal(prev.modTime) && prev.listed.Sub(prev.modTime) > pollRacyWindow {
+		for _, sub := range prev.subdirs {
+			p.pollDir(sub, full, seen, events)
+		}
+		return
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		p.logger.Error("Failed to list polled directory", "dir", dir, "error", err)
+		return
+	}
+
+	cur := &polledDir{
+		modTime: info.ModTime(),
+		listed:  time.Now(),
+		files:   make(map[string]polledFile, len(entries)),
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+
+		if entry.IsDir() {
+			// Processing subdirectories are not part of the tree
+			if _, ok := relativeDir(p.root, path, true); ok && p.recursive {
+				cur.subdirs = append(cur.subdirs, path)
+			}
+			continue
+		}
+
+		var old polledFile
+		known := false
+		if prev != nil {
+			old, known = prev.files[name]
+		}
+		if known && !full {
+			cur.files[name] = old
+			continue
+		}
+
+		fi, err := entry.Info()
+		if err != nil {
+			// Removed since the listing
+			continue
+		}
+		f := polledFile{size: fi.Size(), modTime: fi.ModTime()}
+		cur.files[name] = f
+
+		switch {
+		case !known:
+			*events = append(*events, fsnotify.Event{Name: path, Op: fsnotify.Create})
+		case f.size != old.size || !f.modTime.Equal(old.modTime):
+			*events = append(*events, fsnotify.Event{Name: path, Op: fsnotify.Write})
+		}
+	}
+
+	if prev != nil {
+		for name := range prev.files {
+			if _, ok := cur.files[name]; !ok {
+				*events = append(*events, fsnotify.Event{Name: filepath.Join(dir, name), Op: fsnotify.Remove})
+			}
+		}
+	}
+	p.dirs[dir] = cur
+
+	for _, sub := range cur.subdirs {
+		p.pollDir(sub, full, seen, events)
+	}
+}
+
+// run polls the tree every interval and sends the changes to events until
+// ctx is cancelled
+func (p *poller) run(ctx context.Context, interval time.Duration, events chan<- fsnotify.Event) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		start := time.Now()
+		changes := p.poll()
+		p.logger.Debug("Polled source directory", "dir", p.root, "changes", len(changes), "duration", time.Since(start))
+
+		for _, event := range changes {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPoller(t *testing.T, root string, recursive bool) *poller {
+	t.Helper()
+
+	log, err := logger.New("error", os.DevNull)
+	require.NoError(t, err)
+	return newPoller(root, recursive, log)
+}
+
+// sortedEvents orders events by path, as directory listings have no order
+func sortedEvents(events []fsnotify.Event) []fsnotify.Event {
+	sort.Slice(events, func(i, j int) bool { return events[i].Name < events[j].Name })
+	return events
+}
+
+func TestPoller_Poll(t *testing.T) {
+	root := t.TempDir()
+	kept := filepath.Join(root, "kept.csv")
+	removed := filepath.Join(root, "removed.csv")
+	require.NoError(t, os.WriteFile(kept, []byte("a"), 0600))
+	require.NoError(t, os.WriteFile(removed, []byte("b"), 0600))
+
+	p := newTestPoller(t, root, false)
+	assert.Empty(t, p.poll(), "the first poll only records the tree")
+
+	created := filepath.Join(root, "created.csv")
+	require.NoError(t, os.WriteFile(created, []byte("c"), 0600))
+	require.NoError(t, os.Remove(removed))
+	require.NoError(t, os.WriteFile(kept, []byte("modified"), 0600))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "sub"), 0750))
+
+	assert.Equal(t, []fsnotify.Event{
+		{Name: created, Op: fsnotify.Create},
+		{Name: removed, Op: fsnotify.Remove},
+	}, sortedEvents(p.poll()))
+
+	// Files modified in place are found by the next full scan
+	var events []fsnotify.Event
+	for i := 2; i <= pollFullScanEvery; i++ {
+		events = append(events, p.poll()...)
+	}
+	assert.Equal(t, []fsnotify.Event{{Name: kept, Op: fsnotify.Write}}, events)
+}
+
+func TestPoller_SkipsUnchangedDirectories(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "data.csv"), []byte("a"), 0600))
+
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(root, old, old))
+
+	p := newTestPoller(t, root, false)
+	p.poll()
+	listed := p.dirs[root]
+
+	assert.Empty(t, p.poll())
+	assert.Same(t, listed, p.dirs[root], "unchanged directory listed again")
+
+	// A directory changed shortly before its listing is listed again, as a
+	// later change may not move its modification time
+	require.NoError(t, os.WriteFile(filepath.Join(root, "new.csv"), []byte("b"), 0600))
+	assert.Len(t, p.poll(), 1)
+	listed = p.dirs[root]
+	p.poll()
+	assert.NotSame(t, listed, p.dirs[root])
+}
+
+func TestPoller_Recursive(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "archive"), 0750))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "old"), 0750))
+	gone := filepath.Join(root, "old", "gone.csv")
+	require.NoError(t, os.WriteFile(gone, []byte("a"), 0600))
+
+	p := newTestPoller(t, root, true)
+	p.poll()
+
+	nested := filepath.Join(root, "2025", "06", "report.csv")
+	require.NoError(t, os.MkdirAll(filepath.Dir(nested), 0750))
+	require.NoError(t, os.WriteFile(nested, []byte("b"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "archive", "done.csv"), []byte("c"), 0600))
+	require.NoError(t, os.RemoveAll(filepath.Join(root, "old")))
+
+	assert.Equal(t, []fsnotify.Event{
+		{Name: nested, Op: fsnotify.Create},
+		{Name: gone, Op: fsnotify.Remove},
+	}, sortedEvents(p.poll()))
+}
+
+func TestPoller_NonRecursive(t *testing.T) {
+	root := t.TempDir()
+	p := newTestPoller(t, root, false)
+	p.poll()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "sub"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sub", "data.csv"), []byte("a"), 0600))
+
+	assert.Empty(t, p.poll())
+}
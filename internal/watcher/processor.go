@@ -10,37 +10,77 @@ import (
 
 	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/hooks"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/interfaces"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/ledger"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/metrics"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/objectstore"
 )
 
-// Processor processes files from the queue
+// retryPollInterval is how often idle workers re-check the queue for
+// items whose retry delay has elapsed (new items wake workers immediately)
+const retryPollInterval = 1 * time.Second
+
+// Processor processes files from the queue using a pool of workers
 type Processor struct {
-	queue              interfaces.Queue
-	encryptStrategy    ProcessStrategy
-	decryptStrategy    ProcessStrategy
-	FileHandler        *FileHandler // Exposed for testing (encryption)
-	decryptFileHandler *FileHandler // File handler for decryption
-	logger             logger.Logger
-	mu                 sync.RWMutex
+	queue       interfaces.Queue
+	encryptor   *crypto.Encryptor
+	decryptor   *crypto.Decryptor
+	rules       map[ruleKey]*ruleHandlers
+	FileHandler *FileHandler // Exposed for testing (default encryption rule)
+	ledger      *ledger.Ledger
+	hooks       *hooks.Dispatcher
+	logger      logger.Logger
+	mu          sync.RWMutex
+
+	// Worker pool state
+	poolMu     sync.Mutex
+	poolCtx    context.Context
+	numWorkers int
+	workers    []chan struct{} // stop channel per running worker
+	wg         sync.WaitGroup
+}
+
+// ruleHandlers process the items of one encryption or decryption rule
+type ruleHandlers struct {
+	strategy    ProcessStrategy
+	fileHandler *FileHandler
 }
 
 // ProcessorConfig holds processor configuration
 type ProcessorConfig struct {
 	// Encryption configuration
+	EncryptSourceDir          string
 	EncryptSourceFileBehavior string
 	EncryptArchiveDir         string
 	EncryptFailedDir          string
 	EncryptDLQDir             string
 	CalculateChecksum         bool
+	EncryptFormat             string // "split" (default) or "container"
 
 	// Decryption configuration
+	DecryptSourceDir          string
 	DecryptSourceFileBehavior string
 	DecryptArchiveDir         string
 	DecryptFailedDir          string
 	DecryptDLQDir             string
 	VerifyChecksum            bool
+
+	// Rules are additional (or, for the default rule names, replacement)
+	// per-directory settings (see RulesFromConfig). Items are processed with
+	// the settings of their rule, falling back to the default rule.
+	Rules []RuleConfig
+
+	// Number of concurrent workers (default: 1)
+	Workers int
+
+	// Ledger records processed source files of rules that keep them in place
+	Ledger *ledger.Ledger
+
+	// Hooks are told about completed, failed and dead-lettered items
+	Hooks *hooks.Dispatcher
 }
 
 // NewProcessor creates a new file processor
@@ -51,114 +91,247 @@ func NewProcessor(
 	dec *crypto.Decryptor,
 	log logger.Logger,
 ) (*Processor, error) {
-	// Create encryption file handler
-	encryptFileHandler, err := NewFileHandler(&FileHandlerConfig{
-		SourceFileBehavior: cfg.EncryptSourceFileBehavior,
-		ArchiveDir:         cfg.EncryptArchiveDir,
-		FailedDir:          cfg.EncryptFailedDir,
-		DLQDir:             cfg.EncryptDLQDir,
-	}, log)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create encryption file handler: %w", err)
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = config.DefaultWorkers
 	}
 
-	// Create decryption file handler
-	decryptFileHandler, err := NewFileHandler(&FileHandlerConfig{
-		SourceFileBehavior: cfg.DecryptSourceFileBehavior,
-		ArchiveDir:         cfg.DecryptArchiveDir,
-		FailedDir:          cfg.DecryptFailedDir,
-		DLQDir:             cfg.DecryptDLQDir,
-	}, log)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create decryption file handler: %w", err)
+	p := &Processor{
+		queue:      q,
+		encryptor:  enc,
+		decryptor:  dec,
+		rules:      map[ruleKey]*ruleHandlers{},
+		ledger:     cfg.Ledger,
+		hooks:      cfg.Hooks,
+		logger:     log,
+		numWorkers: workers,
+	}
+
+	defaults := []RuleConfig{
+		{
+			Name:               config.DefaultRuleName,
+			Operation:          model.OperationEncrypt,
+			SourceDir:          cfg.EncryptSourceDir,
+			SourceFileBehavior: cfg.EncryptSourceFileBehavior,
+			ArchiveDir:         cfg.EncryptArchiveDir,
+			FailedDir:          cfg.EncryptFailedDir,
+			DLQDir:             cfg.EncryptDLQDir,
+			CalculateChecksum:  cfg.CalculateChecksum,
+			Format:             cfg.EncryptFormat,
+		},
+		{
+			Name:               config.DefaultRuleName,
+			Operation:          model.OperationDecrypt,
+			SourceDir:          cfg.DecryptSourceDir,
+			SourceFileBehavior: cfg.DecryptSourceFileBehavior,
+			ArchiveDir:         cfg.DecryptArchiveDir,
+			FailedDir:          cfg.DecryptFailedDir,
+			DLQDir:             cfg.DecryptDLQDir,
+			VerifyChecksum:     cfg.VerifyChecksum,
+		},
+	}
+
+	for _, rule := range append(defaults, cfg.Rules...) {
+		if err := p.setRuleLocked(rule); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// setRuleLocked creates or updates the handlers of a rule; the caller must
+// hold p.mu (or own p exclusively)
+func (p *Processor) setRuleLocked(rule RuleConfig) error {
+	handlerCfg := &FileHandlerConfig{
+		SourceDir:          rule.SourceDir,
+		SourceFileBehavior: rule.SourceFileBehavior,
+		ArchiveDir:         rule.ArchiveDir,
+		FailedDir:          rule.FailedDir,
+		DLQDir:             rule.DLQDir,
+	}
+
+	key := ruleKey{operation: rule.Operation, name: rule.Name}
+	handlers, ok := p.rules[key]
+	if ok {
+		handlers.fileHandler.UpdateConfig(handlerCfg)
+	} else {
+		fileHandler, err := NewFileHandler(handlerCfg, p.logger)
+		if err != nil {
+			if rule.Operation == model.OperationDecrypt {
+				return fmt.Errorf("failed to create decryption file handler for rule '%s': %w", rule.Name, err)
+			}
+			return fmt.Errorf("failed to create encryption file handler for rule '%s': %w", rule.Name, err)
+		}
+		handlers = &ruleHandlers{fileHandler: fileHandler}
+		p.rules[key] = handlers
+	}
+
+	publish := PublishOptions{DoneMarker: rule.DoneMarker, QuarantineDir: rule.QuarantineDir}
+
+	switch rule.Operation {
+	case model.OperationEncrypt:
+		if rule.Destination == nil {
+			handlers.strategy = NewEncryptStrategy(p.encryptor, p.logger, rule.CalculateChecksum, rule.Format, publish)
+			break
+		}
+		store, err := objectstore.NewClientFromConfig(rule.Destination)
+		if err != nil {
+			return fmt.Errorf("failed to create destination of rule '%s': %w", rule.Name, err)
+		}
+		handlers.strategy = NewUploadStrategy(p.encryptor, store, p.logger, rule.CalculateChecksum, rule.Destination.KeyStorage, rule.DoneMarker)
+	case model.OperationDecrypt:
+		handlers.strategy = NewDecryptStrategy(p.decryptor, p.logger, rule.VerifyChecksum, publish)
+	default:
+		return fmt.Errorf("unknown operation for rule '%s': %s", rule.Name, rule.Operation)
 	}
 
-	// Create strategies
-	encryptStrategy := NewEncryptStrategy(enc, log, cfg.CalculateChecksum)
-	decryptStrategy := NewDecryptStrategy(dec, log, cfg.VerifyChecksum)
+	if key == (ruleKey{operation: model.OperationEncrypt, name: config.DefaultRuleName}) {
+		p.FileHandler = handlers.fileHandler
+	}
+
+	return nil
+}
+
+// handlersLocked returns the handlers for an item's rule, falling back to
+// the default rule of its operation (e.g. for items queued before rules
+// existed or whose rule was removed); the caller must hold p.mu
+func (p *Processor) handlersLocked(item *model.Item) (*ruleHandlers, bool) {
+	if handlers, ok := p.rules[ruleKey{operation: item.Operation, name: item.Rule}]; ok {
+		return handlers, true
+	}
+	handlers, ok := p.rules[ruleKey{operation: item.Operation, name: config.DefaultRuleName}]
+	return handlers, ok
+}
+
+// handlers returns the strategy and a copy of the file handler of an item's
+// rule. Items are processed without holding p.mu, so a reload never waits
+// for the slowest file; UpdateConfig updates file handlers in place, hence
+// the copy.
+func (p *Processor) handlers(item *model.Item) (ProcessStrategy, *FileHandler, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	handlers, ok := p.handlersLocked(item)
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown operation: %s", item.Operation)
+	}
 
-	return &Processor{
-		queue:              q,
-		encryptStrategy:    encryptStrategy,
-		decryptStrategy:    decryptStrategy,
-		FileHandler:        encryptFileHandler,
-		decryptFileHandler: decryptFileHandler,
-		logger:             log,
-	}, nil
+	fileHandler := *handlers.fileHandler
+	return handlers.strategy, &fileHandler, nil
 }
 
 // UpdateConfig safely updates the processor's configuration.
 func (p *Processor) UpdateConfig(cfg *config.Config) {
+	p.Resize(cfg.Queue.Workers)
+
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	newCfg := &ProcessorConfig{
-		EncryptSourceFileBehavior: cfg.Encryption.SourceFileBehavior,
-		EncryptArchiveDir:         cfg.ArchiveDir("encrypt"),
-		EncryptFailedDir:          cfg.FailedDir("encrypt"),
-		EncryptDLQDir:             cfg.DLQDir("encrypt"),
-		CalculateChecksum:         cfg.Encryption.CalculateChecksum,
-		DecryptSourceFileBehavior: cfg.Decryption.SourceFileBehavior,
-		DecryptArchiveDir:         cfg.ArchiveDir("decrypt"),
-		DecryptFailedDir:          cfg.FailedDir("decrypt"),
-		DecryptDLQDir:             cfg.DLQDir("decrypt"),
-		VerifyChecksum:            cfg.Decryption.VerifyChecksum,
-	}
-
-	// Update encryption file handler
-	p.FileHandler.UpdateConfig(&FileHandlerConfig{
-		SourceFileBehavior: newCfg.EncryptSourceFileBehavior,
-		ArchiveDir:         newCfg.EncryptArchiveDir,
-		FailedDir:          newCfg.EncryptFailedDir,
-		DLQDir:             newCfg.EncryptDLQDir,
-	})
-
-	// Update decryption file handler
-	p.decryptFileHandler.UpdateConfig(&FileHandlerConfig{
-		SourceFileBehavior: newCfg.DecryptSourceFileBehavior,
-		ArchiveDir:         newCfg.DecryptArchiveDir,
-		FailedDir:          newCfg.DecryptFailedDir,
-		DLQDir:             newCfg.DecryptDLQDir,
-	})
-
-	// Update strategies with new configuration
-	// Safe type assertions: these strategies are always set to concrete types in NewProcessor
-	if encryptStrategy, ok := p.encryptStrategy.(*EncryptStrategy); ok {
-		p.encryptStrategy = &EncryptStrategy{
-			encryptor:         encryptStrategy.encryptor,
-			logger:            p.logger,
-			calculateChecksum: newCfg.CalculateChecksum,
+	for _, rule := range RulesFromConfig(cfg) {
+		if err := p.setRuleLocked(rule); err != nil {
+			p.logger.Error("Failed to update processing rule", "rule", rule.Name, "operation", rule.Operation, "error", err)
 		}
 	}
+}
 
-	if decryptStrategy, ok := p.decryptStrategy.(*DecryptStrategy); ok {
-		p.decryptStrategy = &DecryptStrategy{
-			decryptor:      decryptStrategy.decryptor,
-			logger:         p.logger,
-			verifyChecksum: newCfg.VerifyChecksum,
-		}
+// Start starts the worker pool and blocks until the context is cancelled
+// and all workers have finished their current item
+func (p *Processor) Start(ctx context.Context) error {
+	p.poolMu.Lock()
+	p.poolCtx = ctx
+	workers := p.numWorkers
+	p.resizeLocked(workers)
+	p.poolMu.Unlock()
+
+	p.logger.Info("Processor started", "workers", workers)
+
+	<-ctx.Done()
+
+	p.wg.Wait()
+	p.logger.Info("Processor stopped")
+	return nil
+}
+
+// Resize changes the number of concurrent workers. If the pool is running,
+// workers are started or stopped immediately; stopped workers finish their
+// current item before exiting.
+func (p *Processor) Resize(workers int) {
+	if workers <= 0 {
+		workers = config.DefaultWorkers
+	}
+
+	p.poolMu.Lock()
+	defer p.poolMu.Unlock()
+
+	if workers != p.numWorkers {
+		p.logger.Info("Resizing processor worker pool", "from", p.numWorkers, "to", workers)
+	}
+	p.numWorkers = workers
+
+	if p.poolCtx != nil && p.poolCtx.Err() == nil {
+		p.resizeLocked(workers)
 	}
 }
 
-// Start starts processing files from the queue
-func (p *Processor) Start(ctx context.Context) error {
-	ticker := time.NewTicker(1 * time.Second)
+// Workers returns the configured number of workers
+func (p *Processor) Workers() int {
+	p.poolMu.Lock()
+	defer p.poolMu.Unlock()
+
+	return p.numWorkers
+}
+
+// resizeLocked starts or stops workers to match n; the caller must hold poolMu
+func (p *Processor) resizeLocked(n int) {
+	for len(p.workers) < n {
+		stop := make(chan struct{})
+		p.workers = append(p.workers, stop)
+		p.wg.Add(1)
+		go p.runWorker(p.poolCtx, stop)
+	}
+
+	for len(p.workers) > n {
+		last := len(p.workers) - 1
+		close(p.workers[last])
+		p.workers = p.workers[:last]
+	}
+}
+
+// runWorker dequeues and processes items until ctx is cancelled or stop is closed
+func (p *Processor) runWorker(ctx context.Context, stop <-chan struct{}) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(retryPollInterval)
 	defer ticker.Stop()
 
 	for {
-		select {
-		case <-ctx.Done():
-			return nil
+		// Drain all ready items before waiting for the next notification
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-stop:
+				return
+			default:
+			}
 
-		case <-ticker.C:
-			// Try to process next item
 			item := p.queue.Dequeue()
 			if item == nil {
-				continue
+				break
 			}
 
 			p.processItem(ctx, item)
 		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-stop:
+			return
+		case <-p.queue.Notify():
+		case <-ticker.C:
+		}
 	}
 }
 
@@ -166,42 +339,67 @@ func (p *Processor) Start(ctx context.Context) error {
 func (p *Processor) processItem(ctx context.Context, item *model.Item) {
 	item.MarkProcessing()
 
-	p.mu.RLock()
-	defer p.mu.RUnlock()
+	operation := string(item.Operation)
+	metrics.QueueDepth.WithLabelValues(string(model.StatusProcessing)).Inc()
+	defer metrics.QueueDepth.WithLabelValues(string(model.StatusProcessing)).Dec()
+	start := time.Now()
 
 	p.logger.Info("Processing file",
 		"id", item.ID,
 		"operation", item.Operation,
+		"rule", item.Rule,
 		"file", item.SourcePath,
 		"attempt", item.AttemptCount,
 	)
 
-	var err error
-	var strategy ProcessStrategy
-	var fileHandler *FileHandler
+	strategy, fileHandler, err := p.handlers(item)
 
-	switch item.Operation {
-	case model.OperationEncrypt:
-		strategy = p.encryptStrategy
-		fileHandler = p.FileHandler
-	case model.OperationDecrypt:
-		strategy = p.decryptStrategy
-		fileHandler = p.decryptFileHandler
-	default:
-		err = fmt.Errorf("unknown operation: %s", item.Operation)
+	// Kept source files are recorded as they were before processing, so a
+	// change made while processing is picked up again
+	var snapshot *ledger.Entry
+	if err == nil && p.ledger != nil && fileHandler != nil && fileHandler.keepsSource() {
+		if entry, snapErr := p.ledger.Snapshot(item.SourcePath); snapErr == nil {
+			snapshot = &entry
+		} else {
+			p.logger.Error("Failed to read source file state for the ledger", "file", item.SourcePath, "error", snapErr)
+		}
 	}
 
 	if err == nil && strategy != nil {
 		err = strategy.Process(ctx, item)
 	}
 
+	if err != nil && ctx.Err() != nil {
+		// Processing was interrupted by shutdown: put the item back without
+		// counting the attempt or moving the source file
+		p.logger.Info("Processing interrupted, item will be retried",
+			"id", item.ID,
+			"file", item.SourcePath,
+		)
+
+		item.MarkInterrupted()
+		if err := p.queue.Enqueue(item); err != nil {
+			p.logger.Error("Failed to requeue interrupted item", "id", item.ID, "error", err)
+		}
+
+		return
+	}
+
 	if err != nil {
+		metrics.ItemsFailed.WithLabelValues(operation).Inc()
 		p.logger.Error("Failed to process file",
 			"id", item.ID,
 			"file", item.SourcePath,
 			"error", err,
 		)
 
+		// Once requeued the item may be taken by another worker, so hooks
+		// get a copy
+		failed := *item
+		failed.Status = model.StatusFailed
+		failed.Error = err.Error()
+		event := config.HookEventFailed
+
 		// Requeue for retry
 		if err := p.queue.Requeue(item, err); err != nil {
 			p.logger.Error("Failed to requeue item", "id", item.ID, "error", err)
@@ -210,18 +408,30 @@ func (p *Processor) processItem(ctx context.Context, item *model.Item) {
 			if fileHandler != nil {
 				fileHandler.MoveToDLQ(item)
 			}
+			failed.Status = model.StatusDLQ
+			event = config.HookEventDLQ
 		}
 
 		// Move source file to failed directory
 		if fileHandler != nil {
 			fileHandler.MoveToFailed(item.SourcePath)
+			if item.Archive != "" {
+				fileHandler.MoveToFailed(readyMarker(item))
+			}
 		}
 
+		p.notify(event, failed)
 		return
 	}
 
 	// Mark as completed
 	item.MarkCompleted()
+	if err := p.queue.Complete(item); err != nil {
+		p.logger.Error("Failed to record completed item", "id", item.ID, "error", err)
+	}
+	metrics.ItemsProcessed.WithLabelValues(operation).Inc()
+	metrics.BytesProcessed.WithLabelValues(operation).Add(float64(item.FileSize))
+	metrics.ProcessingDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
 
 	p.logger.Info("Successfully processed file",
 		"id", item.ID,
@@ -229,10 +439,21 @@ func (p *Processor) processItem(ctx context.Context, item *model.Item) {
 		"dest", item.DestPath,
 	)
 
+	if snapshot != nil {
+		if err := p.ledger.Record(item.SourcePath, *snapshot); err != nil {
+			p.logger.Error("Failed to record processed file in the ledger", "file", item.SourcePath, "error", err)
+		}
+	}
+
 	// Handle source file with the appropriate file handler
 	if fileHandler != nil {
 		fileHandler.HandleSourceFile(item.SourcePath)
 
+		// A directory encrypted as one archive goes with its ready marker
+		if item.Archive != "" {
+			fileHandler.HandleSourceFile(readyMarker(item))
+		}
+
 		// For decryption, also handle the key file and checksum file
 		if item.Operation == model.OperationDecrypt {
 			if item.KeyPath != "" {
@@ -246,4 +467,16 @@ func (p *Processor) processItem(ctx context.Context, item *model.Item) {
 			}
 		}
 	}
+
+	p.notify(config.HookEventCompleted, *item)
+}
+
+// notify records a hook event for an item, if hooks are configured
+func (p *Processor) notify(event string, item model.Item) {
+	if p.hooks == nil {
+		return
+	}
+	if err := p.hooks.Notify(event, item); err != nil {
+		p.logger.Error("Failed to record hook event", "id", item.ID, "event", event, "error", err)
+	}
 }
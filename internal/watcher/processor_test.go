@@ -1,14 +1,25 @@
 package watcher
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/gitrgoliveira/vault-file-encryption/internal/archive"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/hooks"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/ledger"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/objectstore/objectstoretest"
 
 	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
@@ -40,6 +51,21 @@ func (m *mockVaultClient) DecryptDataKey(ciphertext string) (*vault.DataKey, err
 	}, nil
 }
 
+// keyedMockVaultClient records the transit keys used for data keys
+type keyedMockVaultClient struct {
+	mockVaultClient
+	generatedWith []vault.KeyRef
+}
+
+func (m *keyedMockVaultClient) GenerateDataKeyWithKey(ref vault.KeyRef) (*vault.DataKey, error) {
+	m.generatedWith = append(m.generatedWith, ref)
+	return m.GenerateDataKey()
+}
+
+func (m *keyedMockVaultClient) DecryptDataKeyWithKey(ref vault.KeyRef, ciphertext string) (*vault.DataKey, error) {
+	return m.DecryptDataKey(ciphertext)
+}
+
 func setupTestProcessor(t *testing.T, cfg *ProcessorConfig) (*Processor, *queue.Queue, string) {
 	t.Helper()
 
@@ -179,6 +205,16 @@ func TestProcessor_EncryptFile(t *testing.T) {
 	assert.FileExists(t, destFile)
 	assert.FileExists(t, item.KeyPath)
 
+	// Key file is a v2 JSON sidecar describing the encrypted file
+	keyFile, err := crypto.ReadKeyFile(item.KeyPath)
+	require.NoError(t, err)
+	assert.Equal(t, crypto.KeyFileVersion, keyFile.Version)
+	assert.Equal(t, "vault:v1:mock-encrypted-dek", keyFile.Ciphertext)
+	assert.Equal(t, 1, keyFile.KeyVersion)
+	assert.Equal(t, "source.txt", keyFile.Filename)
+	assert.Equal(t, int64(len(testData)), keyFile.Size)
+	assert.Equal(t, processedItem.Checksum, keyFile.Checksum)
+
 	// Verify checksum was created in dest dir, named after original file
 	// /tmp/encrypted.enc -> checksum at /tmp/source.txt.sha256
 	checksumFile := filepath.Join(filepath.Dir(destFile), filepath.Base(sourceFile)+".sha256")
@@ -230,6 +266,33 @@ func TestProcessor_EncryptFile_Delete(t *testing.T) {
 	assert.NoFileExists(t, destFile+".sha256")
 }
 
+func TestProcessor_EncryptFile_KeepRecordsLedger(t *testing.T) {
+	processed, err := ledger.Open(filepath.Join(t.TempDir(), "ledger.json"), false)
+	require.NoError(t, err)
+
+	cfg := &ProcessorConfig{
+		EncryptSourceFileBehavior: "keep",
+		Ledger:                    processed,
+	}
+
+	processor, q, tmpDir := setupTestProcessor(t, cfg)
+
+	sourceFile := filepath.Join(tmpDir, "source.txt")
+	require.NoError(t, os.WriteFile(sourceFile, []byte("Test data"), 0600))
+
+	destFile := filepath.Join(tmpDir, "source.txt.enc")
+	item := model.NewItem(model.OperationEncrypt, sourceFile, destFile)
+	item.KeyPath = filepath.Join(tmpDir, "source.txt.key")
+
+	require.NoError(t, q.Enqueue(item))
+	processor.processItem(context.Background(), q.Dequeue())
+
+	// Source stays in place and is recorded as processed
+	assert.FileExists(t, sourceFile)
+	assert.FileExists(t, destFile)
+	assert.True(t, processed.Processed(sourceFile))
+}
+
 func TestProcessor_DecryptFile(t *testing.T) {
 	cfg := &ProcessorConfig{
 		EncryptSourceFileBehavior: "delete",
@@ -311,6 +374,211 @@ func TestProcessor_Start_ContextCancellation(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestProcessor_Start_WorkerPool(t *testing.T) {
+	cfg := &ProcessorConfig{
+		EncryptSourceFileBehavior: "delete",
+		Workers:                   4,
+	}
+
+	processor, q, tmpDir := setupTestProcessor(t, cfg)
+	assert.Equal(t, 4, processor.Workers())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, processor.Start(ctx))
+	}()
+
+	// Items are picked up as soon as they are enqueued, not on a ticker
+	const fileCount = 20
+	for i := 0; i < fileCount; i++ {
+		sourceFile := filepath.Join(tmpDir, fmt.Sprintf("file-%d.txt", i))
+		require.NoError(t, os.WriteFile(sourceFile, []byte("worker pool data"), 0600))
+
+		item := model.NewItem(model.OperationEncrypt, sourceFile, sourceFile+".enc")
+		item.KeyPath = sourceFile + ".key"
+		require.NoError(t, q.Enqueue(item))
+	}
+
+	require.Eventually(t, func() bool {
+		matches, _ := filepath.Glob(filepath.Join(tmpDir, "*.key"))
+		return len(matches) == fileCount && q.Size() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("processor did not stop after context cancellation")
+	}
+}
+
+func TestProcessor_Resize(t *testing.T) {
+	cfg := &ProcessorConfig{
+		EncryptSourceFileBehavior: "archive",
+		Workers:                   2,
+	}
+
+	processor, _, tmpDir := setupTestProcessor(t, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		assert.NoError(t, processor.Start(ctx))
+	}()
+
+	// Resize through UpdateConfig, as a SIGHUP reload would
+	processor.UpdateConfig(&config.Config{
+		Encryption: config.EncryptionConfig{
+			SourceDir:          tmpDir,
+			SourceFileBehavior: "archive",
+		},
+		Decryption: &config.DecryptionConfig{
+			SourceDir:          tmpDir,
+			SourceFileBehavior: "archive",
+		},
+		Queue: config.QueueConfig{Workers: 6},
+	})
+	assert.Equal(t, 6, processor.Workers())
+
+	processor.Resize(1)
+	assert.Equal(t, 1, processor.Workers())
+
+	// Non-positive sizes fall back to the default
+	processor.Resize(0)
+	assert.Equal(t, config.DefaultWorkers, processor.Workers())
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("processor did not stop after context cancellation")
+	}
+}
+
+// blockingStrategy holds items in Process until release is closed
+type blockingStrategy struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStrategy) Process(ctx context.Context, item *model.Item) error {
+	close(s.started)
+	<-s.release
+	return nil
+}
+
+func TestProcessor_UpdateConfig_DoesNotWaitForItems(t *testing.T) {
+	cfg := &ProcessorConfig{
+		EncryptSourceFileBehavior: "keep",
+	}
+
+	processor, q, tmpDir := setupTestProcessor(t, cfg)
+
+	blocking := &blockingStrategy{started: make(chan struct{}), release: make(chan struct{})}
+	processor.rules[ruleKey{operation: model.OperationEncrypt, name: config.DefaultRuleName}].strategy = blocking
+
+	sourceFile := filepath.Join(tmpDir, "large.bin")
+	require.NoError(t, os.WriteFile(sourceFile, []byte("test"), 0600))
+	require.NoError(t, q.Enqueue(model.NewItem(model.OperationEncrypt, sourceFile, sourceFile+".enc")))
+
+	processed := make(chan struct{})
+	go func() {
+		defer close(processed)
+		processor.processItem(context.Background(), q.Dequeue())
+	}()
+	<-blocking.started
+
+	// A reload completes while the item is still being processed
+	reloaded := make(chan struct{})
+	go func() {
+		defer close(reloaded)
+		processor.UpdateConfig(&config.Config{
+			Encryption: config.EncryptionConfig{
+				SourceDir:          tmpDir,
+				SourceFileBehavior: "keep",
+			},
+			Queue: config.QueueConfig{Workers: 4},
+		})
+	}()
+
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("UpdateConfig waited for the item being processed")
+	}
+
+	close(blocking.release)
+	<-processed
+	assert.FileExists(t, sourceFile)
+}
+
+func TestProcessor_ProcessItem_Interrupted(t *testing.T) {
+	cfg := &ProcessorConfig{
+		EncryptSourceFileBehavior: "archive",
+	}
+
+	processor, q, tmpDir := setupTestProcessor(t, cfg)
+
+	sourceFile := filepath.Join(tmpDir, "interrupted.txt")
+	require.NoError(t, os.WriteFile(sourceFile, []byte("test"), 0600))
+
+	item := model.NewItem(model.OperationEncrypt, sourceFile, sourceFile+".enc")
+	item.KeyPath = sourceFile + ".key"
+	require.NoError(t, q.Enqueue(item))
+
+	// Simulate shutdown while the item is being processed
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	processedItem := q.Dequeue()
+	require.NotNil(t, processedItem)
+	processor.processItem(ctx, processedItem)
+
+	// Item is back in the queue as pending, without a counted attempt,
+	// and the source file was not moved to the failed directory
+	assert.Equal(t, 1, q.Size())
+	assert.Equal(t, model.StatusPending, processedItem.Status)
+	assert.Equal(t, 0, processedItem.AttemptCount)
+	assert.FileExists(t, sourceFile)
+}
+
+func TestProcessor_EncryptFile_NestedSourceMirrorsArchive(t *testing.T) {
+	tmpDir := t.TempDir()
+	sourceDir := filepath.Join(tmpDir, "source")
+	cfg := &ProcessorConfig{
+		EncryptSourceDir:          sourceDir,
+		EncryptSourceFileBehavior: "archive",
+		EncryptArchiveDir:         filepath.Join(sourceDir, "archive"),
+	}
+
+	processor, q, _ := setupTestProcessor(t, cfg)
+
+	nestedDir := filepath.Join(sourceDir, "2024", "05")
+	require.NoError(t, os.MkdirAll(nestedDir, 0750))
+	sourceFile := filepath.Join(nestedDir, "data.txt")
+	require.NoError(t, os.WriteFile(sourceFile, []byte("nested data"), 0600))
+
+	// Destination directory does not exist yet; the strategy creates it
+	destDir := filepath.Join(tmpDir, "dest", "2024", "05")
+	item := model.NewItem(model.OperationEncrypt, sourceFile, filepath.Join(destDir, "data.txt.enc"))
+	item.KeyPath = filepath.Join(destDir, "data.txt.key")
+	require.NoError(t, q.Enqueue(item))
+
+	processedItem := q.Dequeue()
+	require.NotNil(t, processedItem)
+	processor.processItem(context.Background(), processedItem)
+
+	assert.FileExists(t, item.DestPath)
+	assert.FileExists(t, item.KeyPath)
+	assert.FileExists(t, filepath.Join(sourceDir, "archive", "2024", "05", "data.txt"))
+	assert.NoFileExists(t, sourceFile)
+}
+
 func TestProcessor_HandleSourceFile_UnknownBehavior(t *testing.T) {
 	cfg := &ProcessorConfig{
 		EncryptSourceFileBehavior: "unknown-behavior",
@@ -374,6 +642,48 @@ func TestProcessor_MoveToDLQ(t *testing.T) {
 	assert.NoFileExists(t, sourceFile)
 }
 
+func TestRestoreSource(t *testing.T) {
+	tmpDir := t.TempDir()
+	rules := []RuleConfig{{
+		Name:      config.DefaultRuleName,
+		Operation: model.OperationEncrypt,
+		SourceDir: filepath.Join(tmpDir, "source"),
+		FailedDir: filepath.Join(tmpDir, "failed"),
+		DLQDir:    filepath.Join(tmpDir, "dlq"),
+	}}
+
+	// Nested files are found under their relative path in the DLQ
+	sourceFile := filepath.Join(tmpDir, "source", "nested", "data.txt")
+	dlqFile := filepath.Join(tmpDir, "dlq", "nested", "data.txt")
+	require.NoError(t, os.MkdirAll(filepath.Dir(dlqFile), 0750))
+	require.NoError(t, os.WriteFile(dlqFile, []byte("test"), 0600))
+
+	item := model.NewItem(model.OperationEncrypt, sourceFile, "")
+	item.Rule = "removed-rule"
+
+	from, err := RestoreSource(rules, item)
+	require.NoError(t, err)
+	assert.Equal(t, dlqFile, from)
+	assert.FileExists(t, sourceFile)
+	assert.NoFileExists(t, dlqFile)
+
+	// Nothing to do once the file is in place
+	from, err = RestoreSource(rules, item)
+	require.NoError(t, err)
+	assert.Empty(t, from)
+
+	// Files are also looked for in the failed directory
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "failed", "nested"), 0750))
+	require.NoError(t, os.Rename(sourceFile, filepath.Join(tmpDir, "failed", "nested", "data.txt")))
+	_, err = RestoreSource(rules, item)
+	require.NoError(t, err)
+	assert.FileExists(t, sourceFile)
+
+	missing := model.NewItem(model.OperationEncrypt, filepath.Join(tmpDir, "source", "missing.txt"), "")
+	_, err = RestoreSource(rules, missing)
+	assert.Error(t, err)
+}
+
 func TestProcessor_MoveToFailed_EmptyDir(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -576,3 +886,308 @@ func TestProcessor_ProcessItem_UnknownOperation(t *testing.T) {
 	// Item should have been requeued due to failure
 	assert.Greater(t, processedItem.AttemptCount, 0)
 }
+
+func TestProcessor_ContainerFormat_RoundTrip(t *testing.T) {
+	cfg := &ProcessorConfig{
+		EncryptSourceFileBehavior: "delete",
+		DecryptSourceFileBehavior: "delete",
+		CalculateChecksum:         true,
+		VerifyChecksum:            true,
+		EncryptFormat:             config.FormatContainer,
+	}
+
+	processor, _, tmpDir := setupTestProcessor(t, cfg)
+	ctx := context.Background()
+
+	sourceFile := filepath.Join(tmpDir, "report.csv")
+	testData := []byte("a,b,c\n1,2,3\n")
+	require.NoError(t, os.WriteFile(sourceFile, testData, 0600))
+
+	encryptedFile := filepath.Join(tmpDir, "out", "report.csv.enc")
+	encryptItem := model.NewItem(model.OperationEncrypt, sourceFile, encryptedFile)
+	encryptItem.KeyPath = filepath.Join(tmpDir, "out", "report.csv.key")
+
+	processor.processItem(ctx, encryptItem)
+
+	assert.Equal(t, model.StatusCompleted, encryptItem.Status)
+	assert.FileExists(t, encryptedFile)
+	assert.NoFileExists(t, filepath.Join(tmpDir, "out", "report.csv.key"))
+	assert.NoFileExists(t, filepath.Join(tmpDir, "out", "report.csv.sha256"))
+	assert.Empty(t, encryptItem.KeyPath)
+	assert.NotEmpty(t, encryptItem.Checksum)
+
+	// Decrypt without a key file; the checksum comes from the container header
+	decryptedFile := filepath.Join(tmpDir, "decrypted", "report.csv")
+	decryptItem := model.NewItem(model.OperationDecrypt, encryptedFile, decryptedFile)
+
+	processor.processItem(ctx, decryptItem)
+
+	assert.Equal(t, model.StatusCompleted, decryptItem.Status)
+	decryptedData, err := os.ReadFile(decryptedFile)
+	require.NoError(t, err)
+	assert.Equal(t, testData, decryptedData)
+}
+
+func TestProcessor_NamedRule_UsesItemKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	financeSrc := filepath.Join(tmpDir, "finance")
+	require.NoError(t, os.MkdirAll(financeSrc, 0750))
+
+	q, err := queue.NewQueue(&queue.Config{
+		MaxRetries: 3,
+		BaseDelay:  1 * time.Second,
+		MaxDelay:   5 * time.Second,
+		StatePath:  filepath.Join(tmpDir, "queue.json"),
+	})
+	require.NoError(t, err)
+
+	log, err := logger.New("error", os.DevNull)
+	require.NoError(t, err)
+
+	client := &keyedMockVaultClient{}
+	keyCfg := &crypto.EncryptorConfig{TransitMount: "transit", KeyName: "default-key"}
+	processor, err := NewProcessor(&ProcessorConfig{
+		EncryptSourceFileBehavior: "keep",
+		Rules: []RuleConfig{{
+			Name:               "finance",
+			Operation:          model.OperationEncrypt,
+			SourceDir:          financeSrc,
+			SourceFileBehavior: "delete",
+			KeyName:            "finance",
+		}},
+	}, q, crypto.NewEncryptor(client, keyCfg), crypto.NewDecryptor(client, keyCfg), log)
+	require.NoError(t, err)
+
+	sourceFile := filepath.Join(financeSrc, "ledger.csv")
+	require.NoError(t, os.WriteFile(sourceFile, []byte("ledger"), 0600))
+
+	// The key recorded on the item is used, even if the rule changed since
+	item := model.NewItem(model.OperationEncrypt, sourceFile, filepath.Join(tmpDir, "out", "ledger.csv.enc"))
+	item.KeyPath = filepath.Join(tmpDir, "out", "ledger.csv.key")
+	item.Rule = "finance"
+	item.TransitMount = "transit"
+	item.KeyName = "finance-2024"
+
+	processor.processItem(context.Background(), item)
+	require.Equal(t, model.StatusCompleted, item.Status, item.Error)
+
+	require.Len(t, client.generatedWith, 1)
+	assert.Equal(t, "finance-2024", client.generatedWith[0].KeyName)
+
+	keyFile, err := crypto.ReadKeyFile(item.KeyPath)
+	require.NoError(t, err)
+	assert.Equal(t, "finance-2024", keyFile.KeyName)
+
+	// The rule's source file behavior applies
+	assert.NoFileExists(t, sourceFile)
+
+	// Items of an unknown rule fall back to the default rule and key
+	otherFile := filepath.Join(tmpDir, "other.txt")
+	require.NoError(t, os.WriteFile(otherFile, []byte("other"), 0600))
+	other := model.NewItem(model.OperationEncrypt, otherFile, filepath.Join(tmpDir, "out", "other.txt.enc"))
+	other.KeyPath = filepath.Join(tmpDir, "out", "other.txt.key")
+	other.Rule = "removed"
+
+	processor.processItem(context.Background(), other)
+	require.Equal(t, model.StatusCompleted, other.Status, other.Error)
+	assert.Len(t, client.generatedWith, 1)
+	assert.FileExists(t, otherFile)
+}
+
+func TestProcessor_EncryptArchive_RoundTrip(t *testing.T) {
+	cfg := &ProcessorConfig{
+		EncryptSourceFileBehavior: "delete",
+		DecryptSourceFileBehavior: "keep",
+		CalculateChecksum:         true,
+		VerifyChecksum:            true,
+	}
+
+	processor, _, tmpDir := setupTestProcessor(t, cfg)
+	ctx := context.Background()
+
+	sourceDir := filepath.Join(tmpDir, "reports")
+	require.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "q1"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "q1", "data.csv"), []byte("a,b\n1,2\n"), 0600))
+	marker := sourceDir + readyMarkerSuffix
+	require.NoError(t, os.WriteFile(marker, nil, 0600))
+
+	outDir := filepath.Join(tmpDir, "out")
+	encryptItem := model.NewItem(model.OperationEncrypt, sourceDir, filepath.Join(outDir, "reports.tar.enc"))
+	encryptItem.KeyPath = filepath.Join(outDir, "reports.tar.key")
+	encryptItem.Archive = archive.CompressionNone
+
+	processor.processItem(ctx, encryptItem)
+
+	assert.Equal(t, model.StatusCompleted, encryptItem.Status)
+	assert.NoDirExists(t, sourceDir)
+	assert.NoFileExists(t, marker)
+	assert.FileExists(t, filepath.Join(outDir, "reports.tar.sha256"))
+
+	keyFile, err := crypto.ReadKeyFile(encryptItem.KeyPath)
+	require.NoError(t, err)
+	assert.Equal(t, "reports.tar", keyFile.Filename)
+	assert.Equal(t, encryptItem.Checksum, keyFile.Checksum)
+
+	// The decrypted archive restores the directory
+	tarFile := filepath.Join(tmpDir, "decrypted", "reports.tar")
+	decryptItem := model.NewItem(model.OperationDecrypt, encryptItem.DestPath, tarFile)
+	decryptItem.KeyPath = encryptItem.KeyPath
+
+	processor.processItem(ctx, decryptItem)
+	require.Equal(t, model.StatusCompleted, decryptItem.Status)
+
+	f, err := os.Open(tarFile)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	extractDir := filepath.Join(tmpDir, "extracted")
+	require.NoError(t, archive.Extract(ctx, f, extractDir))
+
+	data, err := os.ReadFile(filepath.Join(extractDir, "reports", "q1", "data.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "a,b\n1,2\n", string(data))
+}
+
+func TestProcessor_Destination_UploadsToBucket(t *testing.T) {
+	server := objectstoretest.NewServer()
+	defer server.Close()
+
+	for _, keyStorage := range []string{config.KeyStorageObject, config.KeyStorageMetadata} {
+		t.Run(keyStorage, func(t *testing.T) {
+			sourceDir := t.TempDir()
+			processor, _, _ := setupTestProcessor(t, &ProcessorConfig{
+				Rules: []RuleConfig{{
+					Name:               config.DefaultRuleName,
+					Operation:          model.OperationEncrypt,
+					SourceDir:          sourceDir,
+					SourceFileBehavior: "delete",
+					CalculateChecksum:  true,
+					DoneMarker:         true,
+					Destination: &config.DestinationConfig{
+						Type:       config.DestinationS3,
+						Endpoint:   server.URL,
+						Bucket:     "encrypted",
+						Prefix:     keyStorage,
+						Region:     objectstoretest.Region,
+						PathStyle:  true,
+						KeyStorage: keyStorage,
+						Credentials: &config.S3CredentialsConfig{
+							AccessKeyID:     objectstoretest.AccessKeyID,
+							SecretAccessKey: objectstoretest.SecretAccessKey,
+						},
+					},
+				}},
+			})
+
+			testData := []byte("quarterly figures")
+			sourceFile := filepath.Join(sourceDir, "report.csv")
+			require.NoError(t, os.WriteFile(sourceFile, testData, 0600))
+
+			// Without dest_dir the watcher queues paths relative to the prefix
+			item := model.NewItem(model.OperationEncrypt, sourceFile, filepath.Join("q1", "report.csv.enc"))
+			item.KeyPath = filepath.Join("q1", "report.csv.key")
+
+			processor.processItem(context.Background(), item)
+			require.Equal(t, model.StatusCompleted, item.Status, item.Error)
+			assert.NoFileExists(t, sourceFile)
+
+			objectKey := keyStorage + "/q1/report.csv.enc"
+			assert.Equal(t, "s3://encrypted/"+objectKey, item.DestPath)
+			assert.Equal(t, "s3://encrypted/"+keyStorage+"/q1/report.csv.sha256", item.ChecksumPath)
+
+			obj := server.Object("encrypted", objectKey)
+			require.NotNil(t, obj)
+			assert.NotNil(t, server.Object("encrypted", objectKey+".done"))
+
+			var keyData []byte
+			if keyStorage == config.KeyStorageObject {
+				assert.Equal(t, "s3://encrypted/"+keyStorage+"/q1/report.csv.key", item.KeyPath)
+				keyObj := server.Object("encrypted", keyStorage+"/q1/report.csv.key")
+				require.NotNil(t, keyObj)
+				keyData = keyObj.Data
+			} else {
+				assert.Empty(t, item.KeyPath)
+				assert.Nil(t, server.Object("encrypted", keyStorage+"/q1/report.csv.key"))
+				var err error
+				keyData, err = base64.StdEncoding.DecodeString(obj.Metadata[KeyFileMetadata])
+				require.NoError(t, err)
+			}
+
+			keyFile, err := crypto.ParseKeyFile(keyData)
+			require.NoError(t, err)
+			assert.Equal(t, "report.csv", keyFile.Filename)
+
+			// The object decrypts with the stored key
+			var decrypted bytes.Buffer
+			info, err := crypto.NewDecryptor(&mockVaultClient{}, nil).DecryptStream(
+				context.Background(), bytes.NewReader(obj.Data), keyFile, &decrypted)
+			require.NoError(t, err)
+			assert.Equal(t, testData, decrypted.Bytes())
+			assert.Equal(t, item.Checksum, info.Checksum)
+		})
+	}
+}
+
+func TestProcessor_Hooks(t *testing.T) {
+	var mu sync.Mutex
+	var events []hooks.Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev hooks.Event
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&ev))
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	log, err := logger.New("error", os.DevNull)
+	require.NoError(t, err)
+	dispatcher, err := hooks.Open(filepath.Join(t.TempDir(), "outbox.json"), []config.HookConfig{{
+		Name:       "notify",
+		URL:        server.URL,
+		Secret:     "s3cret",
+		Events:     []string{config.HookEventCompleted, config.HookEventDLQ},
+		Timeout:    5 * time.Second,
+		MaxRetries: 1,
+	}}, log)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dispatcher.Run(ctx)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	processor, _, tmpDir := setupTestProcessor(t, &ProcessorConfig{
+		EncryptSourceFileBehavior: "archive",
+		Hooks:                     dispatcher,
+	})
+
+	sourceFile := filepath.Join(tmpDir, "report.csv")
+	require.NoError(t, os.WriteFile(sourceFile, []byte("a,b\n1,2\n"), 0600))
+	item := model.NewItem(model.OperationEncrypt, sourceFile, filepath.Join(tmpDir, "report.csv.enc"))
+	item.KeyPath = filepath.Join(tmpDir, "report.csv.key")
+	processor.processItem(context.Background(), item)
+	require.Equal(t, model.StatusCompleted, item.Status, item.Error)
+
+	// The last attempt of a missing file sends it to the DLQ
+	missing := model.NewItem(model.OperationEncrypt, filepath.Join(tmpDir, "missing.csv"), filepath.Join(tmpDir, "missing.csv.enc"))
+	missing.AttemptCount = 2
+	processor.processItem(context.Background(), missing)
+	require.Equal(t, model.StatusDLQ, missing.Status)
+
+	require.Eventually(t, func() bool { return dispatcher.Pending() == 0 }, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, events, 2)
+	assert.Equal(t, config.HookEventCompleted, events[0].Event)
+	assert.Equal(t, sourceFile, events[0].Item.SourcePath)
+	assert.Equal(t, config.HookEventDLQ, events[1].Event)
+	assert.Equal(t, model.StatusDLQ, events[1].Item.Status)
+	assert.NotEmpty(t, events[1].Item.Error)
+}
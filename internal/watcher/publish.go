@@ -0,0 +1,107 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// doneMarkerSuffix names the empty file written after the outputs of an
+// item when done_marker is set, e.g. data.txt.enc.done
+const doneMarkerSuffix = ".done"
+
+// PublishOptions controls how strategies publish their outputs
+type PublishOptions struct {
+	// DoneMarker writes <output>.done once the outputs are in place
+	DoneMarker bool
+
+	// QuarantineDir receives decrypted output that fails checksum
+	// verification (decryption only); such output is deleted when empty
+	QuarantineDir string
+}
+
+// publication writes the outputs of an item under temporary names in their
+// final directories, then renames them into place together. Consumers of the
+// destination directory never see partial files, and the encrypted file only
+// appears once its key and checksum are there.
+type publication struct {
+	files []stagedFile
+}
+
+type stagedFile struct {
+	temp  string
+	final string
+}
+
+// stage returns the temporary path to write an output to. Outputs are
+// renamed in the order they were staged, so the file consumers look for is
+// staged last.
+func (p *publication) stage(final string) string {
+	temp := filepath.Join(filepath.Dir(final), "."+filepath.Base(final)+".tmp")
+	p.files = append(p.files, stagedFile{temp: temp, final: final})
+	return temp
+}
+
+// publish syncs the staged outputs to disk and renames them into place,
+// followed by a done marker for the last one when doneMarker is set
+func (p *publication) publish(doneMarker bool) error {
+	if doneMarker && len(p.files) > 0 {
+		marker := p.stage(p.files[len(p.files)-1].final + doneMarkerSuffix)
+		if err := os.WriteFile(marker, nil, 0600); err != nil { // #nosec G306 - marker file
+			return fmt.Errorf("failed to write done marker: %w", err)
+		}
+	}
+
+	dirs := map[string]bool{}
+	for _, f := range p.files {
+		if err := syncFile(f.temp); err != nil {
+			return fmt.Errorf("failed to sync %s: %w", f.final, err)
+		}
+		dirs[filepath.Dir(f.final)] = true
+	}
+
+	for _, f := range p.files {
+		if err := os.Rename(f.temp, f.final); err != nil {
+			return fmt.Errorf("failed to publish %s: %w", f.final, err)
+		}
+	}
+
+	for dir := range dirs {
+		if err := syncDir(dir); err != nil {
+			return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+		}
+	}
+
+	return nil
+}
+
+// discard removes the staged outputs that were not published
+func (p *publication) discard() {
+	for _, f := range p.files {
+		_ = os.Remove(f.temp)
+	}
+}
+
+// syncFile flushes a written file to disk
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0) // #nosec G304 - staged output file
+	if err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// isPublishArtifact reports whether a file is an output being staged or a
+// done marker, which an encryption source fed by another rule must skip
+func isPublishArtifact(path string) bool {
+	base := filepath.Base(path)
+	if strings.HasSuffix(base, doneMarkerSuffix) {
+		return true
+	}
+	return strings.HasPrefix(base, ".") && strings.HasSuffix(base, ".tmp")
+}
@@ -0,0 +1,204 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dirNames returns the names of the entries of dir
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestPublication(t *testing.T) {
+	dir := t.TempDir()
+	pub := &publication{}
+	defer pub.discard()
+
+	key := pub.stage(filepath.Join(dir, "data.txt.key"))
+	enc := pub.stage(filepath.Join(dir, "data.txt.enc"))
+	require.NoError(t, os.WriteFile(key, []byte("key"), 0600))
+	require.NoError(t, os.WriteFile(enc, []byte("ciphertext"), 0600))
+
+	// Nothing is visible under its final name before publishing
+	assert.ElementsMatch(t, []string{".data.txt.key.tmp", ".data.txt.enc.tmp"}, dirNames(t, dir))
+
+	require.NoError(t, pub.publish(true))
+	assert.ElementsMatch(t, []string{"data.txt.key", "data.txt.enc", "data.txt.enc.done"}, dirNames(t, dir))
+
+	data, err := os.ReadFile(filepath.Join(dir, "data.txt.enc"))
+	require.NoError(t, err)
+	assert.Equal(t, "ciphertext", string(data))
+}
+
+func TestPublication_Discard(t *testing.T) {
+	dir := t.TempDir()
+	pub := &publication{}
+
+	require.NoError(t, os.WriteFile(pub.stage(filepath.Join(dir, "data.txt.enc")), []byte("partial"), 0600))
+	pub.discard()
+
+	assert.Empty(t, dirNames(t, dir))
+}
+
+func TestIsPublishArtifact(t *testing.T) {
+	assert.True(t, isPublishArtifact("/data/out/.report.csv.tmp"))
+	assert.True(t, isPublishArtifact("/data/out/report.csv.done"))
+	assert.False(t, isPublishArtifact("/data/out/report.csv"))
+	assert.False(t, isPublishArtifact("/data/out/report.tmp"))
+}
+
+// encryptForPublishTest encrypts a file with checksum into a new directory
+// and returns the item
+func encryptForPublishTest(t *testing.T, log logger.Logger, publish PublishOptions) *model.Item {
+	t.Helper()
+
+	source := filepath.Join(t.TempDir(), "report.csv")
+	require.NoError(t, os.WriteFile(source, []byte("quarterly figures"), 0600))
+
+	encDir := t.TempDir()
+	item := model.NewItem(model.OperationEncrypt, source, filepath.Join(encDir, "report.csv.enc"))
+	item.KeyPath = filepath.Join(encDir, "report.csv.key")
+
+	strategy := NewEncryptStrategy(crypto.NewEncryptor(&mockVaultClient{}, nil), log, true, config.FormatSplit, publish)
+	require.NoError(t, strategy.Process(context.Background(), item))
+	return item
+}
+
+func TestEncryptStrategy_PublishesOutputs(t *testing.T) {
+	log, err := logger.New("error", os.DevNull)
+	require.NoError(t, err)
+
+	item := encryptForPublishTest(t, log, PublishOptions{DoneMarker: true})
+
+	assert.ElementsMatch(t, []string{"report.csv.enc", "report.csv.key", "report.csv.sha256", "report.csv.enc.done"},
+		dirNames(t, filepath.Dir(item.DestPath)))
+	assert.Equal(t, filepath.Join(filepath.Dir(item.DestPath), "report.csv.sha256"), item.ChecksumPath)
+}
+
+func TestDecryptStrategy_VerifiesBeforePublishing(t *testing.T) {
+	log, err := logger.New("error", os.DevNull)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		quarantine bool
+	}{
+		{name: "quarantined", quarantine: true},
+		{name: "discarded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := encryptForPublishTest(t, log, PublishOptions{})
+
+			// Decrypted output no longer matches the recorded checksum
+			require.NoError(t, crypto.SaveChecksum("0000000000000000000000000000000000000000000000000000000000000000", enc.ChecksumPath))
+
+			publish := PublishOptions{DoneMarker: true}
+			if tt.quarantine {
+				publish.QuarantineDir = filepath.Join(t.TempDir(), "quarantine")
+			}
+
+			outDir := t.TempDir()
+			item := model.NewItem(model.OperationDecrypt, enc.DestPath, filepath.Join(outDir, "report.csv"))
+			item.KeyPath = enc.KeyPath
+
+			strategy := NewDecryptStrategy(crypto.NewDecryptor(&mockVaultClient{}, nil), log, true, publish)
+			err := strategy.Process(context.Background(), item)
+			require.ErrorIs(t, err, errChecksumMismatch)
+
+			// Nothing reaches the destination, not even a temporary file
+			assert.Empty(t, dirNames(t, outDir))
+
+			if tt.quarantine {
+				data, err := os.ReadFile(filepath.Join(publish.QuarantineDir, "report.csv"))
+				require.NoError(t, err)
+				assert.Equal(t, "quarterly figures", string(data))
+
+				if runtime.GOOS != "windows" {
+					info, err := os.Stat(publish.QuarantineDir)
+					require.NoError(t, err)
+					assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+				}
+			}
+		})
+	}
+}
+
+func TestDecryptStrategy_UnreadableChecksumFile(t *testing.T) {
+	log, err := logger.New("error", os.DevNull)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		write func(t *testing.T, path string)
+	}{
+		{name: "invalid", write: func(t *testing.T, path string) {
+			require.NoError(t, os.WriteFile(path, []byte("not a checksum\n"), 0600))
+		}},
+		{name: "unreadable", write: func(t *testing.T, path string) {
+			require.NoError(t, os.Remove(path))
+			require.NoError(t, os.Mkdir(path, 0750))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := encryptForPublishTest(t, log, PublishOptions{})
+			tt.write(t, enc.ChecksumPath)
+
+			publish := PublishOptions{QuarantineDir: filepath.Join(t.TempDir(), "quarantine")}
+			outDir := t.TempDir()
+			item := model.NewItem(model.OperationDecrypt, enc.DestPath, filepath.Join(outDir, "report.csv"))
+			item.KeyPath = enc.KeyPath
+
+			strategy := NewDecryptStrategy(crypto.NewDecryptor(&mockVaultClient{}, nil), log, true, publish)
+			err := strategy.Process(context.Background(), item)
+			require.Error(t, err)
+			assert.NotErrorIs(t, err, errChecksumMismatch)
+
+			// The unverified output is neither published nor quarantined
+			assert.Empty(t, dirNames(t, outDir))
+			assert.NoDirExists(t, publish.QuarantineDir)
+		})
+	}
+}
+
+func TestDecryptStrategy_PublishesVerifiedOutput(t *testing.T) {
+	log, err := logger.New("error", os.DevNull)
+	require.NoError(t, err)
+
+	enc := encryptForPublishTest(t, log, PublishOptions{})
+
+	outDir := t.TempDir()
+	item := model.NewItem(model.OperationDecrypt, enc.DestPath, filepath.Join(outDir, "report.csv"))
+	item.KeyPath = enc.KeyPath
+
+	strategy := NewDecryptStrategy(crypto.NewDecryptor(&mockVaultClient{}, nil), log, true, PublishOptions{DoneMarker: true})
+	require.NoError(t, strategy.Process(context.Background(), item))
+
+	assert.ElementsMatch(t, []string{"report.csv", "report.csv.done"}, dirNames(t, outDir))
+	data, err := os.ReadFile(item.DestPath)
+	require.NoError(t, err)
+	assert.Equal(t, "quarterly figures", string(data))
+}
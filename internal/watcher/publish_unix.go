@@ -0,0 +1,18 @@
+//go:build !windows
+
+package watcher
+
+import "os"
+
+// syncDir flushes a directory, so renames into it survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir) // #nosec G304 - destination directory
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		_ = d.Close()
+		return err
+	}
+	return d.Close()
+}
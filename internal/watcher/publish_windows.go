@@ -0,0 +1,9 @@
+//go:build windows
+
+package watcher
+
+// syncDir is a no-op: Windows cannot sync directories, and NTFS journals
+// renames itself
+func syncDir(string) error {
+	return nil
+}
@@ -0,0 +1,216 @@
+package watcher
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/metrics"
+)
+
+// Locations of stuck files, used as the location label of metrics.StuckFiles
+const (
+	stuckSource = "source"
+	stuckFailed = "failed"
+	stuckDLQ    = "dlq"
+)
+
+// reconcileAfter returns a channel that fires when the next reconciliation
+// is due, or nil when periodic reconciliation is disabled
+func (w *Watcher) reconcileAfter() <-chan time.Time {
+	w.mu.RLock()
+	interval := w.reconcileInterval
+	w.mu.RUnlock()
+
+	if interval <= 0 {
+		return nil
+	}
+	return time.After(interval)
+}
+
+// startReconcile runs reconcile in the background and returns a channel that
+// is closed when it is done; only one reconciliation runs at a time
+func (w *Watcher) startReconcile(ctx context.Context, rewatch bool) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.reconcile(ctx, rewatch)
+	}()
+	return done
+}
+
+// reconcile rescans every source tree for files whose events were missed,
+// e.g. dropped in an fsnotify queue overflow, and queues them like the
+// start-up scan does; files already queued, followed or processed are left
+// alone. With rewatch, the trees are added to the watch list again, for
+// subdirectories created while events were lost. It then reports stuck files.
+// The trees are walked without holding w.mu, so a slow walk does not block
+// events or UpdateConfig.
+func (w *Watcher) reconcile(ctx context.Context, rewatch bool) {
+	start := time.Now()
+
+	w.mu.RLock()
+	routes := w.routes
+	w.mu.RUnlock()
+
+	missed := 0
+	for _, r := range routes {
+		if ctx.Err() != nil {
+			return
+		}
+
+		if rewatch && r.events {
+			if err := w.watchTree(r.sourceDir, r.sourceDir, r.recursive); err != nil {
+				w.logger.Error("Failed to watch source dir again", "dir", r.sourceDir, "operation", r.operation, "error", err)
+			}
+		}
+
+		if _, err := os.Stat(r.sourceDir); err != nil {
+			w.logger.Error("Failed to reconcile source directory", "dir", r.sourceDir, "operation", r.operation, "error", err)
+			continue
+		}
+
+		found := 0
+		w.walkRouteTree(ctx, r, func(path, destDir string, _ fs.DirEntry) {
+			if w.queueMissedFile(r, path, destDir) {
+				found++
+			}
+		})
+		if found > 0 {
+			metrics.ReconciledFiles.WithLabelValues(string(r.operation), r.rule).Add(float64(found))
+			w.logger.Info("Reconciliation found missed files", "count", found, "dir", r.sourceDir, "operation", r.operation, "rule", r.rule)
+		}
+		missed += found
+	}
+
+	w.reportStuck(ctx)
+
+	w.logger.Debug("Reconciled source directories", "missed", missed, "duration", time.Since(start))
+}
+
+// queueMissedFile tracks a file of r found by reconcile, or handles it as a
+// marker, unless it is already queued, followed or processed; the ledger
+// check hashes the file, so it runs without w.mu
+func (w *Watcher) queueMissedFile(r *route, path, destDir string) bool {
+	if target, ok := r.markerTarget(path); ok {
+		w.mu.RLock()
+		defer w.mu.RUnlock()
+		return w.handleMarkerLocked(r, path, target, destDir)
+	}
+
+	// Files of marker-triggered rules are queued through their marker
+	if r.markerTrigger() || !isSourceFile(r.operation, path) {
+		return false
+	}
+
+	w.mu.RLock()
+	matches := w.matchesFilterLocked(r, path)
+	w.mu.RUnlock()
+	if !matches || w.alreadyProcessed(r, path) || w.alreadyQueued(path) {
+		return false
+	}
+
+	// Queued once stable (fully uploaded), without holding up the walk
+	if !w.tracker.Track(path) {
+		return false
+	}
+	w.logger.Info("Pre-existing file found", "file", path, "operation", r.operation, "rule", r.rule)
+	return true
+}
+
+// reportStuck reports files left unprocessed for longer than stuck_after:
+// source files not yet processed, by modification time, and files in the
+// failed and dead letter directories, by how long reconciliation has seen
+// them there (moving a file keeps its modification time). Each is logged
+// once; the counts per rule are exported as metrics.StuckFiles.
+func (w *Watcher) reportStuck(ctx context.Context) {
+	w.mu.RLock()
+	routes := w.routes
+	stuckAfter := w.stuckAfter
+	w.mu.RUnlock()
+
+	w.stuckMu.Lock()
+	reportedBefore, sinceBefore := w.reportedStuck, w.stuckSince
+	w.stuckMu.Unlock()
+
+	now := time.Now()
+	reported := map[string]bool{}
+	seen := map[string]time.Time{}
+	report := func(r *route, path, location string, age time.Duration) {
+		reported[path] = true
+		if !reportedBefore[path] {
+			w.logger.Error("File is stuck", "file", path, "location", location, "operation", r.operation, "rule", r.rule,
+				"age", age.Round(time.Second))
+		}
+	}
+
+	for _, r := range routes {
+		if ctx.Err() != nil {
+			return
+		}
+		counts := map[string]int{}
+
+		w.walkRouteTree(ctx, r, func(path, _ string, d fs.DirEntry) {
+			// Markers, and files still waiting for one, are reported by
+			// checkMarkers
+			if _, ok := r.markerTarget(path); ok {
+				return
+			}
+			if r.markerTrigger() {
+				if _, ok := r.findMarker(path); !ok {
+					return
+				}
+			}
+
+			if !isSourceFile(r.operation, path) {
+				return
+			}
+			w.mu.RLock()
+			matches := w.matchesFilterLocked(r, path)
+			w.mu.RUnlock()
+			if !matches || w.alreadyProcessed(r, path) {
+				return
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return
+			}
+			if age := now.Sub(info.ModTime()); age >= stuckAfter {
+				counts[stuckSource]++
+				report(r, path, stuckSource, age)
+			}
+		})
+
+		for location, dir := range map[string]string{stuckFailed: r.failedDir, stuckDLQ: r.dlqDir} {
+			_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() || ctx.Err() != nil {
+					return nil
+				}
+
+				since, ok := sinceBefore[path]
+				if !ok {
+					since = now
+				}
+				seen[path] = since
+
+				if age := now.Sub(since); age >= stuckAfter {
+					counts[location]++
+					report(r, path, location, age)
+				}
+				return nil
+			})
+		}
+
+		for _, location := range []string{stuckSource, stuckFailed, stuckDLQ} {
+			metrics.StuckFiles.WithLabelValues(string(r.operation), r.rule, location).Set(float64(counts[location]))
+		}
+	}
+
+	w.stuckMu.Lock()
+	w.reportedStuck = reported
+	w.stuckSince = seen
+	w.stuckMu.Unlock()
+}
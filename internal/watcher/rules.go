@@ -0,0 +1,158 @@
+package watcher
+
+import (
+	"time"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/vault"
+)
+
+// RuleConfig describes one watched source tree: where its files go, how
+// processed source files are handled and which transit key is used. Rules
+// come from the (named) encryption and decryption configuration blocks.
+type RuleConfig struct {
+	Name      string
+	Operation model.OperationType
+
+	// Watcher settings. DestDir is empty for rules with a Destination, whose
+	// items then have destinations relative to the bucket prefix.
+	SourceDir string
+	DestDir   string
+	Recursive bool
+	Include   []string
+	Exclude   []string
+
+	// Trigger is config.TriggerMarker to queue files only once a marker file
+	// with one of MarkerSuffixes appears; empty means config.TriggerStability
+	Trigger        string
+	MarkerSuffixes []string
+	MarkerTimeout  time.Duration // Waiting files and markers are reported after this
+
+	// WatchMode is config.WatchModePoll or config.WatchModeHybrid to list the
+	// source tree every PollInterval; empty means config.WatchModeEvents
+	WatchMode    string
+	PollInterval time.Duration
+
+	// Transit key recorded on queued items (empty uses the configured key)
+	TransitMount string
+	KeyName      string
+
+	// Processor settings
+	SourceFileBehavior string
+	ArchiveDir         string
+	FailedDir          string
+	DLQDir             string
+	CalculateChecksum  bool   // encryption only
+	Format             string // encryption only
+	VerifyChecksum     bool   // decryption only
+	QuarantineDir      string // decryption only
+	DoneMarker         bool
+
+	// Directories marked with a <dir>.ready file are encrypted as one tar
+	// archive (encryption only)
+	ArchiveDirectories bool
+	ArchiveCompression string
+
+	// Destination uploads encrypted files to object storage (encryption only)
+	Destination *config.DestinationConfig
+}
+
+// RulesFromConfig returns the encryption and decryption rules of cfg, default
+// blocks first
+func RulesFromConfig(cfg *config.Config) []RuleConfig {
+	var rules []RuleConfig
+
+	for _, enc := range cfg.EncryptionRules() {
+		rules = append(rules, RuleConfig{
+			Name:               enc.Name,
+			Operation:          model.OperationEncrypt,
+			SourceDir:          enc.SourceDir,
+			DestDir:            enc.DestDir,
+			Recursive:          enc.Recursive,
+			Include:            enc.IncludePatterns(),
+			Exclude:            enc.Exclude,
+			Trigger:            enc.Trigger,
+			MarkerSuffixes:     enc.MarkerSuffixes(),
+			MarkerTimeout:      enc.MarkerTimeout,
+			WatchMode:          enc.WatchMode,
+			PollInterval:       enc.PollInterval,
+			TransitMount:       enc.TransitMount,
+			KeyName:            enc.KeyName,
+			SourceFileBehavior: enc.SourceFileBehavior,
+			ArchiveDir:         enc.ArchiveDir(),
+			FailedDir:          enc.FailedDir(),
+			DLQDir:             enc.DLQDir(),
+			CalculateChecksum:  enc.CalculateChecksum,
+			Format:             enc.Format,
+			DoneMarker:         enc.DoneMarker,
+			ArchiveDirectories: enc.ArchiveDirectories,
+			ArchiveCompression: enc.ArchiveCompression,
+			Destination:        enc.Destination,
+		})
+	}
+
+	for _, dec := range cfg.DecryptionRules() {
+		rules = append(rules, RuleConfig{
+			Name:               dec.Name,
+			Operation:          model.OperationDecrypt,
+			SourceDir:          dec.SourceDir,
+			DestDir:            dec.DestDir,
+			Recursive:          dec.Recursive,
+			Include:            dec.Include,
+			Exclude:            dec.Exclude,
+			Trigger:            dec.Trigger,
+			MarkerSuffixes:     dec.MarkerSuffixes(),
+			MarkerTimeout:      dec.MarkerTimeout,
+			WatchMode:          dec.WatchMode,
+			PollInterval:       dec.PollInterval,
+			TransitMount:       dec.TransitMount,
+			KeyName:            dec.KeyName,
+			SourceFileBehavior: dec.SourceFileBehavior,
+			ArchiveDir:         dec.ArchiveDir(),
+			FailedDir:          dec.FailedDir(),
+			DLQDir:             dec.DLQDir(),
+			VerifyChecksum:     dec.VerifyChecksum,
+			QuarantineDir:      dec.QuarantineDir(),
+			DoneMarker:         dec.DoneMarker,
+		})
+	}
+
+	return rules
+}
+
+// ruleKey identifies a rule; encryption and decryption rules may share a name
+type ruleKey struct {
+	operation model.OperationType
+	name      string
+}
+
+// ruleForItem returns the rule an item was queued by, falling back to the
+// default rule of its operation like the processor does
+func ruleForItem(rules []RuleConfig, item *model.Item) (RuleConfig, bool) {
+	var fallback *RuleConfig
+	for i := range rules {
+		if rules[i].Operation != item.Operation {
+			continue
+		}
+		if rules[i].Name == item.Rule {
+			return rules[i], true
+		}
+		if rules[i].Name == config.DefaultRuleName && fallback == nil {
+			fallback = &rules[i]
+		}
+	}
+
+	if fallback == nil {
+		return RuleConfig{}, false
+	}
+	return *fallback, true
+}
+
+// itemKeyRef returns the transit key recorded on a queue item
+func itemKeyRef(item *model.Item) vault.KeyRef {
+	return vault.KeyRef{
+		TransitMount: item.TransitMount,
+		KeyName:      item.KeyName,
+	}
+}
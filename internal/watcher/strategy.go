@@ -2,10 +2,15 @@ package watcher
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 
+	"github.com/gitrgoliveira/vault-file-encryption/internal/archive"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
@@ -16,25 +21,57 @@ type ProcessStrategy interface {
 	Process(ctx context.Context, item *model.Item) error
 }
 
+// errChecksumMismatch is returned when decrypted output does not match the
+// checksum recorded at encryption time
+var errChecksumMismatch = errors.New("checksum verification failed")
+
 // EncryptStrategy handles file encryption
 type EncryptStrategy struct {
 	encryptor         *crypto.Encryptor
 	logger            logger.Logger
 	calculateChecksum bool
+	format            string // config.FormatSplit or config.FormatContainer
+	publish           PublishOptions
 }
 
 // NewEncryptStrategy creates a new encryption strategy
-func NewEncryptStrategy(enc *crypto.Encryptor, log logger.Logger, calculateChecksum bool) *EncryptStrategy {
+func NewEncryptStrategy(enc *crypto.Encryptor, log logger.Logger, calculateChecksum bool, format string, publish PublishOptions) *EncryptStrategy {
 	return &EncryptStrategy{
 		encryptor:         enc,
 		logger:            log,
 		calculateChecksum: calculateChecksum,
+		format:            format,
+		publish:           publish,
 	}
 }
 
-// Process encrypts a file
+// Process encrypts a file with the transit key recorded on the item. The
+// outputs are written under temporary names and renamed into place together,
+// the encrypted file last.
 func (s *EncryptStrategy) Process(ctx context.Context, item *model.Item) error {
+	encryptor, err := s.encryptor.ForKey(itemKeyRef(item))
+	if err != nil {
+		return err
+	}
+
+	if item.Archive != "" {
+		return s.processArchive(ctx, encryptor, item)
+	}
+
+	if s.format == config.FormatContainer {
+		return s.processContainer(ctx, encryptor, item)
+	}
+
+	// Ensure the (possibly mirrored) destination directory exists
+	if err := ensureParentDir(item.DestPath, item.KeyPath); err != nil {
+		return err
+	}
+
+	pub := &publication{}
+	defer pub.discard()
+
 	// Calculate checksum if enabled
+	var checksumPath string
 	if s.calculateChecksum {
 		checksum, err := crypto.CalculateChecksum(item.SourcePath)
 		if err != nil {
@@ -46,61 +83,192 @@ func (s *EncryptStrategy) Process(ctx context.Context, item *model.Item) error {
 		// Example: /source/data.txt -> /encrypted/data.txt.sha256
 		// This keeps checksum with encrypted files, not with source
 		originalName := filepath.Base(item.SourcePath)
-		checksumPath := filepath.Join(filepath.Dir(item.DestPath), originalName+".sha256")
-		if err := crypto.SaveChecksum(checksum, checksumPath); err != nil {
+		checksumPath = filepath.Join(filepath.Dir(item.DestPath), originalName+".sha256")
+		if err := crypto.SaveChecksum(checksum, pub.stage(checksumPath)); err != nil {
 			return fmt.Errorf("failed to save checksum: %w", err)
 		}
-		item.ChecksumPath = checksumPath
-	}
-
-	// Progress callback
-	progressCallback := func(progress float64) {
-		if int(progress)%20 == 0 {
-			s.logger.Info("Encryption progress",
-				"id", item.ID,
-				"file", filepath.Base(item.SourcePath),
-				"progress", fmt.Sprintf("%.0f%%", progress),
-			)
-		}
 	}
+	keyTemp := pub.stage(item.KeyPath)
+	destTemp := pub.stage(item.DestPath)
 
 	// Encrypt file with context
-	encryptedKey, err := s.encryptor.EncryptFile(
+	encryptedKey, err := encryptor.EncryptFile(
 		ctx,
 		item.SourcePath,
-		item.DestPath,
-		progressCallback,
+		destTemp,
+		s.progressCallback(item),
 	)
 	if err != nil {
 		return err
 	}
 
-	// Save encrypted key
-	if err := os.WriteFile(item.KeyPath, []byte(encryptedKey), 0600); err != nil { // #nosec G306 - intentional key file write
+	// Save encrypted key with its metadata (v2 key file)
+	keyFile, err := encryptor.NewKeyFile(item.SourcePath, encryptedKey, item.Checksum)
+	if err != nil {
+		return fmt.Errorf("failed to build key file: %w", err)
+	}
+	if err := crypto.WriteKeyFile(keyTemp, keyFile); err != nil {
 		return fmt.Errorf("failed to save encrypted key: %w", err)
 	}
 
+	if err := pub.publish(s.publish.DoneMarker); err != nil {
+		return err
+	}
+	item.ChecksumPath = checksumPath
+
 	return nil
 }
 
+// processContainer encrypts a file into a single self-describing container.
+// The wrapped key and checksum live in the container header, so no .key or
+// .sha256 sidecar is written.
+func (s *EncryptStrategy) processContainer(ctx context.Context, encryptor *crypto.Encryptor, item *model.Item) error {
+	if err := ensureParentDir(item.DestPath); err != nil {
+		return err
+	}
+
+	pub := &publication{}
+	defer pub.discard()
+
+	header, err := encryptor.EncryptFileContainer(ctx, item.SourcePath, pub.stage(item.DestPath), s.progressCallback(item))
+	if err != nil {
+		return err
+	}
+
+	if err := pub.publish(s.publish.DoneMarker); err != nil {
+		return err
+	}
+	item.KeyPath = ""
+	item.Checksum = header.Checksum
+
+	return nil
+}
+
+// processArchive encrypts a directory as one tar archive with a single data
+// key. The archive is streamed, so it is never written unencrypted; the key
+// file and checksum are named after the archive (reports.tar.key).
+func (s *EncryptStrategy) processArchive(ctx context.Context, encryptor *crypto.Encryptor, item *model.Item) error {
+	if err := ensureParentDir(item.DestPath, item.KeyPath); err != nil {
+		return err
+	}
+
+	src := archive.Reader(ctx, item.SourcePath, item.Archive)
+	defer func() { _ = src.Close() }()
+
+	filename := filepath.Base(item.SourcePath) + "." + archive.Extension(item.Archive)
+
+	pub := &publication{}
+	defer pub.discard()
+
+	// Key file and checksum are named after the archive (reports.tar.key)
+	var checksumPath, checksumTemp, keyTemp string
+	if s.format != config.FormatContainer {
+		if s.calculateChecksum {
+			checksumPath = filepath.Join(filepath.Dir(item.DestPath), filename+".sha256")
+			checksumTemp = pub.stage(checksumPath)
+		}
+		keyTemp = pub.stage(item.KeyPath)
+	}
+	destTemp := pub.stage(item.DestPath)
+
+	dst, err := os.OpenFile(destTemp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600) // #nosec G304 - destination from configuration
+	if err != nil {
+		return fmt.Errorf("failed to create encrypted file: %w", err)
+	}
+
+	s.logger.Info("Encrypting directory as archive", "id", item.ID, "dir", item.SourcePath, "compression", item.Archive)
+
+	var ciphertext string
+	var info *crypto.StreamInfo
+	var header *crypto.ContainerHeader
+	if s.format == config.FormatContainer {
+		header, err = encryptor.EncryptStreamContainer(ctx, src, dst, filename)
+	} else {
+		ciphertext, info, err = encryptor.EncryptStream(ctx, src, dst)
+	}
+
+	if closeErr := dst.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to write encrypted file: %w", closeErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.format == config.FormatContainer {
+		if err := pub.publish(s.publish.DoneMarker); err != nil {
+			return err
+		}
+		item.KeyPath = ""
+		item.Checksum = header.Checksum
+		return nil
+	}
+
+	if s.calculateChecksum {
+		item.Checksum = info.Checksum
+		if err := crypto.SaveChecksum(item.Checksum, checksumTemp); err != nil {
+			return fmt.Errorf("failed to save checksum: %w", err)
+		}
+	}
+
+	keyFile := encryptor.NewStreamKeyFile(filename, info.Size, ciphertext, item.Checksum)
+	if err := crypto.WriteKeyFile(keyTemp, keyFile); err != nil {
+		return fmt.Errorf("failed to save encrypted key: %w", err)
+	}
+
+	if err := pub.publish(s.publish.DoneMarker); err != nil {
+		return err
+	}
+	item.ChecksumPath = checksumPath
+
+	return nil
+}
+
+// progressCallback logs encryption progress every 20%
+func (s *EncryptStrategy) progressCallback(item *model.Item) func(float64) {
+	return func(progress float64) {
+		if int(progress)%20 == 0 {
+			s.logger.Info("Encryption progress",
+				"id", item.ID,
+				"file", filepath.Base(item.SourcePath),
+				"progress", fmt.Sprintf("%.0f%%", progress),
+			)
+		}
+	}
+}
+
 // DecryptStrategy handles file decryption
 type DecryptStrategy struct {
 	decryptor      *crypto.Decryptor
 	logger         logger.Logger
 	verifyChecksum bool
+	publish        PublishOptions
 }
 
 // NewDecryptStrategy creates a new decryption strategy
-func NewDecryptStrategy(dec *crypto.Decryptor, log logger.Logger, verifyChecksum bool) *DecryptStrategy {
+func NewDecryptStrategy(dec *crypto.Decryptor, log logger.Logger, verifyChecksum bool, publish PublishOptions) *DecryptStrategy {
 	return &DecryptStrategy{
 		decryptor:      dec,
 		logger:         log,
 		verifyChecksum: verifyChecksum,
+		publish:        publish,
 	}
 }
 
-// Process decrypts a file
+// Process decrypts a file. Key files and containers record the transit key
+// that wrapped their data key; the item's key is used for legacy key files.
+// The output is written under a temporary name and only published once its
+// checksum has been verified; output that fails verification is quarantined.
 func (s *DecryptStrategy) Process(ctx context.Context, item *model.Item) error {
+	decryptor, err := s.decryptor.ForKey(itemKeyRef(item))
+	if err != nil {
+		return err
+	}
+
+	// Ensure the (possibly mirrored) destination directory exists
+	if err := ensureParentDir(item.DestPath); err != nil {
+		return err
+	}
+
 	// Progress callback
 	progressCallback := func(progress float64) {
 		if int(progress)%20 == 0 {
@@ -112,12 +280,16 @@ func (s *DecryptStrategy) Process(ctx context.Context, item *model.Item) error {
 		}
 	}
 
+	pub := &publication{}
+	defer pub.discard()
+	destTemp := pub.stage(item.DestPath)
+
 	// Decrypt file with context
-	err := s.decryptor.DecryptFile(
+	err = decryptor.DecryptFile(
 		ctx,
 		item.SourcePath,
 		item.KeyPath,
-		item.DestPath,
+		destTemp,
 		progressCallback,
 	)
 	if err != nil {
@@ -126,31 +298,98 @@ func (s *DecryptStrategy) Process(ctx context.Context, item *model.Item) error {
 
 	// Verify checksum if enabled
 	if s.verifyChecksum {
-		// Checksum file is based on the ORIGINAL source file that was encrypted
-		// For decryption: item.SourcePath is data.txt.enc, original was data.txt
-		// Remove .enc extension to get original filename, then add .sha256
-		originalFile := filepath.Base(item.SourcePath)
-		originalFile = originalFile[:len(originalFile)-4] // Remove ".enc"
-		checksumPath := filepath.Join(filepath.Dir(item.SourcePath), originalFile+".sha256")
-
-		if _, err := os.Stat(checksumPath); err == nil {
-			expectedChecksum, err := crypto.LoadChecksum(checksumPath)
-			if err != nil {
-				s.logger.Error("Failed to load checksum for verification", "error", err)
-			} else {
-				valid, err := crypto.VerifyChecksum(item.DestPath, expectedChecksum)
-				if err != nil {
-					return fmt.Errorf("failed to verify checksum: %w", err)
-				}
-				if !valid {
-					return fmt.Errorf("checksum verification failed")
-				}
-				s.logger.Info("Checksum verified", "file", item.DestPath, "checksum_file", checksumPath)
+		if err := s.verify(item, destTemp); err != nil {
+			if errors.Is(err, errChecksumMismatch) {
+				s.quarantine(item, destTemp)
 			}
-		} else {
-			s.logger.Info("Checksum file not found, skipping verification", "checksum_file", checksumPath)
+			return err
+		}
+	}
+
+	return pub.publish(s.publish.DoneMarker)
+}
+
+// verify checks the decrypted output at path against the checksum in the
+// container header or the .sha256 file next to the encrypted file
+func (s *DecryptStrategy) verify(item *model.Item, path string) error {
+	// Self-describing containers carry their own checksum
+	if header, err := crypto.ReadContainerHeader(item.SourcePath); err == nil && header.Checksum != "" {
+		valid, err := crypto.VerifyChecksum(path, header.Checksum)
+		if err != nil {
+			return fmt.Errorf("failed to verify checksum: %w", err)
 		}
+		if !valid {
+			return errChecksumMismatch
+		}
+		s.logger.Info("Checksum verified", "file", item.DestPath, "source", "container header")
+		return nil
+	}
+
+	// Checksum file is based on the ORIGINAL source file that was encrypted
+	// For decryption: item.SourcePath is data.txt.enc, original was data.txt
+	// Remove .enc extension to get original filename, then add .sha256
+	originalFile := filepath.Base(item.SourcePath)
+	originalFile = originalFile[:len(originalFile)-4] // Remove ".enc"
+	checksumPath := filepath.Join(filepath.Dir(item.SourcePath), originalFile+".sha256")
+
+	if _, err := os.Stat(checksumPath); os.IsNotExist(err) {
+		s.logger.Info("Checksum file not found, skipping verification", "checksum_file", checksumPath)
+		return nil
+	}
+
+	// A checksum file that cannot be read leaves the output unverified, so
+	// it is not published; the item is retried
+	expectedChecksum, err := crypto.LoadChecksum(checksumPath)
+	if err != nil {
+		return fmt.Errorf("failed to load checksum for verification: %w", err)
+	}
+	if sum, err := hex.DecodeString(expectedChecksum); err != nil || len(sum) != sha256.Size {
+		return fmt.Errorf("invalid checksum in %s", checksumPath)
 	}
 
+	valid, err := crypto.VerifyChecksum(path, expectedChecksum)
+	if err != nil {
+		return fmt.Errorf("failed to verify checksum: %w", err)
+	}
+	if !valid {
+		return errChecksumMismatch
+	}
+	s.logger.Info("Checksum verified", "file", item.DestPath, "checksum_file", checksumPath)
+	return nil
+}
+
+// quarantine moves decrypted output that failed verification to the
+// quarantine directory. Without one the output is left to be discarded.
+func (s *DecryptStrategy) quarantine(item *model.Item, path string) {
+	if s.publish.QuarantineDir == "" {
+		s.logger.Error("Checksum mismatch, discarding decrypted file", "id", item.ID, "file", item.SourcePath)
+		return
+	}
+
+	// Only the service may read plaintext that failed verification
+	if err := os.MkdirAll(s.publish.QuarantineDir, 0700); err != nil {
+		s.logger.Error("Failed to create quarantine directory", "dir", s.publish.QuarantineDir, "error", err)
+		return
+	}
+
+	quarantined := filepath.Join(s.publish.QuarantineDir, filepath.Base(item.DestPath))
+	if err := os.Rename(path, quarantined); err != nil {
+		s.logger.Error("Failed to quarantine decrypted file", "file", item.SourcePath, "error", err)
+		return
+	}
+	s.logger.Error("Checksum mismatch, decrypted file quarantined", "id", item.ID, "file", item.SourcePath, "quarantine", quarantined)
+}
+
+// ensureParentDir creates the parent directories of the given paths
+func ensureParentDir(paths ...string) error {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		dir := filepath.Dir(path)
+		if err := os.MkdirAll(dir, 0750); err != nil { // #nosec G301 - mirrors source directory layout
+			return fmt.Errorf("failed to create destination directory: %w", err)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,191 @@
+package watcher
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// stabilityTracker follows files that are still being written. Each file has
+// its own timer, so a slow upload never holds up detection of other files: a
+// file is reported stable once its size and modification time stay unchanged
+// for the quiet period, or as soon as its writer closes it where the platform
+// reports that (see closeWatcher). Every write pushes the check back.
+type stabilityTracker struct {
+	quiet  time.Duration
+	stable func(path string)
+
+	mu      sync.Mutex
+	files   map[string]*trackedFile
+	running int // stable callbacks in progress
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// trackedFile is a file waiting to be stable
+type trackedFile struct {
+	timer   *time.Timer
+	size    int64
+	modTime time.Time
+	closed  bool // the writer closed the file after the last change
+}
+
+// newStabilityTracker creates a tracker that calls stable, from its own
+// goroutine, for each file that stopped changing for quiet
+func newStabilityTracker(quiet time.Duration, stable func(path string)) *stabilityTracker {
+	if quiet == 0 {
+		quiet = 1 * time.Second
+	}
+
+	return &stabilityTracker{
+		quiet:  quiet,
+		stable: stable,
+		files:  map[string]*trackedFile{},
+	}
+}
+
+// Track starts following a file, or records a change to a file already
+// followed. It reports whether the file was new to the tracker.
+func (t *stabilityTracker) Track(path string) bool {
+	_, added := t.track(path, true)
+	return added
+}
+
+// Touch records a change to a file already followed. It reports whether the
+// file is followed.
+func (t *stabilityTracker) Touch(path string) bool {
+	followed, _ := t.track(path, false)
+	return followed
+}
+
+// track does the work of Track and Touch
+func (t *stabilityTracker) track(path string, start bool) (followed, added bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Forget(path)
+		return false, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.stopped {
+		return false, false
+	}
+
+	f, ok := t.files[path]
+	if !ok {
+		if !start {
+			return false, false
+		}
+		f = &trackedFile{size: info.Size(), modTime: info.ModTime()}
+		f.timer = time.AfterFunc(t.quiet, func() { t.check(path) })
+		t.files[path] = f
+		return true, true
+	}
+
+	// Events can arrive after the close that ended the writes; only a real
+	// change makes a closed file wait again
+	if f.closed && info.Size() == f.size && info.ModTime().Equal(f.modTime) {
+		return true, false
+	}
+
+	f.size, f.modTime, f.closed = info.Size(), info.ModTime(), false
+	f.timer.Reset(t.quiet)
+	return true, false
+}
+
+// Closed records that the writer of a followed file closed it, which makes
+// the file stable right away. It reports whether the file is followed.
+func (t *stabilityTracker) Closed(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Forget(path)
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	f, ok := t.files[path]
+	if !ok || t.stopped {
+		return ok
+	}
+
+	f.size, f.modTime, f.closed = info.Size(), info.ModTime(), true
+	f.timer.Reset(0)
+	return true
+}
+
+// Forget stops following a file that was removed or renamed
+func (t *stabilityTracker) Forget(path string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if f, ok := t.files[path]; ok {
+		f.timer.Stop()
+		delete(t.files, path)
+	}
+}
+
+// Stop stops following all files and waits for the stable callbacks in
+// progress. Files still being written are found again by the next scan.
+func (t *stabilityTracker) Stop() {
+	t.mu.Lock()
+	t.stopped = true
+	for path, f := range t.files {
+		f.timer.Stop()
+		delete(t.files, path)
+	}
+	t.mu.Unlock()
+
+	t.wg.Wait()
+}
+
+// pending returns the number of files followed or being queued
+func (t *stabilityTracker) pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.files) + t.running
+}
+
+// check runs when a file's timer fires: a file unchanged since it was last
+// seen, or since it was closed, is reported stable; a changed one waits
+// another quiet period
+func (t *stabilityTracker) check(path string) {
+	info, statErr := os.Stat(path)
+
+	t.mu.Lock()
+	f, ok := t.files[path]
+	if !ok || t.stopped {
+		t.mu.Unlock()
+		return
+	}
+
+	if statErr != nil {
+		delete(t.files, path)
+		t.mu.Unlock()
+		return
+	}
+
+	if info.Size() != f.size || !info.ModTime().Equal(f.modTime) {
+		f.size, f.modTime, f.closed = info.Size(), info.ModTime(), false
+		f.timer.Reset(t.quiet)
+		t.mu.Unlock()
+		return
+	}
+
+	delete(t.files, path)
+	t.running++
+	t.wg.Add(1)
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		t.running--
+		t.mu.Unlock()
+		t.wg.Done()
+	}()
+	t.stable(path)
+}
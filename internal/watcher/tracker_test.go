@@ -0,0 +1,180 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stableFiles collects the files a tracker reports as stable
+type stableFiles struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+func (s *stableFiles) add(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths = append(s.paths, path)
+}
+
+func (s *stableFiles) get() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.paths...)
+}
+
+func newTestTracker(t *testing.T, quiet time.Duration) (*stabilityTracker, *stableFiles) {
+	t.Helper()
+
+	stable := &stableFiles{}
+	tracker := newStabilityTracker(quiet, stable.add)
+	t.Cleanup(tracker.Stop)
+	return tracker, stable
+}
+
+func TestNewStabilityTracker_DefaultQuietPeriod(t *testing.T) {
+	tracker := newStabilityTracker(0, func(string) {})
+	assert.Equal(t, 1*time.Second, tracker.quiet)
+}
+
+func TestStabilityTracker_StableFile(t *testing.T) {
+	tracker, stable := newTestTracker(t, 100*time.Millisecond)
+
+	file := filepath.Join(t.TempDir(), "report.csv")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+
+	assert.True(t, tracker.Track(file))
+	assert.False(t, tracker.Track(file), "a followed file is not new")
+
+	require.Eventually(t, func() bool { return tracker.pending() == 0 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{file}, stable.get())
+}
+
+func TestStabilityTracker_WritesPushBackCheck(t *testing.T) {
+	tracker, stable := newTestTracker(t, 200*time.Millisecond)
+
+	file := filepath.Join(t.TempDir(), "upload.bin")
+	f, err := os.Create(file) // #nosec G304 - test file
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	require.True(t, tracker.Track(file))
+	for i := 0; i < 10; i++ {
+		time.Sleep(50 * time.Millisecond)
+		_, err := f.Write([]byte("chunk"))
+		require.NoError(t, err)
+		assert.True(t, tracker.Touch(file))
+	}
+	assert.Empty(t, stable.get(), "file reported stable while being written")
+
+	require.Eventually(t, func() bool { return len(stable.get()) == 1 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestStabilityTracker_ChangeWithoutEvent(t *testing.T) {
+	tracker, stable := newTestTracker(t, 100*time.Millisecond)
+
+	file := filepath.Join(t.TempDir(), "upload.bin")
+	require.NoError(t, os.WriteFile(file, []byte("part"), 0600))
+	require.True(t, tracker.Track(file))
+
+	// The size check catches writes whose events were missed
+	require.NoError(t, os.WriteFile(file, []byte("part and more"), 0600))
+	time.Sleep(150 * time.Millisecond)
+	assert.Empty(t, stable.get())
+
+	require.Eventually(t, func() bool { return len(stable.get()) == 1 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestStabilityTracker_Closed(t *testing.T) {
+	tracker, stable := newTestTracker(t, time.Hour)
+
+	file := filepath.Join(t.TempDir(), "report.csv")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+
+	assert.False(t, tracker.Closed(file), "file not followed yet")
+	require.True(t, tracker.Track(file))
+	assert.True(t, tracker.Closed(file))
+
+	// A late event for the closed file does not restart the wait
+	assert.True(t, tracker.Touch(file))
+
+	require.Eventually(t, func() bool { return len(stable.get()) == 1 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestStabilityTracker_RemovedFile(t *testing.T) {
+	tracker, stable := newTestTracker(t, 100*time.Millisecond)
+	dir := t.TempDir()
+
+	removed := filepath.Join(dir, "removed.csv")
+	require.NoError(t, os.WriteFile(removed, []byte("data"), 0600))
+	require.True(t, tracker.Track(removed))
+	require.NoError(t, os.Remove(removed))
+
+	renamed := filepath.Join(dir, "renamed.csv")
+	require.NoError(t, os.WriteFile(renamed, []byte("data"), 0600))
+	require.True(t, tracker.Track(renamed))
+	tracker.Forget(renamed)
+
+	require.Eventually(t, func() bool { return tracker.pending() == 0 }, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(150 * time.Millisecond)
+	assert.Empty(t, stable.get())
+	assert.False(t, tracker.Track(removed))
+}
+
+// TestStabilityTracker_UploadsDoNotBlockEachOther checks that many files
+// become stable while another one is still being written
+func TestStabilityTracker_UploadsDoNotBlockEachOther(t *testing.T) {
+	tracker, stable := newTestTracker(t, 500*time.Millisecond)
+	dir := t.TempDir()
+
+	var files []string
+	for i := 0; i < 1000; i++ {
+		file := filepath.Join(dir, fmt.Sprintf("file-%04d.csv", i))
+		require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+		files = append(files, file)
+	}
+
+	slow := filepath.Join(dir, "slow.bin")
+	f, err := os.Create(slow) // #nosec G304 - test file
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	require.True(t, tracker.Track(slow))
+
+	for _, file := range files {
+		require.True(t, tracker.Track(file))
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for len(stable.get()) < 1000 {
+		require.True(t, time.Now().Before(deadline), "files not reported while another upload is in progress")
+		_, err := f.Write([]byte("chunk"))
+		require.NoError(t, err)
+		tracker.Touch(slow)
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.NotContains(t, stable.get(), slow)
+	assert.Equal(t, 1, tracker.pending())
+}
+
+func TestStabilityTracker_Stop(t *testing.T) {
+	stable := &stableFiles{}
+	tracker := newStabilityTracker(100*time.Millisecond, stable.add)
+
+	file := filepath.Join(t.TempDir(), "report.csv")
+	require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+	require.True(t, tracker.Track(file))
+
+	tracker.Stop()
+	assert.False(t, tracker.Track(file))
+	assert.Equal(t, 0, tracker.pending())
+
+	time.Sleep(150 * time.Millisecond)
+	assert.Empty(t, stable.get())
+}
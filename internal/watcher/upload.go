@@ -0,0 +1,156 @@
+package watcher
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gitrgoliveira/vault-file-encryption/internal/archive"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/objectstore"
+)
+
+// KeyFileMetadata names the object metadata that holds the base64 encoded
+// key file when a destination stores keys as metadata
+const KeyFileMetadata = "vault-key-file"
+
+// UploadStrategy encrypts files into an S3-compatible bucket instead of a
+// local directory. The ciphertext is streamed with a multipart upload, so it
+// is never written locally.
+type UploadStrategy struct {
+	encryptor         *crypto.Encryptor
+	store             *objectstore.Client
+	logger            logger.Logger
+	calculateChecksum bool
+	keyStorage        string // config.KeyStorageObject or config.KeyStorageMetadata
+	doneMarker        bool
+}
+
+// NewUploadStrategy creates a new upload strategy
+func NewUploadStrategy(enc *crypto.Encryptor, store *objectstore.Client, log logger.Logger, calculateChecksum bool, keyStorage string, doneMarker bool) *UploadStrategy {
+	return &UploadStrategy{
+		encryptor:         enc,
+		store:             store,
+		logger:            log,
+		calculateChecksum: calculateChecksum,
+		keyStorage:        keyStorage,
+		doneMarker:        doneMarker,
+	}
+}
+
+// Process encrypts a file, or a directory as one archive, to the bucket.
+// The item's destination is relative to the bucket prefix until it has been
+// uploaded; it then holds the s3:// URL of the object, as does its key path
+// when the key is stored as a separate object.
+func (s *UploadStrategy) Process(ctx context.Context, item *model.Item) error {
+	encryptor, err := s.encryptor.ForKey(itemKeyRef(item))
+	if err != nil {
+		return err
+	}
+
+	key, err := s.objectKey(item.DestPath)
+	if err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(key, ".enc")
+
+	filename := filepath.Base(item.SourcePath)
+	var src io.ReadCloser
+	if item.Archive != "" {
+		filename += "." + archive.Extension(item.Archive)
+		src = archive.Reader(ctx, item.SourcePath, item.Archive)
+	} else if src, err = os.Open(item.SourcePath); err != nil { // #nosec G304 - queued source file
+		return fmt.Errorf("failed to open source file: %w", err)
+	}
+	defer func() { _ = src.Close() }()
+
+	// The upload reads the ciphertext as it is produced; it starts once the
+	// data key exists, so the key can go in the object metadata
+	pr, pw := io.Pipe()
+	var uploaded chan error
+	ciphertext, info, err := encryptor.EncryptStreamTo(ctx, src, func(ciphertext string) (io.Writer, error) {
+		var metadata map[string]string
+		if s.keyStorage == config.KeyStorageMetadata {
+			// Size and checksum are only known at the end of the stream
+			data, err := encryptor.NewStreamKeyFile(filename, 0, ciphertext, "").Marshal()
+			if err != nil {
+				return nil, err
+			}
+			metadata = map[string]string{KeyFileMetadata: base64.StdEncoding.EncodeToString(data)}
+		}
+
+		uploaded = make(chan error, 1)
+		go func() {
+			err := s.store.Upload(ctx, key, pr, metadata)
+			pr.CloseWithError(err)
+			uploaded <- err
+		}()
+		return pw, nil
+	})
+	pw.CloseWithError(err)
+	if uploaded != nil {
+		if uploadErr := <-uploaded; err == nil {
+			err = uploadErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	item.DestPath = s.store.URL(key)
+	item.KeyPath = ""
+
+	if s.calculateChecksum {
+		item.Checksum = info.Checksum
+		checksumKey := base + ".sha256"
+		if err := s.store.Put(ctx, checksumKey, []byte(item.Checksum), nil); err != nil {
+			return fmt.Errorf("failed to save checksum: %w", err)
+		}
+		item.ChecksumPath = s.store.URL(checksumKey)
+	}
+
+	if s.keyStorage != config.KeyStorageMetadata {
+		data, err := encryptor.NewStreamKeyFile(filename, info.Size, ciphertext, item.Checksum).Marshal()
+		if err != nil {
+			return fmt.Errorf("failed to build key file: %w", err)
+		}
+		keyKey := base + ".key"
+		if err := s.store.Put(ctx, keyKey, data, nil); err != nil {
+			return fmt.Errorf("failed to save encrypted key: %w", err)
+		}
+		item.KeyPath = s.store.URL(keyKey)
+	}
+
+	// Objects appear whole, but one at a time; the marker follows them all
+	if s.doneMarker {
+		if err := s.store.Put(ctx, key+doneMarkerSuffix, nil, nil); err != nil {
+			return fmt.Errorf("failed to write done marker: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// objectKey returns the object key of an item's destination: a path relative
+// to the bucket prefix, or the s3:// URL of an earlier attempt
+func (s *UploadStrategy) objectKey(dest string) (string, error) {
+	if !objectstore.IsURL(dest) {
+		return s.store.Key(filepath.ToSlash(dest)), nil
+	}
+
+	bucket, key, err := objectstore.ParseURL(dest)
+	if err != nil {
+		return "", err
+	}
+	if bucket != s.store.Bucket() {
+		return "", fmt.Errorf("item destination %s is not in bucket %s", dest, s.store.Bucket())
+	}
+	return key, nil
+}
@@ -2,7 +2,9 @@ package watcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -10,8 +12,11 @@ import (
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/archive"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/interfaces"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/ledger"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
 )
@@ -19,16 +24,83 @@ import (
 // Watcher watches directories for file changes
 type Watcher struct {
 	fsWatcher *fsnotify.Watcher
+	closes    *closeWatcher // nil where close events are not available
 	queue     interfaces.Queue
-	detector  *PartialUploadDetector
+	tracker   *stabilityTracker
+	ledger    *ledger.Ledger
 	logger    logger.Logger
 	mu        sync.RWMutex
 
-	// Configuration
-	encryptSourceDir string
-	encryptDestDir   string
-	decryptSourceDir string
-	decryptDestDir   string
+	// Configuration: one route per watched source tree
+	routes []*route
+
+	// Orphan markers and unmarked files already reported, so each is logged
+	// once; only used by the Start goroutine
+	reportedMarkers map[string]bool
+
+	// Source trees are rescanned every reconcileInterval (0 disables it),
+	// and files unprocessed for stuckAfter are reported
+	reconcileInterval time.Duration
+	stuckAfter        time.Duration
+
+	// Stuck files already reported and when files were first found in a
+	// failed or dead letter directory, guarded by stuckMu rather than mu
+	stuckMu       sync.Mutex
+	reportedStuck map[string]bool
+	stuckSince    map[string]time.Time
+
+	// Pollers of the trees in watch mode "poll" or "hybrid" send their
+	// changes to polled; pollers is only used by the Start goroutine, which
+	// UpdateConfig asks through reload to start and stop pollers
+	polled  chan fsnotify.Event
+	pollers map[pollKey]context.CancelFunc
+	reload  chan struct{}
+}
+
+// sourceTracker is implemented by queues that know which source files are
+// waiting or being processed
+type sourceTracker interface {
+	Queued(sourcePath string) bool
+}
+
+// route is a watched source tree and where its files are queued to
+type route struct {
+	rule         string
+	operation    model.OperationType
+	sourceDir    string
+	destDir      string
+	recursive    bool
+	filter       *FileFilter
+	transitMount string
+	keyName      string
+	keep         bool // source files stay in place and are tracked in the ledger
+
+	// archiveCompression is set when directories marked ready are encrypted
+	// as one archive ("none" or "gzip")
+	archiveCompression string
+
+	// markerSuffixes is set when files wait for a marker instead of a
+	// stability check (trigger "marker")
+	markerSuffixes []string
+	markerTimeout  time.Duration
+
+	// pollInterval is set when the tree is listed periodically (watch mode
+	// "poll" or "hybrid"); events is false when it raises no usable events
+	pollInterval time.Duration
+	events       bool
+
+	// failedDir and dlqDir hold the files that failed processing
+	failedDir string
+	dlqDir    string
+}
+
+// readyMarkerSuffix names the file that marks a directory as complete:
+// reports.ready next to reports/ queues the whole directory
+const readyMarkerSuffix = ".ready"
+
+// readyMarker returns the marker file of a directory encrypted as one archive
+func readyMarker(item *model.Item) string {
+	return item.SourcePath + readyMarkerSuffix
 }
 
 // Config holds watcher configuration
@@ -36,145 +108,408 @@ type Config struct {
 	// Encryption directories
 	EncryptSourceDir string
 	EncryptDestDir   string
+	EncryptRecursive bool
 
 	// Decryption directories
 	DecryptSourceDir string
 	DecryptDestDir   string
+	DecryptRecursive bool
+
+	// Include/exclude glob patterns (see FileFilter)
+	EncryptInclude []string
+	EncryptExclude []string
+	DecryptInclude []string
+	DecryptExclude []string
+
+	// Rules are additional source trees, each with its own transit key (see
+	// RulesFromConfig). The Encrypt*/Decrypt* fields above describe a default
+	// rule per operation and may be left empty when Rules covers them.
+	Rules []RuleConfig
 
 	// Stability check duration
 	StabilityDuration time.Duration
+
+	// How often source trees are rescanned for missed files (0 disables
+	// it), and how long files may stay unprocessed before they are reported
+	ReconcileInterval time.Duration
+	StuckAfter        time.Duration
+
+	// Ledger of processed files that were kept in place; files of rules with
+	// source_file_behavior "keep" found in it unchanged are not queued again
+	Ledger *ledger.Ledger
 }
 
 // NewWatcher creates a new file watcher
 func NewWatcher(cfg *Config, q interfaces.Queue, log logger.Logger) (*Watcher, error) {
+	routes, err := buildRoutes(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	fsWatcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create fs watcher: %w", err)
 	}
 
-	detector := NewPartialUploadDetector(cfg.StabilityDuration)
+	closes, err := newCloseWatcher()
+	if err != nil {
+		log.Error("Close events unavailable, files are stable after the stability duration", "error", err)
+	}
 
 	w := &Watcher{
-		fsWatcher:        fsWatcher,
-		queue:            q,
-		detector:         detector,
-		logger:           log,
-		encryptSourceDir: cfg.EncryptSourceDir,
-		encryptDestDir:   cfg.EncryptDestDir,
-		decryptSourceDir: cfg.DecryptSourceDir,
-		decryptDestDir:   cfg.DecryptDestDir,
+		fsWatcher:         fsWatcher,
+		closes:            closes,
+		queue:             q,
+		ledger:            cfg.Ledger,
+		logger:            log,
+		routes:            routes,
+		reconcileInterval: cfg.ReconcileInterval,
+		stuckAfter:        stuckAfterOrDefault(cfg.StuckAfter),
+		polled:            make(chan fsnotify.Event),
+		pollers:           map[pollKey]context.CancelFunc{},
+		reload:            make(chan struct{}, 1),
 	}
+	w.tracker = newStabilityTracker(cfg.StabilityDuration, w.queueStableFile)
 
 	return w, nil
 }
 
-// UpdateConfig safely updates the watcher's configuration.
-func (w *Watcher) UpdateConfig(cfg *config.Config) error {
-	w.mu.Lock()
-	defer w.mu.Unlock()
-
-	newCfg := &Config{
-		EncryptSourceDir: cfg.Encryption.SourceDir,
-		EncryptDestDir:   cfg.Encryption.DestDir,
-		DecryptSourceDir: cfg.Decryption.SourceDir,
-		DecryptDestDir:   cfg.Decryption.DestDir,
+// buildRoutes creates the routes for the default directories and the rules
+// of cfg, skipping rules without a source directory
+func buildRoutes(cfg *Config) ([]*route, error) {
+	rules := []RuleConfig{
+		{
+			Name:      config.DefaultRuleName,
+			Operation: model.OperationEncrypt,
+			SourceDir: cfg.EncryptSourceDir,
+			DestDir:   cfg.EncryptDestDir,
+			Recursive: cfg.EncryptRecursive,
+			Include:   cfg.EncryptInclude,
+			Exclude:   cfg.EncryptExclude,
+		},
+		{
+			Name:      config.DefaultRuleName,
+			Operation: model.OperationDecrypt,
+			SourceDir: cfg.DecryptSourceDir,
+			DestDir:   cfg.DecryptDestDir,
+			Recursive: cfg.DecryptRecursive,
+			Include:   cfg.DecryptInclude,
+			Exclude:   cfg.DecryptExclude,
+		},
 	}
+	rules = append(rules, cfg.Rules...)
 
-	// Update encryption source directory watch
-	if newCfg.EncryptSourceDir != w.encryptSourceDir {
-		if w.encryptSourceDir != "" {
-			if err := w.fsWatcher.Remove(w.encryptSourceDir); err != nil {
-				w.logger.Error("Failed to remove old encrypt source dir from watcher", "dir", w.encryptSourceDir, "error", err)
+	var routes []*route
+	for _, rule := range rules {
+		if rule.SourceDir == "" {
+			continue
+		}
+
+		filter, err := NewFileFilter(rule.Include, rule.Exclude)
+		if err != nil {
+			if rule.Operation == model.OperationDecrypt {
+				return nil, fmt.Errorf("invalid decryption file filter for rule '%s': %w", rule.Name, err)
 			}
+			return nil, fmt.Errorf("invalid encryption file filter for rule '%s': %w", rule.Name, err)
 		}
-		if newCfg.EncryptSourceDir != "" {
-			if err := w.fsWatcher.Add(newCfg.EncryptSourceDir); err != nil {
-				return fmt.Errorf("failed to add new encrypt source dir to watcher: %w", err)
+
+		archiveCompression := ""
+		if rule.ArchiveDirectories {
+			archiveCompression = rule.ArchiveCompression
+			if archiveCompression == "" {
+				archiveCompression = archive.CompressionNone
 			}
-			w.logger.Info("Now watching new encryption source directory", "dir", newCfg.EncryptSourceDir)
 		}
-		w.encryptSourceDir = newCfg.EncryptSourceDir
-		w.encryptDestDir = newCfg.EncryptDestDir
-	}
 
-	// Update decryption source directory watch
-	if newCfg.DecryptSourceDir != w.decryptSourceDir {
-		if w.decryptSourceDir != "" {
-			if err := w.fsWatcher.Remove(w.decryptSourceDir); err != nil {
-				w.logger.Error("Failed to remove old decrypt source dir from watcher", "dir", w.decryptSourceDir, "error", err)
+		var markerSuffixes []string
+		markerTimeout := rule.MarkerTimeout
+		if rule.Trigger == config.TriggerMarker {
+			markerSuffixes = rule.MarkerSuffixes
+			if len(markerSuffixes) == 0 {
+				markerSuffixes = config.DefaultMarkerSuffixes
+			}
+			if markerTimeout == 0 {
+				markerTimeout = config.DefaultMarkerTimeout
 			}
 		}
-		if newCfg.DecryptSourceDir != "" {
-			if err := w.fsWatcher.Add(newCfg.DecryptSourceDir); err != nil {
-				return fmt.Errorf("failed to add new decrypt source dir to watcher: %w", err)
+
+		failedDir, dlqDir := rule.FailedDir, rule.DLQDir
+		if failedDir == "" {
+			failedDir = filepath.Join(rule.SourceDir, "failed")
+		}
+		if dlqDir == "" {
+			dlqDir = filepath.Join(rule.SourceDir, "dlq")
+		}
+
+		var pollInterval time.Duration
+		if rule.WatchMode == config.WatchModePoll || rule.WatchMode == config.WatchModeHybrid {
+			pollInterval = rule.PollInterval
+			if pollInterval == 0 {
+				pollInterval = config.DefaultPollInterval
 			}
-			w.logger.Info("Now watching new decryption source directory", "dir", newCfg.DecryptSourceDir)
 		}
-		w.decryptSourceDir = newCfg.DecryptSourceDir
-		w.decryptDestDir = newCfg.DecryptDestDir
+
+		routes = append(routes, &route{
+			rule:         rule.Name,
+			operation:    rule.Operation,
+			sourceDir:    rule.SourceDir,
+			destDir:      rule.DestDir,
+			recursive:    rule.Recursive,
+			filter:       filter,
+			transitMount: rule.TransitMount,
+			keyName:      rule.KeyName,
+			keep:         rule.SourceFileBehavior == "keep",
+
+			archiveCompression: archiveCompression,
+			markerSuffixes:     markerSuffixes,
+			markerTimeout:      markerTimeout,
+			pollInterval:       pollInterval,
+			events:             rule.WatchMode != config.WatchModePoll,
+			failedDir:          failedDir,
+			dlqDir:             dlqDir,
+		})
+	}
+
+	return routes, nil
+}
+
+// UpdateConfig safely updates the watcher's configuration.
+func (w *Watcher) UpdateConfig(cfg *config.Config) error {
+	routes, err := buildRoutes(&Config{Rules: RulesFromConfig(cfg)})
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Start and stop pollers once the new routes are in place
+	defer func() {
+		select {
+		case w.reload <- struct{}{}:
+		default:
+		}
+	}()
+
+	// Stop watching trees that are no longer configured
+	removed := false
+	for _, old := range w.routes {
+		if !hasTree(routes, old) {
+			w.unwatchTree(old.sourceDir)
+			removed = true
+		}
 	}
 
+	// Watch new trees; after a removal re-add the remaining trees too, as
+	// unwatching a parent tree also removes nested ones
+	for _, r := range routes {
+		isNew := !hasTree(w.routes, r)
+		if (!isNew && !removed) || !r.events {
+			continue
+		}
+		if err := w.watchTree(r.sourceDir, r.sourceDir, r.recursive); err != nil {
+			return fmt.Errorf("failed to add new %s source dir to watcher: %w", r.operation, err)
+		}
+		if isNew {
+			w.logger.Info("Now watching new source directory", "dir", r.sourceDir, "operation", r.operation, "rule", r.rule, "recursive", r.recursive)
+		}
+	}
+
+	w.routes = routes
+	w.reconcileInterval = cfg.Queue.ReconcileInterval
+	w.stuckAfter = stuckAfterOrDefault(cfg.Queue.StuckAfter)
+
 	return nil
 }
 
+// stuckAfterOrDefault returns d, or the default stuck threshold when unset
+func stuckAfterOrDefault(d time.Duration) time.Duration {
+	if d <= 0 {
+		return config.DefaultStuckAfter
+	}
+	return d
+}
+
+// hasTree reports whether routes watches the same tree as r for events
+func hasTree(routes []*route, r *route) bool {
+	for _, other := range routes {
+		if other.sourceDir == r.sourceDir && other.recursive == r.recursive && other.events == r.events {
+			return true
+		}
+	}
+	return false
+}
+
 // Start starts watching the configured directories
 func (w *Watcher) Start(ctx context.Context) error {
 	// Add directories to watch
 	w.mu.RLock()
-	encryptSrc := w.encryptSourceDir
-	decryptSrc := w.decryptSourceDir
+	routes := append([]*route(nil), w.routes...)
 	w.mu.RUnlock()
 
-	if encryptSrc != "" {
-		if err := w.fsWatcher.Add(encryptSrc); err != nil {
-			return fmt.Errorf("failed to watch encrypt source dir: %w", err)
-		}
-		w.logger.Info("Watching encryption source directory", "dir", encryptSrc)
+	// Pollers stop when Start returns, whatever the reason
+	pollCtx, stopPolling := context.WithCancel(ctx)
+	defer stopPolling()
 
-		// Scan for pre-existing files in encryption source directory
-		if err := w.scanDirectory(ctx, encryptSrc, model.OperationEncrypt); err != nil {
-			w.logger.Error("Failed to scan encryption source directory", "dir", encryptSrc, "error", err)
+	for _, r := range routes {
+		if r.events {
+			if err := w.watchTree(r.sourceDir, r.sourceDir, r.recursive); err != nil {
+				return fmt.Errorf("failed to watch %s source dir: %w", r.operation, err)
+			}
 		}
-	}
-
-	if decryptSrc != "" {
-		if err := w.fsWatcher.Add(decryptSrc); err != nil {
-			return fmt.Errorf("failed to watch decrypt source dir: %w", err)
+		// Polling starts before the scan, so files written in between are
+		// not missed
+		if r.pollInterval > 0 {
+			w.startPoller(pollCtx, r)
 		}
-		w.logger.Info("Watching decryption source directory", "dir", decryptSrc)
+		w.logger.Info("Watching source directory", "dir", r.sourceDir, "operation", r.operation, "rule", r.rule,
+			"recursive", r.recursive, "poll_interval", r.pollInterval)
 
-		// Scan for pre-existing files in decryption source directory
-		if err := w.scanDirectory(ctx, decryptSrc, model.OperationDecrypt); err != nil {
-			w.logger.Error("Failed to scan decryption source directory", "dir", decryptSrc, "error", err)
+		// Scan for pre-existing files in the source directory
+		if err := w.scanDirectory(ctx, r.sourceDir, r.operation); err != nil {
+			w.logger.Error("Failed to scan source directory", "dir", r.sourceDir, "operation", r.operation, "error", err)
 		}
 	}
 
-	// Watch for events
+	markerCheck := time.NewTicker(markerCheckInterval)
+	defer markerCheck.Stop()
+	defer w.tracker.Stop()
+
+	// Source trees are rescanned periodically, and right away when events
+	// were lost; a reconciliation runs in the background, one at a time
+	reconcileDue := w.reconcileAfter()
+	var reconciling <-chan struct{}
+	rerun := false
+
+	// Watch for events. Stability checks run on the tracker's timers, so no
+	// file holds up the events of the others.
 	for {
 		select {
 		case <-ctx.Done():
-			return w.fsWatcher.Close()
+			if reconciling != nil {
+				<-reconciling
+			}
+			return w.Stop()
+
+		case <-markerCheck.C:
+			w.checkMarkers()
+
+		case <-reconcileDue:
+			reconcileDue = nil
+			reconciling = w.startReconcile(ctx, false)
+
+		case <-reconciling:
+			reconciling = nil
+			if rerun {
+				rerun = false
+				reconciling = w.startReconcile(ctx, true)
+			} else {
+				reconcileDue = w.reconcileAfter()
+			}
+
+		case <-w.reload:
+			w.syncPollers(pollCtx)
+			if reconciling == nil {
+				reconcileDue = w.reconcileAfter()
+			}
+
+		case path := <-w.closes.Events():
+			w.handleFileClosed(ctx, path)
+
+		case event := <-w.polled:
+			w.handleEvent(ctx, event)
 
 		case event, ok := <-w.fsWatcher.Events:
 			if !ok {
 				return nil
 			}
-
-			if event.Op&fsnotify.Create == fsnotify.Create {
-				w.handleFileCreated(ctx, event.Name)
-			}
+			w.handleEvent(ctx, event)
 
 		case err, ok := <-w.fsWatcher.Errors:
 			if !ok {
 				return nil
 			}
 			w.logger.Error("Watcher error", "error", err)
+
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.logger.Info("Reconciling source directories after lost events")
+				if reconciling != nil {
+					rerun = true
+				} else {
+					reconcileDue = nil
+					reconciling = w.startReconcile(ctx, true)
+				}
+			}
+		}
+	}
+}
+
+// handleEvent handles a file system event, raised by fsnotify or a poller
+func (w *Watcher) handleEvent(ctx context.Context, event fsnotify.Event) {
+	switch {
+	case event.Op&fsnotify.Create == fsnotify.Create:
+		w.handleFileCreated(ctx, event.Name)
+	case event.Op&(fsnotify.Write|fsnotify.Chmod) != 0:
+		w.handleFileWritten(ctx, event.Name)
+	case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+		// A renamed file is created again under its new name
+		w.tracker.Forget(event.Name)
+	}
+}
+
+// startPoller records the current state of a polled tree and starts polling
+// it; only called by the Start goroutine
+func (w *Watcher) startPoller(ctx context.Context, r *route) {
+	key := pollKey{dir: r.sourceDir, recursive: r.recursive, interval: r.pollInterval}
+	if _, ok := w.pollers[key]; ok {
+		return
+	}
+
+	p := newPoller(r.sourceDir, r.recursive, w.logger)
+	p.poll()
+
+	ctx, cancel := context.WithCancel(ctx)
+	w.pollers[key] = cancel
+	go p.run(ctx, r.pollInterval, w.polled)
+}
+
+// syncPollers starts pollers for the polled trees of the current routes and
+// stops the others; only called by the Start goroutine
+func (w *Watcher) syncPollers(ctx context.Context) {
+	w.mu.RLock()
+	var polled []*route
+	wanted := map[pollKey]bool{}
+	for _, r := range w.routes {
+		if r.pollInterval > 0 {
+			polled = append(polled, r)
+			wanted[pollKey{dir: r.sourceDir, recursive: r.recursive, interval: r.pollInterval}] = true
+		}
+	}
+	w.mu.RUnlock()
+
+	for key, cancel := range w.pollers {
+		if !wanted[key] {
+			cancel()
+			delete(w.pollers, key)
+		}
+	}
+
+	for _, r := range polled {
+		if _, ok := w.pollers[pollKey{dir: r.sourceDir, recursive: r.recursive, interval: r.pollInterval}]; !ok {
+			w.logger.Info("Now polling source directory", "dir", r.sourceDir, "operation", r.operation, "rule", r.rule,
+				"poll_interval", r.pollInterval)
+			w.startPoller(ctx, r)
 		}
 	}
 }
 
 // handleFileCreated handles a new file creation event
 func (w *Watcher) handleFileCreated(ctx context.Context, filePath string) {
+	// Files created while shutting down are found by the next scan
+	if ctx.Err() != nil {
+		return
+	}
+
 	// Check if it's a file (not directory)
 	info, err := os.Stat(filePath)
 	if err != nil {
@@ -183,194 +518,605 @@ func (w *Watcher) handleFileCreated(ctx context.Context, filePath string) {
 	}
 
 	if info.IsDir() {
+		w.handleDirCreated(ctx, filePath)
 		return
 	}
 
 	w.mu.RLock()
 	defer w.mu.RUnlock()
 
-	// Determine operation type based on directory
-	dir := filepath.Dir(filePath)
-	var operation model.OperationType
-	var destDir string
+	// Determine the rule (and so the operation) based on directory
+	r, destDir, ok := w.routeLocked(filePath)
+	if !ok {
+		return
+	}
 
-	//nolint:staticcheck // QF1003: Simple if-else is clearer than tagged switch for two different comparisons
-	if dir == w.encryptSourceDir {
-		// Skip .enc and .key files in encryption source
-		if strings.HasSuffix(filePath, ".enc") || strings.HasSuffix(filePath, ".key") {
+	if target, ok := r.markerTarget(filePath); ok {
+		w.handleMarkerLocked(r, filePath, target, destDir)
+		return
+	}
+
+	// Skip files this service writes and files of the other operation
+	if !isSourceFile(r.operation, filePath) || !w.matchesFilterLocked(r, filePath) {
+		return
+	}
+
+	if w.alreadyProcessed(r, filePath) || w.alreadyQueued(filePath) {
+		return
+	}
+
+	if r.markerTrigger() {
+		// The marker normally follows the file. One written first means the
+		// file may still be growing, so it has to be stable as well.
+		if _, ok := r.findMarker(filePath); !ok {
+			w.logger.Debug("File waiting for its marker", "file", filePath, "rule", r.rule)
 			return
 		}
-		operation = model.OperationEncrypt
-		destDir = w.encryptDestDir
-	} else if dir == w.decryptSourceDir {
-		// Only process .enc files for decryption
-		if !strings.HasSuffix(filePath, ".enc") {
+	}
+
+	// Wait for file to be stable (fully uploaded) without blocking other events
+	if w.tracker.Track(filePath) {
+		w.logger.Info("New file detected", "file", filePath, "operation", r.operation, "rule", r.rule)
+	}
+}
+
+// handleFileWritten handles a write or attribute change. Files already
+// followed wait longer; others, such as a kept file modified after it was
+// processed, are handled as new files.
+func (w *Watcher) handleFileWritten(ctx context.Context, filePath string) {
+	if w.tracker.Touch(filePath) {
+		return
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil || info.IsDir() {
+		return
+	}
+
+	w.handleFileCreated(ctx, filePath)
+}
+
+// handleFileClosed handles a file closed after being written, which makes
+// a followed file stable without waiting for the stability duration
+func (w *Watcher) handleFileClosed(ctx context.Context, filePath string) {
+	if w.tracker.Closed(filePath) {
+		return
+	}
+
+	// The close can be reported before the creation
+	w.handleFileCreated(ctx, filePath)
+	w.tracker.Closed(filePath)
+}
+
+// queueStableFile queues a file the stability tracker reports as complete,
+// or a marked file whose key file was not there yet. It runs on the
+// tracker's goroutines, so the route is looked up again in case the
+// configuration changed while the file was being written. w.mu is not held
+// while waiting for a key file, so a reload or other files are not held up.
+func (w *Watcher) queueStableFile(filePath string) {
+	w.mu.RLock()
+	r, destDir, ok := w.routeLocked(filePath)
+	if !ok || !isSourceFile(r.operation, filePath) || !w.matchesFilterLocked(r, filePath) {
+		w.mu.RUnlock()
+		return
+	}
+
+	markerPath := ""
+	if r.markerTrigger() {
+		// The marker may have been consumed by queueing the file already
+		if markerPath, ok = r.findMarker(filePath); !ok {
+			w.mu.RUnlock()
 			return
 		}
+	}
 
-		// Check if corresponding .key file exists (based on original filename)
-		// example.xlsx.enc -> example.xlsx.key
-		keyPath := strings.TrimSuffix(filePath, ".enc") + ".key"
+	w.mu.RUnlock()
 
-		// Wait for key file to appear (it might be written after .enc file)
-		// This handles the race condition where fsnotify detects .enc before .key is written
-		keyExists := false
-		for i := 0; i < 10; i++ { // Try for up to 1 second
-			if _, err := os.Stat(keyPath); err == nil {
-				keyExists = true
-				break
-			}
-			time.Sleep(100 * time.Millisecond)
+	// The ledger check hashes the file, so it runs without the lock
+	if w.alreadyProcessed(r, filePath) || w.alreadyQueued(filePath) {
+		// A marker written again for a file that needs no processing is spent
+		if markerPath != "" {
+			w.consumeMarker(markerPath)
 		}
+		return
+	}
 
-		if !keyExists {
+	if markerPath == "" {
+		w.logger.Info("File is stable", "file", filePath)
+	}
+
+	// Decryption needs the wrapped data key: either a sibling .key file or
+	// the header of a self-describing container. The .key file might be
+	// written after the .enc file, so wait briefly for it to appear.
+	keyPath := ""
+	if r.operation == model.OperationDecrypt {
+		if keyPath, ok = findDecryptionKey(filePath, 10); !ok {
 			w.logger.Error("Encrypted file without key file", "file", filePath)
 			return
 		}
-
-		operation = model.OperationDecrypt
-		destDir = w.decryptDestDir
-	} else {
-		return
 	}
 
-	w.logger.Info("New file detected", "file", filePath, "operation", operation)
-
-	// Wait for file to be stable (fully uploaded) with context support
-	if err := w.detector.WaitForStability(ctx, filePath, 5*time.Minute); err != nil {
-		w.logger.Error("File did not stabilize", "file", filePath, "error", err)
+	// The configuration may have changed while waiting for the key file
+	w.mu.RLock()
+	r, destDir, ok = w.routeLocked(filePath)
+	w.mu.RUnlock()
+	if !ok {
 		return
 	}
 
-	w.logger.Info("File is stable", "file", filePath)
-
-	// Create queue item
-	fileName := filepath.Base(filePath)
-	destPath := filepath.Join(destDir, fileName)
-
-	item := model.NewItem(operation, filePath, destPath)
-	item.FileSize = info.Size()
+	w.enqueueFile(r, filePath, destDir, keyPath, markerPath)
+}
 
-	// For decryption, set key path
-	if operation == model.OperationDecrypt {
-		// Key file is based on original filename: example.xlsx.enc -> example.xlsx.key
-		item.KeyPath = strings.TrimSuffix(filePath, ".enc") + ".key"
-		// Remove .enc from dest path
-		item.DestPath = strings.TrimSuffix(destPath, ".enc")
-	} else {
-		// For encryption, add .enc to destination and set key path based on original filename
-		item.DestPath = destPath + ".enc"
-		// Key file is based on the original source filename, stored in destination directory
-		originalName := filepath.Base(filePath)
-		item.KeyPath = filepath.Join(filepath.Dir(destPath), originalName+".key")
+// enqueueFile queues a file of r, consuming its marker if markerPath is set,
+// and reports whether it was queued. Routes are not changed once built, so
+// w.mu need not be held.
+func (w *Watcher) enqueueFile(r *route, filePath, destDir, keyPath, markerPath string) bool {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		w.logger.Error("Failed to stat file", "file", filePath, "error", err)
+		return false
 	}
 
-	// Enqueue for processing
+	item := newQueueItem(r, filePath, destDir, keyPath, info.Size())
 	if err := w.queue.Enqueue(item); err != nil {
 		w.logger.Error("Failed to enqueue item", "file", filePath, "error", err)
-		return
+		return false
+	}
+
+	if markerPath == "" {
+		w.logger.Info("File queued for processing", "file", filePath, "id", item.ID)
+		return true
 	}
 
-	w.logger.Info("File queued for processing", "file", filePath, "id", item.ID)
+	w.consumeMarker(markerPath)
+	w.logger.Info("Marked file queued for processing", "file", filePath, "marker", markerPath, "id", item.ID, "rule", r.rule)
+	return true
 }
 
 // Stop stops the watcher
 func (w *Watcher) Stop() error {
+	if err := w.closes.Close(); err != nil {
+		w.logger.Error("Failed to close close-event watcher", "error", err)
+	}
 	return w.fsWatcher.Close()
 }
 
 // scanDirectory scans a directory for pre-existing files and queues them for processing
+// once stable; marked files and directories are queued right away. In recursive mode, subdirectories (other than archive, failed and dlq) are scanned too.
 func (w *Watcher) scanDirectory(ctx context.Context, dir string, operation model.OperationType) error {
-	entries, err := os.ReadDir(dir)
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	filesFound, err := w.scanDirectoryLocked(ctx, dir, operation)
 	if err != nil {
-		return fmt.Errorf("failed to read directory: %w", err)
+		return err
 	}
 
-	w.mu.RLock()
-	defer w.mu.RUnlock()
+	if filesFound > 0 {
+		w.logger.Info("Pre-existing files found", "count", filesFound, "operation", operation, "dir", dir)
+	}
 
-	var destDir string
-	if operation == model.OperationEncrypt {
-		destDir = w.encryptDestDir
-	} else {
-		destDir = w.decryptDestDir
+	return nil
+}
+
+// scanDirectoryLocked does the work of scanDirectory; the caller must hold w.mu
+func (w *Watcher) scanDirectoryLocked(ctx context.Context, dir string, operation model.OperationType) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read directory: %w", err)
 	}
 
-	filesQueued := 0
+	filesFound := 0
 	for _, entry := range entries {
-		// Skip directories and subdirectories (archive, failed, dlq, etc.)
+		filePath := filepath.Join(dir, entry.Name())
+
+		// Descend into subdirectories in recursive mode; the processing
+		// directories and anything outside the watched tree are skipped by
+		// routeDirLocked
 		if entry.IsDir() {
+			if r, ok := w.routeDirLocked(filePath); ok && r.operation == operation {
+				queued, err := w.scanDirectoryLocked(ctx, filePath, operation)
+				if err != nil {
+					w.logger.Error("Failed to scan subdirectory", "dir", filePath, "error", err)
+				}
+				filesFound += queued
+			}
 			continue
 		}
 
-		filePath := filepath.Join(dir, entry.Name())
+		r, destDir, ok := w.routeLocked(filePath)
+		if !ok || r.operation != operation {
+			continue
+		}
 
-		// Apply same filtering as handleFileCreated
-		if operation == model.OperationEncrypt {
-			// Skip .enc and .key files in encryption source
-			if strings.HasSuffix(filePath, ".enc") || strings.HasSuffix(filePath, ".key") || strings.HasSuffix(filePath, ".sha256") {
-				continue
-			}
-		} else if operation == model.OperationDecrypt {
-			// Only process .enc files for decryption
-			if !strings.HasSuffix(filePath, ".enc") {
-				continue
+		if target, ok := r.markerTarget(filePath); ok {
+			if w.handleMarkerLocked(r, filePath, target, destDir) {
+				filesFound++
 			}
+			continue
+		}
 
-			// Check if corresponding .key file exists
-			keyPath := strings.TrimSuffix(filePath, ".enc") + ".key"
-			if _, err := os.Stat(keyPath); os.IsNotExist(err) {
-				w.logger.Error("Encrypted file without key file", "file", filePath)
-				continue
-			}
+		// Files of marker-triggered rules are queued through their marker
+		if r.markerTrigger() {
+			continue
 		}
 
-		// Get file info
-		info, err := entry.Info()
-		if err != nil {
-			w.logger.Error("Failed to get file info", "file", filePath, "error", err)
+		// Apply same filtering as handleFileCreated
+		if !isSourceFile(operation, filePath) || !w.matchesFilterLocked(r, filePath) {
 			continue
 		}
 
-		// Wait for file to be stable (fully uploaded) with context support
-		if err := w.detector.WaitForStability(ctx, filePath, 5*time.Minute); err != nil {
-			w.logger.Error("File did not stabilize", "file", filePath, "error", err)
+		if w.alreadyProcessed(r, filePath) || w.alreadyQueued(filePath) {
+			continue
+		}
+
+		// Queued once stable (fully uploaded), without holding up the scan
+		if w.tracker.Track(filePath) {
+			w.logger.Info("Pre-existing file found", "file", filePath, "operation", operation, "rule", r.rule)
+			filesFound++
+		}
+	}
+
+	return filesFound, nil
+}
+
+// handleDirCreated starts watching a new subdirectory in recursive mode and
+// queues any files that were written before the watch was added
+func (w *Watcher) handleDirCreated(ctx context.Context, dirPath string) {
+	w.mu.RLock()
+	r, ok := w.routeDirLocked(dirPath)
+	w.mu.RUnlock()
+
+	if !ok {
+		return
+	}
+	operation := r.operation
+
+	if err := w.watchTree(r.sourceDir, dirPath, true); err != nil {
+		w.logger.Error("Failed to watch new subdirectory", "dir", dirPath, "error", err)
+		return
+	}
+
+	w.logger.Info("Watching new subdirectory", "dir", dirPath, "operation", operation)
+
+	if err := w.scanDirectory(ctx, dirPath, operation); err != nil {
+		w.logger.Error("Failed to scan new subdirectory", "dir", dirPath, "error", err)
+	}
+}
+
+// routeLocked determines the route and mirrored destination directory for a
+// file inside one of the watched source trees; the caller must hold w.mu.
+// When several trees match (nested configurations), the deepest root wins.
+func (w *Watcher) routeLocked(filePath string) (*route, string, bool) {
+	dir := filepath.Dir(filePath)
+	if w.inProcessingDirLocked(dir) {
+		return nil, "", false
+	}
+
+	var match *route
+	var destDir string
+
+	for _, r := range w.routes {
+		if match != nil && len(r.sourceDir) <= len(match.sourceDir) {
 			continue
 		}
+		if rel, ok := relativeDir(r.sourceDir, dir, r.recursive); ok {
+			match = r
+			destDir = filepath.Join(r.destDir, rel)
+		}
+	}
+
+	return match, destDir, match != nil
+}
 
-		w.logger.Info("Pre-existing file found and stable", "file", filePath, "operation", operation)
+// newQueueItem creates the queue item for a file matched by r. Encrypted
+// files are written to destDir as <name>.enc with a <name>.key; decrypted
+// files drop the .enc suffix. keyPath is the wrapped key of a file to be
+// decrypted ("" for containers).
+func newQueueItem(r *route, filePath, destDir, keyPath string, size int64) *model.Item {
+	fileName := filepath.Base(filePath)
+	destPath := filepath.Join(destDir, fileName)
 
-		// Create queue item
-		fileName := filepath.Base(filePath)
-		destPath := filepath.Join(destDir, fileName)
+	item := model.NewItem(r.operation, filePath, destPath)
+	item.FileSize = size
+	item.Rule = r.rule
+	item.TransitMount = r.transitMount
+	item.KeyName = r.keyName
 
-		item := model.NewItem(operation, filePath, destPath)
-		item.FileSize = info.Size()
+	if r.operation == model.OperationDecrypt {
+		// Key file is based on original filename: example.xlsx.enc -> example.xlsx.key
+		// (empty for self-describing containers)
+		item.KeyPath = keyPath
+		// Remove .enc from dest path
+		item.DestPath = strings.TrimSuffix(destPath, ".enc")
+	} else {
+		// For encryption, add .enc to destination; the key file is based on
+		// the original source filename, stored in the destination directory
+		item.DestPath = destPath + ".enc"
+		item.KeyPath = filepath.Join(destDir, fileName+".key")
+	}
 
-		// For decryption, set key path
-		if operation == model.OperationDecrypt {
-			item.KeyPath = strings.TrimSuffix(filePath, ".enc") + ".key"
-			item.DestPath = strings.TrimSuffix(destPath, ".enc")
+	return item
+}
+
+// queueMarkedDirLocked queues the directory a ready marker belongs to, to be
+// encrypted as one archive. The marker is written once the directory is
+// complete, so there is no stability wait; include and exclude patterns
+// apply to files, not to marked directories. It reports whether an item was
+// queued; the caller must hold w.mu.
+func (w *Watcher) queueMarkedDirLocked(r *route, markerPath, destDir string) bool {
+	dirPath := strings.TrimSuffix(markerPath, readyMarkerSuffix)
+	info, err := os.Stat(dirPath)
+	if err != nil || !info.IsDir() {
+		w.logger.Debug("Skipping ready marker without directory", "marker", markerPath, "rule", r.rule)
+		return false
+	}
+
+	if w.alreadyQueued(dirPath) {
+		return false
+	}
+
+	size, err := archive.Size(dirPath)
+	if err != nil {
+		w.logger.Error("Failed to read marked directory", "dir", dirPath, "error", err)
+		return false
+	}
+
+	item := newArchiveItem(r, dirPath, destDir, size)
+	if err := w.queue.Enqueue(item); err != nil {
+		w.logger.Error("Failed to enqueue item", "dir", dirPath, "error", err)
+		return false
+	}
+
+	w.logger.Info("Directory queued for processing", "dir", dirPath, "id", item.ID, "compression", r.archiveCompression)
+	return true
+}
+
+// newArchiveItem creates the queue item for a directory encrypted as one
+// archive: reports/ becomes reports.tar.enc (or .tar.gz.enc) with a
+// reports.tar.key in destDir
+func newArchiveItem(r *route, dirPath, destDir string, size int64) *model.Item {
+	name := filepath.Base(dirPath) + "." + archive.Extension(r.archiveCompression)
+
+	item := model.NewItem(r.operation, dirPath, filepath.Join(destDir, name+".enc"))
+	item.KeyPath = filepath.Join(destDir, name+".key")
+	item.FileSize = size
+	item.Rule = r.rule
+	item.TransitMount = r.transitMount
+	item.KeyName = r.keyName
+	item.Archive = r.archiveCompression
+
+	return item
+}
+
+// findDecryptionKey locates the wrapped data key for an encrypted file. It
+// returns the sibling .key path, or "" when the file is a self-describing
+// container. The .key file is polled up to attempts times, 100ms apart.
+func findDecryptionKey(filePath string, attempts int) (string, bool) {
+	if isContainer, err := crypto.IsContainer(filePath); err == nil && isContainer {
+		return "", true
+	}
+
+	keyPath := strings.TrimSuffix(filePath, ".enc") + ".key"
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+		if _, err := os.Stat(keyPath); err == nil {
+			return keyPath, true
+		}
+	}
+
+	return "", false
+}
+
+// matchesFilterLocked applies the route's include/exclude patterns to a
+// file, logging skipped files at debug level; the caller must hold w.mu
+func (w *Watcher) matchesFilterLocked(r *route, filePath string) bool {
+	relPath, err := filepath.Rel(r.sourceDir, filePath)
+	if err != nil {
+		relPath = filepath.Base(filePath)
+	}
+
+	ok, rule := r.filter.Match(relPath)
+	if !ok {
+		w.logger.Debug("Skipping file excluded by filter", "file", filePath, "operation", r.operation, "rule", rule)
+	}
+
+	return ok
+}
+
+// alreadyProcessed reports whether a file of a keep rule is in the ledger and
+// unchanged since it was processed
+func (w *Watcher) alreadyProcessed(r *route, filePath string) bool {
+	if !r.keep || w.ledger == nil || !w.ledger.Processed(filePath) {
+		return false
+	}
+
+	w.logger.Debug("Skipping file already processed", "file", filePath, "operation", r.operation, "rule", r.rule)
+	return true
+}
+
+// alreadyQueued reports whether a file is waiting in the queue or being
+// processed, e.g. after a restart or a replay from the dead letter queue
+func (w *Watcher) alreadyQueued(filePath string) bool {
+	tracker, ok := w.queue.(sourceTracker)
+	if !ok || !tracker.Queued(filePath) {
+		return false
+	}
+
+	w.logger.Debug("Skipping file already queued", "file", filePath)
+	return true
+}
+
+// walkRouteTree calls fn for each file in the source tree of r that r owns,
+// with its mirrored destination directory, skipping subtrees of other routes
+// and processing directories. The walk can take long on large or network
+// trees, so w.mu is only held to route each entry, not across the walk.
+func (w *Watcher) walkRouteTree(ctx context.Context, r *route, fn func(path, destDir string, d fs.DirEntry)) {
+	_ = filepath.WalkDir(r.sourceDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || ctx.Err() != nil {
+			return nil
+		}
+
+		w.mu.RLock()
+		var owned bool
+		var destDir string
+		if d.IsDir() {
+			sub, ok := w.routeDirLocked(path)
+			owned = path == r.sourceDir || (ok && sub == r)
 		} else {
-			// For encryption, add .enc to destination and set key path based on original filename
-			item.DestPath = destPath + ".enc"
-			originalName := filepath.Base(filePath)
-			item.KeyPath = filepath.Join(filepath.Dir(destPath), originalName+".key")
+			var owner *route
+			owner, destDir, owned = w.routeLocked(path)
+			owned = owned && owner == r
+		}
+		w.mu.RUnlock()
+
+		switch {
+		case d.IsDir() && !owned:
+			return filepath.SkipDir
+		case !d.IsDir() && owned:
+			fn(path, destDir, d)
+		}
+		return nil
+	})
+}
+
+// routeDirLocked determines the route of a subdirectory of a recursively
+// watched source tree; the caller must hold w.mu
+func (w *Watcher) routeDirLocked(dirPath string) (*route, bool) {
+	if w.inProcessingDirLocked(dirPath) {
+		return nil, false
+	}
+
+	var match *route
+
+	for _, r := range w.routes {
+		// The root of a nested rule is watched and scanned by that rule
+		if rel, ok := relativeDir(r.sourceDir, dirPath, false); ok && rel == "." {
+			return nil, false
 		}
 
-		// Enqueue for processing
-		if err := w.queue.Enqueue(item); err != nil {
-			w.logger.Error("Failed to enqueue item", "file", filePath, "error", err)
+		if !r.recursive || (match != nil && len(r.sourceDir) <= len(match.sourceDir)) {
 			continue
 		}
+		if _, ok := relativeDir(r.sourceDir, dirPath, true); ok {
+			match = r
+		}
+	}
+
+	return match, match != nil
+}
+
+// inProcessingDirLocked reports whether dir is inside the archive, failed,
+// dlq or quarantine directory of any route, so a rule nested inside another rule's tree
+// does not have its processed files picked up again; the caller must hold w.mu
+func (w *Watcher) inProcessingDirLocked(dir string) bool {
+	for _, r := range w.routes {
+		rel, err := filepath.Rel(r.sourceDir, dir)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if processingDirs[strings.SplitN(rel, string(filepath.Separator), 2)[0]] {
+			return true
+		}
+	}
+	return false
+}
+
+// watchTree adds start to the fsnotify watch list. In recursive mode every
+// subdirectory of start is added too, except the processing subdirectories
+// (archive, failed, dlq, quarantine) directly under root.
+func (w *Watcher) watchTree(root, start string, recursive bool) error {
+	if !recursive {
+		return w.watchDir(start)
+	}
+
+	return filepath.WalkDir(start, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if path == start {
+				return err
+			}
+			w.logger.Error("Failed to access directory", "dir", path, "error", err)
+			return nil
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		if _, ok := relativeDir(root, path, true); !ok {
+			return filepath.SkipDir
+		}
+
+		if err := w.watchDir(path); err != nil {
+			if path == start {
+				return err
+			}
+			w.logger.Error("Failed to watch subdirectory", "dir", path, "error", err)
+		}
+
+		return nil
+	})
+}
 
-		w.logger.Info("Pre-existing file queued for processing", "file", filePath, "id", item.ID)
-		filesQueued++
+// unwatchTree removes root and all of its subdirectories from the watch list
+func (w *Watcher) unwatchTree(root string) {
+	for _, path := range w.fsWatcher.WatchList() {
+		if _, ok := relativeDir(root, path, true); !ok {
+			continue
+		}
+		if err := w.fsWatcher.Remove(path); err != nil {
+			w.logger.Error("Failed to remove directory from watcher", "dir", path, "error", err)
+		}
+		w.closes.Remove(path)
 	}
+}
 
-	if filesQueued > 0 {
-		w.logger.Info("Pre-existing files queued", "count", filesQueued, "operation", operation)
+// watchDir adds a directory to the fsnotify watch list and, where close
+// events are available, to the close watcher. Without close events files
+// are stable after the stability duration, so that failure is only logged.
+func (w *Watcher) watchDir(dir string) error {
+	if err := w.fsWatcher.Add(dir); err != nil {
+		return err
 	}
 
+	if err := w.closes.Add(dir); err != nil {
+		w.logger.Error("Failed to watch directory for close events", "dir", dir, "error", err)
+	}
 	return nil
 }
+
+// processingDirs are the subdirectories created inside each source directory
+// for processed files; they are never watched or scanned
+var processingDirs = map[string]bool{
+	"archive":    true,
+	"failed":     true,
+	"dlq":        true,
+	"quarantine": true,
+}
+
+// relativeDir returns dir relative to root if dir belongs to the watched tree.
+// Without recursion only root itself belongs to the tree; with recursion any
+// subdirectory does, except the processing subdirectories directly under root.
+func relativeDir(root, dir string, recursive bool) (string, bool) {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return "", false
+	}
+
+	if rel == "." {
+		return rel, true
+	}
+
+	if !recursive || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+
+	first := strings.SplitN(rel, string(filepath.Separator), 2)[0]
+	if processingDirs[first] {
+		return "", false
+	}
+
+	return rel, true
+}
@@ -4,13 +4,18 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gitrgoliveira/vault-file-encryption/internal/config"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/ledger"
+	"github.com/gitrgoliveira/vault-file-encryption/internal/metrics"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/model"
 
+	"github.com/gitrgoliveira/vault-file-encryption/internal/crypto"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/logger"
 	"github.com/gitrgoliveira/vault-file-encryption/internal/queue"
 	"github.com/stretchr/testify/assert"
@@ -74,15 +79,23 @@ func setupTestWatcher(t *testing.T, cfg *Config) (*Watcher, *queue.Queue, string
 	// Create watcher
 	watcher, err := NewWatcher(cfg, q, log)
 	require.NoError(t, err)
+	t.Cleanup(func() { _ = watcher.Stop() })
 
 	return watcher, q, tmpDir
 }
 
+// settle waits until the stability tracker has queued or dropped every file
+// it followed
+func settle(t *testing.T, w *Watcher) {
+	t.Helper()
+	require.Eventually(t, func() bool { return w.tracker.pending() == 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
 func TestNewWatcher(t *testing.T) {
 	watcher, q, _ := setupTestWatcher(t, nil)
 	require.NotNil(t, watcher)
 	require.NotNil(t, watcher.fsWatcher)
-	require.NotNil(t, watcher.detector)
+	require.NotNil(t, watcher.tracker)
 	require.NotNil(t, watcher.queue)
 	assert.Equal(t, q, watcher.queue)
 }
@@ -112,7 +125,7 @@ func TestWatcher_HandleFileCreated_EncryptOperation(t *testing.T) {
 	watcher.handleFileCreated(ctx, testFile)
 
 	// Wait a bit for processing
-	time.Sleep(200 * time.Millisecond)
+	settle(t, watcher)
 
 	// Check if item was queued
 	item := q.Dequeue()
@@ -138,7 +151,7 @@ func TestWatcher_HandleFileCreated_SkipEncFiles(t *testing.T) {
 	ctx := context.Background()
 	watcher.handleFileCreated(ctx, encFile)
 
-	time.Sleep(200 * time.Millisecond)
+	settle(t, watcher)
 
 	// Should not be queued
 	item := q.Dequeue()
@@ -157,7 +170,7 @@ func TestWatcher_HandleFileCreated_SkipKeyFiles(t *testing.T) {
 	ctx := context.Background()
 	watcher.handleFileCreated(ctx, keyFile)
 
-	time.Sleep(200 * time.Millisecond)
+	settle(t, watcher)
 
 	// Should not be queued
 	item := q.Dequeue()
@@ -182,7 +195,7 @@ func TestWatcher_HandleFileCreated_DecryptOperation(t *testing.T) {
 	watcher.handleFileCreated(ctx, encFile)
 
 	// Wait for stability check
-	time.Sleep(200 * time.Millisecond)
+	settle(t, watcher)
 
 	// Check if item was queued
 	item := q.Dequeue()
@@ -208,13 +221,50 @@ func TestWatcher_HandleFileCreated_DecryptWithoutKey(t *testing.T) {
 	ctx := context.Background()
 	watcher.handleFileCreated(ctx, encFile)
 
-	time.Sleep(200 * time.Millisecond)
+	settle(t, watcher)
 
 	// Should not be queued (missing key file)
 	item := q.Dequeue()
 	assert.Nil(t, item)
 }
 
+func TestWatcher_QueueStableFile_KeyWaitDoesNotHoldLock(t *testing.T) {
+	watcher, q, tmpDir := setupTestWatcher(t, nil)
+
+	decryptSrc := filepath.Join(tmpDir, "decrypt-src")
+	encFile := filepath.Join(decryptSrc, "test.enc")
+	keyFile := filepath.Join(decryptSrc, "test.key")
+	require.NoError(t, os.WriteFile(encFile, []byte("encrypted data"), 0600))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		watcher.queueStableFile(encFile)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// A reload is not held up while the key file is awaited
+	locked := make(chan struct{})
+	go func() {
+		watcher.mu.Lock()
+		watcher.mu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(300 * time.Millisecond):
+		t.Fatal("watcher lock held while waiting for the key file")
+	}
+
+	require.NoError(t, os.WriteFile(keyFile, []byte("vault:v1:key"), 0600))
+	<-done
+
+	item := q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, encFile, item.SourcePath)
+	assert.Equal(t, keyFile, item.KeyPath)
+}
+
 func TestWatcher_HandleFileCreated_SkipNonEncFilesInDecryptDir(t *testing.T) {
 	watcher, q, tmpDir := setupTestWatcher(t, nil)
 
@@ -227,7 +277,7 @@ func TestWatcher_HandleFileCreated_SkipNonEncFilesInDecryptDir(t *testing.T) {
 	ctx := context.Background()
 	watcher.handleFileCreated(ctx, txtFile)
 
-	time.Sleep(200 * time.Millisecond)
+	settle(t, watcher)
 
 	// Should not be queued
 	item := q.Dequeue()
@@ -246,7 +296,7 @@ func TestWatcher_HandleFileCreated_Directory(t *testing.T) {
 	ctx := context.Background()
 	watcher.handleFileCreated(ctx, subDir)
 
-	time.Sleep(200 * time.Millisecond)
+	settle(t, watcher)
 
 	// Directories should not be queued
 	item := q.Dequeue()
@@ -262,7 +312,7 @@ func TestWatcher_HandleFileCreated_NonExistentFile(t *testing.T) {
 	ctx := context.Background()
 	watcher.handleFileCreated(ctx, nonExistent)
 
-	time.Sleep(200 * time.Millisecond)
+	settle(t, watcher)
 
 	// Should not crash, and nothing should be queued
 	item := q.Dequeue()
@@ -284,9 +334,9 @@ func TestWatcher_HandleFileCreated_ContextCancellation(t *testing.T) {
 
 	watcher.handleFileCreated(ctx, testFile)
 
-	time.Sleep(200 * time.Millisecond)
+	settle(t, watcher)
 
-	// Should not be queued due to context cancellation during stability check
+	// Should not be followed once the context is cancelled
 	item := q.Dequeue()
 	assert.Nil(t, item)
 }
@@ -339,10 +389,13 @@ func TestWatcher_UpdateConfig(t *testing.T) {
 
 	// Verify config was updated
 	watcher.mu.RLock()
-	assert.Equal(t, newEncryptSrc, watcher.encryptSourceDir)
-	assert.Equal(t, newEncryptDest, watcher.encryptDestDir)
-	assert.Equal(t, newDecryptSrc, watcher.decryptSourceDir)
-	assert.Equal(t, newDecryptDest, watcher.decryptDestDir)
+	require.Len(t, watcher.routes, 2)
+	assert.Equal(t, model.OperationEncrypt, watcher.routes[0].operation)
+	assert.Equal(t, newEncryptSrc, watcher.routes[0].sourceDir)
+	assert.Equal(t, newEncryptDest, watcher.routes[0].destDir)
+	assert.Equal(t, model.OperationDecrypt, watcher.routes[1].operation)
+	assert.Equal(t, newDecryptSrc, watcher.routes[1].sourceDir)
+	assert.Equal(t, newDecryptDest, watcher.routes[1].destDir)
 	watcher.mu.RUnlock()
 }
 
@@ -443,9 +496,745 @@ func TestWatcher_FileFromOtherDirectory(t *testing.T) {
 	ctx := context.Background()
 	watcher.handleFileCreated(ctx, testFile)
 
-	time.Sleep(200 * time.Millisecond)
+	settle(t, watcher)
 
 	// Should not be queued (not from watched directories)
 	item := q.Dequeue()
 	assert.Nil(t, item)
 }
+
+func TestWatcher_ScanDirectory_NonRecursiveSkipsSubdirectories(t *testing.T) {
+	watcher, q, tmpDir := setupTestWatcher(t, nil)
+
+	encryptSrc := filepath.Join(tmpDir, "encrypt-src")
+	nestedDir := filepath.Join(encryptSrc, "2024", "01", "02")
+	require.NoError(t, os.MkdirAll(nestedDir, 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(nestedDir, "nested.txt"), []byte("nested"), 0600))
+
+	err := watcher.scanDirectory(context.Background(), encryptSrc, model.OperationEncrypt)
+	require.NoError(t, err)
+	settle(t, watcher)
+
+	assert.Equal(t, 0, q.Size())
+}
+
+func TestWatcher_ScanDirectory_RecursiveMirrorsDestination(t *testing.T) {
+	watcher, q, tmpDir := setupTestWatcher(t, &Config{EncryptRecursive: true})
+
+	encryptSrc := filepath.Join(tmpDir, "encrypt-src")
+	encryptDest := filepath.Join(tmpDir, "encrypt-dest")
+
+	nestedDir := filepath.Join(encryptSrc, "2024", "01", "02")
+	require.NoError(t, os.MkdirAll(nestedDir, 0750))
+	nestedFile := filepath.Join(nestedDir, "report.csv")
+	require.NoError(t, os.WriteFile(nestedFile, []byte("nested"), 0600))
+
+	// Files in processing subdirectories must never be picked up
+	for _, sub := range []string{"archive", "failed", "dlq"} {
+		dir := filepath.Join(encryptSrc, sub)
+		require.NoError(t, os.MkdirAll(dir, 0750))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "old.txt"), []byte("old"), 0600))
+	}
+
+	err := watcher.scanDirectory(context.Background(), encryptSrc, model.OperationEncrypt)
+	require.NoError(t, err)
+	settle(t, watcher)
+
+	require.Equal(t, 1, q.Size())
+	item := q.Dequeue()
+	require.NotNil(t, item)
+
+	mirroredDir := filepath.Join(encryptDest, "2024", "01", "02")
+	assert.Equal(t, nestedFile, item.SourcePath)
+	assert.Equal(t, filepath.Join(mirroredDir, "report.csv.enc"), item.DestPath)
+	assert.Equal(t, filepath.Join(mirroredDir, "report.csv.key"), item.KeyPath)
+}
+
+func TestWatcher_Recursive_NewSubdirectory(t *testing.T) {
+	watcher, q, tmpDir := setupTestWatcher(t, &Config{EncryptRecursive: true})
+
+	encryptSrc := filepath.Join(tmpDir, "encrypt-src")
+	encryptDest := filepath.Join(tmpDir, "encrypt-dest")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = watcher.Start(ctx)
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	// Create a nested folder after start-up and drop a file into it
+	nestedDir := filepath.Join(encryptSrc, "2025", "06")
+	require.NoError(t, os.MkdirAll(nestedDir, 0750))
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, os.WriteFile(filepath.Join(nestedDir, "late.txt"), []byte("late"), 0600))
+
+	require.Eventually(t, func() bool {
+		return q.Size() == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	item := q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, filepath.Join(encryptDest, "2025", "06", "late.txt.enc"), item.DestPath)
+}
+
+func TestWatcher_SlowUploadDoesNotBlockOthers(t *testing.T) {
+	watcher, q, tmpDir := setupTestWatcher(t, nil)
+	encryptSrc := filepath.Join(tmpDir, "encrypt-src")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = watcher.Start(ctx)
+	}()
+	time.Sleep(200 * time.Millisecond)
+
+	slow := filepath.Join(encryptSrc, "slow.bin")
+	f, err := os.Create(slow) // #nosec G304 - test file
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	fast := filepath.Join(encryptSrc, "fast.txt")
+	require.NoError(t, os.WriteFile(fast, []byte("fast"), 0600))
+
+	// The slow upload keeps writing while the other file is queued
+	deadline := time.Now().Add(5 * time.Second)
+	for q.Size() == 0 {
+		require.True(t, time.Now().Before(deadline), "file not queued while another upload is in progress")
+		_, err := f.Write([]byte("chunk"))
+		require.NoError(t, err)
+		time.Sleep(20 * time.Millisecond)
+	}
+	item := q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, fast, item.SourcePath)
+
+	require.NoError(t, f.Close())
+	require.Eventually(t, func() bool { return q.Size() == 1 }, 5*time.Second, 20*time.Millisecond)
+	item = q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, slow, item.SourcePath)
+}
+
+func TestWatcher_PollMode(t *testing.T) {
+	tmpDir := t.TempDir()
+	pollSrc := filepath.Join(tmpDir, "nfs")
+	require.NoError(t, os.MkdirAll(pollSrc, 0750))
+	existing := filepath.Join(pollSrc, "existing.csv")
+	require.NoError(t, os.WriteFile(existing, []byte("existing"), 0600))
+
+	watcher, q, _ := setupTestWatcher(t, &Config{
+		Rules: []RuleConfig{{
+			Name:         "nfs",
+			Operation:    model.OperationEncrypt,
+			SourceDir:    pollSrc,
+			DestDir:      filepath.Join(tmpDir, "nfs-dest"),
+			WatchMode:    config.WatchModePoll,
+			PollInterval: 100 * time.Millisecond,
+		}},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = watcher.Start(ctx)
+	}()
+
+	// Pre-existing files are found by the startup scan
+	require.Eventually(t, func() bool { return q.Size() == 1 }, 5*time.Second, 20*time.Millisecond)
+	item := q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, existing, item.SourcePath)
+	assert.NotContains(t, watcher.fsWatcher.WatchList(), pollSrc, "polled tree is not watched for events")
+
+	polled := filepath.Join(pollSrc, "polled.csv")
+	require.NoError(t, os.WriteFile(polled, []byte("polled"), 0600))
+
+	require.Eventually(t, func() bool { return q.Size() == 1 }, 5*time.Second, 20*time.Millisecond)
+	item = q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, polled, item.SourcePath)
+	assert.Equal(t, "nfs", item.Rule)
+}
+
+func TestWatcher_UpdateConfig_PollMode(t *testing.T) {
+	watcher, q, tmpDir := setupTestWatcher(t, nil)
+	encryptSrc := filepath.Join(tmpDir, "encrypt-src")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = watcher.Start(ctx)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	require.Contains(t, watcher.fsWatcher.WatchList(), encryptSrc)
+
+	require.NoError(t, watcher.UpdateConfig(&config.Config{
+		Encryption: config.EncryptionConfig{
+			SourceDir:    encryptSrc,
+			DestDir:      filepath.Join(tmpDir, "encrypt-dest"),
+			WatchMode:    config.WatchModePoll,
+			PollInterval: 100 * time.Millisecond,
+		},
+	}))
+	assert.NotContains(t, watcher.fsWatcher.WatchList(), encryptSrc)
+	time.Sleep(200 * time.Millisecond)
+
+	// Only the poller can find the file now
+	file := filepath.Join(encryptSrc, "late.csv")
+	require.NoError(t, os.WriteFile(file, []byte("late"), 0600))
+
+	require.Eventually(t, func() bool { return q.Size() == 1 }, 5*time.Second, 20*time.Millisecond)
+	item := q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, file, item.SourcePath)
+}
+
+func TestRelativeDir(t *testing.T) {
+	root := filepath.Join("data", "source")
+
+	tests := []struct {
+		name      string
+		dir       string
+		recursive bool
+		wantRel   string
+		wantOK    bool
+	}{
+		{"root", root, false, ".", true},
+		{"root recursive", root, true, ".", true},
+		{"nested non-recursive", filepath.Join(root, "a"), false, "", false},
+		{"nested recursive", filepath.Join(root, "a", "b"), true, filepath.Join("a", "b"), true},
+		{"archive excluded", filepath.Join(root, "archive"), true, "", false},
+		{"failed excluded", filepath.Join(root, "failed", "x"), true, "", false},
+		{"dlq excluded", filepath.Join(root, "dlq"), true, "", false},
+		{"nested archive allowed", filepath.Join(root, "a", "archive"), true, filepath.Join("a", "archive"), true},
+		{"outside root", filepath.Join("data", "other"), true, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rel, ok := relativeDir(root, tt.dir, tt.recursive)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantRel, rel)
+		})
+	}
+}
+
+func TestWatcher_ScanDirectory_AppliesFilter(t *testing.T) {
+	watcher, q, tmpDir := setupTestWatcher(t, &Config{
+		EncryptRecursive: true,
+		EncryptInclude:   []string{"*.csv"},
+		EncryptExclude:   []string{"**/tmp/**"},
+	})
+
+	encryptSrc := filepath.Join(tmpDir, "encrypt-src")
+	require.NoError(t, os.MkdirAll(filepath.Join(encryptSrc, "tmp"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(encryptSrc, "keep.csv"), []byte("a"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(encryptSrc, "skip.txt"), []byte("b"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(encryptSrc, "tmp", "skip.csv"), []byte("c"), 0600))
+
+	err := watcher.scanDirectory(context.Background(), encryptSrc, model.OperationEncrypt)
+	require.NoError(t, err)
+	settle(t, watcher)
+
+	require.Equal(t, 1, q.Size())
+	item := q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, filepath.Join(encryptSrc, "keep.csv"), item.SourcePath)
+}
+
+func TestWatcher_ScanDirectory_SkipsKeptFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	processed, err := ledger.Open(filepath.Join(tmpDir, "ledger.json"), false)
+	require.NoError(t, err)
+
+	encryptSrc := filepath.Join(tmpDir, "keep-src")
+	require.NoError(t, os.MkdirAll(encryptSrc, 0750))
+
+	watcher, q, _ := setupTestWatcher(t, &Config{
+		Rules: []RuleConfig{{
+			Name:               "kept",
+			Operation:          model.OperationEncrypt,
+			SourceDir:          encryptSrc,
+			DestDir:            filepath.Join(tmpDir, "keep-dest"),
+			SourceFileBehavior: "keep",
+		}},
+		Ledger: processed,
+	})
+
+	done := filepath.Join(encryptSrc, "done.txt")
+	changed := filepath.Join(encryptSrc, "changed.txt")
+	fresh := filepath.Join(encryptSrc, "new.txt")
+	for _, file := range []string{done, changed, fresh} {
+		require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+	}
+	for _, file := range []string{done, changed} {
+		entry, err := processed.Snapshot(file)
+		require.NoError(t, err)
+		require.NoError(t, processed.Record(file, entry))
+	}
+	require.NoError(t, os.WriteFile(changed, []byte("new data"), 0600))
+
+	err = watcher.scanDirectory(context.Background(), encryptSrc, model.OperationEncrypt)
+	require.NoError(t, err)
+	settle(t, watcher)
+
+	var queued []string
+	for item := q.Dequeue(); item != nil; item = q.Dequeue() {
+		queued = append(queued, item.SourcePath)
+	}
+	assert.ElementsMatch(t, []string{changed, fresh}, queued)
+}
+
+func TestWatcher_ScanDirectory_SkipsQueuedFiles(t *testing.T) {
+	watcher, q, tmpDir := setupTestWatcher(t, &Config{StabilityDuration: 10 * time.Millisecond})
+	encryptSrc := filepath.Join(tmpDir, "encrypt-src")
+
+	queuedFile := filepath.Join(encryptSrc, "queued.txt")
+	fresh := filepath.Join(encryptSrc, "new.txt")
+	for _, file := range []string{queuedFile, fresh} {
+		require.NoError(t, os.WriteFile(file, []byte("data"), 0600))
+	}
+
+	// Queued before a restart
+	existing := model.NewItem(model.OperationEncrypt, queuedFile, filepath.Join(tmpDir, "encrypt-dest", "queued.txt.enc"))
+	require.NoError(t, q.Enqueue(existing))
+
+	err := watcher.scanDirectory(context.Background(), encryptSrc, model.OperationEncrypt)
+	require.NoError(t, err)
+	settle(t, watcher)
+
+	var queued []string
+	for item := q.Dequeue(); item != nil; item = q.Dequeue() {
+		queued = append(queued, item.SourcePath)
+	}
+	assert.ElementsMatch(t, []string{queuedFile, fresh}, queued)
+}
+
+func TestNewWatcher_InvalidFilterPattern(t *testing.T) {
+	_, _, tmpDir := setupTestWatcher(t, nil)
+
+	_, err := NewWatcher(&Config{
+		EncryptSourceDir: filepath.Join(tmpDir, "encrypt-src"),
+		EncryptDestDir:   filepath.Join(tmpDir, "encrypt-dest"),
+		EncryptInclude:   []string{"[bad"},
+	}, nil, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid encryption file filter")
+}
+
+func TestWatcher_ScanDirectory_ContainerWithoutKeyFile(t *testing.T) {
+	watcher, q, tmpDir := setupTestWatcher(t, nil)
+
+	plainFile := filepath.Join(tmpDir, "plain.txt")
+	require.NoError(t, os.WriteFile(plainFile, []byte("container"), 0600))
+
+	decryptSrc := filepath.Join(tmpDir, "decrypt-src")
+	containerFile := filepath.Join(decryptSrc, "plain.txt.enc")
+	encryptor := crypto.NewEncryptor(&mockVaultClient{}, nil)
+	_, err := encryptor.EncryptFileContainer(context.Background(), plainFile, containerFile, nil)
+	require.NoError(t, err)
+
+	// A split-format .enc without its .key file is still skipped
+	require.NoError(t, os.WriteFile(filepath.Join(decryptSrc, "orphan.txt.enc"), []byte("FENC"), 0600))
+
+	err = watcher.scanDirectory(context.Background(), decryptSrc, model.OperationDecrypt)
+	require.NoError(t, err)
+	settle(t, watcher)
+
+	require.Equal(t, 1, q.Size())
+	item := q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, containerFile, item.SourcePath)
+	assert.Empty(t, item.KeyPath)
+	assert.Equal(t, filepath.Join(tmpDir, "decrypt-dest", "plain.txt"), item.DestPath)
+}
+
+func TestWatcher_ScanDirectory_NamedRuleRouting(t *testing.T) {
+	tmpDir := t.TempDir()
+	encryptSrc := filepath.Join(tmpDir, "encrypt-src")
+	financeSrc := filepath.Join(encryptSrc, "finance")
+	financeDest := filepath.Join(tmpDir, "finance-dest")
+	require.NoError(t, os.MkdirAll(filepath.Join(financeSrc, "archive"), 0750))
+
+	watcher, q, _ := setupTestWatcher(t, &Config{
+		EncryptSourceDir: encryptSrc,
+		EncryptRecursive: true,
+		Rules: []RuleConfig{{
+			Name:         "finance",
+			Operation:    model.OperationEncrypt,
+			SourceDir:    financeSrc,
+			DestDir:      financeDest,
+			TransitMount: "transit",
+			KeyName:      "finance",
+		}},
+	})
+
+	require.NoError(t, os.WriteFile(filepath.Join(encryptSrc, "general.txt"), []byte("general"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(financeSrc, "ledger.csv"), []byte("ledger"), 0600))
+	// Processed files of the nested rule are not picked up by the outer tree
+	require.NoError(t, os.WriteFile(filepath.Join(financeSrc, "archive", "old.csv"), []byte("old"), 0600))
+
+	// The outer scan leaves the nested rule's root to that rule
+	require.NoError(t, watcher.scanDirectory(context.Background(), encryptSrc, model.OperationEncrypt))
+	settle(t, watcher)
+	require.Equal(t, 1, q.Size())
+	item := q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, config.DefaultRuleName, item.Rule)
+	assert.Empty(t, item.KeyName)
+
+	require.NoError(t, watcher.scanDirectory(context.Background(), financeSrc, model.OperationEncrypt))
+	settle(t, watcher)
+	item = q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, "finance", item.Rule)
+	assert.Equal(t, "transit", item.TransitMount)
+	assert.Equal(t, "finance", item.KeyName)
+	assert.Equal(t, filepath.Join(financeDest, "ledger.csv.enc"), item.DestPath)
+	assert.Equal(t, filepath.Join(financeDest, "ledger.csv.key"), item.KeyPath)
+	assert.Nil(t, q.Dequeue())
+}
+
+func TestWatcher_ScanDirectory_ReadyMarkedDirectory(t *testing.T) {
+	tmpDir := t.TempDir()
+	bundleSrc := filepath.Join(tmpDir, "bundles")
+	bundleDest := filepath.Join(tmpDir, "bundles-dest")
+	reports := filepath.Join(bundleSrc, "reports")
+	require.NoError(t, os.MkdirAll(filepath.Join(reports, "q1"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(reports, "summary.txt"), []byte("summary"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(reports, "q1", "data.csv"), []byte("a,b"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(bundleSrc, "reports.ready"), nil, 0600))
+
+	// Directories without a marker are still being written; markers without
+	// a directory are ignored
+	require.NoError(t, os.MkdirAll(filepath.Join(bundleSrc, "incomplete"), 0750))
+	require.NoError(t, os.WriteFile(filepath.Join(bundleSrc, "missing.ready"), nil, 0600))
+
+	watcher, q, _ := setupTestWatcher(t, &Config{
+		Rules: []RuleConfig{{
+			Name:               "bundles",
+			Operation:          model.OperationEncrypt,
+			SourceDir:          bundleSrc,
+			DestDir:            bundleDest,
+			ArchiveDirectories: true,
+			ArchiveCompression: "gzip",
+		}},
+	})
+
+	require.NoError(t, watcher.scanDirectory(context.Background(), bundleSrc, model.OperationEncrypt))
+	settle(t, watcher)
+	require.Equal(t, 1, q.Size())
+
+	item := q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, reports, item.SourcePath)
+	assert.Equal(t, "gzip", item.Archive)
+	assert.Equal(t, filepath.Join(bundleDest, "reports.tar.gz.enc"), item.DestPath)
+	assert.Equal(t, filepath.Join(bundleDest, "reports.tar.gz.key"), item.KeyPath)
+	assert.Equal(t, int64(len("summary")+len("a,b")), item.FileSize)
+	assert.Equal(t, "bundles", item.Rule)
+}
+
+func TestWatcher_HandleFileCreated_ReadyMarkerWithoutArchiving(t *testing.T) {
+	watcher, q, tmpDir := setupTestWatcher(t, nil)
+
+	// Without archive_directories a .ready file is an ordinary file
+	encryptSrc := filepath.Join(tmpDir, "encrypt-src")
+	require.NoError(t, os.MkdirAll(filepath.Join(encryptSrc, "reports"), 0750))
+	marker := filepath.Join(encryptSrc, "reports.ready")
+	require.NoError(t, os.WriteFile(marker, []byte("ready"), 0600))
+
+	watcher.handleFileCreated(context.Background(), marker)
+	settle(t, watcher)
+
+	item := q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, marker, item.SourcePath)
+	assert.Empty(t, item.Archive)
+}
+
+// markerRule returns a marker-triggered encryption rule for directories in
+// tmpDir
+func markerRule(tmpDir string) RuleConfig {
+	return RuleConfig{
+		Name:           "markers",
+		Operation:      model.OperationEncrypt,
+		SourceDir:      filepath.Join(tmpDir, "encrypt-src"),
+		DestDir:        filepath.Join(tmpDir, "encrypt-dest"),
+		Trigger:        config.TriggerMarker,
+		MarkerSuffixes: config.DefaultMarkerSuffixes,
+		MarkerTimeout:  time.Hour,
+	}
+}
+
+func TestWatcher_HandleFileCreated_MarkerTrigger(t *testing.T) {
+	tmpDir := t.TempDir()
+	rule := markerRule(tmpDir)
+	require.NoError(t, os.MkdirAll(rule.SourceDir, 0750))
+
+	watcher, q, _ := setupTestWatcher(t, &Config{Rules: []RuleConfig{rule}})
+
+	file := filepath.Join(rule.SourceDir, "upload.csv")
+	require.NoError(t, os.WriteFile(file, []byte("a,b"), 0600))
+
+	// Stable but unmarked: still being uploaded as far as the watcher knows
+	watcher.handleFileCreated(context.Background(), file)
+	settle(t, watcher)
+	assert.Equal(t, 0, q.Size())
+
+	marker := file + ".done"
+	require.NoError(t, os.WriteFile(marker, nil, 0600))
+	watcher.handleFileCreated(context.Background(), marker)
+
+	item := q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, file, item.SourcePath)
+	assert.Equal(t, filepath.Join(tmpDir, "encrypt-dest", "upload.csv.enc"), item.DestPath)
+	assert.NoFileExists(t, marker, "marker is consumed")
+}
+
+func TestWatcher_ScanDirectory_MarkerTrigger(t *testing.T) {
+	tmpDir := t.TempDir()
+	decryptSrc := filepath.Join(tmpDir, "incoming")
+	require.NoError(t, os.MkdirAll(decryptSrc, 0750))
+
+	watcher, q, _ := setupTestWatcher(t, &Config{
+		Rules: []RuleConfig{{
+			Name:           "sftp",
+			Operation:      model.OperationDecrypt,
+			SourceDir:      decryptSrc,
+			DestDir:        filepath.Join(tmpDir, "out"),
+			Trigger:        config.TriggerMarker,
+			MarkerSuffixes: []string{".ok"},
+		}},
+	})
+
+	for _, name := range []string{"marked.csv", "unmarked.csv"} {
+		require.NoError(t, os.WriteFile(filepath.Join(decryptSrc, name+".enc"), []byte("encrypted"), 0600))
+		require.NoError(t, os.WriteFile(filepath.Join(decryptSrc, name+".key"), []byte("key"), 0600))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(decryptSrc, "marked.csv.enc.ok"), nil, 0600))
+	// Only the configured suffix counts
+	require.NoError(t, os.WriteFile(filepath.Join(decryptSrc, "unmarked.csv.enc.ready"), nil, 0600))
+
+	require.NoError(t, watcher.scanDirectory(context.Background(), decryptSrc, model.OperationDecrypt))
+	settle(t, watcher)
+	require.Equal(t, 1, q.Size())
+
+	item := q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, filepath.Join(decryptSrc, "marked.csv.enc"), item.SourcePath)
+	assert.Equal(t, filepath.Join(decryptSrc, "marked.csv.key"), item.KeyPath)
+	assert.Equal(t, "sftp", item.Rule)
+	assert.NoFileExists(t, filepath.Join(decryptSrc, "marked.csv.enc.ok"))
+}
+
+func TestWatcher_MarkerTrigger_KeyFileLate(t *testing.T) {
+	tmpDir := t.TempDir()
+	decryptSrc := filepath.Join(tmpDir, "incoming")
+	require.NoError(t, os.MkdirAll(decryptSrc, 0750))
+
+	watcher, q, _ := setupTestWatcher(t, &Config{
+		Rules: []RuleConfig{{
+			Name:           "sftp",
+			Operation:      model.OperationDecrypt,
+			SourceDir:      decryptSrc,
+			DestDir:        filepath.Join(tmpDir, "out"),
+			Trigger:        config.TriggerMarker,
+			MarkerSuffixes: []string{".ok"},
+		}},
+	})
+
+	encFile := filepath.Join(decryptSrc, "data.csv.enc")
+	keyFile := filepath.Join(decryptSrc, "data.csv.key")
+	marker := encFile + ".ok"
+	require.NoError(t, os.WriteFile(encFile, []byte("encrypted"), 0600))
+	require.NoError(t, os.WriteFile(marker, nil, 0600))
+
+	// The marker handler does not wait for the key file under the lock
+	start := time.Now()
+	watcher.handleFileCreated(context.Background(), marker)
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	assert.Equal(t, 0, q.Size())
+	assert.FileExists(t, marker)
+
+	// The tracker queues the file once its key file arrives
+	require.NoError(t, os.WriteFile(keyFile, []byte("key"), 0600))
+	settle(t, watcher)
+
+	item := q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, encFile, item.SourcePath)
+	assert.Equal(t, keyFile, item.KeyPath)
+	assert.NoFileExists(t, marker, "marker is consumed")
+}
+
+func TestWatcher_CheckMarkers(t *testing.T) {
+	tmpDir := t.TempDir()
+	rule := markerRule(tmpDir)
+	require.NoError(t, os.MkdirAll(rule.SourceDir, 0750))
+
+	watcher, _, _ := setupTestWatcher(t, &Config{Rules: []RuleConfig{rule}})
+
+	stale := filepath.Join(rule.SourceDir, "stalled.csv")
+	orphan := filepath.Join(rule.SourceDir, "gone.csv.ready")
+	fresh := filepath.Join(rule.SourceDir, "uploading.csv")
+	for _, path := range []string{stale, orphan, fresh} {
+		require.NoError(t, os.WriteFile(path, []byte("x"), 0600))
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(stale, old, old))
+	require.NoError(t, os.Chtimes(orphan, old, old))
+
+	watcher.checkMarkers()
+
+	assert.Equal(t, map[string]bool{stale: true, orphan: true}, watcher.reportedMarkers)
+	assert.Equal(t, float64(1), metrics.MarkerWaiting.WithLabelValues("encrypt", "markers", waitingFile).Value())
+	assert.Equal(t, float64(1), metrics.MarkerWaiting.WithLabelValues("encrypt", "markers", waitingMarker).Value())
+
+	// Once the file is marked and queued it is no longer reported
+	require.NoError(t, os.Remove(orphan))
+	require.NoError(t, os.WriteFile(stale+".ready", nil, 0600))
+	watcher.handleFileCreated(context.Background(), stale+".ready")
+
+	watcher.checkMarkers()
+	assert.Empty(t, watcher.reportedMarkers)
+	assert.Equal(t, float64(0), metrics.MarkerWaiting.WithLabelValues("encrypt", "markers", waitingFile).Value())
+}
+
+func TestWatcher_Reconcile(t *testing.T) {
+	watcher, q, tmpDir := setupTestWatcher(t, &Config{StabilityDuration: 10 * time.Millisecond})
+	encryptSrc := filepath.Join(tmpDir, "encrypt-src")
+
+	// Written while events were lost
+	missed := filepath.Join(encryptSrc, "missed.csv")
+	require.NoError(t, os.WriteFile(missed, []byte("data"), 0600))
+
+	watcher.reconcile(context.Background(), false)
+	settle(t, watcher)
+	require.Equal(t, 1, q.Size())
+
+	// Files already queued are not queued again
+	watcher.reconcile(context.Background(), false)
+	settle(t, watcher)
+	assert.Equal(t, 1, q.Size())
+
+	item := q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, missed, item.SourcePath)
+}
+
+// lockProbeQueue records whether the watcher lock was held while the queue
+// was asked about a file
+type lockProbeQueue struct {
+	*queue.Queue
+	w    *Watcher
+	held atomic.Bool
+}
+
+func (q *lockProbeQueue) Queued(sourcePath string) bool {
+	locked := make(chan struct{})
+	go func() {
+		q.w.mu.Lock()
+		q.w.mu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		q.held.Store(true)
+	}
+	return q.Queue.Queued(sourcePath)
+}
+
+func TestWatcher_Reconcile_DoesNotHoldLock(t *testing.T) {
+	watcher, q, tmpDir := setupTestWatcher(t, &Config{StabilityDuration: 10 * time.Millisecond})
+	probe := &lockProbeQueue{Queue: q, w: watcher}
+	watcher.queue = probe
+
+	missed := filepath.Join(tmpDir, "encrypt-src", "missed.csv")
+	require.NoError(t, os.WriteFile(missed, []byte("data"), 0600))
+
+	watcher.reconcile(context.Background(), false)
+	settle(t, watcher)
+
+	assert.False(t, probe.held.Load(), "watcher lock held while walking the source tree")
+	assert.Equal(t, 1, q.Size())
+}
+
+func TestWatcher_Start_ReconcilesPeriodically(t *testing.T) {
+	watcher, q, tmpDir := setupTestWatcher(t, &Config{ReconcileInterval: 100 * time.Millisecond})
+	encryptSrc := filepath.Join(tmpDir, "encrypt-src")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		_ = watcher.Start(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		return slices.Contains(watcher.fsWatcher.WatchList(), encryptSrc)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Events of the source directory are lost
+	watcher.mu.Lock()
+	watcher.unwatchTree(encryptSrc)
+	watcher.mu.Unlock()
+
+	missed := filepath.Join(encryptSrc, "missed.csv")
+	require.NoError(t, os.WriteFile(missed, []byte("data"), 0600))
+
+	require.Eventually(t, func() bool { return q.Size() == 1 }, 5*time.Second, 20*time.Millisecond)
+	item := q.Dequeue()
+	require.NotNil(t, item)
+	assert.Equal(t, missed, item.SourcePath)
+}
+
+func TestWatcher_ReportStuck(t *testing.T) {
+	watcher, q, tmpDir := setupTestWatcher(t, &Config{StuckAfter: time.Hour})
+	encryptSrc := filepath.Join(tmpDir, "encrypt-src")
+
+	stale := filepath.Join(encryptSrc, "stalled.csv")
+	fresh := filepath.Join(encryptSrc, "uploading.csv")
+	failed := filepath.Join(encryptSrc, "failed", "broken.csv")
+	dead := filepath.Join(encryptSrc, "dlq", "2025", "dead.csv")
+	for _, path := range []string{stale, fresh, failed, dead} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0750))
+		require.NoError(t, os.WriteFile(path, []byte("x"), 0600))
+	}
+
+	// Moved files keep their old modification time
+	old := time.Now().Add(-2 * time.Hour)
+	for _, path := range []string{stale, failed, dead} {
+		require.NoError(t, os.Chtimes(path, old, old))
+	}
+
+	// Queued files are reported too: they may be failing over and over
+	require.NoError(t, q.Enqueue(model.NewItem(model.OperationEncrypt, stale, stale+".enc")))
+
+	watcher.reportStuck(context.Background())
+
+	assert.Equal(t, map[string]bool{stale: true}, watcher.reportedStuck)
+	assert.Equal(t, float64(1), metrics.StuckFiles.WithLabelValues("encrypt", config.DefaultRuleName, stuckSource).Value())
+	assert.Equal(t, float64(0), metrics.StuckFiles.WithLabelValues("encrypt", config.DefaultRuleName, stuckFailed).Value())
+	assert.Contains(t, watcher.stuckSince, failed)
+	assert.Contains(t, watcher.stuckSince, dead)
+
+	// Failed files are stuck once they have been there for stuck_after
+	for path := range watcher.stuckSince {
+		watcher.stuckSince[path] = old
+	}
+	require.NoError(t, os.Remove(stale))
+
+	watcher.reportStuck(context.Background())
+
+	assert.Equal(t, map[string]bool{failed: true, dead: true}, watcher.reportedStuck)
+	assert.Equal(t, float64(0), metrics.StuckFiles.WithLabelValues("encrypt", config.DefaultRuleName, stuckSource).Value())
+	assert.Equal(t, float64(1), metrics.StuckFiles.WithLabelValues("encrypt", config.DefaultRuleName, stuckFailed).Value())
+	assert.Equal(t, float64(1), metrics.StuckFiles.WithLabelValues("encrypt", config.DefaultRuleName, stuckDLQ).Value())
+}